@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyMarker starts every API key, which tells them apart from JWTs in an
+// Authorization header
+const apiKeyMarker = "rk_"
+
+const (
+	// apiKeyPrefixBytes is the size of the random public part of a key
+	apiKeyPrefixBytes = 8
+	// apiKeySecretBytes is the size of the random secret part of a key
+	apiKeySecretBytes = 32
+)
+
+// GeneratedAPIKey is the key material of a new API key
+type GeneratedAPIKey struct {
+	// Key is handed to the client once and never stored
+	Key string
+	// Prefix identifies the key; it is stored in clear and safe to display
+	Prefix string
+	// Hash is the hash of the secret part of Key, stored to verify it
+	Hash string
+}
+
+// GenerateAPIKey generates the material of a new API key. Keys have the form
+// "rk_<prefix>_<secret>".
+func GenerateAPIKey() (GeneratedAPIKey, error) {
+	prefix := make([]byte, apiKeyPrefixBytes)
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(prefix); err != nil {
+		return GeneratedAPIKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return GeneratedAPIKey{}, err
+	}
+
+	encodedPrefix := hex.EncodeToString(prefix)
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	return GeneratedAPIKey{
+		Key:    apiKeyMarker + encodedPrefix + "_" + encodedSecret,
+		Prefix: encodedPrefix,
+		Hash:   HashAPIKeySecret(encodedSecret),
+	}, nil
+}
+
+// IsAPIKey reports whether token has the form of an API key rather than of a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyMarker)
+}
+
+// ParseAPIKey splits a key into its prefix and secret
+func ParseAPIKey(key string) (prefix, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyMarker)
+	if !ok {
+		return "", "", false
+	}
+	prefix, secret, ok = strings.Cut(rest, "_")
+	if !ok || len(prefix) != hex.EncodedLen(apiKeyPrefixBytes) || secret == "" {
+		return "", "", false
+	}
+	return prefix, secret, true
+}
+
+// HashAPIKeySecret hashes the secret part of a key for storage. The secret is random, so
+// a fast hash is enough: there is nothing to guess from.
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAPIKeySecret reports whether secret matches hash, in constant time
+func VerifyAPIKeySecret(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKeySecret(secret)), []byte(hash)) == 1
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	generated, err := GenerateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, IsAPIKey(generated.Key))
+	prefix, secret, ok := ParseAPIKey(generated.Key)
+	require.True(t, ok)
+	assert.Equal(t, generated.Prefix, prefix)
+	assert.True(t, VerifyAPIKeySecret(secret, generated.Hash))
+	// ハッシュから秘密は分からない
+	assert.NotContains(t, generated.Hash, secret)
+
+	// 毎回異なる鍵を生成する
+	other, err := GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, generated.Prefix, other.Prefix)
+	assert.False(t, VerifyAPIKeySecret(secret, other.Hash))
+}
+
+func TestParseAPIKey_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"空", ""},
+		{"JWT", "eyJhbGciOiJIUzI1NiJ9.e30.sig"},
+		{"区切りなし", "rk_0123456789abcdef"},
+		{"秘密が空", "rk_0123456789abcdef_"},
+		{"短いプレフィックス", "rk_0123_secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, ok := ParseAPIKey(tt.key)
+			assert.False(t, ok)
+		})
+	}
+
+	// 秘密には _ が含まれうる
+	prefix, secret, ok := ParseAPIKey("rk_0123456789abcdef_a_b-c")
+	require.True(t, ok)
+	assert.Equal(t, "0123456789abcdef", prefix)
+	assert.Equal(t, "a_b-c", secret)
+}
+
+func TestVerifyAPIKeySecret(t *testing.T) {
+	hash := HashAPIKeySecret("secret")
+	assert.True(t, VerifyAPIKeySecret("secret", hash))
+	assert.False(t, VerifyAPIKeySecret("Secret", hash))
+	assert.False(t, VerifyAPIKeySecret("secret", strings.ToUpper(hash)))
+	assert.False(t, VerifyAPIKeySecret("secret", ""))
+}
@@ -0,0 +1,133 @@
+// Package auth authenticates API callers and describes what they may do. Callers are
+// identified by a Principal: users carry roles and API keys carry scopes, and the HTTP
+// and gRPC layers check them against the Permission of the operation.
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// Role is a level of access. Roles are ordered: an editor can do everything a reader
+// can, and an admin everything an editor can.
+type Role string
+
+const (
+	// RoleReader may read books, rate them and ask for recommendations
+	RoleReader Role = "reader"
+	// RoleEditor may also create, change and delete books
+	RoleEditor Role = "editor"
+	// RoleAdmin may also use the administration endpoints
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders the roles; unknown roles rank below reader and grant nothing
+var roleRanks = map[Role]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Includes reports whether r grants everything required grants
+func (r Role) Includes(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
+
+// Scope is a right granted to an API key. Unlike roles, scopes are not ordered.
+type Scope string
+
+const (
+	// ScopeBooksRead allows reading and exporting books
+	ScopeBooksRead Scope = "books:read"
+	// ScopeBooksWrite allows creating, changing, deleting and importing books
+	ScopeBooksWrite Scope = "books:write"
+	// ScopeRecommend allows asking for recommendations
+	ScopeRecommend Scope = "recommend"
+)
+
+// Scopes lists every scope an API key can be granted
+var Scopes = []Scope{ScopeBooksRead, ScopeBooksWrite, ScopeRecommend}
+
+// Permission is what an operation requires: users need Role and API keys need Scope.
+// Operations without a scope are closed to API keys.
+type Permission struct {
+	Role  Role
+	Scope Scope
+}
+
+var (
+	// ReadBooks is required to read, search and export books
+	ReadBooks = Permission{Role: RoleReader, Scope: ScopeBooksRead}
+	// WriteBooks is required to create, change, delete and import books
+	WriteBooks = Permission{Role: RoleEditor, Scope: ScopeBooksWrite}
+	// Recommend is required to ask for recommendations
+	Recommend = Permission{Role: RoleReader, Scope: ScopeRecommend}
+	// RateBooks is required to rate books. Ratings are personal, so API keys cannot rate.
+	RateBooks = Permission{Role: RoleReader}
+	// Administer is required by the administration endpoints
+	Administer = Permission{Role: RoleAdmin}
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	// Subject identifies the caller, such as the sub claim of a token
+	Subject string
+	// Roles are the roles granted to the caller
+	Roles []Role
+	// APIKeyID is the ID of the API key the caller authenticated with, or zero for users
+	APIKeyID uint
+	// Scopes are the scopes granted to the API key
+	Scopes []Scope
+}
+
+// IsAPIKey reports whether the principal authenticated with an API key
+func (p *Principal) IsAPIKey() bool {
+	return p.APIKeyID != 0
+}
+
+// Has reports whether any of the principal's roles includes role
+func (p *Principal) Has(role Role) bool {
+	for _, r := range p.Roles {
+		if r.Includes(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the principal may perform an operation requiring perm: by role
+// for users and by scope for API keys
+func (p *Principal) Allows(perm Permission) bool {
+	if p.IsAPIKey() {
+		return perm.Scope != "" && p.HasScope(perm.Scope)
+	}
+	return p.Has(perm.Role)
+}
+
+// ErrInvalidToken is returned for credentials that are malformed, expired, not signed
+// by a trusted key or not meant for this API
+var ErrInvalidToken = errors.New("invalid token")
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of ctx, if the request was authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
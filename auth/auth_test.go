@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRole_Includes(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleEditor, false},
+		{RoleEditor, RoleReader, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleAdmin, RoleEditor, true},
+		{RoleAdmin, RoleAdmin, true},
+		{Role("superuser"), RoleReader, false},
+		{Role(""), RoleReader, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+"/"+string(tt.required), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.role.Includes(tt.required))
+		})
+	}
+}
+
+func TestPrincipal_Has(t *testing.T) {
+	// いずれかのロールが要求を満たせばよい
+	p := &Principal{Subject: "alice", Roles: []Role{"unknown", RoleEditor}}
+	assert.True(t, p.Has(RoleReader))
+	assert.True(t, p.Has(RoleEditor))
+	assert.False(t, p.Has(RoleAdmin))
+	assert.False(t, (&Principal{}).Has(RoleReader))
+}
+
+func TestPrincipal_Allows(t *testing.T) {
+	editor := &Principal{Subject: "alice", Roles: []Role{RoleEditor}}
+	key := &Principal{Subject: "api-key:1", APIKeyID: 1, Scopes: []Scope{ScopeBooksRead, ScopeRecommend}}
+	// ロールを持っていても API キーはスコープで判定する
+	keyWithRoles := &Principal{Subject: "api-key:2", APIKeyID: 2, Roles: []Role{RoleAdmin}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		perm      Permission
+		want      bool
+	}{
+		{"ユーザー: 読み取り", editor, ReadBooks, true},
+		{"ユーザー: 書き込み", editor, WriteBooks, true},
+		{"ユーザー: 推薦", editor, Recommend, true},
+		{"ユーザー: 管理", editor, Administer, false},
+		{"ユーザー: 評価", editor, RateBooks, true},
+		{"APIキー: 読み取り", key, ReadBooks, true},
+		{"APIキー: 推薦", key, Recommend, true},
+		{"APIキー: 書き込み", key, WriteBooks, false},
+		{"APIキー: 管理は不可", key, Administer, false},
+		{"APIキー: 評価は不可", key, RateBooks, false},
+		{"APIキー: ロールは無視", keyWithRoles, ReadBooks, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.principal.Allows(tt.perm))
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	p := &Principal{Subject: "alice"}
+	got, ok := FromContext(NewContext(context.Background(), p))
+	assert.True(t, ok)
+	assert.Same(t, p, got)
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// jsonWebKey is a key of a JSON Web Key Set (RFC 7517). Only the members needed for
+// RSA public keys and symmetric keys are decoded.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n"`
+	E string `json:"e"`
+	// Symmetric key
+	K string `json:"k"`
+}
+
+// keySet holds the verification keys of a JWKS, by key ID
+type keySet struct {
+	rsa  map[string]*rsa.PublicKey
+	hmac map[string][]byte
+}
+
+// loadJWKS reads a JWKS file. RSA keys verify RS256 tokens and "oct" keys HS256
+// tokens; keys meant for encryption or other algorithms are skipped. Keys are held to
+// the same minimum lengths as configured ones.
+func loadJWKS(path string) (*keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(data)
+}
+
+func parseJWKS(data []byte) (*keySet, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := &keySet{rsa: map[string]*rsa.PublicKey{}, hmac: map[string][]byte{}}
+	for i, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch {
+		case jwk.Kty == "RSA" && (jwk.Alg == "" || jwk.Alg == "RS256"):
+			key, err := jwk.rsaPublicKey()
+			if err != nil {
+				return nil, fmt.Errorf("invalid JWKS key %d: %w", i, err)
+			}
+			keys.rsa[jwk.Kid] = key
+		case jwk.Kty == "oct" && (jwk.Alg == "" || jwk.Alg == "HS256"):
+			secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("invalid JWKS key %d: bad k", i)
+			}
+			if len(secret) < minHMACSecretLength {
+				return nil, fmt.Errorf("invalid JWKS key %d: HS256 key of %d bytes is shorter than %d", i, len(secret), minHMACSecretLength)
+			}
+			keys.hmac[jwk.Kid] = secret
+		}
+	}
+	if len(keys.rsa) == 0 && len(keys.hmac) == 0 {
+		return nil, errors.New("JWKS has no RS256 or HS256 signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("bad modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("bad exponent")
+	}
+
+	key := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+	if key.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA key of %d bits is too short", key.N.BitLen())
+	}
+	return key, nil
+}
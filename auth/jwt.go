@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minHMACSecretLength is the shortest HS256 secret accepted, the size of the hash output
+const minHMACSecretLength = 32
+
+// JWTConfig configures the verification of bearer tokens
+type JWTConfig struct {
+	// HMACSecret verifies HS256 tokens
+	HMACSecret string
+	// JWKSFile is a local JSON Web Key Set; its RSA keys verify RS256 tokens and its
+	// symmetric keys HS256 tokens, selected by the kid header
+	JWKSFile string
+	// Issuer, when set, must match the iss claim
+	Issuer string
+	// Audience, when set, must be one of the aud claim
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf
+	Leeway time.Duration
+}
+
+// JWTVerifier verifies HS256 and RS256 JSON Web Tokens. Tokens must carry an exp claim;
+// their roles are read from the roles claim.
+type JWTVerifier struct {
+	hmacSecret []byte
+	keys       *keySet
+	parser     *jwt.Parser
+}
+
+// roleClaims are the claims read from a token
+type roleClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+// NewJWTVerifier creates a verifier from cfg, which must provide a secret or a JWKS file
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{keys: &keySet{}}
+	if cfg.HMACSecret != "" {
+		if len(cfg.HMACSecret) < minHMACSecretLength {
+			return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minHMACSecretLength)
+		}
+		v.hmacSecret = []byte(cfg.HMACSecret)
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", cfg.JWKSFile, err)
+		}
+		v.keys = keys
+	}
+	if v.hmacSecret == nil && cfg.JWKSFile == "" {
+		return nil, errors.New("no JWT verification key configured")
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(options...)
+	return v, nil
+}
+
+// Verify checks the signature and claims of token and returns its principal. Every
+// failure wraps ErrInvalidToken.
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	var claims roleClaims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	principal := &Principal{Subject: claims.Subject}
+	for _, role := range claims.Roles {
+		principal.Roles = append(principal.Roles, Role(role))
+	}
+	return principal, nil
+}
+
+// key selects the verification key of a token from its alg and kid headers
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method {
+	case jwt.SigningMethodHS256:
+		if secret, ok := v.keys.hmac[kid]; ok {
+			return secret, nil
+		}
+		if kid == "" && v.hmacSecret != nil {
+			return v.hmacSecret, nil
+		}
+	case jwt.SigningMethodRS256:
+		if key, ok := v.keys.rsa[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(v.keys.rsa) == 1 {
+			for _, key := range v.keys.rsa {
+				return key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no %s key with kid %q", token.Method.Alg(), kid)
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testRSAKey はテスト全体で使い回すRSA鍵（生成が遅いため）
+var testRSAKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func signHS256(t *testing.T, secret string, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signed
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+// writeJWKS は鍵をJWKSファイルに書き出す
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "alice",
+		"roles": []string{"editor"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTVerifier_HS256(t *testing.T) {
+	v, err := NewJWTVerifier(JWTConfig{HMACSecret: testSecret})
+	require.NoError(t, err)
+
+	principal, err := v.Verify(signHS256(t, testSecret, "", validClaims()))
+
+	require.NoError(t, err)
+	assert.Equal(t, "alice", principal.Subject)
+	assert.Equal(t, []Role{RoleEditor}, principal.Roles)
+}
+
+func TestJWTVerifier_RS256FromJWKS(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	path := writeJWKS(t,
+		rsaJWK("key-1", &testRSAKey.PublicKey),
+		rsaJWK("key-2", &other.PublicKey),
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	)
+	v, err := NewJWTVerifier(JWTConfig{JWKSFile: path})
+	require.NoError(t, err)
+
+	// kid で鍵を選ぶ
+	principal, err := v.Verify(signRS256(t, other, "key-2", validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", principal.Subject)
+
+	// 別の鍵の kid では検証できない
+	_, err = v.Verify(signRS256(t, other, "key-1", validClaims()))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// 鍵が複数ある場合 kid は必須
+	_, err = v.Verify(signRS256(t, testRSAKey, "", validClaims()))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWTVerifier_HS256FromJWKS(t *testing.T) {
+	path := writeJWKS(t, map[string]string{
+		"kty": "oct",
+		"kid": "shared",
+		"k":   base64.RawURLEncoding.EncodeToString([]byte(testSecret)),
+	})
+	v, err := NewJWTVerifier(JWTConfig{JWKSFile: path})
+	require.NoError(t, err)
+
+	_, err = v.Verify(signHS256(t, testSecret, "shared", validClaims()))
+	assert.NoError(t, err)
+	_, err = v.Verify(signHS256(t, testSecret, "", validClaims()))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWTVerifier_Rejects(t *testing.T) {
+	v, err := NewJWTVerifier(JWTConfig{
+		HMACSecret: testSecret,
+		Issuer:     "https://auth.example.com",
+		Audience:   "recomemento",
+	})
+	require.NoError(t, err)
+
+	claims := func(modify func(jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		c["iss"] = "https://auth.example.com"
+		c["aud"] = "recomemento"
+		modify(c)
+		return c
+	}
+
+	valid := signHS256(t, testSecret, "", claims(func(jwt.MapClaims) {}))
+	_, err = v.Verify(valid)
+	require.NoError(t, err)
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims(func(jwt.MapClaims) {})).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"期限切れ", signHS256(t, testSecret, "", claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }))},
+		{"expなし", signHS256(t, testSecret, "", claims(func(c jwt.MapClaims) { delete(c, "exp") }))},
+		{"発行者が異なる", signHS256(t, testSecret, "", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }))},
+		{"対象が異なる", signHS256(t, testSecret, "", claims(func(c jwt.MapClaims) { c["aud"] = "other-api" }))},
+		{"秘密鍵が異なる", signHS256(t, "fedcba9876543210fedcba9876543210", "", claims(func(jwt.MapClaims) {}))},
+		{"署名なし（alg=none）", unsigned},
+		{"鍵の設定がないRS256", signRS256(t, testRSAKey, "", claims(func(jwt.MapClaims) {}))},
+		{"改ざん", valid[:len(valid)-2] + "xx"},
+		{"JWTではない", "not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(tt.token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestNewJWTVerifier_InvalidConfig(t *testing.T) {
+	shortKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		cfg  JWTConfig
+	}{
+		{"鍵なし", JWTConfig{}},
+		{"短い秘密鍵", JWTConfig{HMACSecret: "short"}},
+		{"存在しないJWKS", JWTConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}},
+		{"署名用の鍵がないJWKS", JWTConfig{JWKSFile: writeJWKS(t, map[string]string{"kty": "EC", "kid": "ec"})}},
+		{"短いRSA鍵", JWTConfig{JWKSFile: writeJWKS(t, rsaJWK("short", &shortKey.PublicKey))}},
+		{"短いHS256鍵のJWKS", JWTConfig{JWKSFile: writeJWKS(t, map[string]string{
+			"kty": "oct",
+			"kid": "short",
+			"k":   base64.RawURLEncoding.EncodeToString([]byte("short")),
+		})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWTVerifier(tt.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"recomemento-api-go/dto"
+)
+
+// Book is a book together with its entity tag, which IfMatch takes to make a later
+// update or deletion conditional
+type Book struct {
+	dto.BookResponse
+	// ETag is the entity tag of this version of the book
+	ETag string `json:"-"`
+}
+
+// ListBooks returns the books matching query, ordered by ID
+func (c *Client) ListBooks(ctx context.Context, query dto.ListBooksQuery) ([]dto.BookResponse, error) {
+	values := url.Values{}
+	for name, value := range map[string]string{"genre": query.Genre, "purpose": query.Purpose, "author": query.Author} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+
+	var books []dto.BookResponse
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/books", query: values}, &books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// GetBook returns a book by ID
+func (c *Client) GetBook(ctx context.Context, id uint) (*Book, error) {
+	return c.book(ctx, request{method: http.MethodGet, path: bookPath(id)})
+}
+
+// CreateBook creates a book
+func (c *Client) CreateBook(ctx context.Context, req dto.CreateBookRequest) (*Book, error) {
+	return c.book(ctx, request{method: http.MethodPost, path: "/books", body: req})
+}
+
+// UpdateBook changes the fields of req that are set and leaves the others untouched.
+// Pass IfMatch to only apply the change to the version of the book that was read.
+func (c *Client) UpdateBook(ctx context.Context, id uint, req dto.UpdateBookRequest, opts ...CallOption) (*Book, error) {
+	return c.book(ctx, request{method: http.MethodPatch, path: bookPath(id), body: req, opts: opts})
+}
+
+// DeleteBook deletes a book and returns it as it was. Pass IfMatch to only delete the
+// version of the book that was read.
+func (c *Client) DeleteBook(ctx context.Context, id uint, opts ...CallOption) (*Book, error) {
+	return c.book(ctx, request{method: http.MethodDelete, path: bookPath(id), opts: opts})
+}
+
+// Recommend returns a book of the requested genre with the requested purpose. It fails
+// with ErrRecommendationNotFound when there is none.
+func (c *Client) Recommend(ctx context.Context, req dto.RecommendBookRequest) (*dto.BookResponse, error) {
+	var book dto.BookResponse
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/books/recommend", body: req}, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// book sends a request answered with a single book
+func (c *Client) book(ctx context.Context, r request) (*Book, error) {
+	var book Book
+	header, err := c.do(ctx, r, &book.BookResponse)
+	if err != nil {
+		return nil, err
+	}
+	book.ETag = header.Get("ETag")
+	return &book, nil
+}
+
+func bookPath(id uint) string {
+	return fmt.Sprintf("/books/%d", id)
+}
@@ -0,0 +1,288 @@
+// Package client is a Go client for the Recomemento REST API. It speaks /v1 with the
+// request and response types of the dto package, retries idempotent requests with
+// exponential backoff and reports problem details responses as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPrefix is the path of the API version the client speaks
+const apiPrefix = "/v1"
+
+// RetryPolicy controls how failed requests are retried. Only requests that are safe to
+// repeat are retried: reads, PUT and DELETE. A request is retried when it could not be
+// sent or when the server answers 429, 502, 503 or 504.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first; 1 disables retries
+	MaxAttempts int
+	// InitialBackoff is the upper bound of the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts, including one requested by Retry-After
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of a client created without WithRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// Client calls the Recomemento API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	retry      RetryPolicy
+	language   string
+	userAgent  string
+	token      string
+	apiKey     string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to send requests; http.DefaultClient by default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetryPolicy sets the retry policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithLanguage sets the Accept-Language of every request, which selects the language of
+// error messages
+func WithLanguage(language string) Option {
+	return func(c *Client) {
+		c.language = language
+	}
+}
+
+// WithUserAgent sets the User-Agent of every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithBearerToken authenticates every request with token, a JWT granting the role the
+// calls require: reader for reads, editor for changes
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithAPIKey authenticates every request with an API key granting the scopes the calls
+// require: books:read for reads, books:write for changes and recommend for Recommend
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// New creates a client for the API served at baseURL, such as "http://localhost:3001"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy,
+		userAgent:  "recomemento-go-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+// CallOption configures a single call
+type CallOption func(*http.Request)
+
+// IfMatch makes an update or deletion conditional on the book still having etag, as
+// returned in Book.ETag. The call fails with ErrPreconditionFailed otherwise.
+func IfMatch(etag string) CallOption {
+	return func(req *http.Request) {
+		req.Header.Set("If-Match", etag)
+	}
+}
+
+// request describes a call to the API
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	opts   []CallOption
+}
+
+// do sends req, retrying it according to the retry policy, and decodes a successful
+// response into out unless out is nil. It returns the response headers.
+func (c *Client) do(ctx context.Context, r request, out interface{}) (http.Header, error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return nil, fmt.Errorf("encoding request: %w", err)
+		}
+	}
+
+	attempts := 1
+	if retryable(r.method, r.path) {
+		attempts = c.retry.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, r, body)
+		if err == nil && (attempt == attempts || !retryableStatus(resp.StatusCode)) {
+			defer resp.Body.Close()
+			return resp.Header, decodeResponse(resp, out)
+		}
+		if err != nil && (attempt == attempts || ctx.Err() != nil) {
+			return nil, err
+		}
+
+		wait := c.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = min(retryAfter, c.retry.MaxBackoff)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends one attempt of r
+func (c *Client) send(ctx context.Context, r request, body []byte) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += apiPrefix + r.path
+	u.RawQuery = r.query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.language != "" {
+		req.Header.Set("Accept-Language", c.language)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	for _, opt := range r.opts {
+		opt(req)
+	}
+	return c.httpClient.Do(req)
+}
+
+// backoff returns the wait before retry number attempt: a random duration up to an
+// exponentially growing bound ("full jitter"), so that clients failing together do not
+// retry together
+func (c *Client) backoff(attempt int) time.Duration {
+	bound := c.retry.InitialBackoff << (attempt - 1)
+	if bound <= 0 || bound > c.retry.MaxBackoff {
+		bound = c.retry.MaxBackoff
+	}
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// retryable reports whether a request may be sent again without changing its effect.
+// Recommendations are read-only even though they are POSTed.
+func retryable(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return method == http.MethodPost && path == "/books/recommend"
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP-date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// decodeResponse decodes a successful response into out, or an error response into *Error
+func decodeResponse(resp *http.Response, out interface{}) error {
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"recomemento-api-go/dto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetry はテストを待たせないリトライ設定
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := New(server.URL, append([]Option{WithRetryPolicy(fastRetry)}, opts...)...)
+	require.NoError(t, err)
+	return c
+}
+
+func writeProblem(w http.ResponseWriter, problem dto.ErrorResponse) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func TestNew_InvalidBaseURL(t *testing.T) {
+	for _, baseURL := range []string{"localhost:3001", "ftp://example.com", "://"} {
+		_, err := New(baseURL)
+		assert.Error(t, err, baseURL)
+	}
+}
+
+func TestListBooks(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/api/v1/books", r.URL.Path)
+		assert.Equal(t, "genre=Fiction", r.URL.RawQuery)
+		assert.Equal(t, "ja", r.Header.Get("Accept-Language"))
+		assert.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+		w.Write([]byte(`[{"id":1,"title":"A"},{"id":2,"title":"B"}]`))
+	}, WithLanguage("ja"), WithBearerToken("secret-token"))
+	// ベースURLのパスは保持される
+	c.baseURL.Path = "/api"
+
+	books, err := c.ListBooks(context.Background(), dto.ListBooksQuery{Genre: "Fiction"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []dto.BookResponse{{ID: 1, Title: "A"}, {ID: 2, Title: "B"}}, books)
+}
+
+func TestGetBook_ETag(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/books/7", r.URL.Path)
+		assert.Equal(t, "rk_0123456789abcdef_secret", r.Header.Get("X-API-Key"))
+		w.Header().Set("ETag", `"7-3"`)
+		w.Write([]byte(`{"id":7,"title":"Go"}`))
+	}, WithAPIKey("rk_0123456789abcdef_secret"))
+
+	book, err := c.GetBook(context.Background(), 7)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), book.ID)
+	assert.Equal(t, "Go", book.Title)
+	assert.Equal(t, `"7-3"`, book.ETag)
+}
+
+func TestUpdateBook_IfMatch(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		assert.Equal(t, `"7-3"`, r.Header.Get("If-Match"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"title": "New"}, body)
+		w.Header().Set("ETag", `"7-4"`)
+		w.Write([]byte(`{"id":7,"title":"New"}`))
+	})
+
+	title := "New"
+	book, err := c.UpdateBook(context.Background(), 7, dto.UpdateBookRequest{Title: &title}, IfMatch(`"7-3"`))
+
+	require.NoError(t, err)
+	assert.Equal(t, "New", book.Title)
+	assert.Equal(t, `"7-4"`, book.ETag)
+}
+
+func TestErrors_DecodedFromProblem(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, dto.ErrorResponse{
+			Type:   "urn:recomemento:problem:VALIDATION_FAILED",
+			Title:  "Validation failed",
+			Status: http.StatusBadRequest,
+			Detail: "The request has invalid fields",
+			Code:   dto.CodeValidationFailed,
+			Errors: []dto.FieldError{{Field: "title", Rule: "required", Message: "title is required"}},
+		})
+	})
+
+	_, err := c.CreateBook(context.Background(), dto.CreateBookRequest{})
+
+	assert.ErrorIs(t, err, ErrValidationFailed)
+	assert.NotErrorIs(t, err, ErrBookNotFound)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.Len(t, apiErr.Errors, 1)
+	assert.Equal(t, "title", apiErr.Errors[0].Field)
+	assert.Equal(t, "recomemento: VALIDATION_FAILED: The request has invalid fields", err.Error())
+}
+
+func TestErrors_NotAProblem(t *testing.T) {
+	// プロキシなどが返すproblem形式でないエラーはステータスのみ
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<html>Forbidden</html>"))
+	})
+
+	_, err := c.GetBook(context.Background(), 1)
+
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Empty(t, apiErr.Code)
+	assert.Equal(t, "recomemento: 403 Forbidden", err.Error())
+}
+
+func TestRetry_IdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	book, err := c.GetBook(context.Background(), 1)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), book.ID)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	_, err := c.DeleteBook(context.Background(), 1)
+
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetry_NotForNonIdempotentRequests(t *testing.T) {
+	// 作成と部分更新は重複して適用される恐れがあるため再送しない
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := c.CreateBook(context.Background(), dto.CreateBookRequest{Title: "A"})
+	assert.Error(t, err)
+	_, err = c.UpdateBook(context.Background(), 1, dto.UpdateBookRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRetry_Recommend(t *testing.T) {
+	// 推薦はPOSTだが読み取りのみのため再送する
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"id":3,"title":"Recommended"}`))
+	})
+
+	book, err := c.Recommend(context.Background(), dto.RecommendBookRequest{Genre: "Fiction", Purpose: "Learning"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Recommended", book.Title)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRetry_NotForClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeProblem(w, dto.ErrorResponse{Status: http.StatusNotFound, Code: dto.CodeBookNotFound})
+	})
+
+	_, err := c.GetBook(context.Background(), 1)
+
+	assert.ErrorIs(t, err, ErrBookNotFound)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetry_ContextCanceledDuringBackoff(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Minute}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetBook(ctx, 1)
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"秒数", "3", 3 * time.Second, true},
+		{"過去の日時", "Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+		{"空", "", 0, false},
+		{"不正な値", "soon", 0, false},
+		{"負の秒数", "-1", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBackoff_Bounded(t *testing.T) {
+	c, err := New("http://localhost", WithRetryPolicy(RetryPolicy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}))
+	require.NoError(t, err)
+
+	for attempt := 1; attempt <= 70; attempt++ {
+		wait := c.backoff(attempt)
+		assert.GreaterOrEqual(t, wait, time.Duration(0))
+		assert.LessOrEqual(t, wait, time.Second)
+	}
+}
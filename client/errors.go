@@ -0,0 +1,67 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"recomemento-api-go/dto"
+)
+
+// maxErrorBody limits how much of an error response is read
+const maxErrorBody = 64 * 1024
+
+// Error is an error response of the API. ErrorResponse holds the problem details
+// document; responses that are not problem details, such as those of a proxy, only
+// carry the status. Use errors.Is with the Err* values to test for an error code.
+type Error struct {
+	dto.ErrorResponse
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("recomemento: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Detail == "" {
+		return fmt.Sprintf("recomemento: %s", e.Code)
+	}
+	return fmt.Sprintf("recomemento: %s: %s", e.Code, e.Detail)
+}
+
+// Is reports whether target is an *Error with the same code, so that
+// errors.Is(err, client.ErrBookNotFound) matches any BOOK_NOT_FOUND response
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// Errors for the error codes callers typically handle, for use with errors.Is
+var (
+	ErrValidationFailed       = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeValidationFailed}}
+	ErrInvalidRequest         = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeInvalidRequest}}
+	ErrBookNotFound           = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeBookNotFound}}
+	ErrRecommendationNotFound = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeRecommendationNotFound}}
+	ErrPreconditionFailed     = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodePreconditionFailed}}
+	ErrConflict               = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeConflict}}
+	ErrConstraintViolation    = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeConstraintViolation}}
+	ErrUnauthorized           = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeUnauthorized}}
+	ErrForbidden              = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeForbidden}}
+	ErrInsufficientScope      = &Error{ErrorResponse: dto.ErrorResponse{Code: dto.CodeInsufficientScope}}
+)
+
+// decodeError reads an error response
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" || mediaType == "application/json" {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		if err := json.Unmarshal(body, &apiErr.ErrorResponse); err != nil {
+			apiErr.ErrorResponse = dto.ErrorResponse{}
+		}
+	}
+	return apiErr
+}
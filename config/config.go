@@ -0,0 +1,243 @@
+// Package config loads the configuration of the server and its commands. Every setting
+// has a default, and may be set in a YAML or TOML file, by an environment variable and
+// by a command line flag, each overriding the previous ones.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"recomemento-api-go/ratelimit"
+)
+
+// Config is the effective configuration. The struct tags describe each setting: key is
+// its name in files, env its environment variable and flag its command line flag.
+// Settings tagged secret are redacted by Print.
+type Config struct {
+	Server    Server    `key:"server"`
+	Database  Database  `key:"database"`
+	Auth      Auth      `key:"auth"`
+	CORS      CORS      `key:"cors"`
+	RateLimit RateLimit `key:"rate_limit"`
+	Books     Books     `key:"books"`
+
+	// sources records where each setting was last set, by path
+	sources map[string]string
+}
+
+// Server configures the HTTP and gRPC listeners
+type Server struct {
+	Port               int       `key:"port" env:"PORT" flag:"port" usage:"HTTP port"`
+	GRPCPort           int       `key:"grpc_port" env:"GRPC_PORT" flag:"grpc-port" usage:"gRPC port"`
+	LegacyRoutesSunset time.Time `key:"legacy_routes_sunset" env:"LEGACY_ROUTES_SUNSET" flag:"legacy-routes-sunset" usage:"sunset date (YYYY-MM-DD) announced for the unversioned routes"`
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For and X-Real-IP
+	// headers give the IP address of the client. The headers of any other peer are
+	// ignored, so that clients cannot pick the address they are rate limited by.
+	TrustedProxies []string `key:"trusted_proxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma-separated IP addresses or CIDRs of the reverse proxies trusted for X-Forwarded-For"`
+}
+
+// Database configures the connection to the database
+type Database struct {
+	URL      string `key:"url" env:"DATABASE_URL" flag:"database-url" secret:"password" usage:"database URL (sqlite:, postgres:// or mysql://) or SQLite file path"`
+	LogLevel string `key:"log_level" env:"DATABASE_LOG_LEVEL" flag:"database-log-level" usage:"SQL log level: silent, error, warn or info"`
+	// AutoMigrate applies the pending migrations at startup. Deployments that migrate
+	// as a separate step disable it, and the server then refuses to start on a schema
+	// that is out of date.
+	AutoMigrate bool   `key:"auto_migrate" env:"DATABASE_AUTO_MIGRATE" flag:"database-auto-migrate" usage:"apply pending migrations at startup"`
+	Pool        Pool   `key:"pool"`
+	SQLite      SQLite `key:"sqlite"`
+}
+
+// Pool limits the connections to the database
+type Pool struct {
+	MaxOpenConns    int           `key:"max_open_conns" env:"DATABASE_MAX_OPEN_CONNS" flag:"database-max-open-conns" usage:"maximum open connections; with SQLite in WAL mode, of the read pool beside the single writer"`
+	MaxIdleConns    int           `key:"max_idle_conns" env:"DATABASE_MAX_IDLE_CONNS" flag:"database-max-idle-conns" usage:"maximum idle connections kept open"`
+	ConnMaxLifetime time.Duration `key:"conn_max_lifetime" env:"DATABASE_CONN_MAX_LIFETIME" flag:"database-conn-max-lifetime" usage:"time after which a connection is closed, 0 for never"`
+}
+
+// SQLite sets the pragmas of SQLite connections. Parameters in the database URL, such as
+// _journal_mode, take precedence.
+type SQLite struct {
+	JournalMode string        `key:"journal_mode" env:"SQLITE_JOURNAL_MODE" flag:"sqlite-journal-mode" usage:"journal mode: wal, delete, truncate, persist, memory or off"`
+	Synchronous string        `key:"synchronous" env:"SQLITE_SYNCHRONOUS" flag:"sqlite-synchronous" usage:"synchronous level: off, normal, full or extra"`
+	BusyTimeout time.Duration `key:"busy_timeout" env:"SQLITE_BUSY_TIMEOUT" flag:"sqlite-busy-timeout" usage:"time to wait for a lock before failing with database is locked"`
+	ForeignKeys bool          `key:"foreign_keys" env:"SQLITE_FOREIGN_KEYS" flag:"sqlite-foreign-keys" usage:"enforce foreign key constraints"`
+}
+
+// LogLevels are the valid values of Database.LogLevel, from the quietest
+var LogLevels = []string{"silent", "error", "warn", "info"}
+
+// SQLiteJournalModes are the valid values of SQLite.JournalMode
+var SQLiteJournalModes = []string{"wal", "delete", "truncate", "persist", "memory", "off"}
+
+// SQLiteSynchronousLevels are the valid values of SQLite.Synchronous, from the fastest
+var SQLiteSynchronousLevels = []string{"off", "normal", "full", "extra"}
+
+// Auth configures authentication. Secrets have no flag, since command lines are
+// visible to every user of the machine.
+type Auth struct {
+	Disabled       bool   `key:"disabled" env:"AUTH_DISABLED" flag:"auth-disabled" usage:"disable authentication (local development only)"`
+	JWTHS256Secret string `key:"jwt_hs256_secret" env:"JWT_HS256_SECRET" secret:"true" usage:"HS256 signing key of the JWTs"`
+	JWKSFile       string `key:"jwks_file" env:"JWT_JWKS_FILE" flag:"jwks-file" usage:"JWKS file with the keys verifying the JWTs"`
+	Issuer         string `key:"issuer" env:"JWT_ISSUER" flag:"jwt-issuer" usage:"required iss of the JWTs"`
+	Audience       string `key:"audience" env:"JWT_AUDIENCE" flag:"jwt-audience" usage:"required aud of the JWTs"`
+}
+
+// CORS configures the CORS policy
+type CORS struct {
+	AllowedOrigins   []string      `key:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" flag:"cors-allowed-origins" usage:"comma-separated origins allowed to call the API, or * for every origin (default: none)"`
+	AllowCredentials bool          `key:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" flag:"cors-allow-credentials" usage:"allow cookies and Authorization headers from the allowed origins"`
+	ExposedHeaders   []string      `key:"exposed_headers" env:"CORS_EXPOSED_HEADERS" flag:"cors-exposed-headers" usage:"comma-separated response headers readable by scripts (default: the API's headers)"`
+	MaxAge           time.Duration `key:"max_age" env:"CORS_MAX_AGE" flag:"cors-max-age" usage:"how long browsers may cache preflights"`
+}
+
+// RateLimit configures the rate limits per client
+type RateLimit struct {
+	Default   ratelimit.Limit `key:"default" env:"RATE_LIMIT" flag:"rate-limit" usage:"requests per client, such as 600/1m, or off"`
+	Recommend ratelimit.Limit `key:"recommend" env:"RATE_LIMIT_RECOMMEND" flag:"rate-limit-recommend" usage:"recommendations per client, such as 30/1m, or off"`
+	IP        ratelimit.Limit `key:"ip" env:"RATE_LIMIT_IP" flag:"rate-limit-ip" usage:"requests per IP address before authentication, such as 1200/1m, or off"`
+}
+
+// Books configures the maximum length of each book field, in characters
+type Books struct {
+	MaxTitleLength       int `key:"max_title_length" env:"MAX_TITLE_LENGTH" flag:"max-title-length" usage:"maximum length of titles"`
+	MaxAuthorLength      int `key:"max_author_length" env:"MAX_AUTHOR_LENGTH" flag:"max-author-length" usage:"maximum length of authors"`
+	MaxGenreLength       int `key:"max_genre_length" env:"MAX_GENRE_LENGTH" flag:"max-genre-length" usage:"maximum length of genres"`
+	MaxPurposeLength     int `key:"max_purpose_length" env:"MAX_PURPOSE_LENGTH" flag:"max-purpose-length" usage:"maximum length of purposes"`
+	MaxDescriptionLength int `key:"max_description_length" env:"MAX_DESCRIPTION_LENGTH" flag:"max-description-length" usage:"maximum length of descriptions"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:     3001,
+			GRPCPort: 50051,
+		},
+		Database: Database{
+			URL:         "./data/books.db",
+			LogLevel:    "info",
+			AutoMigrate: true,
+			Pool: Pool{
+				MaxOpenConns:    10,
+				MaxIdleConns:    10,
+				ConnMaxLifetime: time.Hour,
+			},
+			SQLite: SQLite{
+				JournalMode: "wal",
+				Synchronous: "normal",
+				BusyTimeout: 5 * time.Second,
+				ForeignKeys: true,
+			},
+		},
+		CORS: CORS{
+			MaxAge: 10 * time.Minute,
+		},
+		RateLimit: RateLimit{
+			Default:   ratelimit.Limit{Requests: 600, Period: time.Minute},
+			Recommend: ratelimit.Limit{Requests: 30, Period: time.Minute},
+			IP:        ratelimit.Limit{Requests: 1200, Period: time.Minute},
+		},
+		Books: Books{
+			MaxTitleLength:       200,
+			MaxAuthorLength:      100,
+			MaxGenreLength:       50,
+			MaxPurposeLength:     50,
+			MaxDescriptionLength: 2000,
+		},
+	}
+}
+
+// Validate reports every invalid setting. Settings depending on each other, such as
+// CORS credentials with a wildcard origin, are checked by the code applying them.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(path, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", c.describe(path), fmt.Sprintf(format, args...)))
+	}
+
+	for _, port := range []struct {
+		path  string
+		value int
+	}{
+		{"server.port", c.Server.Port},
+		{"server.grpc_port", c.Server.GRPCPort},
+	} {
+		if port.value < 1 || port.value > 65535 {
+			invalid(port.path, "port %d is out of range 1-65535", port.value)
+		}
+	}
+	if c.Server.Port == c.Server.GRPCPort {
+		invalid("server.grpc_port", "must differ from server.port")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			invalid("server.trusted_proxies", "%q is neither an IP address nor a CIDR", proxy)
+		}
+	}
+	if c.Database.URL == "" {
+		invalid("database.url", "must not be empty")
+	}
+	if !slices.Contains(LogLevels, c.Database.LogLevel) {
+		invalid("database.log_level", "%q is not one of %v", c.Database.LogLevel, LogLevels)
+	}
+	if c.Database.Pool.MaxOpenConns < 1 {
+		invalid("database.pool.max_open_conns", "must be positive")
+	}
+	if c.Database.Pool.MaxIdleConns < 0 {
+		invalid("database.pool.max_idle_conns", "must not be negative")
+	}
+	for _, duration := range []struct {
+		path  string
+		value time.Duration
+	}{
+		{"database.pool.conn_max_lifetime", c.Database.Pool.ConnMaxLifetime},
+		{"database.sqlite.busy_timeout", c.Database.SQLite.BusyTimeout},
+		{"cors.max_age", c.CORS.MaxAge},
+	} {
+		if duration.value < 0 {
+			invalid(duration.path, "must not be negative")
+		}
+	}
+	if !slices.Contains(SQLiteJournalModes, c.Database.SQLite.JournalMode) {
+		invalid("database.sqlite.journal_mode", "%q is not one of %v", c.Database.SQLite.JournalMode, SQLiteJournalModes)
+	}
+	if !slices.Contains(SQLiteSynchronousLevels, c.Database.SQLite.Synchronous) {
+		invalid("database.sqlite.synchronous", "%q is not one of %v", c.Database.SQLite.Synchronous, SQLiteSynchronousLevels)
+	}
+	for _, length := range []struct {
+		path  string
+		value int
+	}{
+		{"books.max_title_length", c.Books.MaxTitleLength},
+		{"books.max_author_length", c.Books.MaxAuthorLength},
+		{"books.max_genre_length", c.Books.MaxGenreLength},
+		{"books.max_purpose_length", c.Books.MaxPurposeLength},
+		{"books.max_description_length", c.Books.MaxDescriptionLength},
+	} {
+		if length.value <= 0 {
+			invalid(length.path, "must be positive")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Source returns where the setting at path, such as "server.port", was set: "default",
+// "file <path>", "env <VARIABLE>" or "flag -<name>"
+func (c *Config) Source(path string) string {
+	if source, ok := c.sources[path]; ok {
+		return source
+	}
+	return "default"
+}
+
+// describe names the setting at path with its source, for error messages
+func (c *Config) describe(path string) string {
+	if source := c.Source(path); source != "default" {
+		return path + " (" + source + ")"
+	}
+	return path
+}
@@ -0,0 +1,303 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a leaf of Config, described by its struct tags
+type setting struct {
+	path   string // dotted keys from the root, such as "server.port"
+	index  []int  // field index from the root, for reflect.Value.FieldByIndex
+	env    string
+	flag   string
+	usage  string
+	secret string // "true" to redact the value, "password" to redact the password of a URL
+}
+
+// settings lists the leaves of Config in declaration order
+var settings = collectSettings(reflect.TypeOf(Config{}), "", nil)
+
+func collectSettings(t reflect.Type, prefix string, index []int) []setting {
+	var leaves []setting
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("key")
+		if key == "" {
+			continue
+		}
+		fieldIndex := append(cloneIndex(index), i)
+		if field.Type.Kind() == reflect.Struct && !isValue(field.Type) {
+			leaves = append(leaves, collectSettings(field.Type, prefix+key+".", fieldIndex)...)
+			continue
+		}
+		leaves = append(leaves, setting{
+			path:   prefix + key,
+			index:  fieldIndex,
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret"),
+		})
+	}
+	return leaves
+}
+
+// cloneIndex copies index, so that sibling fields do not share its backing array
+func cloneIndex(index []int) []int {
+	return append([]int(nil), index...)
+}
+
+// isValue reports whether a struct type is a single value rather than a group of
+// settings
+func isValue(t reflect.Type) bool {
+	return t == reflect.TypeOf(time.Time{}) || reflect.PointerTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+// Loader loads the configuration from a file, the environment and the flags of a
+// command
+type Loader struct {
+	// LookupEnv reads the environment; os.LookupEnv unless replaced, as tests do
+	LookupEnv func(key string) (string, bool)
+
+	file  string
+	flags map[string]string
+}
+
+// NewLoader creates a loader reading the flags of fs: -config, naming the configuration
+// file, and one flag per setting. Load must be called after fs is parsed.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{LookupEnv: os.LookupEnv, flags: make(map[string]string)}
+	fs.StringVar(&l.file, "config", "", "configuration file, .yaml, .yml or .toml (env CONFIG_FILE)")
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		usage := s.usage
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		if kind := reflect.TypeOf(Config{}).FieldByIndex(s.index).Type.Kind(); kind == reflect.Bool {
+			fs.Var(boolFlag{l, s.path}, s.flag, usage)
+		} else {
+			fs.Func(s.flag, usage, func(value string) error {
+				l.flags[s.path] = value
+				return nil
+			})
+		}
+	}
+	return l
+}
+
+// boolFlag records a boolean flag, which may be given without a value
+type boolFlag struct {
+	l    *Loader
+	path string
+}
+
+func (f boolFlag) String() string   { return "" }
+func (f boolFlag) IsBoolFlag() bool { return true }
+
+func (f boolFlag) Set(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return err
+	}
+	f.l.flags[f.path] = value
+	return nil
+}
+
+// Load returns the configuration: the defaults, overridden by the configuration file
+// named by -config or CONFIG_FILE, then by the environment, then by the flags. The
+// configuration is validated; every invalid setting is reported.
+func (l *Loader) Load() (*Config, error) {
+	c := Default()
+	c.sources = make(map[string]string)
+	root := reflect.ValueOf(c).Elem()
+
+	file := l.file
+	if file == "" {
+		file, _ = l.LookupEnv("CONFIG_FILE")
+	}
+	if file != "" {
+		if err := c.loadFile(root, file); err != nil {
+			return nil, err
+		}
+	}
+
+	// Empty variables count as unset, as they always have for this server
+	var errs []error
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		if value, ok := l.LookupEnv(s.env); ok && value != "" {
+			errs = append(errs, c.set(root, s, value, "env "+s.env))
+		}
+	}
+	for _, s := range settings {
+		if value, ok := l.flags[s.path]; ok {
+			errs = append(errs, c.set(root, s, value, "flag -"+s.flag))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// set parses value into the setting s, recording source
+func (c *Config) set(root reflect.Value, s setting, value, source string) error {
+	if err := parseInto(root.FieldByIndex(s.index), value); err != nil {
+		return fmt.Errorf("%s (%s): %w", s.path, source, err)
+	}
+	c.sources[s.path] = source
+	return nil
+}
+
+// parseInto parses value into field. Lists are comma-separated.
+func parseInto(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, such as 10m", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	case time.Time:
+		var date time.Time
+		if value = strings.TrimSpace(value); value != "" {
+			var err error
+			if date, err = time.Parse(time.DateOnly, value); err != nil {
+				return fmt.Errorf("invalid date %q, want YYYY-MM-DD", value)
+			}
+		}
+		field.Set(reflect.ValueOf(date))
+		return nil
+	}
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(strings.TrimSpace(value)))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, want true or false", value)
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// loadFile applies the configuration file at path, in YAML or TOML by its extension
+func (c *Config) loadFile(root reflect.Value, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	byPath := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byPath[s.path] = s
+	}
+	var errs []error
+	c.applyFile(root, byPath, values, "", "file "+path, &errs)
+	return errors.Join(errs...)
+}
+
+// applyFile applies the values of a table of the configuration file, whose keys are
+// under prefix. Unknown keys are errors, so that typos do not go unnoticed.
+func (c *Config) applyFile(root reflect.Value, byPath map[string]setting, values map[string]interface{}, prefix, source string, errs *[]error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := prefix + key
+		value := values[key]
+		if table, ok := value.(map[string]interface{}); ok {
+			c.applyFile(root, byPath, table, path+".", source, errs)
+			continue
+		}
+		s, ok := byPath[path]
+		if !ok {
+			*errs = append(*errs, fmt.Errorf("%s (%s): unknown setting", path, source))
+			continue
+		}
+		if err := c.set(root, s, fileValue(value), source); err != nil {
+			*errs = append(*errs, err)
+		}
+	}
+}
+
+// fileValue formats a value decoded from a file like it would be written in the
+// environment
+func fileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fileValue(item)
+		}
+		return strings.Join(items, ",")
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"encoding"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in Print
+const redacted = "REDACTED"
+
+// Print writes the configuration to w as YAML, which Load accepts as a configuration
+// file. Every setting not left at its default is commented with its source, and secrets
+// are redacted.
+func (c *Config) Print(w io.Writer) error {
+	root := reflect.ValueOf(c).Elem()
+	document := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range settings {
+		value := valueNode(root.FieldByIndex(s.index), s.secret)
+		if source := c.Source(s.path); source != "default" {
+			value.LineComment = source
+		}
+
+		// Descend to the mapping of the setting, creating it on first use
+		mapping := document
+		keys := strings.Split(s.path, ".")
+		for _, key := range keys[:len(keys)-1] {
+			mapping = child(mapping, key)
+		}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: keys[len(keys)-1]}, value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// child returns the mapping under key in mapping, adding it if missing
+func child(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, node)
+	return node
+}
+
+// valueNode formats field as YAML, redacting it as secret requires
+func valueNode(field reflect.Value, secret string) *yaml.Node {
+	scalar := func(tag, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	}
+
+	switch v := field.Interface().(type) {
+	case time.Duration:
+		return scalar("!!str", v.String())
+	case time.Time:
+		if v.IsZero() {
+			return scalar("!!str", "")
+		}
+		return scalar("!!str", v.Format(time.DateOnly))
+	}
+	if marshaler, ok := field.Interface().(encoding.TextMarshaler); ok {
+		text, _ := marshaler.MarshalText()
+		return scalar("!!str", string(text))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return scalar("!!str", redact(field.String(), secret))
+	case reflect.Int:
+		return scalar("!!int", strconv.FormatInt(field.Int(), 10))
+	case reflect.Bool:
+		return scalar("!!bool", strconv.FormatBool(field.Bool()))
+	case reflect.Slice:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < field.Len(); i++ {
+			list.Content = append(list.Content, scalar("!!str", field.Index(i).String()))
+		}
+		return list
+	}
+	return scalar("!!str", field.String())
+}
+
+// redact hides value if it is a secret. URLs only have their password hidden, so that
+// the host and database remain visible; SQLite paths are left as they are.
+func redact(value, secret string) string {
+	switch {
+	case value == "":
+		return value
+	case secret == "true":
+		return redacted
+	case secret == "password":
+		u, err := url.Parse(value)
+		if err != nil {
+			return value
+		}
+		hidden := false
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+				hidden = true
+			}
+		}
+		// PostgreSQL also takes the password as a connection option
+		if query := u.Query(); query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+			hidden = true
+		}
+		if hidden {
+			return u.String()
+		}
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"recomemento-api-go/config"
+)
+
+// runConfig implements `config print [flags]`, which writes the effective configuration
+// as YAML to stdout, with the source of every setting and secrets redacted. It takes the
+// flags of the server, so that a command line can be checked before it is deployed. It
+// returns the process exit code.
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "Usage: recomemento-api config print [flags]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	loader := config.NewLoader(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: recomemento-api config print [flags]\n\nPrints the effective configuration, from the defaults, the configuration file, the\nenvironment and the flags, with secrets redacted.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Printf("config: invalid configuration:\n%v", err)
+		return 1
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		log.Printf("config: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -1,34 +1,103 @@
 package database
 
 import (
+	"io"
 	"log"
+	"time"
 
+	"recomemento-api-go/migrations"
 	"recomemento-api-go/models"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-// InitDatabase initializes the database connection and runs migrations
-func InitDatabase(dbPath string) (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+// LogLevel is the level of the SQL logger used by Open. The logger writes to
+// stdout, so commands whose output is meant to be piped lower it.
+var LogLevel = logger.Info
+
+// Options tunes the connections opened by Open. Zero values keep the defaults of the
+// drivers and of database/sql.
+type Options struct {
+	// JournalMode, Synchronous, BusyTimeout and ForeignKeys set the pragmas of the same
+	// names on every SQLite connection, unless the database URL sets them. In WAL mode,
+	// reads use a pool of connections and writes a single connection, so that writers
+	// never wait on each other's locks.
+	JournalMode string
+	Synchronous string
+	BusyTimeout time.Duration
+	ForeignKeys bool
+
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime limit the connection pool; with
+	// SQLite in WAL mode, the pool of readers
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// InitDatabase connects to the database at databaseURL, which ParseURL reads, and
+// applies the pending migrations. It fails with migrations.ErrNewerSchema when a newer
+// build has migrated the database.
+func InitDatabase(databaseURL string, options Options) (*gorm.DB, error) {
+	db, err := Open(databaseURL, options)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := migrations.Up(db)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Database migrated to version %d (%d migrations applied)", migrations.Latest(), len(applied))
+	return db, nil
+}
+
+// Open connects to the database at databaseURL, which ParseURL reads, without
+// migrating it
+func Open(databaseURL string, options Options) (*gorm.DB, error) {
+	connection, err := ParseURL(databaseURL)
 	if err != nil {
 		return nil, err
 	}
 
-	// Auto migrate the schema
-	err = db.AutoMigrate(&models.Book{})
+	dialector, split := connection.Dialector(), false
+	if connection.Driver == DriverSQLite {
+		dialector, split, err = sqliteDialector(connection.DSN, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(LogLevel),
+	})
 	if err != nil {
 		return nil, err
 	}
+	if !split {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		setPoolLimits(sqlDB, options)
+	}
 
-	log.Println("Database connected and migrated successfully")
+	log.Printf("Database (%s) connected successfully", connection.Driver)
 	return db, nil
 }
 
+// Close closes the connections of db, with SQLite in WAL mode those of both pools
+func Close(db *gorm.DB) error {
+	if closer, ok := db.ConnPool.(io.Closer); ok {
+		return closer.Close()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // SeedDatabase seeds the database with initial data
 func SeedDatabase(db *gorm.DB) error {
 	// Check if we already have data
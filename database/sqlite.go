@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// sqliteParams are the connection parameters of go-sqlite3 set from Options, with the
+// aliases that the driver accepts for them
+var sqliteParams = map[string][]string{
+	"_journal_mode": {"_journal_mode", "_journal"},
+	"_synchronous":  {"_synchronous", "_sync"},
+	"_busy_timeout": {"_busy_timeout", "_timeout"},
+	"_foreign_keys": {"_foreign_keys", "_fk"},
+}
+
+// sqliteDialector opens the SQLite database of dsn tuned by options. In WAL mode, reads
+// go to a pool of connections and writes to a single one, and split is true; otherwise,
+// and for in-memory databases, whose every connection is a separate database, a single
+// pool serves both.
+func sqliteDialector(dsn string, options Options) (dialector gorm.Dialector, split bool, err error) {
+	base, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, false, err
+	}
+
+	add := url.Values{}
+	set := func(param, value string) {
+		for _, alias := range sqliteParams[param] {
+			if params.Has(alias) {
+				return
+			}
+		}
+		add.Set(param, value)
+	}
+	if options.JournalMode != "" {
+		set("_journal_mode", strings.ToUpper(options.JournalMode))
+	}
+	if options.Synchronous != "" {
+		set("_synchronous", strings.ToUpper(options.Synchronous))
+	}
+	if options.BusyTimeout > 0 {
+		set("_busy_timeout", strconv.FormatInt(options.BusyTimeout.Milliseconds(), 10))
+	}
+	if options.ForeignKeys {
+		set("_foreign_keys", "1")
+	}
+	dsn = withParams(dsn, add)
+
+	memory := strings.Contains(base, ":memory:") || params.Get("mode") == "memory"
+	journal := params.Get("_journal_mode") + params.Get("_journal") + add.Get("_journal_mode")
+	if memory || !strings.EqualFold(journal, "WAL") {
+		return sqlite.Open(dsn), false, nil
+	}
+
+	// BEGIN IMMEDIATE takes the write lock at once, rather than failing to upgrade a
+	// read lock when another connection writes, which busy_timeout cannot wait out
+	writer, err := sql.Open(sqlite.DriverName, withParams(dsn, url.Values{"_txlock": {"immediate"}}))
+	if err != nil {
+		return nil, false, err
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(options.ConnMaxLifetime)
+	// The first connection switches the file to WAL mode, before any reader opens it
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return nil, false, err
+	}
+
+	reader, err := sql.Open(sqlite.DriverName, withParams(dsn, url.Values{"_query_only": {"1"}}))
+	if err != nil {
+		writer.Close()
+		return nil, false, err
+	}
+	setPoolLimits(reader, options)
+
+	return &sqlite.Dialector{DSN: dsn, Conn: &splitPool{reader: reader, writer: writer}}, true, nil
+}
+
+// withParams appends params to the query of dsn, leaving the parameters already in dsn
+// as they were written
+func withParams(dsn string, params url.Values) string {
+	if len(params) == 0 {
+		return dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + params.Encode()
+}
+
+// splitPool sends the statements that only read to a pool of reader connections and
+// every other one, transactions included, to a single writer connection. SQLite in WAL
+// mode lets readers run beside a writer, but writers wait on each other's locks and
+// fail with "database is locked" once busy_timeout runs out.
+type splitPool struct {
+	reader *sql.DB
+	writer *sql.DB
+}
+
+func (p *splitPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.pool(query).PrepareContext(ctx, query)
+}
+
+func (p *splitPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.writer.ExecContext(ctx, query, args...)
+}
+
+// QueryContext also runs writes, such as INSERT ... RETURNING, which go to the writer
+func (p *splitPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.pool(query).QueryContext(ctx, query, args...)
+}
+
+func (p *splitPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.pool(query).QueryRowContext(ctx, query, args...)
+}
+
+func (p *splitPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.writer.BeginTx(ctx, opts)
+}
+
+// GetDBConn returns the writer as the sql.DB of the connection, for gorm.DB.DB
+func (p *splitPool) GetDBConn() (*sql.DB, error) {
+	return p.writer, nil
+}
+
+// Close closes both pools; closing the sql.DB of GetDBConn would leave the readers open
+func (p *splitPool) Close() error {
+	return errors.Join(p.reader.Close(), p.writer.Close())
+}
+
+// pool returns the connections running query
+func (p *splitPool) pool(query string) *sql.DB {
+	if isRead(query) {
+		return p.reader
+	}
+	return p.writer
+}
+
+// isRead reports whether query only reads: a SELECT, a WITH whose main statement is a
+// SELECT, or an EXPLAIN, which never runs the statement it explains. Anything else,
+// statements starting with a comment included, goes to the writer, which runs them all.
+func isRead(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	switch {
+	case hasKeyword(query, "SELECT"), hasKeyword(query, "EXPLAIN"):
+		return true
+	case hasKeyword(query, "WITH"):
+		return hasKeyword(withStatement(query[len("WITH"):]), "SELECT")
+	}
+	return false
+}
+
+// withStatement returns the main statement of a WITH clause, the first statement keyword
+// that follows its common table expressions, outside their parentheses and quotes
+func withStatement(query string) string {
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '\'', '"', '`':
+			if end := strings.IndexByte(query[i+1:], c); end >= 0 {
+				i += end + 1
+			}
+		case '[':
+			if end := strings.IndexByte(query[i+1:], ']'); end >= 0 {
+				i += end + 1
+			}
+		default:
+			if depth > 0 || (i > 0 && isWordChar(query[i-1])) {
+				continue
+			}
+			for _, keyword := range []string{"SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "VALUES"} {
+				if hasKeyword(query[i:], keyword) {
+					return query[i:]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// hasKeyword reports whether query starts with keyword, ignoring case
+func hasKeyword(query, keyword string) bool {
+	return len(query) >= len(keyword) && strings.EqualFold(query[:len(keyword)], keyword) &&
+		(len(query) == len(keyword) || !isWordChar(query[len(keyword)]))
+}
+
+// isWordChar reports whether c can be part of an SQL keyword or identifier
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// setPoolLimits applies the pool limits of options to db
+func setPoolLimits(db *sql.DB, options Options) {
+	if options.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(options.MaxOpenConns)
+	}
+	if options.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(options.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(options.ConnMaxLifetime)
+}
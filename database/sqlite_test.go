@@ -0,0 +1,180 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"recomemento-api-go/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// walOptions are the options of the default configuration
+var walOptions = Options{
+	JournalMode:  "wal",
+	Synchronous:  "normal",
+	BusyTimeout:  5 * time.Second,
+	ForeignKeys:  true,
+	MaxOpenConns: 4,
+}
+
+// openTemp opens a migrated SQLite database in a temporary file, with query parameters
+func openTemp(t *testing.T, params string, options Options) *gorm.DB {
+	t.Helper()
+	LogLevel = logger.Silent
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "books.db")+params, options)
+	require.NoError(t, err)
+	t.Cleanup(func() { Close(db) })
+	return db
+}
+
+// pragma reads a pragma: the SELECT goes to the readers and the PRAGMA statement to the
+// writer
+func pragma(t *testing.T, db *gorm.DB, name string) (reader, writer string) {
+	t.Helper()
+	require.NoError(t, db.Raw("SELECT * FROM pragma_"+name).Scan(&reader).Error)
+	require.NoError(t, db.Raw("PRAGMA "+name).Scan(&writer).Error)
+	return reader, writer
+}
+
+func TestOpen_SQLitePragmas(t *testing.T) {
+	db := openTemp(t, "", walOptions)
+
+	for _, tt := range []struct {
+		pragma string
+		value  string
+	}{
+		{"journal_mode", "wal"},
+		{"synchronous", "1"},
+		{"busy_timeout", "5000"},
+		{"foreign_keys", "1"},
+	} {
+		reader, writer := pragma(t, db, tt.pragma)
+		assert.Equal(t, tt.value, reader, tt.pragma)
+		assert.Equal(t, tt.value, writer, tt.pragma)
+	}
+
+	// 読み取り用の接続は書き込めない
+	reader, writer := pragma(t, db, "query_only")
+	assert.Equal(t, "1", reader)
+	assert.Equal(t, "0", writer)
+}
+
+func TestOpen_SQLiteURLParametersWin(t *testing.T) {
+	db := openTemp(t, "?_journal=DELETE&_timeout=100", walOptions)
+
+	_, journal := pragma(t, db, "journal_mode")
+	_, timeout := pragma(t, db, "busy_timeout")
+	assert.Equal(t, "delete", journal)
+	assert.Equal(t, "100", timeout)
+}
+
+func TestOpen_SQLiteMemory(t *testing.T) {
+	// インメモリのデータベースは接続ごとに別なので、読み書きを分けない
+	LogLevel = logger.Silent
+	db, err := InitDatabase(":memory:", walOptions)
+	require.NoError(t, err)
+	repo := models.NewBookRepository(db)
+
+	book := &models.Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	require.NoError(t, repo.Create(book))
+	_, err = repo.GetByID(book.ID)
+	assert.NoError(t, err)
+}
+
+func TestOpen_SQLiteConcurrentWrites(t *testing.T) {
+	// 同時に書き込んでも database is locked にならない
+	db := openTemp(t, "", walOptions)
+	repo := models.NewBookRepository(db)
+	seed := &models.Book{Title: "Counter", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "0"}
+	require.NoError(t, repo.Create(seed))
+
+	const writers, writes = 8, 25
+	errs := make(chan error, writers*writes*3)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				book := &models.Book{Title: fmt.Sprintf("Book %d-%d", w, i), Author: "Author", Genre: "Fiction", Purpose: "Learning", Description: "Description"}
+				errs <- repo.Create(book)
+				_, err := repo.Update(seed.ID, map[string]interface{}{"description": book.Title})
+				errs <- err
+				_, err = repo.Search("book")
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	stored, err := repo.GetByID(seed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1+writers*writes), stored.Version)
+	var count int64
+	require.NoError(t, db.Model(&models.Book{}).Count(&count).Error)
+	assert.Equal(t, int64(1+writers*writes), count)
+}
+
+func TestIsRead(t *testing.T) {
+	// 読み取るだけの文が読み取り用の接続で実行される
+	tests := []struct {
+		query  string
+		reader bool
+	}{
+		{"SELECT * FROM books", true},
+		{"\n  select count(*) FROM books", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"INSERT INTO books (title) VALUES (?) RETURNING id", false},
+		{"UPDATE books SET version = version + 1", false},
+		{"PRAGMA journal_mode", false},
+		{"WITH ids AS (SELECT id FROM books) DELETE FROM books WHERE id IN ids", false},
+		{"WITH ids AS (SELECT id FROM books) SELECT * FROM books WHERE id IN ids", true},
+		{"with recursive n(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM n WHERE i < 5) select i from n", true},
+		{"WITH a AS (SELECT ') INSERT' AS s), \"update\" AS (SELECT 1) SELECT * FROM a", true},
+		{"WITH selected AS (SELECT id FROM books) UPDATE books SET version = 1 WHERE id IN selected", false},
+		{"WITH ids AS MATERIALIZED (SELECT id FROM books) INSERT INTO books SELECT * FROM ids", false},
+		{"EXPLAIN QUERY PLAN SELECT * FROM books", true},
+		{"explain DELETE FROM books", true},
+		{"SELECTED_BOOKS", false},
+		{"-- comment\nSELECT 1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.reader, isRead(tt.query))
+		})
+	}
+}
+
+func TestOpen_SQLiteReadsOnReaders(t *testing.T) {
+	// WITH と EXPLAIN は書き込みできない読み取り用の接続でも実行できる
+	db := openTemp(t, "", walOptions)
+
+	var ids []uint
+	require.NoError(t, db.Raw("WITH ids AS (SELECT id FROM books) SELECT id FROM ids").Scan(&ids).Error)
+	var plan []map[string]interface{}
+	require.NoError(t, db.Raw("EXPLAIN QUERY PLAN SELECT * FROM books WHERE isbn = ?", "x").Scan(&plan).Error)
+	assert.NotEmpty(t, plan)
+}
+
+func TestClose_SQLiteClosesBothPools(t *testing.T) {
+	LogLevel = logger.Silent
+	db, err := Open(filepath.Join(t.TempDir(), "books.db"), walOptions)
+	require.NoError(t, err)
+	pool := db.ConnPool.(*splitPool)
+
+	require.NoError(t, Close(db))
+
+	assert.ErrorContains(t, pool.reader.Ping(), "database is closed")
+	assert.ErrorContains(t, pool.writer.Ping(), "database is closed")
+}
@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// CreateAPIKeyRequest represents the request body for issuing an API key
+type CreateAPIKeyRequest struct {
+	// Describes the client the key is issued to
+	Name string `json:"name" xml:"name" binding:"required,notblank,max=100" sanitize:"line" example:"Partner bookstore"`
+	// Scopes granted to the key
+	Scopes []string `json:"scopes" xml:"scopes>scope" binding:"required,min=1,dive,oneof=books:read books:write recommend" example:"books:read,recommend" enums:"books:read,books:write,recommend"`
+	// When the key stops working (optional, must be in the future)
+	ExpiresAt *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty" binding:"omitempty,future" example:"2027-01-01T00:00:00Z"`
+}
+
+// APIKeyResponse represents an API key. The key itself is only returned when the key is
+// issued or rotated.
+type APIKeyResponse struct {
+	XMLName xml.Name `json:"-" xml:"api_key" swaggerignore:"true"`
+	// The ID of the key
+	ID uint `json:"id" xml:"id" example:"1"`
+	// Describes the client the key is issued to
+	Name string `json:"name" xml:"name" example:"Partner bookstore"`
+	// Public part of the key, which identifies it in listings
+	Prefix string `json:"prefix" xml:"prefix" example:"3f9a0c2b7d1e4a56"`
+	// Scopes granted to the key
+	Scopes []string `json:"scopes" xml:"scopes>scope" example:"books:read,recommend"`
+	// When the key was issued
+	CreatedAt time.Time `json:"created_at" xml:"created_at" example:"2026-10-01T09:00:00Z"`
+	// When the key stops working, if it expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty" example:"2027-01-01T00:00:00Z"`
+	// When the key was revoked, if it was
+	RevokedAt *time.Time `json:"revoked_at,omitempty" xml:"revoked_at,omitempty" example:"2026-11-01T09:00:00Z"`
+	// When the key was last used
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" xml:"last_used_at,omitempty" example:"2026-10-18T12:00:00Z"`
+	// Number of requests authenticated with the key
+	UsageCount int64 `json:"usage_count" xml:"usage_count" example:"1342"`
+	// The key to send in X-API-Key or as a bearer token. Store it safely: it cannot be
+	// retrieved again.
+	Key string `json:"key,omitempty" xml:"key,omitempty" example:"rk_3f9a0c2b7d1e4a56_Xq7..."`
+}
@@ -1,64 +1,376 @@
 package dto
 
+import (
+	"encoding/xml"
+)
+
 // CreateBookRequest represents the request body for creating a book
 type CreateBookRequest struct {
 	// The title of the book
-	Title string `json:"title" binding:"required" example:"The Great Gatsby"`
+	Title string `json:"title" xml:"title" binding:"required,notblank,maxlen=title" sanitize:"line" example:"The Great Gatsby"`
 	// The author of the book
-	Author string `json:"author" binding:"required" example:"F. Scott Fitzgerald"`
+	Author string `json:"author" xml:"author" binding:"required,notblank,maxlen=author" sanitize:"line" example:"F. Scott Fitzgerald"`
 	// The genre of the book
-	Genre string `json:"genre" binding:"required" example:"Fiction"`
+	Genre string `json:"genre" xml:"genre" binding:"required,notblank,maxlen=genre" sanitize:"line" example:"Fiction"`
 	// The purpose of the book
-	Purpose string `json:"purpose" binding:"required" example:"Entertainment"`
+	Purpose string `json:"purpose" xml:"purpose" binding:"required,notblank,maxlen=purpose" sanitize:"line" example:"Entertainment"`
 	// The description of the book
-	Description string `json:"description" binding:"required" example:"A story of the fabulously wealthy Jay Gatsby and his love for the beautiful Daisy Buchanan."`
+	Description string `json:"description" xml:"description" binding:"required,notblank,maxlen=description" sanitize:"text" example:"A story of the fabulously wealthy Jay Gatsby and his love for the beautiful Daisy Buchanan."`
+	// ISBN-10 or ISBN-13 of the book; hyphens and spaces are removed (optional)
+	ISBN string `json:"isbn,omitempty" xml:"isbn,omitempty" binding:"omitempty,isbn" sanitize:"isbn" example:"9780743273565"`
 }
 
 // UpdateBookRequest represents the request body for updating a book
 // All fields are optional and will only update the provided fields
 type UpdateBookRequest struct {
 	// The title of the book (optional)
-	Title *string `json:"title,omitempty" example:"The Great Gatsby"`
+	Title *string `json:"title,omitempty" xml:"title,omitempty" example:"The Great Gatsby"`
 	// The author of the book (optional)
-	Author *string `json:"author,omitempty" example:"F. Scott Fitzgerald"`
+	Author *string `json:"author,omitempty" xml:"author,omitempty" example:"F. Scott Fitzgerald"`
 	// The genre of the book (optional)
-	Genre *string `json:"genre,omitempty" example:"Fiction"`
+	Genre *string `json:"genre,omitempty" xml:"genre,omitempty" example:"Fiction"`
 	// The purpose of the book (optional)
-	Purpose *string `json:"purpose,omitempty" example:"Entertainment"`
+	Purpose *string `json:"purpose,omitempty" xml:"purpose,omitempty" example:"Entertainment"`
 	// The description of the book (optional)
-	Description *string `json:"description,omitempty" example:"A story of the fabulously wealthy Jay Gatsby and his love for the beautiful Daisy Buchanan."`
+	Description *string `json:"description,omitempty" xml:"description,omitempty" example:"A story of the fabulously wealthy Jay Gatsby and his love for the beautiful Daisy Buchanan."`
+	// ISBN-10 or ISBN-13 of the book; empty to clear it (optional)
+	ISBN *string `json:"isbn,omitempty" xml:"isbn,omitempty" example:"9780743273565"`
+}
+
+// ReplaceBookRequest represents the full representation of a book used by PUT and as the
+// target document of merge patches and JSON patches
+type ReplaceBookRequest struct {
+	// The title of the book
+	Title string `json:"title" xml:"title" binding:"required,notblank,maxlen=title" sanitize:"line" example:"The Great Gatsby"`
+	// The author of the book
+	Author string `json:"author" xml:"author" binding:"required,notblank,maxlen=author" sanitize:"line" example:"F. Scott Fitzgerald"`
+	// The genre of the book
+	Genre string `json:"genre" xml:"genre" binding:"required,notblank,maxlen=genre" sanitize:"line" example:"Fiction"`
+	// The purpose of the book
+	Purpose string `json:"purpose" xml:"purpose" binding:"required,notblank,maxlen=purpose" sanitize:"line" example:"Entertainment"`
+	// The description of the book
+	Description string `json:"description" xml:"description" binding:"required,notblank,maxlen=description" sanitize:"text" example:"A story of the fabulously wealthy Jay Gatsby and his love for the beautiful Daisy Buchanan."`
+	// ISBN-10 or ISBN-13 of the book; empty to clear it
+	ISBN string `json:"isbn" xml:"isbn" binding:"omitempty,isbn" sanitize:"isbn" example:"9780743273565"`
+}
+
+// JSONPatchOperation represents a single RFC 6902 operation (documentation only)
+type JSONPatchOperation struct {
+	// The operation to perform
+	Op string `json:"op" example:"replace" enums:"add,remove,replace,move,copy,test"`
+	// JSON pointer to the target field
+	Path string `json:"path" example:"/title"`
+	// The value for add, replace and test
+	Value interface{} `json:"value,omitempty" swaggertype:"string" example:"The Great Gatsby"`
+	// JSON pointer to the source field for move and copy
+	From string `json:"from,omitempty" example:"/author"`
 }
 
 // RecommendBookRequest represents the request body for book recommendation
 type RecommendBookRequest struct {
 	// The genre to search for recommendations
-	Genre string `json:"genre" binding:"required" example:"Fiction"`
+	Genre string `json:"genre" xml:"genre" binding:"required,notblank,maxlen=genre" sanitize:"line" example:"Fiction"`
 	// The type of book (optional)
-	Type string `json:"type" example:"Novel"`
+	Type string `json:"type" xml:"type" sanitize:"line" example:"Novel"`
 	// The purpose of the book for recommendation
-	Purpose string `json:"purpose" binding:"required" example:"Entertainment"`
+	Purpose string `json:"purpose" xml:"purpose" binding:"required,notblank,maxlen=purpose" sanitize:"line" example:"Entertainment"`
 }
 
-// BookResponse represents the response body for book operations
+// BookResponse represents the response body for book operations. Fields left out by a
+// fields= query parameter are omitted; every stored book has them set otherwise.
 type BookResponse struct {
+	XMLName xml.Name `json:"-" xml:"book" swaggerignore:"true"`
 	// Unique identifier for the book
-	ID uint `json:"id" example:"1"`
+	ID uint `json:"id,omitempty" xml:"id,omitempty" example:"1"`
 	// The title of the book
-	Title string `json:"title" example:"The Great Gatsby"`
+	Title string `json:"title,omitempty" xml:"title,omitempty" example:"The Great Gatsby"`
 	// The author of the book
-	Author string `json:"author" example:"F. Scott Fitzgerald"`
+	Author string `json:"author,omitempty" xml:"author,omitempty" example:"F. Scott Fitzgerald"`
 	// The genre of the book
-	Genre string `json:"genre" example:"Fiction"`
+	Genre string `json:"genre,omitempty" xml:"genre,omitempty" example:"Fiction"`
 	// The purpose of the book
-	Purpose string `json:"purpose" example:"Entertainment"`
+	Purpose string `json:"purpose,omitempty" xml:"purpose,omitempty" example:"Entertainment"`
 	// The description of the book
-	Description string `json:"description" example:"A story of the fabulously wealthy Jay Gatsby and his love for the beautiful Daisy Buchanan."`
+	Description string `json:"description,omitempty" xml:"description,omitempty" example:"A story of the fabulously wealthy Jay Gatsby and his love for the beautiful Daisy Buchanan."`
+	// ISBN of the book, if known
+	ISBN string `json:"isbn,omitempty" xml:"isbn,omitempty" example:"9780743273565"`
+	// Authors of the book; only present with include=authors
+	Authors AuthorList `json:"authors,omitempty" xml:"authors,omitempty"`
+	// Tags of the book in name order; only present with include=tags, and left out for
+	// books without tags
+	Tags TagList `json:"tags,omitempty" xml:"tags,omitempty" swaggertype:"array,string" example:"american,classic"`
+	// Summary of the ratings of the book; only present with include=ratings
+	Ratings *RatingSummaryResponse `json:"ratings,omitempty" xml:"ratings,omitempty"`
+}
+
+// AuthorList is the authors embedded in a book response, written in XML as
+// <authors><author>...</author></authors>. encoding/xml writes the parent of an
+// "authors>author" path even for an empty list, so the list marshals itself instead.
+type AuthorList []AuthorResponse
+
+func (l AuthorList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalXMLList(e, start, "author", l)
+}
+
+// TagList is the tags embedded in a book response, written in XML as
+// <tags><tag>...</tag></tags> like AuthorList
+type TagList []string
+
+func (l TagList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return marshalXMLList(e, start, "tag", l)
+}
+
+// marshalXMLList writes items as elements named item inside start
+func marshalXMLList[T any](e *xml.Encoder, start xml.StartElement, item string, items []T) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, value := range items {
+		if err := e.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: item}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// AuthorResponse represents an author embedded in a book response
+type AuthorResponse struct {
+	// Name of the author
+	Name string `json:"name" xml:"name" example:"F. Scott Fitzgerald"`
+	// Number of books by the author in the catalog
+	BookCount int64 `json:"book_count" xml:"book_count" example:"3"`
+}
+
+// RatingSummaryResponse summarizes the ratings of a book
+type RatingSummaryResponse struct {
+	XMLName xml.Name `json:"-" xml:"ratings" swaggerignore:"true"`
+	// Number of ratings
+	Count int64 `json:"count" xml:"count" example:"12"`
+	// Mean score from 1 to 5, rounded to two decimals; 0 without ratings
+	Average float64 `json:"average" xml:"average" example:"4.25"`
+}
+
+// Related resources that can be embedded with include=
+const (
+	IncludeAuthors = "authors"
+	IncludeTags    = "tags"
+	IncludeRatings = "ratings"
+)
+
+// BookRepresentationQuery represents the query parameters shaping book responses
+type BookRepresentationQuery struct {
+	// Comma-separated fields to return, e.g. id,title,author; all fields when empty
+	Fields string `form:"fields" json:"fields" binding:"omitempty,listof=id title author genre purpose description isbn"`
+	// Comma-separated related resources to embed: authors, tags, ratings
+	Include string `form:"include" json:"include" binding:"omitempty,listof=authors tags ratings"`
+}
+
+// SetBookTagsRequest represents the request body replacing the tags of a book
+type SetBookTagsRequest struct {
+	// Tags of the book; they are lowercased and duplicates are removed. Empty to remove
+	// every tag.
+	Tags []string `json:"tags" xml:"tags>tag" binding:"max=20,dive,notblank,max=50" sanitize:"line" example:"classic,american"`
 }
 
-// ErrorResponse represents an error response
+// BookTagsResponse represents the tags of a book
+type BookTagsResponse struct {
+	XMLName xml.Name `json:"-" xml:"book_tags" swaggerignore:"true"`
+	// Tags of the book in name order
+	Tags []string `json:"tags" xml:"tags>tag" example:"american,classic"`
+}
+
+// RateBookRequest represents the request body rating a book
+type RateBookRequest struct {
+	// Score from 1 to 5
+	Score int `json:"score" xml:"score" binding:"required,min=1,max=5" example:"4"`
+}
+
+// ListBooksQuery represents the query parameters that filter the book list
+type ListBooksQuery struct {
+	// Only books of this genre
+	Genre string `form:"genre" json:"genre" binding:"omitempty,maxlen=genre"`
+	// Only books with this purpose
+	Purpose string `form:"purpose" json:"purpose" binding:"omitempty,maxlen=purpose"`
+	// Only books whose author contains this text, ignoring case
+	Author string `form:"author" json:"author" binding:"omitempty,maxlen=author"`
+}
+
+// Formats of a book export
+const (
+	ExportFormatCSV        = "csv"
+	ExportFormatNDJSON     = "ndjson"
+	ExportFormatXLSX       = "xlsx"
+	ExportFormatMARC       = "marc"
+	ExportFormatMARCXML    = "marcxml"
+	ExportFormatDublinCore = "dc"
+	ExportFormatONIX       = "onix"
+)
+
+// ExportBooksQuery represents the query parameters of a book export
+type ExportBooksQuery struct {
+	ListBooksQuery
+	// Format of the export file; defaults to csv
+	Format string `form:"format" json:"format" binding:"omitempty,oneof=csv ndjson xlsx marc marcxml dc onix"`
+}
+
+// Modes of a bulk request
+const (
+	// BulkModeAtomic applies all operations in one transaction or none of them
+	BulkModeAtomic = "atomic"
+	// BulkModeBestEffort applies every operation independently
+	BulkModeBestEffort = "best_effort"
+)
+
+// BulkRequest represents the request body for bulk operations
+type BulkRequest struct {
+	// atomic (default) rolls back every operation if one fails; best_effort applies the others
+	Mode string `json:"mode" xml:"mode" binding:"omitempty,oneof=atomic best_effort" example:"atomic" enums:"atomic,best_effort"`
+	// The operations to apply, in order
+	Operations []RawDocument `json:"operations" xml:"operations>operation" binding:"required,min=1,max=1000" swaggertype:"array,object"`
+}
+
+// BulkOperation represents a single operation of a bulk request
+type BulkOperation struct {
+	// The operation to perform
+	Op string `json:"op" xml:"op" binding:"required,oneof=create update delete" example:"update" enums:"create,update,delete"`
+	// The book to update or delete
+	ID uint `json:"id" xml:"id" binding:"required_unless=Op create,excluded_if=Op create" example:"1"`
+	// Version the update or delete is conditional on, like If-Match (optional)
+	Version uint `json:"version,omitempty" xml:"version,omitempty" binding:"excluded_if=Op create" example:"3"`
+	// The book to create (all fields) or the fields to update
+	Book RawDocument `json:"book,omitempty" xml:"book,omitempty" binding:"required_unless=Op delete,excluded_if=Op delete" swaggertype:"object"`
+}
+
+// BulkResponse represents the response body for bulk operations
+type BulkResponse struct {
+	XMLName xml.Name `json:"-" xml:"bulk_response" swaggerignore:"true"`
+	// The mode the operations were applied in
+	Mode string `json:"mode" xml:"mode" example:"atomic"`
+	// Number of operations that were applied
+	Succeeded int `json:"succeeded" xml:"succeeded" example:"2"`
+	// Number of operations that were not applied
+	Failed int `json:"failed" xml:"failed" example:"0"`
+	// Result of every operation, in request order
+	Results []BulkResult `json:"results" xml:"results>result"`
+}
+
+// BulkResult represents the outcome of a single bulk operation
+type BulkResult struct {
+	// Position of the operation in the request
+	Index int `json:"index" xml:"index" example:"0"`
+	// The operation that was requested
+	Op string `json:"op,omitempty" xml:"op,omitempty" example:"update"`
+	// HTTP status the operation would have had as a single request
+	Status int `json:"status" xml:"status" example:"200"`
+	// The created or updated book, or the deleted book as it was before deletion
+	Book *BookResponse `json:"book,omitempty" xml:"book,omitempty"`
+	// Current version of the book
+	Version uint `json:"version,omitempty" xml:"version,omitempty" example:"4"`
+	// Why the operation was not applied
+	Error *ErrorResponse `json:"error,omitempty" xml:"problem,omitempty"`
+}
+
+// Statuses of a row in an import report
+const (
+	ImportStatusCreated   = "created"
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusInvalid   = "invalid"
+	ImportStatusFailed    = "failed"
+)
+
+// ImportReport represents the response body of an import
+type ImportReport struct {
+	XMLName xml.Name `json:"-" xml:"import_report" swaggerignore:"true"`
+	// Whether the import only validated the file
+	DryRun bool `json:"dry_run" xml:"dry_run" example:"false"`
+	// Number of rows read
+	Total int `json:"total" xml:"total" example:"120"`
+	// Number of books created (or that would be created in a dry run)
+	Created int `json:"created" xml:"created" example:"115"`
+	// Number of rows skipped as duplicates
+	Duplicates int `json:"duplicates" xml:"duplicates" example:"3"`
+	// Number of rows that failed validation
+	Invalid int `json:"invalid" xml:"invalid" example:"2"`
+	// Number of valid rows that could not be saved
+	Failed int `json:"failed" xml:"failed" example:"0"`
+	// Every row that was not imported, in file order
+	Rows []ImportRowResult `json:"rows" xml:"rows>row"`
+}
+
+// ImportRowResult describes a row of an import file that was not imported
+type ImportRowResult struct {
+	// Line of the row in the file, starting at 1. MARC (ISO 2709) files have no lines;
+	// their rows are numbered by record.
+	Line int `json:"line" xml:"line" example:"7"`
+	// duplicate, invalid or failed
+	Status string `json:"status" xml:"status" example:"invalid" enums:"duplicate,invalid,failed"`
+	// Title of the book in the row, if any
+	Title string `json:"title,omitempty" xml:"title,omitempty" example:"The Great Gatsby"`
+	// ID of the existing book the row duplicates
+	DuplicateOf uint `json:"duplicate_of,omitempty" xml:"duplicate_of,omitempty" example:"1"`
+	// Line of the earlier row the row duplicates
+	DuplicateOfLine int `json:"duplicate_of_line,omitempty" xml:"duplicate_of_line,omitempty" example:"3"`
+	// Human-readable explanation
+	Message string `json:"message" xml:"message" example:"One or more fields are invalid"`
+	// Per-field validation errors
+	Errors []FieldError `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// Stable machine-readable error codes returned in ErrorResponse.Code
+const (
+	CodeInvalidRequest         = "INVALID_REQUEST"
+	CodeValidationFailed       = "VALIDATION_FAILED"
+	CodeInvalidID              = "INVALID_ID"
+	CodeInvalidPatch           = "INVALID_PATCH"
+	CodeBookNotFound           = "BOOK_NOT_FOUND"
+	CodeRecommendationNotFound = "RECOMMENDATION_NOT_FOUND"
+	CodeRouteNotFound          = "ROUTE_NOT_FOUND"
+	CodePreconditionFailed     = "PRECONDITION_FAILED"
+	CodeConflict               = "CONFLICT"
+	CodeConstraintViolation    = "CONSTRAINT_VIOLATION"
+	CodeInternalError          = "INTERNAL_ERROR"
+	CodeBulkAborted            = "BULK_ABORTED"
+	CodeInvalidImport          = "INVALID_IMPORT"
+	CodeUnsupportedFormat      = "UNSUPPORTED_FORMAT"
+	CodeRequestTooLarge        = "REQUEST_TOO_LARGE"
+	CodeUnauthorized           = "UNAUTHORIZED"
+	CodeForbidden              = "FORBIDDEN"
+	CodeInsufficientScope      = "INSUFFICIENT_SCOPE"
+	CodeAPIKeyNotFound         = "API_KEY_NOT_FOUND"
+	CodeAPIKeyRevoked          = "API_KEY_REVOKED"
+	CodeRateLimited            = "RATE_LIMITED"
+)
+
+// ErrorResponse represents an RFC 7807 problem details response (application/problem+json,
+// or application/problem+xml in the XML form of RFC 7807 appendix A)
 type ErrorResponse struct {
-	// Error type or code
-	Error string `json:"error" example:"Book not found"`
-	// Detailed error message
-	Message string `json:"message" example:"The requested book could not be found"`
-} 
\ No newline at end of file
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem" swaggerignore:"true"`
+	// URI reference identifying the problem type
+	Type string `json:"type" xml:"type" example:"urn:recomemento:problem:BOOK_NOT_FOUND"`
+	// Short, human-readable summary of the problem type
+	Title string `json:"title" xml:"title" example:"Book not found"`
+	// HTTP status code
+	Status int `json:"status" xml:"status" example:"404"`
+	// Human-readable explanation specific to this occurrence
+	Detail string `json:"detail,omitempty" xml:"detail,omitempty" example:"The requested book could not be found"`
+	// URI reference identifying this occurrence of the problem
+	Instance string `json:"instance,omitempty" xml:"instance,omitempty" example:"/books/42"`
+	// Stable machine-readable error code
+	Code string `json:"code" xml:"code" example:"BOOK_NOT_FOUND"`
+	// Per-field validation errors
+	Errors []FieldError `json:"errors,omitempty" xml:"errors>i,omitempty"`
+	// Rows an import applied before it failed; they are not rolled back
+	Import *ImportReport `json:"import,omitempty" xml:"import_report,omitempty"`
+}
+
+// FieldError describes a validation failure of a single request field
+type FieldError struct {
+	// JSON name of the invalid field
+	Field string `json:"field" xml:"field" example:"title"`
+	// Validation rule that failed
+	Rule string `json:"rule" xml:"rule" example:"required"`
+	// Parameter of the rule, if any
+	Param string `json:"param,omitempty" xml:"param,omitempty" example:""`
+	// Human-readable explanation
+	Message string `json:"message" xml:"message" example:"title is required"`
+}
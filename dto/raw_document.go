@@ -0,0 +1,49 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/xml"
+
+	"github.com/ugorji/go/codec"
+)
+
+// RawDocument is an embedded document kept undecoded in the format of the request it
+// came in, so that it can be decoded and validated on its own. In XML it holds the
+// whole element; attributes are not kept.
+type RawDocument []byte
+
+// UnmarshalJSON keeps a copy of the JSON value
+func (r *RawDocument) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+// UnmarshalXML keeps the element with its contents
+func (r *RawDocument) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var element struct {
+		Inner []byte `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&element, &start); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<" + start.Name.Local + ">")
+	b.Write(element.Inner)
+	b.WriteString("</" + start.Name.Local + ">")
+	*r = b.Bytes()
+	return nil
+}
+
+// CodecDecodeSelf keeps the MessagePack value
+func (r *RawDocument) CodecDecodeSelf(d *codec.Decoder) {
+	var raw codec.Raw
+	d.MustDecode(&raw)
+	*r = RawDocument(raw)
+}
+
+// CodecEncodeSelf writes the MessagePack value back as is, which needs a handle with Raw set
+func (r *RawDocument) CodecEncodeSelf(e *codec.Encoder) {
+	raw := codec.Raw(*r)
+	e.MustEncode(&raw)
+}
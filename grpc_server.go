@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"recomemento-api-go/handlers"
+	"recomemento-api-go/models"
+	bookv1 "recomemento-api-go/proto/book/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// newGRPCServer creates the gRPC server exposing the BookService over bookRepo, with
+// calls rate limited per peer address, authenticated by authenticator and then rate
+// limited per client by limiter. Server
+// reflection is enabled so that tools such as grpcurl can discover the service.
+func newGRPCServer(bookRepo models.BookDatabase, authenticator *handlers.Authenticator, limiter *handlers.RateLimiter) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(limiter.IPUnaryServerInterceptor(), authenticator.UnaryServerInterceptor(), limiter.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(limiter.IPStreamServerInterceptor(), authenticator.StreamServerInterceptor(), limiter.StreamServerInterceptor()),
+	)
+	bookv1.RegisterBookServiceServer(server, handlers.NewGRPCBookService(bookRepo))
+	reflection.Register(server)
+	return server
+}
+
+// serveGRPC serves the gRPC API on addr until ctx is done, then stops once the calls in
+// flight have finished
+func serveGRPC(ctx context.Context, addr string, bookRepo models.BookDatabase, authenticator *handlers.Authenticator, limiter *handlers.RateLimiter) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := newGRPCServer(bookRepo, authenticator, limiter)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	return server.Serve(listener)
+}
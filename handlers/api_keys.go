@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles the administration of API keys
+type APIKeyHandler struct {
+	keyRepo models.APIKeyDatabase
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(keyRepo models.APIKeyDatabase) *APIKeyHandler {
+	return &APIKeyHandler{
+		keyRepo: keyRepo,
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary Issue an API key
+// @Description Issue an API key for a machine client. The key is only returned in this response; store it safely.
+// @Tags api-keys
+// @Accept json,xml,application/msgpack
+// @Produce json,xml,application/msgpack
+// @Param key body dto.CreateAPIKeyRequest true "Key name, scopes and expiry"
+// @Success 201 {object} dto.APIKeyResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Router /admin/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req dto.CreateAPIKeyRequest
+	if err := c.ShouldBindWith(&req, sanitizedBody); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+
+	generated, err := auth.GenerateAPIKey()
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	key := &models.APIKey{
+		Name:       req.Name,
+		Prefix:     generated.Prefix,
+		SecretHash: generated.Hash,
+		Scopes:     strings.Join(uniqueScopes(req.Scopes), " "),
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := h.keyRepo.Create(key); err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	response := apiKeyResponse(key)
+	response.Key = generated.Key
+	c.Header("Cache-Control", "no-store")
+	respond(c, http.StatusCreated, response)
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List every API key, revoked and expired ones included, with its usage
+// @Tags api-keys
+// @Produce json,xml,application/msgpack
+// @Success 200 {array} dto.APIKeyResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Router /admin/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.keyRepo.List()
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	response := make(apiKeyList, 0, len(keys))
+	for i := range keys {
+		response = append(response, apiKeyResponse(&keys[i]))
+	}
+	respond(c, http.StatusOK, response)
+}
+
+// apiKeyList is the key collection returned by ListAPIKeys. Like bookList, it is a plain
+// array in JSON and MessagePack and an api_keys element holding an api_key element per
+// key in XML.
+type apiKeyList []dto.APIKeyResponse
+
+func (l apiKeyList) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: "api_keys"}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	for i := range l {
+		if err := encoder.Encode(&l[i]); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// GetAPIKey godoc
+// @Summary Get an API key
+// @Description Get an API key and its usage
+// @Tags api-keys
+// @Produce json,xml,application/msgpack
+// @Param id path int true "API key ID"
+// @Success 200 {object} dto.APIKeyResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Router /admin/api-keys/{id} [get]
+func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		AbortWithProblem(c, errInvalidID())
+		return
+	}
+
+	key, err := h.keyRepo.GetByID(uint(id))
+	if err != nil {
+		AbortWithProblem(c, apiKeyError(err))
+		return
+	}
+	respond(c, http.StatusOK, apiKeyResponse(key))
+}
+
+// RotateAPIKey godoc
+// @Summary Rotate an API key
+// @Description Replace the secret of an API key, keeping its name, scopes and usage. The previous key stops working immediately; the new key is only returned in this response.
+// @Tags api-keys
+// @Produce json,xml,application/msgpack
+// @Param id path int true "API key ID"
+// @Success 200 {object} dto.APIKeyResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Router /admin/api-keys/{id}/rotate [post]
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		AbortWithProblem(c, errInvalidID())
+		return
+	}
+
+	generated, err := auth.GenerateAPIKey()
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	key, err := h.keyRepo.Rotate(uint(id), generated.Prefix, generated.Hash)
+	if err != nil {
+		AbortWithProblem(c, apiKeyError(err))
+		return
+	}
+
+	response := apiKeyResponse(key)
+	response.Key = generated.Key
+	c.Header("Cache-Control", "no-store")
+	respond(c, http.StatusOK, response)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key; it stops working immediately. Revoking a revoked key has no effect.
+// @Tags api-keys
+// @Produce json,xml,application/msgpack
+// @Param id path int true "API key ID"
+// @Success 200 {object} dto.APIKeyResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Router /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		AbortWithProblem(c, errInvalidID())
+		return
+	}
+
+	key, err := h.keyRepo.Revoke(uint(id), time.Now())
+	if err != nil {
+		AbortWithProblem(c, apiKeyError(err))
+		return
+	}
+	respond(c, http.StatusOK, apiKeyResponse(key))
+}
+
+// apiKeyError maps the repository errors of API key operations onto their own codes,
+// which would otherwise be reported as errors about books
+func apiKeyError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		appErr := NewAppError(dto.CodeAPIKeyNotFound)
+		appErr.Err = err
+		return appErr
+	case errors.Is(err, models.ErrAPIKeyRevoked):
+		appErr := NewAppError(dto.CodeAPIKeyRevoked)
+		appErr.Err = err
+		return appErr
+	}
+	return err
+}
+
+// uniqueScopes drops repeated scopes, keeping the first occurrence
+func uniqueScopes(scopes []string) []string {
+	var unique []string
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
+
+// apiKeyResponse describes a key without its secret
+func apiKeyResponse(key *models.APIKey) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		LastUsedAt: key.LastUsedAt,
+		UsageCount: key.UsageCount,
+	}
+}
+
+// APIKeyVerifier verifies API keys against the keys issued by APIKeyHandler and records
+// every authorized use. Uses are counted in memory and written to the repository by
+// Flush, which Run calls periodically, rather than by a write per request.
+type APIKeyVerifier struct {
+	keyRepo models.APIKeyDatabase
+
+	mu    sync.Mutex
+	usage map[uint]apiKeyUsage
+}
+
+// apiKeyUsage is the uses of a key not written to the repository yet
+type apiKeyUsage struct {
+	count    int64
+	lastUsed time.Time
+}
+
+// NewAPIKeyVerifier creates a verifier over keyRepo
+func NewAPIKeyVerifier(keyRepo models.APIKeyDatabase) *APIKeyVerifier {
+	return &APIKeyVerifier{keyRepo: keyRepo, usage: make(map[uint]apiKeyUsage)}
+}
+
+// Run flushes the recorded uses every interval until ctx is done, then a last time
+func (v *APIKeyVerifier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			v.Flush()
+		case <-ctx.Done():
+			v.Flush()
+			return
+		}
+	}
+}
+
+// Flush writes the uses recorded since the last flush to the repository. Uses that fail
+// to be written are logged and kept for the next flush.
+func (v *APIKeyVerifier) Flush() {
+	v.mu.Lock()
+	pending := v.usage
+	v.usage = make(map[uint]apiKeyUsage)
+	v.mu.Unlock()
+
+	for id, usage := range pending {
+		if err := v.keyRepo.RecordUsage(id, usage.count, usage.lastUsed); err != nil {
+			log.Printf("recording %d uses of API key %d: %v", usage.count, id, err)
+			v.recordUsage(id, usage)
+		}
+	}
+}
+
+// recordUsage adds usage to the uses of key id waiting for a flush
+func (v *APIKeyVerifier) recordUsage(id uint, usage apiKeyUsage) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	pending := v.usage[id]
+	pending.count += usage.count
+	if usage.lastUsed.After(pending.lastUsed) {
+		pending.lastUsed = usage.lastUsed
+	}
+	v.usage[id] = pending
+}
+
+// Verify returns the principal of an active key. Unknown, revoked and expired keys are
+// rejected with auth.ErrInvalidToken; other errors come from the repository. The use is
+// only counted once authorized, by recordUse.
+func (v *APIKeyVerifier) Verify(token string) (*auth.Principal, error) {
+	prefix, secret, ok := auth.ParseAPIKey(token)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed API key", auth.ErrInvalidToken)
+	}
+
+	key, err := v.keyRepo.GetByPrefix(prefix)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown API key", auth.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !auth.VerifyAPIKeySecret(secret, key.SecretHash) {
+		return nil, fmt.Errorf("%w: API key secret mismatch", auth.ErrInvalidToken)
+	}
+	if !key.Active(now) {
+		return nil, fmt.Errorf("%w: API key %d is revoked or expired", auth.ErrInvalidToken, key.ID)
+	}
+
+	principal := &auth.Principal{
+		Subject:  "api-key:" + strconv.FormatUint(uint64(key.ID), 10),
+		APIKeyID: key.ID,
+	}
+	for _, scope := range key.ScopeList() {
+		principal.Scopes = append(principal.Scopes, auth.Scope(scope))
+	}
+	return principal, nil
+}
+
+// recordUse counts a use of the key of principal, once the Authenticator has found that
+// the key grants the operation
+func (v *APIKeyVerifier) recordUse(principal *auth.Principal) {
+	v.recordUsage(principal.APIKeyID, apiKeyUsage{count: 1, lastUsed: time.Now()})
+}
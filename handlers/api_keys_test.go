@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+	bookv1 "recomemento-api-go/proto/book/v1"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// apiKeyTestServer serves the API key administration and two book routes over an
+// in-memory key store, authenticating admins with testVerifier tokens
+type apiKeyTestServer struct {
+	router   *gin.Engine
+	repo     models.APIKeyDatabase
+	verifier *APIKeyVerifier
+}
+
+func newAPIKeyTestServer(t *testing.T) *apiKeyTestServer {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.APIKey{}))
+	repo := models.NewAPIKeyRepository(db)
+
+	admins := fakeVerifier{"admin-token": {Subject: "admin", Roles: []auth.Role{auth.RoleAdmin}}}
+	for token, principal := range testVerifier {
+		admins[token] = principal
+	}
+	verifier := NewAPIKeyVerifier(repo)
+	authenticator := NewAuthenticator(admins, verifier)
+	handler := NewAPIKeyHandler(repo)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	admin := r.Group("/admin/api-keys", authenticator.Require(auth.Administer))
+	admin.POST("", handler.CreateAPIKey)
+	admin.GET("", handler.ListAPIKeys)
+	admin.GET("/:id", handler.GetAPIKey)
+	admin.POST("/:id/rotate", handler.RotateAPIKey)
+	admin.DELETE("/:id", handler.RevokeAPIKey)
+	echo := func(c *gin.Context) {
+		principal, _ := auth.FromContext(c.Request.Context())
+		c.String(http.StatusOK, principal.Subject)
+	}
+	r.GET("/books", authenticator.Require(auth.ReadBooks), echo)
+	r.POST("/books", authenticator.Require(auth.WriteBooks), echo)
+
+	return &apiKeyTestServer{router: r, repo: repo, verifier: verifier}
+}
+
+func (s *apiKeyTestServer) do(method, url string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// issue issues a key with scopes as an admin
+func (s *apiKeyTestServer) issue(t *testing.T, scopes ...string) dto.APIKeyResponse {
+	t.Helper()
+	w := s.do("POST", "/admin/api-keys", map[string]interface{}{"name": "Partner", "scopes": scopes}, "Authorization", "Bearer admin-token")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var issued dto.APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+	return issued
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response dto.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	return response.Code
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+
+	w := s.do("POST", "/admin/api-keys", map[string]interface{}{
+		"name": "  Partner bookstore ", "scopes": []string{"books:read", "recommend", "books:read"},
+	}, "Authorization", "Bearer admin-token")
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var issued dto.APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &issued))
+	assert.Equal(t, "Partner bookstore", issued.Name)
+	assert.Equal(t, []string{"books:read", "recommend"}, issued.Scopes)
+	assert.Equal(t, "rk_"+issued.Prefix+"_", issued.Key[:len(issued.Prefix)+4])
+
+	// 鍵そのものは発行時にしか返さない
+	stored, err := s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, stored.SecretHash, issued.Key[len(issued.Prefix)+4:])
+	w = s.do("GET", "/admin/api-keys", nil, "Authorization", "Bearer admin-token")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"key"`)
+	assert.Contains(t, w.Body.String(), issued.Prefix)
+}
+
+func TestAPIKeys_XMLAndMessagePack(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	send := func(method, url, contentType, body, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("XMLで発行する", func(t *testing.T) {
+		w := send("POST", "/admin/api-keys", "application/xml",
+			`<api_key><name>  Partner &lt;b&gt;bookstore&lt;/b&gt; </name><scopes><scope>books:read</scope><scope>recommend</scope></scopes></api_key>`,
+			"application/xml")
+
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+		var issued dto.APIKeyResponse
+		require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &issued))
+		assert.Equal(t, "Partner bookstore", issued.Name)
+		assert.Equal(t, []string{"books:read", "recommend"}, issued.Scopes)
+		assert.NotEmpty(t, issued.Key)
+	})
+
+	t.Run("一覧をXMLで返す", func(t *testing.T) {
+		w := send("GET", "/admin/api-keys", "", "", "application/xml")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			XMLName xml.Name             `xml:"api_keys"`
+			Keys    []dto.APIKeyResponse `xml:"api_key"`
+		}
+		require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list.Keys, 1)
+		assert.Equal(t, "Partner bookstore", list.Keys[0].Name)
+	})
+
+	t.Run("MessagePackで取得する", func(t *testing.T) {
+		w := send("GET", "/admin/api-keys/1", "", "", "application/msgpack")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+		var key dto.APIKeyResponse
+		require.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), msgpackHandle).Decode(&key))
+		assert.Equal(t, "Partner bookstore", key.Name)
+	})
+
+	t.Run("検証エラーはXMLの問題詳細", func(t *testing.T) {
+		w := send("POST", "/admin/api-keys", "application/xml", `<api_key><name>Partner</name></api_key>`, "application/xml")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/problem+xml", w.Header().Get("Content-Type"))
+		var problem dto.ErrorResponse
+		require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, dto.CodeValidationFailed, problem.Code)
+	})
+}
+
+func TestCreateAPIKey_ValidationError(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		body  map[string]interface{}
+		field string
+		rule  string
+	}{
+		{"名前なし", map[string]interface{}{"scopes": []string{"recommend"}}, "name", "required"},
+		{"スコープなし", map[string]interface{}{"name": "Partner", "scopes": []string{}}, "scopes", "min"},
+		{"未知のスコープ", map[string]interface{}{"name": "Partner", "scopes": []string{"books:delete"}}, "scopes[0]", "oneof"},
+		{"過去の有効期限", map[string]interface{}{"name": "Partner", "scopes": []string{"recommend"}, "expires_at": past}, "expires_at", "future"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("POST", "/admin/api-keys", tt.body, "Authorization", "Bearer admin-token")
+
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			var response dto.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, dto.CodeValidationFailed, response.Code)
+			require.Len(t, response.Errors, 1)
+			assert.Equal(t, tt.field, response.Errors[0].Field)
+			assert.Equal(t, tt.rule, response.Errors[0].Rule)
+		})
+	}
+}
+
+func TestAPIKeyAdministration_RequiresAdmin(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read", "books:write", "recommend")
+
+	w := s.do("GET", "/admin/api-keys", nil, "Authorization", "Bearer editor-token")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, dto.CodeForbidden, errorCode(t, w))
+
+	// すべてのスコープを持つ API キーでも管理はできない
+	w = s.do("GET", "/admin/api-keys", nil, "X-API-Key", issued.Key)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, dto.CodeForbidden, errorCode(t, w))
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read")
+
+	// X-API-Key と Bearer のどちらでも認証できる
+	w := s.do("GET", "/books", nil, "X-API-Key", issued.Key)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, fmt.Sprintf("api-key:%d", issued.ID), w.Body.String())
+	w = s.do("GET", "/books", nil, "Authorization", "Bearer "+issued.Key)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// スコープのない操作は INSUFFICIENT_SCOPE
+	w = s.do("POST", "/books", nil, "X-API-Key", issued.Key, "Accept-Language", "ja")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `Bearer realm="recomemento", error="insufficient_scope"`, w.Header().Get("WWW-Authenticate"))
+	var response dto.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, dto.CodeInsufficientScope, response.Code)
+	assert.Equal(t, "この操作には books:write スコープを持つAPIキーが必要です", response.Detail)
+
+	// 利用回数は認可されたリクエストだけ数え、まとめて書き込む
+	stored, err := s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stored.UsageCount)
+	s.verifier.Flush()
+	stored, err = s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.UsageCount)
+	assert.NotNil(t, stored.LastUsedAt)
+}
+
+func TestAPIKeyAuthentication_ForbiddenCallsAreNotCounted(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read")
+
+	// スコープが足りず 403 になった呼び出しは利用回数に数えない
+	w := s.do("POST", "/books", nil, "X-API-Key", issued.Key)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = s.do("GET", "/admin/api-keys", nil, "X-API-Key", issued.Key)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	s.verifier.Flush()
+	stored, err := s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stored.UsageCount)
+	assert.Nil(t, stored.LastUsedAt)
+}
+
+// failingUsageRepo fails to record the uses of keys the first failures times
+type failingUsageRepo struct {
+	models.APIKeyDatabase
+	failures int
+}
+
+func (r *failingUsageRepo) RecordUsage(id uint, count int64, at time.Time) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("database is locked")
+	}
+	return r.APIKeyDatabase.RecordUsage(id, count, at)
+}
+
+func TestAPIKeyVerifier_FlushKeepsFailedUses(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read")
+	verifier := NewAPIKeyVerifier(&failingUsageRepo{APIKeyDatabase: s.repo, failures: 1})
+	principal, err := verifier.Verify(issued.Key)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		verifier.recordUse(principal)
+	}
+
+	// 書き込みに失敗した利用回数は次の書き込みまで保持する
+	verifier.Flush()
+	stored, err := s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stored.UsageCount)
+
+	verifier.recordUse(principal)
+	verifier.Flush()
+	stored, err = s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stored.UsageCount)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	// 書き込み済みの利用回数は再び書き込まない
+	verifier.Flush()
+	stored, err = s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stored.UsageCount)
+}
+
+func TestAPIKeyVerifier_RunFlushesWhenDone(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.verifier.Run(ctx, time.Hour)
+		close(done)
+	}()
+	principal, err := s.verifier.Verify(issued.Key)
+	require.NoError(t, err)
+	s.verifier.recordUse(principal)
+
+	// 停止時に残りの利用回数を書き込む
+	cancel()
+	<-done
+	stored, err := s.repo.GetByID(issued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stored.UsageCount)
+}
+
+func TestAPIKeyAuthentication_Rejects(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read")
+	expired := time.Now().Add(-time.Minute)
+	generated, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	require.NoError(t, s.repo.Create(&models.APIKey{
+		Name: "Expired", Prefix: generated.Prefix, SecretHash: generated.Hash, Scopes: "books:read", ExpiresAt: &expired,
+	}))
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"形式が不正", "not-a-key"},
+		{"未知のプレフィックス", "rk_0000000000000000_secret"},
+		{"秘密が異なる", "rk_" + issued.Prefix + "_wrong"},
+		{"期限切れ", generated.Key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do("GET", "/books", nil, "X-API-Key", tt.key)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, `Bearer realm="recomemento", error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, dto.CodeUnauthorized, errorCode(t, w))
+		})
+	}
+}
+
+func TestAPIKeyAuthentication_NotConfigured(t *testing.T) {
+	// API キーの検証器がない場合、API キーは拒否される
+	r := gin.New()
+	r.GET("/books", NewAuthenticator(testVerifier, nil).Require(auth.ReadBooks), func(c *gin.Context) {})
+	req := httptest.NewRequest("GET", "/books", nil)
+	req.Header.Set("X-API-Key", "rk_0123456789abcdef_secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read")
+
+	w := s.do("POST", fmt.Sprintf("/admin/api-keys/%d/rotate", issued.ID), nil, "Authorization", "Bearer admin-token")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var rotated dto.APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Equal(t, issued.ID, rotated.ID)
+	assert.Equal(t, issued.Scopes, rotated.Scopes)
+	assert.NotEqual(t, issued.Key, rotated.Key)
+
+	// 古い鍵はすぐに使えなくなる
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/books", nil, "X-API-Key", issued.Key).Code)
+	assert.Equal(t, http.StatusOK, s.do("GET", "/books", nil, "X-API-Key", rotated.Key).Code)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "books:read")
+
+	w := s.do("DELETE", fmt.Sprintf("/admin/api-keys/%d", issued.ID), nil, "Authorization", "Bearer admin-token")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var revoked dto.APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revoked))
+	assert.NotNil(t, revoked.RevokedAt)
+	assert.Empty(t, revoked.Key)
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/books", nil, "X-API-Key", issued.Key).Code)
+
+	// 失効したキーはローテーションできない
+	w = s.do("POST", fmt.Sprintf("/admin/api-keys/%d/rotate", issued.ID), nil, "Authorization", "Bearer admin-token")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, dto.CodeAPIKeyRevoked, errorCode(t, w))
+}
+
+func TestAPIKeyAdministration_NotFound(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+
+	for _, request := range []struct{ method, url string }{
+		{"GET", "/admin/api-keys/999"},
+		{"POST", "/admin/api-keys/999/rotate"},
+		{"DELETE", "/admin/api-keys/999"},
+	} {
+		w := s.do(request.method, request.url, nil, "Authorization", "Bearer admin-token")
+		assert.Equal(t, http.StatusNotFound, w.Code, request.url)
+		assert.Equal(t, dto.CodeAPIKeyNotFound, errorCode(t, w), request.url)
+	}
+
+	w := s.do("GET", "/admin/api-keys/abc", nil, "Authorization", "Bearer admin-token")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, dto.CodeInvalidID, errorCode(t, w))
+}
+
+func TestGRPC_APIKeyScopes(t *testing.T) {
+	s := newAPIKeyTestServer(t)
+	issued := s.issue(t, "recommend")
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("FindByGenreAndPurpose", "Fiction", "Entertainment").Return(&models.Book{ID: 1, Title: "1984"}, nil)
+	client := newAuthenticatedGRPCTestClient(t, mockRepo, NewAuthenticator(testVerifier, NewAPIKeyVerifier(s.repo)))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", issued.Key)
+
+	book, err := client.RecommendBook(ctx, &bookv1.RecommendBookRequest{Genre: "Fiction", Purpose: "Entertainment"})
+	require.NoError(t, err)
+	assert.Equal(t, "1984", book.GetTitle())
+
+	_, err = client.GetBook(ctx, &bookv1.GetBookRequest{Id: 1})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, dto.CodeInsufficientScope, errorInfoReason(t, err))
+}
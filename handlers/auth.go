@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// authRealm is the realm announced in WWW-Authenticate
+const authRealm = "recomemento"
+
+// TokenVerifier turns the credentials of a request into a principal. It returns an error
+// wrapping auth.ErrInvalidToken for credentials it rejects.
+type TokenVerifier interface {
+	Verify(token string) (*auth.Principal, error)
+}
+
+// usageRecorder is implemented by verifiers counting the uses of credentials. Only the
+// uses that pass authorization are recorded, so that forbidden calls are not counted.
+type usageRecorder interface {
+	recordUse(principal *auth.Principal)
+}
+
+// Authenticator authenticates requests and checks the permission their operation
+// requires. Users authenticate with a JWT bearer token and machine clients with an API
+// key, sent either as a bearer token or in X-API-Key. A nil Authenticator, or one without
+// verifiers, lets every request through; it is meant for development and tests only.
+type Authenticator struct {
+	tokens  TokenVerifier
+	apiKeys TokenVerifier
+}
+
+// NewAuthenticator creates an authenticator verifying JWTs with tokens and API keys with
+// apiKeys. Either may be nil to reject that kind of credential.
+func NewAuthenticator(tokens, apiKeys TokenVerifier) *Authenticator {
+	return &Authenticator{tokens: tokens, apiKeys: apiKeys}
+}
+
+// enabled reports whether requests are authenticated at all
+func (a *Authenticator) enabled() bool {
+	return a != nil && (a.tokens != nil || a.apiKeys != nil)
+}
+
+// Require returns middleware admitting requests whose credentials grant perm. Missing
+// or invalid credentials are answered with 401 and credentials without the permission
+// with 403, both as problems with a WWW-Authenticate challenge (RFC 6750). The principal
+// of admitted requests is available from auth.FromContext(c.Request.Context()).
+func (a *Authenticator) Require(perm auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled() {
+			c.Next()
+			return
+		}
+
+		principal, challenge, err := a.authorize(c.GetHeader("Authorization"), c.GetHeader("X-API-Key"), perm)
+		if err != nil {
+			if challenge != "" {
+				c.Header("WWW-Authenticate", challenge)
+			}
+			AbortWithProblem(c, err)
+			return
+		}
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+// authorize authenticates the credentials of a request, an Authorization header or an
+// API key, and checks that they grant perm. On failure it returns the WWW-Authenticate
+// challenge to send, if any.
+func (a *Authenticator) authorize(authorization, apiKey string, perm auth.Permission) (*auth.Principal, string, error) {
+	verifier, token := a.apiKeys, strings.TrimSpace(apiKey)
+	if token == "" {
+		var ok bool
+		if token, ok = bearerToken(authorization); !ok {
+			return nil, fmt.Sprintf("Bearer realm=%q", authRealm), NewAppError(dto.CodeUnauthorized)
+		}
+		if !auth.IsAPIKey(token) {
+			verifier = a.tokens
+		}
+	}
+
+	invalid := fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\"", authRealm)
+	if verifier == nil {
+		return nil, invalid, NewAppError(dto.CodeUnauthorized)
+	}
+	principal, err := verifier.Verify(token)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		appErr := NewAppError(dto.CodeUnauthorized)
+		appErr.Err = err
+		return nil, invalid, appErr
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := permissionError(principal, perm); err != nil {
+		return nil, fmt.Sprintf("Bearer realm=%q, error=\"insufficient_scope\"", authRealm), err
+	}
+	if recorder, ok := verifier.(usageRecorder); ok {
+		recorder.recordUse(principal)
+	}
+	return principal, "", nil
+}
+
+// permissionError returns the error for a principal lacking perm, or nil. API keys are
+// told the scope they lack; users, and API keys calling operations closed to them, the
+// role.
+func permissionError(principal *auth.Principal, perm auth.Permission) error {
+	switch {
+	case principal.Allows(perm):
+		return nil
+	case principal.IsAPIKey() && perm.Scope != "":
+		return NewAppError(dto.CodeInsufficientScope, perm.Scope)
+	default:
+		return NewAppError(dto.CodeForbidden, perm.Role)
+	}
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header
+func bearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// requirePermission checks that the principal of ctx has perm, for operations whose
+// required permission depends on more than the route, such as GraphQL mutations.
+// Requests that went through no authenticating middleware carry no principal and are
+// let through.
+func requirePermission(ctx context.Context, perm auth.Permission) error {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return permissionError(principal, perm)
+}
+
+// grpcMethodPermissions lists the permission required by every gRPC method. Methods
+// missing here require auth.Administer.
+var grpcMethodPermissions = map[string]auth.Permission{
+	"/recomemento.book.v1.BookService/GetBook":                       auth.ReadBooks,
+	"/recomemento.book.v1.BookService/ListBooks":                     auth.ReadBooks,
+	"/recomemento.book.v1.BookService/SearchBooks":                   auth.ReadBooks,
+	"/recomemento.book.v1.BookService/RecommendBook":                 auth.Recommend,
+	"/recomemento.book.v1.BookService/ExportBooks":                   auth.ReadBooks,
+	"/recomemento.book.v1.BookService/CreateBook":                    auth.WriteBooks,
+	"/recomemento.book.v1.BookService/UpdateBook":                    auth.WriteBooks,
+	"/recomemento.book.v1.BookService/DeleteBook":                    auth.WriteBooks,
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":      auth.ReadBooks,
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo": auth.ReadBooks,
+}
+
+// grpcAuthorize authenticates the authorization or x-api-key metadata of a gRPC call
+// against the permission of its method
+func (a *Authenticator) grpcAuthorize(ctx context.Context, method string) (context.Context, error) {
+	perm, ok := grpcMethodPermissions[method]
+	if !ok {
+		perm = auth.Administer
+	}
+
+	var authorization, apiKey string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+		if values := md.Get("x-api-key"); len(values) > 0 {
+			apiKey = values[0]
+		}
+	}
+	principal, _, err := a.authorize(authorization, apiKey, perm)
+	if err != nil {
+		return nil, grpcError(ctx, method, err, false)
+	}
+	return auth.NewContext(ctx, principal), nil
+}
+
+// UnaryServerInterceptor authenticates unary gRPC calls like Require does HTTP requests
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !a.enabled() {
+			return handler(ctx, req)
+		}
+		ctx, err := a.grpcAuthorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates streaming gRPC calls like Require does HTTP
+// requests
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !a.enabled() {
+			return handler(srv, stream)
+		}
+		ctx, err := a.grpcAuthorize(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authenticatedStream is a server stream whose context carries the principal
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+	bookv1 "recomemento-api-go/proto/book/v1"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeVerifier accepts the tokens it maps to principals
+type fakeVerifier map[string]*auth.Principal
+
+func (v fakeVerifier) Verify(token string) (*auth.Principal, error) {
+	if principal, ok := v[token]; ok {
+		return principal, nil
+	}
+	return nil, fmt.Errorf("%w: unknown token", auth.ErrInvalidToken)
+}
+
+var testVerifier = fakeVerifier{
+	"reader-token": {Subject: "reader", Roles: []auth.Role{auth.RoleReader}},
+	"editor-token": {Subject: "editor", Roles: []auth.Role{auth.RoleEditor}},
+}
+
+// serveWithAuth serves a request through Require(perm) into a handler echoing the subject
+func serveWithAuth(authenticator *Authenticator, perm auth.Permission, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/books", authenticator.Require(perm), func(c *gin.Context) {
+		subject := ""
+		if principal, ok := auth.FromContext(c.Request.Context()); ok {
+			subject = principal.Subject
+		}
+		c.String(http.StatusOK, subject)
+	})
+
+	req := httptest.NewRequest("GET", "/books", nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequire_Rejects(t *testing.T) {
+	authenticator := NewAuthenticator(testVerifier, nil)
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		code          string
+		challenge     string
+	}{
+		{"トークンなし", "", http.StatusUnauthorized, dto.CodeUnauthorized, `Bearer realm="recomemento"`},
+		{"Bearer以外のスキーム", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, dto.CodeUnauthorized, `Bearer realm="recomemento"`},
+		{"空のトークン", "Bearer ", http.StatusUnauthorized, dto.CodeUnauthorized, `Bearer realm="recomemento"`},
+		{"無効なトークン", "Bearer forged", http.StatusUnauthorized, dto.CodeUnauthorized, `Bearer realm="recomemento", error="invalid_token"`},
+		{"ロール不足", "Bearer reader-token", http.StatusForbidden, dto.CodeForbidden, `Bearer realm="recomemento", error="insufficient_scope"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWithAuth(authenticator, auth.WriteBooks, map[string]string{"Authorization": tt.authorization})
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.challenge, w.Header().Get("WWW-Authenticate"))
+			var response dto.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.code, response.Code)
+		})
+	}
+}
+
+func TestRequire_ForbiddenDetailIsLocalized(t *testing.T) {
+	w := serveWithAuth(NewAuthenticator(testVerifier, nil), auth.WriteBooks, map[string]string{
+		"Authorization":   "Bearer reader-token",
+		"Accept-Language": "ja",
+	})
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var response dto.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "この操作には editor ロールが必要です", response.Detail)
+}
+
+func TestRequire_Admits(t *testing.T) {
+	// 上位のロールは下位のロールを含む
+	w := serveWithAuth(NewAuthenticator(testVerifier, nil), auth.ReadBooks, map[string]string{"Authorization": "bearer editor-token"})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "editor", w.Body.String())
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+}
+
+// failingVerifier fails like a verifier whose store is unavailable
+type failingVerifier struct{}
+
+func (failingVerifier) Verify(string) (*auth.Principal, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestRequire_VerifierFailure(t *testing.T) {
+	// 資格情報の誤りではない失敗は 401 ではなく 500
+	w := serveWithAuth(NewAuthenticator(nil, failingVerifier{}), auth.ReadBooks, map[string]string{"X-API-Key": "rk_0123456789abcdef_secret"})
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestRequire_Disabled(t *testing.T) {
+	for name, authenticator := range map[string]*Authenticator{"nil": nil, "検証器なし": NewAuthenticator(nil, nil)} {
+		t.Run(name, func(t *testing.T) {
+			w := serveWithAuth(authenticator, auth.Administer, nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestGraphQL_MutationRequiresEditor(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/graphql", NewAuthenticator(testVerifier, nil).Require(auth.ReadBooks), NewGraphQLHandler(mockRepo).Serve)
+
+	_, response := postGraphQLTo(t, r, map[string]interface{}{
+		"query": `mutation { deleteBook(id: "1") { id } }`,
+	}, "Authorization", "Bearer reader-token")
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, dto.CodeForbidden, response.Errors[0].Extensions["code"])
+	assert.Equal(t, float64(http.StatusForbidden), response.Errors[0].Extensions["status"])
+	mockRepo.AssertNotCalled(t, "Delete")
+}
+
+// newAuthenticatedGRPCTestClient is newGRPCTestClient behind the interceptors of authenticator
+func newAuthenticatedGRPCTestClient(t *testing.T, mockRepo *MockBookDatabase, authenticator *Authenticator) bookv1.BookServiceClient {
+	t.Helper()
+	return newGRPCTestClient(t, mockRepo,
+		grpc.ChainUnaryInterceptor(authenticator.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(authenticator.StreamServerInterceptor()),
+	)
+}
+
+func TestGRPC_Authentication(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	client := newAuthenticatedGRPCTestClient(t, mockRepo, NewAuthenticator(testVerifier, nil))
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	_, err := client.GetBook(context.Background(), &bookv1.GetBookRequest{Id: 1})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, dto.CodeUnauthorized, errorInfoReason(t, err))
+
+	_, err = client.DeleteBook(withToken("reader-token"), &bookv1.DeleteBookRequest{Id: 1})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, dto.CodeForbidden, errorInfoReason(t, err))
+
+	// ストリーミングも同じく認証される
+	stream, err := client.ListBooks(withToken("forged"), &bookv1.ListBooksRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	mockRepo.AssertNotCalled(t, "GetByID")
+	mockRepo.AssertNotCalled(t, "Delete")
+}
+
+func TestGRPC_AuthenticationAdmits(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Delete", uint(1)).Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	client := newAuthenticatedGRPCTestClient(t, mockRepo, NewAuthenticator(testVerifier, nil))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer editor-token")
+	_, err := client.DeleteBook(ctx, &bookv1.DeleteBookRequest{Id: 1})
+
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRequirePermission(t *testing.T) {
+	// 認証を経ていないリクエストは通す
+	assert.NoError(t, requirePermission(context.Background(), auth.Administer))
+
+	ctx := auth.NewContext(context.Background(), testVerifier["reader-token"])
+	assert.NoError(t, requirePermission(ctx, auth.ReadBooks))
+	var appErr *AppError
+	require.True(t, errors.As(requirePermission(ctx, auth.WriteBooks), &appErr))
+	assert.Equal(t, dto.CodeForbidden, appErr.Code)
+}
+
+func TestRateBook_RatesAsSubject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Rate", uint(1), "reader", 4).Return(nil)
+	mockRepo.On("SummarizeRatings", []uint{1}).Return(map[uint]models.RatingSummary{1: {Count: 1, Average: 4}}, nil)
+	apiKeys := fakeVerifier{"rk_0123456789abcdef_secret": {
+		Subject: "api-key:1", APIKeyID: 1, Scopes: auth.Scopes,
+	}}
+	r := gin.New()
+	r.PUT("/books/:id/rating", NewAuthenticator(testVerifier, apiKeys).Require(auth.RateBooks), NewBookHandler(mockRepo).RateBook)
+	rate := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/books/1/rating", strings.NewReader(`{"score": 4}`))
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("利用者ごとに評価する", func(t *testing.T) {
+		w := rate(map[string]string{"Authorization": "Bearer reader-token"})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"count": 1, "average": 4}`, w.Body.String())
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("APIキーでは評価できない", func(t *testing.T) {
+		w := rate(map[string]string{"X-API-Key": "rk_0123456789abcdef_secret"})
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockRepo.AssertNumberOfCalls(t, "Rate", 1)
+	})
+}
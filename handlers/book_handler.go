@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"encoding/xml"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -26,20 +28,24 @@ func NewBookHandler(bookRepo models.BookDatabase) *BookHandler {
 // @Summary Create a new book
 // @Description Create a new book with the provided information
 // @Tags books
-// @Accept json
-// @Produce json
+// @Accept json,xml,application/msgpack
+// @Produce json,xml,application/msgpack
 // @Param book body dto.CreateBookRequest true "Book information"
 // @Success 201 {object} dto.BookResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /books [post]
 func (h *BookHandler) CreateBook(c *gin.Context) {
 	var req dto.CreateBookRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Invalid request",
-			Message: err.Error(),
-		})
+	if err := c.ShouldBindWith(&req, sanitizedBody); err != nil {
+		AbortWithProblem(c, bindError(err))
 		return
 	}
 
@@ -49,13 +55,11 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		Genre:       req.Genre,
 		Purpose:     req.Purpose,
 		Description: req.Description,
+		ISBN:        req.ISBN,
 	}
 
 	if err := h.bookRepo.Create(book); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "Failed to create book",
-			Message: err.Error(),
-		})
+		AbortWithProblem(c, err)
 		return
 	}
 
@@ -66,27 +70,49 @@ func (h *BookHandler) CreateBook(c *gin.Context) {
 		Genre:       book.Genre,
 		Purpose:     book.Purpose,
 		Description: book.Description,
+		ISBN:        book.ISBN,
 	}
 
-	c.JSON(http.StatusCreated, response)
+	c.Header("ETag", representationETag(book, negotiateFormat(c.GetHeader("Accept")), bookRepresentation{}))
+	respond(c, http.StatusCreated, response)
 }
 
 // GetAllBooks godoc
 // @Summary Get all books
-// @Description Get a list of all books
+// @Description Get a list of all books, optionally filtered by genre, purpose and author. fields= selects
+// @Description the returned fields and include= embeds related resources.
 // @Tags books
 // @Accept json
-// @Produce json
+// @Produce json,xml,application/msgpack
+// @Param genre query string false "Only books of this genre"
+// @Param purpose query string false "Only books with this purpose"
+// @Param author query string false "Only books whose author contains this text, ignoring case"
+// @Param fields query string false "Comma-separated fields to return (id,title,author,genre,purpose,description,isbn)"
+// @Param include query string false "Comma-separated related resources to embed (authors,tags,ratings)"
 // @Success 200 {array} dto.BookResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /books [get]
 func (h *BookHandler) GetAllBooks(c *gin.Context) {
-	books, err := h.bookRepo.GetAll()
+	var query dto.ListBooksQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+	representation, err := bindBookRepresentation(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "Failed to get books",
-			Message: err.Error(),
-		})
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+
+	books, err := h.bookRepo.Find(bookFilter(query))
+	if err != nil {
+		AbortWithProblem(c, err)
 		return
 	}
 
@@ -99,10 +125,42 @@ func (h *BookHandler) GetAllBooks(c *gin.Context) {
 			Genre:       book.Genre,
 			Purpose:     book.Purpose,
 			Description: book.Description,
+			ISBN:        book.ISBN,
 		})
+		representation.shape(&response[len(response)-1])
+	}
+	if err := h.embed(representation, books, response); err != nil {
+		AbortWithProblem(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	respond(c, http.StatusOK, bookList(response))
+}
+
+// bookList is the book collection returned by GetAllBooks. It is a plain array in JSON
+// and MessagePack and a books element holding a book element per book in XML.
+type bookList []dto.BookResponse
+
+func (l bookList) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: "books"}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	for i := range l {
+		if err := encoder.Encode(&l[i]); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// bookFilter maps the list query parameters onto a repository filter
+func bookFilter(query dto.ListBooksQuery) models.BookFilter {
+	return models.BookFilter{
+		Genre:   query.Genre,
+		Purpose: query.Purpose,
+		Author:  query.Author,
+	}
 }
 
 // GetBookByID godoc
@@ -110,30 +168,40 @@ func (h *BookHandler) GetAllBooks(c *gin.Context) {
 // @Description Get a specific book by its ID
 // @Tags books
 // @Accept json
-// @Produce json
+// @Produce json,xml,application/msgpack
 // @Param id path int true "Book ID"
+// @Param fields query string false "Comma-separated fields to return (id,title,author,genre,purpose,description,isbn)"
+// @Param include query string false "Comma-separated related resources to embed (authors,tags,ratings)"
+// @Param If-None-Match header string false "ETag from a previous response"
 // @Success 200 {object} dto.BookResponse
+// @Header 200 {string} ETag "Current version of the book"
+// @Success 304 "Not modified"
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /books/{id} [get]
 func (h *BookHandler) GetBookByID(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Invalid ID",
-			Message: "ID must be a valid number",
-		})
+		AbortWithProblem(c, errInvalidID())
+		return
+	}
+
+	representation, err := bindBookRepresentation(c)
+	if err != nil {
+		AbortWithProblem(c, bindError(err))
 		return
 	}
 
 	book, err := h.bookRepo.GetByID(uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
-			Error:   "Book not found",
-			Message: "The requested book could not be found",
-		})
+		AbortWithProblem(c, err)
 		return
 	}
 
@@ -144,80 +212,114 @@ func (h *BookHandler) GetBookByID(c *gin.Context) {
 		Genre:       book.Genre,
 		Purpose:     book.Purpose,
 		Description: book.Description,
+		ISBN:        book.ISBN,
+	}
+	representation.shape(&response)
+	responses := []dto.BookResponse{response}
+	if err := h.embed(representation, []models.Book{*book}, responses); err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	etag := representationETag(book, negotiateFormat(c.GetHeader("Accept")), representation)
+	if representation.embeds() {
+		if etag, err = embeddedETag(etag, responses[0]); err != nil {
+			AbortWithProblem(c, err)
+			return
+		}
+	}
+	c.Header("ETag", etag)
+	// The tag depends on the format, so caches must revalidate per Accept, 304s included
+	varyAccept(c)
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		c.Status(http.StatusNotModified)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	respond(c, http.StatusOK, responses[0])
 }
 
 // UpdateBook godoc
 // @Summary Update a book
-// @Description Update a book by its ID
+// @Description Partially update a book by its ID. Accepts a plain JSON, XML or MessagePack document (only provided fields are changed),
+// @Description JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902). The resulting book must still
+// @Description satisfy the same validation rules as on creation.
 // @Tags books
-// @Accept json
-// @Produce json
+// @Accept json,xml,application/msgpack,application/merge-patch+json,application/json-patch+json
+// @Produce json,xml,application/msgpack
 // @Param id path int true "Book ID"
-// @Param book body dto.UpdateBookRequest true "Updated book information"
+// @Param If-Match header string false "ETag the update is conditional on"
+// @Param book body dto.UpdateBookRequest true "Updated book information, a merge patch or an array of dto.JSONPatchOperation"
 // @Success 200 {object} dto.BookResponse
+// @Header 200 {string} ETag "New version of the book"
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 412 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /books/{id} [patch]
 func (h *BookHandler) UpdateBook(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Invalid ID",
-			Message: "ID must be a valid number",
-		})
+		AbortWithProblem(c, errInvalidID())
 		return
 	}
 
-	var req dto.UpdateBookRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Invalid request",
-			Message: err.Error(),
-		})
+	change, err := bindBookPatch(c)
+	if err != nil {
+		AbortWithProblem(c, bindError(err))
 		return
 	}
 
-	updates := make(map[string]interface{})
-	if req.Title != nil {
-		updates["title"] = *req.Title
-	}
-	if req.Author != nil {
-		updates["author"] = *req.Author
-	}
-	if req.Genre != nil {
-		updates["genre"] = *req.Genre
-	}
-	if req.Purpose != nil {
-		updates["purpose"] = *req.Purpose
-	}
-	if req.Description != nil {
-		updates["description"] = *req.Description
-	}
+	h.applyBookChange(c, uint(id), change)
+}
 
-	book, err := h.bookRepo.Update(uint(id), updates)
+// ReplaceBook godoc
+// @Summary Replace a book
+// @Description Replace all fields of a book by its ID
+// @Tags books
+// @Accept json,xml,application/msgpack
+// @Produce json,xml,application/msgpack
+// @Param id path int true "Book ID"
+// @Param If-Match header string false "ETag the replacement is conditional on"
+// @Param book body dto.ReplaceBookRequest true "Full book information"
+// @Success 200 {object} dto.BookResponse
+// @Header 200 {string} ETag "New version of the book"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 412 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /books/{id} [put]
+func (h *BookHandler) ReplaceBook(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
-			Error:   "Book not found",
-			Message: "The requested book could not be found",
-		})
+		AbortWithProblem(c, errInvalidID())
 		return
 	}
 
-	response := dto.BookResponse{
-		ID:          book.ID,
-		Title:       book.Title,
-		Author:      book.Author,
-		Genre:       book.Genre,
-		Purpose:     book.Purpose,
-		Description: book.Description,
+	var req dto.ReplaceBookRequest
+	if err := c.ShouldBindWith(&req, sanitizedBody); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	h.applyBookChange(c, uint(id), func(dto.ReplaceBookRequest) (dto.ReplaceBookRequest, error) {
+		return req, nil
+	})
 }
 
 // DeleteBook godoc
@@ -225,30 +327,42 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 // @Description Delete a book by its ID
 // @Tags books
 // @Accept json
-// @Produce json
+// @Produce json,xml,application/msgpack
 // @Param id path int true "Book ID"
+// @Param If-Match header string false "ETag the deletion is conditional on"
 // @Success 200 {object} dto.BookResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 412 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /books/{id} [delete]
 func (h *BookHandler) DeleteBook(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Invalid ID",
-			Message: "ID must be a valid number",
-		})
+		AbortWithProblem(c, errInvalidID())
 		return
 	}
 
-	book, err := h.bookRepo.Delete(uint(id))
+	version, ok := h.ifMatchVersion(c, uint(id))
+	if !ok {
+		return
+	}
+
+	var book *models.Book
+	if version != 0 {
+		book, err = h.bookRepo.DeleteIfVersion(uint(id), version)
+	} else {
+		book, err = h.bookRepo.Delete(uint(id))
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
-			Error:   "Book not found",
-			Message: "The requested book could not be found",
-		})
+		AbortWithProblem(c, err)
 		return
 	}
 
@@ -259,39 +373,43 @@ func (h *BookHandler) DeleteBook(c *gin.Context) {
 		Genre:       book.Genre,
 		Purpose:     book.Purpose,
 		Description: book.Description,
+		ISBN:        book.ISBN,
 	}
 
-	c.JSON(http.StatusOK, response)
+	respond(c, http.StatusOK, response)
 }
 
 // RecommendBook godoc
 // @Summary Recommend a book
 // @Description Get a book recommendation based on genre and purpose
 // @Tags books
-// @Accept json
-// @Produce json
+// @Accept json,xml,application/msgpack
+// @Produce json,xml,application/msgpack
 // @Param recommendation body dto.RecommendBookRequest true "Recommendation criteria"
 // @Success 200 {object} dto.BookResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Router /books/recommend [post]
 func (h *BookHandler) RecommendBook(c *gin.Context) {
 	var req dto.RecommendBookRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Invalid request",
-			Message: err.Error(),
-		})
+	if err := c.ShouldBindWith(&req, sanitizedBody); err != nil {
+		AbortWithProblem(c, bindError(err))
 		return
 	}
 
 	book, err := h.bookRepo.FindByGenreAndPurpose(req.Genre, req.Purpose)
+	if errors.Is(err, models.ErrNotFound) {
+		AbortWithProblem(c, NewAppError(dto.CodeRecommendationNotFound))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
-			Error:   "No recommendation found",
-			Message: "No book found matching the criteria",
-		})
+		AbortWithProblem(c, err)
 		return
 	}
 
@@ -302,18 +420,8 @@ func (h *BookHandler) RecommendBook(c *gin.Context) {
 		Genre:       book.Genre,
 		Purpose:     book.Purpose,
 		Description: book.Description,
+		ISBN:        book.ISBN,
 	}
 
-	c.JSON(http.StatusOK, response)
-}
-
-// AppError represents a custom error type
-type AppError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Detail  string `json:"detail,omitempty"`
+	respond(c, http.StatusOK, response)
 }
-
-func (e *AppError) Error() string {
-	return e.Message
-} 
\ No newline at end of file
@@ -2,19 +2,31 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/iotest"
 
+	"recomemento-api-go/auth"
 	"recomemento-api-go/dto"
+	"recomemento-api-go/matchkey"
 	"recomemento-api-go/models"
+	"recomemento-api-go/testutil"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"github.com/ugorji/go/codec"
+	"github.com/xuri/excelize/v2"
 )
 
 // BookHandlerExtendedTestSuite はテストスイートを定義
@@ -43,6 +55,27 @@ func (m *MockExtendedBookDatabase) GetAll() ([]models.Book, error) {
 	return args.Get(0).([]models.Book), args.Error(1)
 }
 
+func (m *MockExtendedBookDatabase) Find(filter models.BookFilter) ([]models.Book, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.Book), args.Error(1)
+}
+
+func (m *MockExtendedBookDatabase) Search(query string) ([]models.Book, error) {
+	args := m.Called(query)
+	return args.Get(0).([]models.Book), args.Error(1)
+}
+
+func (m *MockExtendedBookDatabase) Each(filter models.BookFilter, fn func(book *models.Book) error) error {
+	args := m.Called(filter)
+	books := args.Get(0).([]models.Book)
+	for i := range books {
+		if err := fn(&books[i]); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
 func (m *MockExtendedBookDatabase) GetByID(id uint) (*models.Book, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -67,6 +100,22 @@ func (m *MockExtendedBookDatabase) Delete(id uint) (*models.Book, error) {
 	return args.Get(0).(*models.Book), args.Error(1)
 }
 
+func (m *MockExtendedBookDatabase) UpdateIfVersion(id uint, version uint, updates map[string]interface{}) (*models.Book, error) {
+	args := m.Called(id, version, updates)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (m *MockExtendedBookDatabase) DeleteIfVersion(id uint, version uint) (*models.Book, error) {
+	args := m.Called(id, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
 func (m *MockExtendedBookDatabase) FindByGenreAndPurpose(genre, purpose string) (*models.Book, error) {
 	args := m.Called(genre, purpose)
 	if args.Get(0) == nil {
@@ -75,6 +124,56 @@ func (m *MockExtendedBookDatabase) FindByGenreAndPurpose(genre, purpose string)
 	return args.Get(0).(*models.Book), args.Error(1)
 }
 
+func (m *MockExtendedBookDatabase) CountByAuthor(authors []string) (map[string]int64, error) {
+	args := m.Called(authors)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *MockExtendedBookDatabase) FindDuplicates(isbns, matchKeys []string) ([]models.Book, error) {
+	args := m.Called(isbns, matchKeys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Book), args.Error(1)
+}
+
+func (m *MockExtendedBookDatabase) SetTags(bookID uint, tags []string) error {
+	args := m.Called(bookID, tags)
+	return args.Error(0)
+}
+
+func (m *MockExtendedBookDatabase) FindTags(bookIDs []uint) (map[uint][]string, error) {
+	args := m.Called(bookIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uint][]string), args.Error(1)
+}
+
+func (m *MockExtendedBookDatabase) Rate(bookID uint, rater string, score int) error {
+	args := m.Called(bookID, rater, score)
+	return args.Error(0)
+}
+
+func (m *MockExtendedBookDatabase) SummarizeRatings(bookIDs []uint) (map[uint]models.RatingSummary, error) {
+	args := m.Called(bookIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uint]models.RatingSummary), args.Error(1)
+}
+
+func (m *MockExtendedBookDatabase) Transaction(fn func(repo models.BookDatabase) error) error {
+	args := m.Called()
+	if err := fn(m); err != nil {
+		return err
+	}
+	return args.Error(0)
+}
+
 // SetupTest は各テスト前に実行される
 func (suite *BookHandlerExtendedTestSuite) SetupTest() {
 	gin.SetMode(gin.TestMode)
@@ -85,10 +184,16 @@ func (suite *BookHandlerExtendedTestSuite) SetupTest() {
 	// ルート設定
 	suite.router.POST("/books", suite.handler.CreateBook)
 	suite.router.GET("/books", suite.handler.GetAllBooks)
+	suite.router.GET("/books/export", suite.handler.ExportBooks)
 	suite.router.GET("/books/:id", suite.handler.GetBookByID)
 	suite.router.PATCH("/books/:id", suite.handler.UpdateBook)
+	suite.router.PUT("/books/:id", suite.handler.ReplaceBook)
 	suite.router.DELETE("/books/:id", suite.handler.DeleteBook)
+	suite.router.PUT("/books/:id/tags", suite.handler.SetBookTags)
+	suite.router.PUT("/books/:id/rating", withPrincipal(&auth.Principal{Subject: "alice", Roles: []auth.Role{auth.RoleReader}}), suite.handler.RateBook)
 	suite.router.POST("/books/recommend", suite.handler.RecommendBook)
+	suite.router.POST("/books/bulk", suite.handler.BulkBooks)
+	suite.router.POST("/books/import", suite.handler.ImportBooks)
 }
 
 // ========== CreateBook Tests ==========
@@ -142,8 +247,42 @@ func (suite *BookHandlerExtendedTestSuite) TestCreateBook_ValidationError_Missin
 	var response dto.ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Invalid request", response.Error)
-	assert.Contains(suite.T(), response.Message, "Title")
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Code)
+	assert.Equal(suite.T(), http.StatusBadRequest, response.Status)
+	assert.Equal(suite.T(), "/books", response.Instance)
+	assert.Equal(suite.T(), []dto.FieldError{
+		{Field: "title", Rule: "required", Message: "title is required"},
+	}, response.Errors)
+	assert.Equal(suite.T(), "application/problem+json", w.Header().Get("Content-Type"))
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_ValidationError_Japanese() {
+	// Arrange - タイトルが欠けているリクエスト
+	req := dto.CreateBookRequest{
+		Author:      "Test Author",
+		Genre:       "Fiction",
+		Purpose:     "Entertainment",
+		Description: "Test Description",
+	}
+
+	// Act - Accept-Languageで日本語を要求
+	body, _ := json.Marshal(req)
+	w := suite.performRequestWithHeaders("POST", "/books", bytes.NewBuffer(body), map[string]string{
+		"Accept-Language": "ja-JP,ja;q=0.9,en;q=0.8",
+	})
+
+	// Assert - コードとフィールド名は言語に依存しない
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "ja", w.Header().Get("Content-Language"))
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Code)
+	assert.Equal(suite.T(), "入力内容に誤りがあります", response.Title)
+	assert.Equal(suite.T(), []dto.FieldError{
+		{Field: "title", Rule: "required", Message: "タイトルは必須です"},
+	}, response.Errors)
 }
 
 func (suite *BookHandlerExtendedTestSuite) TestCreateBook_ValidationError_AllFieldsMissing() {
@@ -160,7 +299,110 @@ func (suite *BookHandlerExtendedTestSuite) TestCreateBook_ValidationError_AllFie
 	var response dto.ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Invalid request", response.Error)
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Code)
+	assert.Len(suite.T(), response.Errors, 5)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_SanitizesFields() {
+	// Arrange - 前後の空白、HTMLタグ、制御文字を含むリクエスト
+	body := `{
+		"title": "  The <b>Great</b>\u0000 Gatsby  ",
+		"author": "F. Scott\n  Fitzgerald",
+		"genre": "Fiction",
+		"purpose": "Entertainment",
+		"description": "<script>alert(1)</script>Line 1\r\nLine 2 &amp; more\u0007"
+	}`
+
+	suite.mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Title == "The Great Gatsby" &&
+			book.Author == "F. Scott Fitzgerald" &&
+			book.Description == "Line 1\nLine 2 & more"
+	})).Return(nil)
+
+	// Act
+	w := suite.performRequest("POST", "/books", bytes.NewBufferString(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_ValidationError_WhitespaceOnlyTitle() {
+	// Arrange - 空白のみのタイトルは空文字として扱われる
+	req := dto.CreateBookRequest{
+		Title:       " \t\n ",
+		Author:      "Test Author",
+		Genre:       "Fiction",
+		Purpose:     "Entertainment",
+		Description: "Test Description",
+	}
+
+	// Act
+	body, _ := json.Marshal(req)
+	w := suite.performRequest("POST", "/books", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []dto.FieldError{
+		{Field: "title", Rule: "required", Message: "title is required"},
+	}, response.Errors)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Create", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_ValidationError_DescriptionTooLong() {
+	// Arrange - 上限は文字数で数えるため、マルチバイト文字でも2000文字までは許可される
+	req := dto.CreateBookRequest{
+		Title:       "Test Book",
+		Author:      "Test Author",
+		Genre:       "Fiction",
+		Purpose:     "Entertainment",
+		Description: strings.Repeat("あ", 2001),
+	}
+
+	// Act
+	body, _ := json.Marshal(req)
+	w := suite.performRequest("POST", "/books", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []dto.FieldError{
+		{Field: "description", Rule: "maxlen", Param: "2000", Message: "description must be at most 2000 characters"},
+	}, response.Errors)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_ConfiguredFieldLimits() {
+	// Arrange - 上限を変更できることを確認（他のテストに影響しないよう元に戻す）
+	SetFieldLimits(FieldLimits{Title: 5})
+	defer SetFieldLimits(DefaultFieldLimits)
+
+	req := dto.CreateBookRequest{
+		Title:       "Too long",
+		Author:      "Test Author",
+		Genre:       "Fiction",
+		Purpose:     "Entertainment",
+		Description: "Test Description",
+	}
+
+	// Act
+	body, _ := json.Marshal(req)
+	w := suite.performRequest("POST", "/books", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "maxlen", response.Errors[0].Rule)
+	assert.Equal(suite.T(), "5", response.Errors[0].Param)
 }
 
 func (suite *BookHandlerExtendedTestSuite) TestCreateBook_InvalidJSON() {
@@ -173,7 +415,52 @@ func (suite *BookHandlerExtendedTestSuite) TestCreateBook_InvalidJSON() {
 	var response dto.ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Invalid request", response.Error)
+	assert.Equal(suite.T(), dto.CodeInvalidRequest, response.Code)
+	assert.Empty(suite.T(), response.Errors)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBookBodies_TooLarge() {
+	// 上限を超える長さの文字列のキーを持つ MessagePack のマップ
+	msgpackPrefix := []byte{0x81, 0xdb, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msgpackPrefix[2:], maxBodyBytes+1)
+
+	for _, tt := range []struct {
+		name, method, url, contentType string
+		prefix                         []byte
+	}{
+		{"作成 XML", "POST", "/books", "application/xml", nil},
+		{"作成 MessagePack", "POST", "/books", "application/msgpack", msgpackPrefix},
+		{"置換 JSON", "PUT", "/books/1", "application/json", nil},
+		{"部分更新 JSON", "PATCH", "/books/1", "application/json", nil},
+		{"JSON Merge Patch", "PATCH", "/books/1", mimeMergePatch, nil},
+		{"JSON Patch", "PATCH", "/books/1", mimeJSONPatch, nil},
+	} {
+		suite.Run(tt.name, func() {
+			body := io.MultiReader(bytes.NewReader(tt.prefix), io.LimitReader(repeatReader(' '), maxBodyBytes+1))
+			req := httptest.NewRequest(tt.method, tt.url, body)
+			req.Header.Set("Content-Type", tt.contentType)
+			req.ContentLength = -1
+
+			w := httptest.NewRecorder()
+			suite.router.ServeHTTP(w, req)
+
+			assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code)
+			testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeRequestTooLarge,
+				"The request body exceeds the limit of 1048576 bytes")
+		})
+	}
+
+	suite.Run("Content-Lengthが上限を超える", func() {
+		req := httptest.NewRequest("POST", "/books", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = maxBodyBytes + 1
+
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code)
+	})
+	suite.mockRepo.AssertNotCalled(suite.T(), "Create", mock.Anything)
 }
 
 func (suite *BookHandlerExtendedTestSuite) TestCreateBook_DatabaseError() {
@@ -198,8 +485,8 @@ func (suite *BookHandlerExtendedTestSuite) TestCreateBook_DatabaseError() {
 	var response dto.ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Failed to create book", response.Error)
-	assert.Equal(suite.T(), "database error", response.Message)
+	assert.Equal(suite.T(), dto.CodeInternalError, response.Code)
+	assert.NotContains(suite.T(), response.Detail, "database error") // 内部エラーの詳細はクライアントに返さない
 }
 
 // ========== GetBookByID Tests ==========
@@ -236,13 +523,13 @@ func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_InvalidID() {
 	var response dto.ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Invalid ID", response.Error)
-	assert.Equal(suite.T(), "ID must be a valid number", response.Message)
+	assert.Equal(suite.T(), dto.CodeInvalidID, response.Code)
+	assert.Equal(suite.T(), "ID must be a valid number", response.Detail)
 }
 
 func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_NotFound() {
 	// Arrange
-	suite.mockRepo.On("GetByID", uint(999)).Return(nil, errors.New("record not found"))
+	suite.mockRepo.On("GetByID", uint(999)).Return(nil, models.ErrNotFound)
 
 	// Act
 	w := suite.performRequest("GET", "/books/999", nil)
@@ -253,7 +540,129 @@ func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_NotFound() {
 	var response dto.ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Book not found", response.Error)
+	assert.Equal(suite.T(), dto.CodeBookNotFound, response.Code)
+	assert.Equal(suite.T(), "urn:recomemento:problem:BOOK_NOT_FOUND", response.Type)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_DatabaseError() {
+	// Arrange - DB障害は404ではなく500として扱う
+	suite.mockRepo.On("GetByID", uint(1)).Return(nil, errors.New("database is locked"))
+
+	// Act
+	w := suite.performRequest("GET", "/books/1", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), dto.CodeInternalError, response.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_ReturnsETag() {
+	// Arrange
+	book := &models.Book{ID: 1, Title: "Test Book", Version: 3}
+	suite.mockRepo.On("GetByID", uint(1)).Return(book, nil)
+
+	// Act
+	w := suite.performRequest("GET", "/books/1", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `"1-3"`, w.Header().Get("ETag"))
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_IfNoneMatch_NotModified() {
+	// Arrange
+	book := &models.Book{ID: 1, Title: "Test Book", Version: 3}
+	suite.mockRepo.On("GetByID", uint(1)).Return(book, nil)
+
+	// Act - 弱いETagでも一致すれば304
+	req := httptest.NewRequest("GET", "/books/1", nil)
+	req.Header.Set("If-None-Match", `W/"1-3"`)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusNotModified, w.Code)
+	assert.Empty(suite.T(), w.Body.String())
+	assert.Equal(suite.T(), `"1-3"`, w.Header().Get("ETag"))
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_IfNoneMatch_VariesByAccept() {
+	// Arrange
+	book := &models.Book{ID: 1, Title: "Test Book", Version: 3}
+	suite.mockRepo.On("GetByID", uint(1)).Return(book, nil)
+
+	// Act - 304でもAcceptで変わることを示す
+	w := suite.performRequestWithHeaders("GET", "/books/1", nil, map[string]string{"If-None-Match": `"1-3"`})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusNotModified, w.Code)
+	assert.Equal(suite.T(), []string{"Accept"}, w.Header().Values("Vary"))
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_ETagPerRepresentation() {
+	// Arrange
+	book := &models.Book{ID: 1, Title: "Test Book", Version: 3}
+	suite.mockRepo.On("GetByID", uint(1)).Return(book, nil)
+
+	// Act - 形式やフィールドが違えば別のETagになる
+	xml := suite.performRequestWithHeaders("GET", "/books/1", nil, map[string]string{"Accept": "application/xml"})
+	fields := suite.performRequest("GET", "/books/1?fields=title,id", nil)
+	reordered := suite.performRequest("GET", "/books/1?fields=id,title", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, xml.Code)
+	assert.Regexp(suite.T(), `^"1-3-[0-9a-f]{8}"$`, xml.Header().Get("ETag"))
+	assert.Regexp(suite.T(), `^"1-3-[0-9a-f]{8}"$`, fields.Header().Get("ETag"))
+	assert.NotEqual(suite.T(), xml.Header().Get("ETag"), fields.Header().Get("ETag"))
+	assert.Equal(suite.T(), fields.Header().Get("ETag"), reordered.Header().Get("ETag"))
+	assert.Equal(suite.T(), []string{"Accept"}, xml.Header().Values("Vary"))
+
+	// Act - JSONのETagではXMLの表現は304にならない
+	w := suite.performRequestWithHeaders("GET", "/books/1", nil, map[string]string{"Accept": "application/xml", "If-None-Match": `"1-3"`})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotEmpty(suite.T(), w.Body.String())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUnknownRoute_ProblemResponse() {
+	// Arrange
+	suite.router.NoRoute(RouteNotFound)
+
+	// Act
+	w := suite.performRequest("GET", "/unknown", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), "application/problem+json", w.Header().Get("Content-Type"))
+	testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeRouteNotFound, "No route matches GET /unknown")
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_NotFound_Japanese() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(999)).Return(nil, models.ErrNotFound)
+
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books/999", nil, map[string]string{"Accept-Language": "ja"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), "ja", w.Header().Get("Content-Language"))
+	testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeBookNotFound, "指定された本は存在しません")
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_UnsupportedLanguage_FallsBackToEnglish() {
+	// Act - 未対応の言語は英語にフォールバック
+	w := suite.performRequestWithHeaders("GET", "/books/abc", nil, map[string]string{"Accept-Language": "fr-FR"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "en", w.Header().Get("Content-Language"))
+	testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeInvalidID, "ID must be a valid number")
 }
 
 func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_NegativeID() {
@@ -273,7 +682,7 @@ func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_Success() {
 		{ID: 2, Title: "Book 2", Author: "Author 2", Genre: "Technology", Purpose: "Learning", Description: "Description 2"},
 	}
 	
-	suite.mockRepo.On("GetAll").Return(expectedBooks, nil)
+	suite.mockRepo.On("Find", models.BookFilter{}).Return(expectedBooks, nil)
 
 	// Act
 	w := suite.performRequest("GET", "/books", nil)
@@ -292,7 +701,7 @@ func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_Success() {
 func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_EmptyResult() {
 	// Arrange
 	emptyBooks := []models.Book{}
-	suite.mockRepo.On("GetAll").Return(emptyBooks, nil)
+	suite.mockRepo.On("Find", models.BookFilter{}).Return(emptyBooks, nil)
 
 	// Act
 	w := suite.performRequest("GET", "/books", nil)
@@ -308,7 +717,7 @@ func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_EmptyResult() {
 
 func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_DatabaseError() {
 	// Arrange
-	suite.mockRepo.On("GetAll").Return([]models.Book{}, errors.New("database connection failed"))
+	suite.mockRepo.On("Find", models.BookFilter{}).Return([]models.Book{}, errors.New("database connection failed"))
 
 	// Act
 	w := suite.performRequest("GET", "/books", nil)
@@ -319,20 +728,38 @@ func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_DatabaseError() {
 	var response dto.ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Failed to get books", response.Error)
+	assert.Equal(suite.T(), dto.CodeInternalError, response.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_Filters() {
+	// Arrange
+	filter := models.BookFilter{Genre: "Fiction", Purpose: "Entertainment", Author: "smith"}
+	suite.mockRepo.On("Find", filter).Return([]models.Book{*suite.sampleBook()}, nil)
+
+	// Act
+	w := suite.performRequest("GET", "/books?genre=Fiction&purpose=Entertainment&author=smith", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockRepo.AssertExpectations(suite.T())
 }
 
 // ========== UpdateBook Tests ==========
 
 func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_Success() {
 	// Arrange
+	originalBook := &models.Book{
+		ID: 1, Title: "Original Title", Author: "Original Author",
+		Genre: "Fiction", Purpose: "Entertainment", Description: "Original Description", Version: 1,
+	}
 	updatedBook := &models.Book{
 		ID: 1, Title: "Updated Title", Author: "Original Author",
-		Genre: "Fiction", Purpose: "Entertainment", Description: "Original Description",
+		Genre: "Fiction", Purpose: "Entertainment", Description: "Original Description", Version: 2,
 	}
 	
 	updates := map[string]interface{}{"title": "Updated Title"}
-	suite.mockRepo.On("Update", uint(1), updates).Return(updatedBook, nil)
+	suite.mockRepo.On("GetByID", uint(1)).Return(originalBook, nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), updates).Return(updatedBook, nil)
 
 	updateReq := dto.UpdateBookRequest{
 		Title: stringPointer("Updated Title"),
@@ -354,7 +781,7 @@ func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_Success() {
 
 func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_NotFound() {
 	// Arrange
-	suite.mockRepo.On("Update", uint(999), mock.Anything).Return(nil, errors.New("record not found"))
+	suite.mockRepo.On("GetByID", uint(999)).Return(nil, models.ErrNotFound)
 
 	updateReq := dto.UpdateBookRequest{
 		Title: stringPointer("Updated Title"),
@@ -368,52 +795,398 @@ func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_NotFound() {
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
 }
 
-// ========== DeleteBook Tests ==========
-
-func (suite *BookHandlerExtendedTestSuite) TestDeleteBook_Success() {
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_DatabaseError() {
 	// Arrange
-	deletedBook := &models.Book{
-		ID: 1, Title: "Book to Delete", Author: "Author",
-		Genre: "Fiction", Purpose: "Entertainment", Description: "Description",
-	}
-	
-	suite.mockRepo.On("Delete", uint(1)).Return(deletedBook, nil)
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), mock.Anything).Return(nil, errors.New("disk I/O error"))
 
 	// Act
-	w := suite.performRequest("DELETE", "/books/1", nil)
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("Updated Title")})
+	w := suite.performRequest("PATCH", "/books/1", bytes.NewBuffer(body))
 
 	// Assert
-	assert.Equal(suite.T(), http.StatusOK, w.Code)
-	
-	var response dto.BookResponse
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), deletedBook.Title, response.Title)
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
 }
 
-// ========== RecommendBook Tests ==========
-
-func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_Success() {
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_ConstraintViolation() {
 	// Arrange
-	recommendedBook := &models.Book{
-		ID: 1, Title: "Recommended Book", Author: "Author",
-		Genre: "Fiction", Purpose: "Entertainment", Description: "Description",
-	}
-	
-	suite.mockRepo.On("FindByGenreAndPurpose", "Fiction", "Entertainment").Return(recommendedBook, nil)
-
-	recommendReq := dto.RecommendBookRequest{
-		Genre:   "Fiction",
-		Purpose: "Entertainment",
-	}
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), mock.Anything).Return(nil, models.ErrValidation)
 
 	// Act
-	body, _ := json.Marshal(recommendReq)
-	w := suite.performRequest("POST", "/books/recommend", bytes.NewBuffer(body))
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("Updated Title")})
+	w := suite.performRequest("PATCH", "/books/1", bytes.NewBuffer(body))
 
 	// Assert
-	assert.Equal(suite.T(), http.StatusOK, w.Code)
-	
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_EmptyRequiredField() {
+	// Arrange - 必須フィールドを空文字にするPATCHは拒否される
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+
+	// Act
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("")})
+	w := suite.performRequest("PATCH", "/books/1", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockRepo.AssertNotCalled(suite.T(), "UpdateIfVersion", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_MergePatch() {
+	// Arrange
+	updatedBook := suite.sampleBook()
+	updatedBook.Genre = "Classic"
+	updatedBook.Version = 2
+
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), map[string]interface{}{"genre": "Classic"}).Return(updatedBook, nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBufferString(`{"genre": "Classic"}`),
+		map[string]string{"Content-Type": "application/merge-patch+json"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_MergePatch_NullClearsRequiredField() {
+	// Arrange - null はフィールドの削除を意味するが、必須項目なので拒否される
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBufferString(`{"description": null}`),
+		map[string]string{"Content-Type": "application/merge-patch+json"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "description", response.Errors[0].Field)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_SanitizesFields() {
+	// Arrange - PATCHでも作成時と同じ正規化が行われる
+	updatedBook := suite.sampleBook()
+	updatedBook.Title = "New Title"
+	updatedBook.Version = 2
+
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), map[string]interface{}{"title": "New Title"}).Return(updatedBook, nil)
+
+	// Act
+	w := suite.performRequest("PATCH", "/books/1", bytes.NewBufferString(`{"title": "  <i>New</i>   Title "}`))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_MergePatch_TitleTooLong() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	patch, _ := json.Marshal(map[string]string{"title": strings.Repeat("a", 201)})
+
+	// Act
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBuffer(patch),
+		map[string]string{"Content-Type": "application/merge-patch+json"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "title", response.Errors[0].Field)
+	assert.Equal(suite.T(), "maxlen", response.Errors[0].Rule)
+	suite.mockRepo.AssertNotCalled(suite.T(), "UpdateIfVersion", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_JSONPatch() {
+	// Arrange
+	updatedBook := suite.sampleBook()
+	updatedBook.Title = "New Title"
+	updatedBook.Version = 2
+
+	updates := map[string]interface{}{"title": "New Title"}
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), updates).Return(updatedBook, nil)
+
+	// Act
+	patch := `[{"op": "test", "path": "/title", "value": "Original Title"}, {"op": "replace", "path": "/title", "value": "New Title"}]`
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBufferString(patch),
+		map[string]string{"Content-Type": "application/json-patch+json"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_JSONPatch_FailedTest() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+
+	// Act
+	patch := `[{"op": "test", "path": "/title", "value": "Someone Else's Title"}, {"op": "replace", "path": "/title", "value": "New Title"}]`
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBufferString(patch),
+		map[string]string{"Content-Type": "application/json-patch+json"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+	suite.mockRepo.AssertNotCalled(suite.T(), "UpdateIfVersion", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_JSONPatch_UnknownField() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+
+	// Act
+	patch := `[{"op": "add", "path": "/publisher", "value": "Scribner"}]`
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBufferString(patch),
+		map[string]string{"Content-Type": "application/json-patch+json"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_RetriesAfterConcurrentWrite() {
+	// Arrange - If-Match なしの場合は再読込して再適用する
+	current := suite.sampleBook()
+	reread := suite.sampleBook()
+	reread.Version = 2
+	updatedBook := suite.sampleBook()
+	updatedBook.Title = "Updated Title"
+	updatedBook.Version = 3
+
+	updates := map[string]interface{}{"title": "Updated Title"}
+	suite.mockRepo.On("GetByID", uint(1)).Return(current, nil).Once()
+	suite.mockRepo.On("GetByID", uint(1)).Return(reread, nil).Once()
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), updates).Return(nil, models.ErrVersionMismatch)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(2), updates).Return(updatedBook, nil)
+
+	// Act
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("Updated Title")})
+	w := suite.performRequest("PATCH", "/books/1", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `"1-3"`, w.Header().Get("ETag"))
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// ========== ReplaceBook Tests ==========
+
+func (suite *BookHandlerExtendedTestSuite) TestReplaceBook_Success() {
+	// Arrange
+	req := dto.ReplaceBookRequest{
+		Title: "Replaced Title", Author: "Replaced Author", Genre: "Fiction",
+		Purpose: "Entertainment", Description: "Original Description",
+	}
+	replacedBook := &models.Book{
+		ID: 1, Title: req.Title, Author: req.Author, Genre: req.Genre,
+		Purpose: req.Purpose, Description: req.Description, Version: 2,
+	}
+
+	updates := map[string]interface{}{"title": "Replaced Title", "author": "Replaced Author"}
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), updates).Return(replacedBook, nil)
+
+	// Act
+	body, _ := json.Marshal(req)
+	w := suite.performRequest("PUT", "/books/1", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response dto.BookResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "Replaced Title", response.Title)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestReplaceBook_MissingField() {
+	// Arrange - PUTは全フィールドが必須
+	req := dto.ReplaceBookRequest{Title: "Only Title"}
+
+	// Act
+	body, _ := json.Marshal(req)
+	w := suite.performRequest("PUT", "/books/1", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.mockRepo.AssertNotCalled(suite.T(), "GetByID", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_IfMatch_Success() {
+	// Arrange
+	current := suite.sampleBook()
+	current.Version = 2
+	updatedBook := suite.sampleBook()
+	updatedBook.Title = "Updated Title"
+	updatedBook.Version = 3
+
+	updates := map[string]interface{}{"title": "Updated Title"}
+	suite.mockRepo.On("GetByID", uint(1)).Return(current, nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(2), updates).Return(updatedBook, nil)
+
+	// Act
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("Updated Title")})
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBuffer(body), map[string]string{"If-Match": `"1-2"`})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `"1-3"`, w.Header().Get("ETag"))
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_IfMatch_RepresentationETag() {
+	// Arrange - XMLやfields=で取得した表現のETagも同じ版として一致する
+	current := suite.sampleBook()
+	current.Version = 2
+	updatedBook := suite.sampleBook()
+	updatedBook.Version = 3
+	suite.mockRepo.On("GetByID", uint(1)).Return(current, nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(2), mock.Anything).Return(updatedBook, nil)
+	etag := representationETag(current, formatXML, bookRepresentation{})
+
+	// Act
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("Updated Title")})
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBuffer(body), map[string]string{"If-Match": etag})
+	stale := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBuffer(body), map[string]string{"If-Match": `"1-1-0123abcd", W/"1-2"`})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, stale.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_IfMatch_PreconditionFailed() {
+	// Arrange - 別のタブで既に更新されている
+	current := suite.sampleBook()
+	current.Title = "Changed Elsewhere"
+	current.Version = 3
+	suite.mockRepo.On("GetByID", uint(1)).Return(current, nil)
+
+	// Act
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("Updated Title")})
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBuffer(body), map[string]string{"If-Match": `"1-2"`})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+	suite.mockRepo.AssertNotCalled(suite.T(), "UpdateIfVersion", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_IfMatch_LostRace() {
+	// Arrange - 取得後、書き込み前に他のリクエストが更新した
+	current := suite.sampleBook()
+	current.Version = 2
+	suite.mockRepo.On("GetByID", uint(1)).Return(current, nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(2), mock.Anything).Return(nil, models.ErrVersionMismatch)
+
+	// Act
+	body, _ := json.Marshal(dto.UpdateBookRequest{Title: stringPointer("Updated Title")})
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBuffer(body), map[string]string{"If-Match": `"1-2"`})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+}
+
+// ========== DeleteBook Tests ==========
+
+func (suite *BookHandlerExtendedTestSuite) TestDeleteBook_Success() {
+	// Arrange
+	deletedBook := &models.Book{
+		ID: 1, Title: "Book to Delete", Author: "Author",
+		Genre: "Fiction", Purpose: "Entertainment", Description: "Description",
+	}
+	
+	suite.mockRepo.On("Delete", uint(1)).Return(deletedBook, nil)
+
+	// Act
+	w := suite.performRequest("DELETE", "/books/1", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	
+	var response dto.BookResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), deletedBook.Title, response.Title)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestDeleteBook_NotFound() {
+	// Arrange
+	suite.mockRepo.On("Delete", uint(999)).Return(nil, models.ErrNotFound)
+
+	// Act
+	w := suite.performRequest("DELETE", "/books/999", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestDeleteBook_DatabaseError() {
+	// Arrange
+	suite.mockRepo.On("Delete", uint(1)).Return(nil, errors.New("database is locked"))
+
+	// Act
+	w := suite.performRequest("DELETE", "/books/1", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestDeleteBook_ConcurrentModification() {
+	// Arrange - If-Match なしの削除が同時更新と競合した
+	suite.mockRepo.On("Delete", uint(1)).Return(nil, models.ErrVersionMismatch)
+
+	// Act
+	w := suite.performRequest("DELETE", "/books/1", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestDeleteBook_IfMatch_PreconditionFailed() {
+	// Arrange
+	current := &models.Book{ID: 1, Title: "Book to Delete", Version: 5}
+	suite.mockRepo.On("GetByID", uint(1)).Return(current, nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("DELETE", "/books/1", nil, map[string]string{"If-Match": `"1-4"`})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+	suite.mockRepo.AssertNotCalled(suite.T(), "DeleteIfVersion", mock.Anything, mock.Anything)
+}
+
+// ========== RecommendBook Tests ==========
+
+func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_Success() {
+	// Arrange
+	recommendedBook := &models.Book{
+		ID: 1, Title: "Recommended Book", Author: "Author",
+		Genre: "Fiction", Purpose: "Entertainment", Description: "Description",
+	}
+	
+	suite.mockRepo.On("FindByGenreAndPurpose", "Fiction", "Entertainment").Return(recommendedBook, nil)
+
+	recommendReq := dto.RecommendBookRequest{
+		Genre:   "Fiction",
+		Purpose: "Entertainment",
+	}
+
+	// Act
+	body, _ := json.Marshal(recommendReq)
+	w := suite.performRequest("POST", "/books/recommend", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	
 	var response dto.BookResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(suite.T(), err)
@@ -422,7 +1195,7 @@ func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_Success() {
 
 func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_NotFound() {
 	// Arrange
-	suite.mockRepo.On("FindByGenreAndPurpose", "NonExistent", "Purpose").Return(nil, errors.New("record not found"))
+	suite.mockRepo.On("FindByGenreAndPurpose", "NonExistent", "Purpose").Return(nil, models.ErrNotFound)
 
 	recommendReq := dto.RecommendBookRequest{
 		Genre:   "NonExistent",
@@ -437,6 +1210,23 @@ func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_NotFound() {
 	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
 }
 
+func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_DatabaseError() {
+	// Arrange
+	suite.mockRepo.On("FindByGenreAndPurpose", "Fiction", "Entertainment").Return(nil, errors.New("connection refused"))
+
+	recommendReq := dto.RecommendBookRequest{
+		Genre:   "Fiction",
+		Purpose: "Entertainment",
+	}
+
+	// Act
+	body, _ := json.Marshal(recommendReq)
+	w := suite.performRequest("POST", "/books/recommend", bytes.NewBuffer(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
 func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_ValidationError() {
 	// Arrange - 必須フィールドが欠けている
 	recommendReq := dto.RecommendBookRequest{
@@ -452,20 +1242,1175 @@ func (suite *BookHandlerExtendedTestSuite) TestRecommendBook_ValidationError() {
 	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
 }
 
-// ========== Helper Functions ==========
+// ========== BulkBooks Tests ==========
 
-func (suite *BookHandlerExtendedTestSuite) performRequest(method, url string, body *bytes.Buffer) *httptest.ResponseRecorder {
-	var req *http.Request
-	if body != nil {
-		req = httptest.NewRequest(method, url, body)
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req = httptest.NewRequest(method, url, nil)
-	}
-	
-	w := httptest.NewRecorder()
-	suite.router.ServeHTTP(w, req)
-	return w
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_Atomic_Success() {
+	// Arrange
+	updatedBook := suite.sampleBook()
+	updatedBook.Title = "New Title"
+	updatedBook.Version = 2
+
+	suite.mockRepo.On("Transaction").Return(nil)
+	suite.mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool { return book.Title == "Created" })).Return(nil)
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), map[string]interface{}{"title": "New Title"}).Return(updatedBook, nil)
+	suite.mockRepo.On("DeleteIfVersion", uint(2), uint(3)).Return(&models.Book{ID: 2, Title: "Deleted", Version: 3}, nil)
+
+	body := `{"operations": [
+		{"op": "create", "book": {"title": " Created ", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "Description"}},
+		{"op": "update", "id": 1, "book": {"title": "New Title"}},
+		{"op": "delete", "id": 2, "version": 3}
+	]}`
+
+	// Act
+	w := suite.performRequest("POST", "/books/bulk", bytes.NewBufferString(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response dto.BulkResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), dto.BulkModeAtomic, response.Mode)
+	assert.Equal(suite.T(), 3, response.Succeeded)
+	assert.Equal(suite.T(), 0, response.Failed)
+	assert.Equal(suite.T(), http.StatusCreated, response.Results[0].Status)
+	assert.Equal(suite.T(), "Created", response.Results[0].Book.Title)
+	assert.Equal(suite.T(), http.StatusOK, response.Results[1].Status)
+	assert.Equal(suite.T(), uint(2), response.Results[1].Version)
+	assert.Equal(suite.T(), "delete", response.Results[2].Op)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_Atomic_InvalidItemSkipsTransaction() {
+	// Arrange - 2番目の操作が不正なので、トランザクションを開始せずに全て中止
+	body := `{"operations": [
+		{"op": "delete", "id": 1},
+		{"op": "create", "book": {"title": "Missing fields"}},
+		{"op": "delete", "id": 2}
+	]}`
+
+	// Act
+	w := suite.performRequest("POST", "/books/bulk", bytes.NewBufferString(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+
+	var response dto.BulkResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, response.Failed)
+	assert.Equal(suite.T(), http.StatusFailedDependency, response.Results[0].Status)
+	assert.Equal(suite.T(), dto.CodeBulkAborted, response.Results[0].Error.Code)
+	assert.Equal(suite.T(), "Not applied because operation 1 failed and the bulk request was rolled back", response.Results[0].Error.Detail)
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Results[1].Error.Code)
+	assert.Equal(suite.T(), "/books/bulk#/operations/1", response.Results[1].Error.Instance)
+	assert.Equal(suite.T(), "book.author", response.Results[1].Error.Errors[0].Field)
+	assert.Equal(suite.T(), dto.CodeBulkAborted, response.Results[2].Error.Code)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Transaction")
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_BestEffort_PartialFailure() {
+	// Arrange
+	suite.mockRepo.On("Delete", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("Delete", uint(999)).Return(nil, models.ErrNotFound)
+	suite.mockRepo.On("DeleteIfVersion", uint(2), uint(1)).Return(nil, models.ErrVersionMismatch)
+
+	body := `{"mode": "best_effort", "operations": [
+		{"op": "delete", "id": 1},
+		{"op": "delete", "id": 999},
+		{"op": "delete", "id": 2, "version": 1},
+		{"op": "archive", "id": 3}
+	]}`
+
+	// Act
+	w := suite.performRequest("POST", "/books/bulk", bytes.NewBufferString(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+
+	var response dto.BulkResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, response.Succeeded)
+	assert.Equal(suite.T(), 3, response.Failed)
+	assert.Equal(suite.T(), http.StatusOK, response.Results[0].Status)
+	assert.Equal(suite.T(), dto.CodeBookNotFound, response.Results[1].Error.Code)
+	assert.Equal(suite.T(), dto.CodePreconditionFailed, response.Results[2].Error.Code)
+	assert.Equal(suite.T(), "op", response.Results[3].Error.Errors[0].Field)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Transaction")
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_TooManyOperations() {
+	// Arrange
+	operations := make([]string, 1001)
+	for i := range operations {
+		operations[i] = `{"op": "delete", "id": 1}`
+	}
+	body := `{"operations": [` + strings.Join(operations, ",") + `]}`
+
+	// Act
+	w := suite.performRequest("POST", "/books/bulk", bytes.NewBufferString(body))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	var response dto.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []dto.FieldError{
+		{Field: "operations", Rule: "max", Param: "1000", Message: "operations must contain at most 1000 entries"},
+	}, response.Errors)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_TooLarge() {
+	suite.Run("Content-Lengthが上限を超える", func() {
+		req := httptest.NewRequest("POST", "/books/bulk", strings.NewReader(`{"operations": []}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = maxBulkBytes + 1
+
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code)
+		testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeRequestTooLarge,
+			"The request body exceeds the limit of 16777216 bytes")
+	})
+
+	// 上限を超える長さの文字列のキーを持つ MessagePack のマップ
+	msgpackPrefix := []byte{0x81, 0xdb, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msgpackPrefix[2:], maxBulkBytes+1)
+	for _, tt := range []struct {
+		name, contentType string
+		prefix            []byte
+	}{
+		{"JSON", "application/json", nil},
+		{"XML", "application/xml", nil},
+		{"MessagePack", "application/msgpack", msgpackPrefix},
+	} {
+		contentType := tt.contentType
+		suite.Run("長さのわからない本文が上限を超える "+tt.name, func() {
+			// 操作数の検証より前に、読み込む量で打ち切る
+			body := io.MultiReader(bytes.NewReader(tt.prefix), io.LimitReader(repeatReader(' '), maxBulkBytes+1))
+			req := httptest.NewRequest("POST", "/books/bulk", body)
+			req.Header.Set("Content-Type", contentType)
+			req.ContentLength = -1
+
+			w := httptest.NewRecorder()
+			suite.router.ServeHTTP(w, req)
+
+			assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code)
+		})
+	}
+}
+
+// ========== ImportBooks Tests ==========
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_CSV() {
+	// Arrange - 既存の本とISBN・正規化したタイトルと著者で重複を判定する
+	existing := []models.Book{
+		{ID: 1, Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", ISBN: "9780743273565",
+			MatchKey: matchkey.Book("The Great Gatsby", "F. Scott Fitzgerald")},
+		{ID: 2, Title: "Clean Code", Author: "Robert C. Martin", MatchKey: matchkey.Book("Clean Code", "Robert C. Martin")},
+	}
+	// 既存の本は全件ではなく、行のISBNと鍵で検索する
+	suite.mockRepo.On("FindDuplicates", []string{"9780451524935", "9780743273565"}, mock.MatchedBy(func(keys []string) bool {
+		return len(keys) == 5 && keys[2] == matchkey.Book("Clean Code", "Robert C Martin")
+	})).Return(existing, nil)
+	suite.mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Title == "1984" && book.ISBN == "9780451524935"
+	})).Return(nil)
+
+	csv := "Title,Author,Genre,Purpose,Description,ISBN,Notes\n" +
+		"1984,George Orwell,Fiction,Entertainment,Dystopia,978-0-451-52493-5,ignored\n" +
+		"Another Gatsby,Someone,Fiction,Entertainment,Same ISBN,978-0-7432-7356-5,\n" +
+		"CLEAN  CODE,\"Robert C Martin\",Technology,Learning,Same title and author,,\n" +
+		",Nobody,Fiction,Entertainment,No title,,\n" +
+		"1984,George Orwell,Fiction,Entertainment,Repeated row,,\n"
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/import", bytes.NewBufferString(csv),
+		map[string]string{"Content-Type": "text/csv"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var report dto.ImportReport
+	err := json.Unmarshal(w.Body.Bytes(), &report)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), report.DryRun)
+	assert.Equal(suite.T(), 5, report.Total)
+	assert.Equal(suite.T(), 1, report.Created)
+	assert.Equal(suite.T(), 3, report.Duplicates)
+	assert.Equal(suite.T(), 1, report.Invalid)
+
+	assert.Len(suite.T(), report.Rows, 4)
+	assert.Equal(suite.T(), uint(1), report.Rows[0].DuplicateOf)
+	assert.Equal(suite.T(), 3, report.Rows[0].Line)
+	assert.Equal(suite.T(), uint(2), report.Rows[1].DuplicateOf)
+	assert.Equal(suite.T(), dto.ImportStatusInvalid, report.Rows[2].Status)
+	assert.Equal(suite.T(), "title", report.Rows[2].Errors[0].Field)
+	assert.Equal(suite.T(), 2, report.Rows[3].DuplicateOfLine)
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "Create", 1)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_NDJSON_DryRun() {
+	// Arrange
+	suite.mockRepo.On("FindDuplicates", mock.Anything, mock.Anything).Return([]models.Book{}, nil)
+
+	ndjson := `{"title": "Book A", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "A"}
+
+{"title": "Book B", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "B", "isbn": "123"}
+not json
+`
+
+	// Act - dry_runでは作成しない
+	w := suite.performRequestWithHeaders("POST", "/books/import?format=ndjson&dry_run=true", bytes.NewBufferString(ndjson),
+		map[string]string{"Accept-Language": "ja"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var report dto.ImportReport
+	err := json.Unmarshal(w.Body.Bytes(), &report)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), report.DryRun)
+	assert.Equal(suite.T(), 3, report.Total)
+	assert.Equal(suite.T(), 1, report.Created)
+	assert.Equal(suite.T(), 2, report.Invalid)
+	assert.Equal(suite.T(), 3, report.Rows[0].Line)
+	assert.Equal(suite.T(), "isbn", report.Rows[0].Errors[0].Field)
+	assert.Equal(suite.T(), "ISBNはISBN-10またはISBN-13の形式で入力してください", report.Rows[0].Errors[0].Message)
+	assert.Equal(suite.T(), 4, report.Rows[1].Line)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Create", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_MissingColumns() {
+	// Act
+	w := suite.performRequest("POST", "/books/import?format=csv", bytes.NewBufferString("title,author\nA,B\n"))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeInvalidImport,
+		"The header is missing the required columns: genre, purpose, description")
+	suite.mockRepo.AssertNotCalled(suite.T(), "FindDuplicates", mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_UnsupportedFormat() {
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/import", bytes.NewBufferString("<books/>"),
+		map[string]string{"Content-Type": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusUnsupportedMediaType, w.Code)
+	testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeUnsupportedFormat,
+		`Format "application/xml" is not supported; use one of csv, ndjson, marc, marcxml, dc, onix`)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_MARC() {
+	// Arrange
+	data, err := encodeISO2709(marcFromBook(&models.Book{
+		Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", Genre: "Fiction",
+		Purpose: "Entertainment", Description: "A classic", ISBN: "9780743273565",
+	}))
+	suite.Require().NoError(err)
+	suite.mockRepo.On("FindDuplicates", mock.Anything, mock.Anything).Return([]models.Book{}, nil)
+	suite.mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Title == "The Great Gatsby" && book.ISBN == "9780743273565"
+	})).Return(nil)
+
+	// Act: フォーマットは Content-Type から判定
+	w := suite.performRequestWithHeaders("POST", "/books/import", bytes.NewBuffer(data),
+		map[string]string{"Content-Type": "application/marc"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"created":1`)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_ONIXMissingPurpose() {
+	// Arrange: 目的（Audience）のない出版社データは検証エラーになる
+	onix := `<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+<Product>
+  <RecordReference>1</RecordReference>
+  <DescriptiveDetail>
+    <TitleDetail><TitleType>01</TitleType><TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>Title</TitleText></TitleElement></TitleDetail>
+    <Contributor><ContributorRole>A01</ContributorRole><PersonName>Author</PersonName></Contributor>
+    <Subject><SubjectSchemeIdentifier>20</SubjectSchemeIdentifier><SubjectHeadingText>Fiction</SubjectHeadingText></Subject>
+  </DescriptiveDetail>
+  <CollateralDetail><TextContent><TextType>03</TextType><ContentAudience>00</ContentAudience><Text>Text</Text></TextContent></CollateralDetail>
+</Product>
+</ONIXMessage>`
+	suite.mockRepo.On("FindDuplicates", mock.Anything, mock.Anything).Return([]models.Book{}, nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/import?format=onix", bytes.NewBufferString(onix),
+		map[string]string{"Content-Type": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var report dto.ImportReport
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(suite.T(), 1, report.Invalid)
+	assert.Equal(suite.T(), 2, report.Rows[0].Line)
+	assert.Equal(suite.T(), "purpose", report.Rows[0].Errors[0].Field)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Create", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_DuplicatesAcrossBatches() {
+	// Arrange - 重複の検索は行のまとまりごとに行う
+	suite.mockRepo.On("FindDuplicates", mock.Anything, mock.Anything).Return([]models.Book{}, nil)
+	var body bytes.Buffer
+	for i := 0; i < importBatchSize; i++ {
+		fmt.Fprintf(&body, `{"title": "Book %d", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "D"}`+"\n", i)
+	}
+	body.WriteString(`{"title": "BOOK 0", "author": "author", "genre": "Fiction", "purpose": "Entertainment", "description": "D"}` + "\n")
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/import?format=ndjson&dry_run=true", &body, nil)
+
+	// Assert - 前のまとまりの行とも重複を判定する
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var report dto.ImportReport
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(suite.T(), importBatchSize, report.Created)
+	assert.Equal(suite.T(), 1, report.Duplicates)
+	assert.Equal(suite.T(), 1, report.Rows[0].DuplicateOfLine)
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "FindDuplicates", 2)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_LongLine() {
+	// Arrange
+	suite.mockRepo.On("FindDuplicates", mock.Anything, mock.Anything).Return([]models.Book{}, nil)
+	body := bytes.NewBufferString(`{"title": "` + strings.Repeat("a", maxImportLineBytes) + `"}` + "\n" +
+		`{"title": "Book", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "D"}` + "\n")
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/import?format=ndjson&dry_run=true", body, nil)
+
+	// Assert - 長すぎる行は読み飛ばし、次の行から続ける
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var report dto.ImportReport
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(suite.T(), 2, report.Total)
+	assert.Equal(suite.T(), 1, report.Created)
+	assert.Equal(suite.T(), 1, report.Invalid)
+	assert.Equal(suite.T(), 1, report.Rows[0].Line)
+	assert.Equal(suite.T(), "The row could not be parsed: line is longer than 1048576 bytes", report.Rows[0].Message)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_TooLarge() {
+	suite.Run("Content-Lengthが上限を超える", func() {
+		req := httptest.NewRequest("POST", "/books/import?format=ndjson", strings.NewReader("{}\n"))
+		req.ContentLength = maxImportBytes + 1
+
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code)
+		testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeRequestTooLarge,
+			"The request body exceeds the limit of 67108864 bytes")
+		suite.mockRepo.AssertNotCalled(suite.T(), "FindDuplicates", mock.Anything, mock.Anything)
+	})
+
+	suite.Run("長さのわからない本文が上限を超える", func() {
+		body := io.MultiReader(io.LimitReader(repeatReader(' '), maxImportBytes), strings.NewReader(" \n"))
+		req := httptest.NewRequest("POST", "/books/import?format=ndjson", body)
+		req.ContentLength = -1
+
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, w.Code)
+		testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeRequestTooLarge,
+			"The request body exceeds the limit of 67108864 bytes")
+	})
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestImportBooks_ReadErrorPartway() {
+	// Arrange - 最初のまとまりを書き込んだ後で本文の読み込みに失敗する
+	suite.mockRepo.On("FindDuplicates", mock.Anything, mock.Anything).Return([]models.Book{}, nil)
+	suite.mockRepo.On("Create", mock.Anything).Return(nil)
+	var rows bytes.Buffer
+	for i := 0; i <= importBatchSize; i++ {
+		fmt.Fprintf(&rows, `{"title": "Book %d", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "D"}`+"\n", i)
+	}
+	body := io.MultiReader(&rows, iotest.ErrReader(errors.New("connection reset")))
+	req := httptest.NewRequest("POST", "/books/import?format=ndjson", body)
+	w := httptest.NewRecorder()
+
+	// Act
+	suite.router.ServeHTTP(w, req)
+
+	// Assert - エラーとともに、失敗までに書き込んだ行の件数を返す
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	var problem dto.ErrorResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(suite.T(), dto.CodeInternalError, problem.Code)
+	suite.Require().NotNil(problem.Import)
+	assert.Equal(suite.T(), importBatchSize+1, problem.Import.Total)
+	assert.Equal(suite.T(), importBatchSize+1, problem.Import.Created)
+	assert.Zero(suite.T(), problem.Import.Failed)
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "Create", importBatchSize+1)
+}
+
+// repeatReader reads the same byte forever
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// ========== ExportBooks Tests ==========
+
+// exportBooks はエクスポートテスト用の書籍を返す
+func exportBooks() []models.Book {
+	return []models.Book{
+		{ID: 1, Title: "吾輩は猫である", Author: "夏目漱石", Genre: "Fiction", Purpose: "Entertainment", Description: "猫の視点で描く, \"風刺\"小説", ISBN: "9784101010014"},
+		{ID: 2, Title: "Go入門", Author: "Author 2", Genre: "Technology", Purpose: "Learning", Description: "1行目\n2行目"},
+	}
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_CSV() {
+	// Arrange
+	suite.mockRepo.On("Each", models.BookFilter{Genre: "Fiction"}).Return(exportBooks(), nil)
+
+	// Act
+	w := suite.performRequest("GET", "/books/export?genre=Fiction", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(suite.T(), `attachment; filename="books.csv"`, w.Header().Get("Content-Disposition"))
+
+	body := w.Body.String()
+	assert.True(suite.T(), strings.HasPrefix(body, "\ufeff"), "BOMで始まること")
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(body, "\ufeff"))).ReadAll()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), [][]string{
+		{"id", "title", "author", "genre", "purpose", "description", "isbn"},
+		{"1", "吾輩は猫である", "夏目漱石", "Fiction", "Entertainment", "猫の視点で描く, \"風刺\"小説", "9784101010014"},
+		{"2", "Go入門", "Author 2", "Technology", "Learning", "1行目\n2行目", ""},
+	}, records)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_CSVCanBeImported() {
+	// Arrange
+	suite.mockRepo.On("Each", models.BookFilter{}).Return(exportBooks(), nil)
+	suite.mockRepo.On("FindDuplicates", mock.Anything, mock.Anything).Return([]models.Book{}, nil)
+	suite.mockRepo.On("Create", mock.AnythingOfType("*models.Book")).Return(nil)
+	exported := suite.performRequest("GET", "/books/export", nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/import", bytes.NewBuffer(exported.Body.Bytes()),
+		map[string]string{"Content-Type": "text/csv"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var report dto.ImportReport
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(suite.T(), 2, report.Created)
+	suite.mockRepo.AssertNumberOfCalls(suite.T(), "Create", 2)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_NDJSON() {
+	// Arrange
+	suite.mockRepo.On("Each", models.BookFilter{Author: "漱石"}).Return(exportBooks()[:1], nil)
+
+	// Act
+	w := suite.performRequest("GET", "/books/export?format=ndjson&author=%E6%BC%B1%E7%9F%B3", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/x-ndjson", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	assert.Len(suite.T(), lines, 1)
+	var book dto.BookResponse
+	assert.NoError(suite.T(), json.Unmarshal([]byte(lines[0]), &book))
+	assert.Equal(suite.T(), "吾輩は猫である", book.Title)
+	assert.Equal(suite.T(), "9784101010014", book.ISBN)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_XLSX() {
+	// Arrange
+	suite.mockRepo.On("Each", models.BookFilter{}).Return(exportBooks(), nil)
+
+	// Act
+	w := suite.performRequest("GET", "/books/export?format=xlsx", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `attachment; filename="books.xlsx"`, w.Header().Get("Content-Disposition"))
+
+	file, err := excelize.OpenReader(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(suite.T(), err)
+	defer file.Close()
+	rows, err := file.GetRows("Books")
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), rows, 3)
+	assert.Equal(suite.T(), []string{"id", "title", "author", "genre", "purpose", "description", "isbn"}, rows[0])
+	assert.Equal(suite.T(), []string{"2", "Go入門", "Author 2", "Technology", "Learning", "1行目\n2行目"}, rows[2])
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_MARCXML() {
+	// Arrange
+	suite.mockRepo.On("Each", models.BookFilter{}).Return(exportBooks(), nil)
+
+	// Act
+	w := suite.performRequest("GET", "/books/export?format=marcxml", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/marcxml+xml", w.Header().Get("Content-Type"))
+	assert.Equal(suite.T(), `attachment; filename="books.marc.xml"`, w.Header().Get("Content-Disposition"))
+	assert.Contains(suite.T(), w.Body.String(), `<collection xmlns="http://www.loc.gov/MARC21/slim">`)
+	assert.Contains(suite.T(), w.Body.String(), `<subfield code="a">吾輩は猫である</subfield>`)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_Empty() {
+	// Arrange
+	suite.mockRepo.On("Each", models.BookFilter{}).Return([]models.Book{}, nil)
+
+	// Act
+	w := suite.performRequest("GET", "/books/export?format=ndjson", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Empty(suite.T(), w.Body.String())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_UnsupportedFormat() {
+	// Act
+	w := suite.performRequest("GET", "/books/export?format=pdf", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	var response dto.ErrorResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Code)
+	assert.Equal(suite.T(), "format", response.Errors[0].Field)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Each", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestExportBooks_DatabaseError() {
+	// Arrange
+	suite.mockRepo.On("Each", models.BookFilter{}).Return([]models.Book{}, errors.New("database connection failed"))
+
+	// Act
+	w := suite.performRequest("GET", "/books/export", nil)
+
+	// Assert: 書き込み開始前のエラーは problem details として返す
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Equal(suite.T(), "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Empty(suite.T(), w.Header().Get("Content-Disposition"))
+}
+
+// ========== Content Negotiation Tests ==========
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_XML() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books/1", nil, map[string]string{"Accept": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(suite.T(), w.Header().Values("Vary"), "Accept")
+	assert.Contains(suite.T(), w.Body.String(), "<book><id>1</id><title>Original Title</title>")
+
+	var response dto.BookResponse
+	assert.NoError(suite.T(), xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), "Original Author", response.Author)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_MsgPack() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+
+	// Act - x-msgpackの別名でも選ばれる
+	w := suite.performRequestWithHeaders("GET", "/books/1", nil, map[string]string{"Accept": "application/x-msgpack"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/msgpack", w.Header().Get("Content-Type"))
+
+	var response map[string]interface{}
+	assert.NoError(suite.T(), codec.NewDecoderBytes(w.Body.Bytes(), msgpackHandle).Decode(&response))
+	assert.Equal(suite.T(), "Original Title", response["title"])
+	assert.EqualValues(suite.T(), 1, response["id"])
+	assert.NotContains(suite.T(), response, "XMLName")
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_XML() {
+	// Arrange
+	books := []models.Book{*suite.sampleBook(), {ID: 2, Title: "Second"}}
+	suite.mockRepo.On("Find", models.BookFilter{}).Return(books, nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books", nil, map[string]string{"Accept": "text/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	var response struct {
+		XMLName xml.Name           `xml:"books"`
+		Books   []dto.BookResponse `xml:"book"`
+	}
+	assert.NoError(suite.T(), xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(suite.T(), response.Books, 2)
+	assert.Equal(suite.T(), "Second", response.Books[1].Title)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_QualityValues() {
+	// Arrange
+	suite.mockRepo.On("Find", models.BookFilter{}).Return([]models.Book{*suite.sampleBook()}, nil)
+
+	// Act - q値の高い形式が選ばれる
+	w := suite.performRequestWithHeaders("GET", "/books", nil, map[string]string{"Accept": "application/json;q=0.5, application/msgpack"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "application/msgpack", w.Header().Get("Content-Type"))
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_XMLBody() {
+	// Arrange - XMLのリクエストもサニタイズと検証を通る
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<book>
+  <title>  Clean &lt;b&gt;Code&lt;/b&gt; </title>
+  <author>Robert C. Martin</author>
+  <genre>Programming</genre>
+  <purpose>Learning</purpose>
+  <description>A handbook of agile software craftsmanship</description>
+  <isbn>978-0-13-235088-4</isbn>
+</book>`
+	suite.mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Title == "Clean Code" && book.ISBN == "9780132350884"
+	})).Return(nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books", bytes.NewBufferString(body), map[string]string{
+		"Content-Type": "application/xml",
+		"Accept":       "application/xml",
+	})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var response dto.BookResponse
+	assert.NoError(suite.T(), xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), "Clean Code", response.Title)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_MsgPackBody() {
+	// Arrange
+	req := dto.CreateBookRequest{
+		Title: "Test Book", Author: "Test Author", Genre: "Fiction",
+		Purpose: "Entertainment", Description: "Test Description",
+	}
+	var body []byte
+	suite.Require().NoError(codec.NewEncoderBytes(&body, msgpackHandle).Encode(req))
+	suite.mockRepo.On("Create", mock.AnythingOfType("*models.Book")).Return(nil)
+
+	// Act - レスポンスはAcceptがなければJSON
+	w := suite.performRequestWithHeaders("POST", "/books", bytes.NewBuffer(body), map[string]string{"Content-Type": "application/msgpack"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+	var response dto.BookResponse
+	assert.NoError(suite.T(), json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), "Test Book", response.Title)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestCreateBook_MsgPackValidationError() {
+	// Arrange
+	var body []byte
+	suite.Require().NoError(codec.NewEncoderBytes(&body, msgpackHandle).Encode(map[string]string{"title": "   "}))
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books", bytes.NewBuffer(body), map[string]string{
+		"Content-Type": "application/msgpack",
+		"Accept":       "application/msgpack",
+	})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	assert.Equal(suite.T(), "application/msgpack", w.Header().Get("Content-Type"))
+
+	var response dto.ErrorResponse
+	assert.NoError(suite.T(), codec.NewDecoderBytes(w.Body.Bytes(), msgpackHandle).Decode(&response))
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Code)
+	assert.NotEmpty(suite.T(), response.Errors)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestUpdateBook_XMLBody() {
+	// Arrange - 含まれない要素は変更しない
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), map[string]interface{}{"title": "New Title"}).Return(&models.Book{ID: 1, Title: "New Title", Author: "Original Author", Version: 2}, nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("PATCH", "/books/1", bytes.NewBufferString("<book><title>New Title</title></book>"),
+		map[string]string{"Content-Type": "text/xml; charset=utf-8"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_NotFound_ProblemXML() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(999)).Return(nil, models.ErrNotFound)
+
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books/999", nil, map[string]string{"Accept": "application/xml"})
+
+	// Assert - RFC 7807 付録AのXML形式
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Equal(suite.T(), "application/problem+xml", w.Header().Get("Content-Type"))
+	assert.Equal(suite.T(), []string{"Accept, Accept-Language"}, w.Header().Values("Vary"))
+	assert.Contains(suite.T(), w.Body.String(), `<problem xmlns="urn:ietf:rfc:7807">`)
+
+	var response dto.ErrorResponse
+	assert.NoError(suite.T(), xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), dto.CodeBookNotFound, response.Code)
+	assert.Equal(suite.T(), http.StatusNotFound, response.Status)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_XML() {
+	// Act - 失敗した操作のエラーもXMLで返る
+	body := `{"mode":"best_effort","operations":[{"op":"delete"}]}`
+	w := suite.performRequestWithHeaders("POST", "/books/bulk", bytes.NewBufferString(body), map[string]string{"Accept": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `<result><index>0</index><op>delete</op><status>400</status><problem xmlns="urn:ietf:rfc:7807">`)
+
+	var response dto.BulkResponse
+	assert.NoError(suite.T(), xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), 1, response.Failed)
+	suite.Require().Len(response.Results, 1)
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Results[0].Error.Code)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_XMLRequest() {
+	// Arrange - XMLのリクエストも操作ごとに正規化・検証する
+	suite.mockRepo.On("Transaction").Return(nil)
+	suite.mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool { return book.Title == "Created" })).Return(nil)
+	suite.mockRepo.On("DeleteIfVersion", uint(2), uint(3)).Return(&models.Book{ID: 2, Title: "Deleted", Version: 3}, nil)
+
+	body := `<bulk_request><mode>atomic</mode><operations>
+		<operation><op>create</op><book><title> Created </title><author>Author</author><genre>Fiction</genre><purpose>Entertainment</purpose><description>Description</description></book></operation>
+		<operation><op>delete</op><id>2</id><version>3</version></operation>
+	</operations></bulk_request>`
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/bulk", bytes.NewBufferString(body),
+		map[string]string{"Content-Type": "application/xml", "Accept": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var response dto.BulkResponse
+	suite.Require().NoError(xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), 2, response.Succeeded)
+	suite.Require().Len(response.Results, 2)
+	assert.Equal(suite.T(), http.StatusCreated, response.Results[0].Status)
+	assert.Equal(suite.T(), "Created", response.Results[0].Book.Title)
+	assert.Equal(suite.T(), "delete", response.Results[1].Op)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_XMLRequest_InvalidOperation() {
+	// Arrange - 不正な操作はその操作だけのエラーになる
+	suite.mockRepo.On("Delete", uint(1)).Return(suite.sampleBook(), nil)
+
+	body := `<bulk_request><mode>best_effort</mode><operations>
+		<operation><op>delete</op><id>1</id></operation>
+		<operation><op>delete</op><id>abc</id></operation>
+		<operation><op>create</op><book><title>Missing fields</title></book></operation>
+	</operations></bulk_request>`
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/bulk", bytes.NewBufferString(body), map[string]string{"Content-Type": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+
+	var response dto.BulkResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), 1, response.Succeeded)
+	assert.Equal(suite.T(), 2, response.Failed)
+	assert.Equal(suite.T(), http.StatusOK, response.Results[0].Status)
+	assert.Equal(suite.T(), http.StatusBadRequest, response.Results[1].Status)
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Results[2].Error.Code)
+	assert.Equal(suite.T(), "book.author", response.Results[2].Error.Errors[0].Field)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestBulkBooks_MessagePackRequest() {
+	// Arrange
+	updatedBook := suite.sampleBook()
+	updatedBook.Title = "New Title"
+	updatedBook.Version = 2
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("UpdateIfVersion", uint(1), uint(1), map[string]interface{}{"title": "New Title"}).Return(updatedBook, nil)
+
+	var body []byte
+	suite.Require().NoError(codec.NewEncoderBytes(&body, msgpackHandle).Encode(map[string]interface{}{
+		"mode": "best_effort",
+		"operations": []interface{}{
+			map[string]interface{}{"op": "update", "id": 1, "book": map[string]string{"title": " New\tTitle "}},
+			map[string]interface{}{"op": "update", "id": 2},
+		},
+	}))
+
+	// Act
+	w := suite.performRequestWithHeaders("POST", "/books/bulk", bytes.NewBuffer(body),
+		map[string]string{"Content-Type": "application/msgpack", "Accept": "application/msgpack"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+
+	var response dto.BulkResponse
+	suite.Require().NoError(codec.NewDecoderBytes(w.Body.Bytes(), msgpackHandle).Decode(&response))
+	assert.Equal(suite.T(), 1, response.Succeeded)
+	suite.Require().Len(response.Results, 2)
+	assert.Equal(suite.T(), uint(2), response.Results[0].Version)
+	assert.Equal(suite.T(), "New Title", response.Results[0].Book.Title)
+	assert.Equal(suite.T(), "book", response.Results[1].Error.Errors[0].Field)
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+// ========== Sparse Fieldset / Include Tests ==========
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_SparseFieldset() {
+	// Arrange
+	suite.mockRepo.On("Find", models.BookFilter{}).Return([]models.Book{*suite.sampleBook()}, nil)
+
+	// Act - 一覧表示に必要なフィールドだけを返す
+	w := suite.performRequest("GET", "/books?fields=id,title,author", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `[{"id":1,"title":"Original Title","author":"Original Author"}]`, w.Body.String())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_IncludeAuthors() {
+	// Arrange - 著者ごとの冊数は1回のクエリでまとめて取得する
+	books := []models.Book{
+		{ID: 1, Title: "Book 1", Author: "Author A"},
+		{ID: 2, Title: "Book 2", Author: "Author B"},
+		{ID: 3, Title: "Book 3", Author: "Author A"},
+	}
+	suite.mockRepo.On("Find", models.BookFilter{}).Return(books, nil)
+	suite.mockRepo.On("CountByAuthor", []string{"Author A", "Author B"}).
+		Return(map[string]int64{"Author A": 2, "Author B": 1}, nil).Once()
+
+	// Act
+	w := suite.performRequest("GET", "/books?fields=id&include=authors", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `[
+		{"id":1,"authors":[{"name":"Author A","book_count":2}]},
+		{"id":2,"authors":[{"name":"Author B","book_count":1}]},
+		{"id":3,"authors":[{"name":"Author A","book_count":2}]}
+	]`, w.Body.String())
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_FieldsAndInclude() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("CountByAuthor", []string{"Original Author"}).Return(map[string]int64{"Original Author": 4}, nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books/1?fields=title&include=authors", nil, map[string]string{"Accept": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `<book><title>Original Title</title><authors><author><name>Original Author</name><book_count>4</book_count></author></authors></book>`, w.Body.String())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_IncludeTagsAndRatings() {
+	// Arrange - タグと評価もそれぞれ1回のクエリでまとめて取得する
+	books := []models.Book{
+		{ID: 1, Title: "Book 1", Author: "Author A"},
+		{ID: 2, Title: "Book 2", Author: "Author B"},
+	}
+	suite.mockRepo.On("Find", models.BookFilter{}).Return(books, nil)
+	suite.mockRepo.On("FindTags", []uint{1, 2}).Return(map[uint][]string{1: {"american", "classic"}}, nil).Once()
+	suite.mockRepo.On("SummarizeRatings", []uint{1, 2}).
+		Return(map[uint]models.RatingSummary{1: {Count: 3, Average: 11.0 / 3}}, nil).Once()
+
+	// Act
+	w := suite.performRequest("GET", "/books?fields=id&include=tags,ratings", nil)
+
+	// Assert - タグのない本ではタグを省き、評価のない本は0件の要約になる
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `[
+		{"id":1,"tags":["american","classic"],"ratings":{"count":3,"average":3.67}},
+		{"id":2,"ratings":{"count":0,"average":0}}
+	]`, w.Body.String())
+	suite.mockRepo.AssertExpectations(suite.T())
+	suite.mockRepo.AssertNotCalled(suite.T(), "CountByAuthor", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_IncludeTagsAndRatings_XML() {
+	// Arrange
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("FindTags", []uint{1}).Return(map[uint][]string{1: {"classic"}}, nil)
+	suite.mockRepo.On("SummarizeRatings", []uint{1}).Return(map[uint]models.RatingSummary{1: {Count: 2, Average: 4.5}}, nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books/1?fields=title&include=ratings,tags", nil, map[string]string{"Accept": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `<book><title>Original Title</title><tags><tag>classic</tag></tags><ratings><count>2</count><average>4.5</average></ratings></book>`, w.Body.String())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_EmbeddedChangesETag() {
+	// Arrange - 埋め込んだ評価は本の版を変えずに変わる
+	suite.mockRepo.On("GetByID", uint(1)).Return(suite.sampleBook(), nil)
+	suite.mockRepo.On("SummarizeRatings", []uint{1}).Return(map[uint]models.RatingSummary{1: {Count: 1, Average: 5}}, nil).Once()
+	suite.mockRepo.On("SummarizeRatings", []uint{1}).Return(map[uint]models.RatingSummary{1: {Count: 2, Average: 4}}, nil).Once()
+	first := suite.performRequest("GET", "/books/1?include=ratings", nil)
+	etag := first.Header().Get("ETag")
+	suite.Require().NotEmpty(etag)
+	assert.True(suite.T(), strings.HasPrefix(etag, `"1-1-`), etag)
+
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books/1?include=ratings", nil, map[string]string{"If-None-Match": etag})
+
+	// Assert - 評価が変われば304ではなく新しい表現を返す
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.NotEqual(suite.T(), etag, w.Header().Get("ETag"))
+	assert.Contains(suite.T(), w.Body.String(), `"ratings":{"count":2,"average":4}`)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestSetBookTags() {
+	// Arrange - タグは正規化し、小文字にして重複を除く
+	suite.mockRepo.On("SetTags", uint(1), []string{"american", "classic", "sci fi"}).Return(nil)
+
+	// Act
+	w := suite.performRequest("PUT", "/books/1/tags", bytes.NewBufferString(`{"tags": ["Classic", " american ", "classic", "Sci\tFi"]}`))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"tags": ["american", "classic", "sci fi"]}`, w.Body.String())
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestSetBookTags_XML() {
+	// Arrange
+	suite.mockRepo.On("SetTags", uint(1), []string{"classic"}).Return(nil)
+
+	// Act
+	w := suite.performRequestWithHeaders("PUT", "/books/1/tags", bytes.NewBufferString(`<book_tags><tags><tag>Classic</tag></tags></book_tags>`),
+		map[string]string{"Content-Type": "application/xml", "Accept": "application/xml"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), `<book_tags><tags><tag>classic</tag></tags></book_tags>`, w.Body.String())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestSetBookTags_Invalid() {
+	tooMany := make([]string, 21)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+	body, err := json.Marshal(map[string][]string{"tags": tooMany})
+	suite.Require().NoError(err)
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+		rule  string
+	}{
+		{"タグが多すぎる", string(body), "tags", "max"},
+		{"空白だけのタグ", `{"tags": ["classic", "  "]}`, "tags[1]", "notblank"},
+		{"長すぎるタグ", `{"tags": ["` + strings.Repeat("a", 51) + `"]}`, "tags[0]", "max"},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			w := suite.performRequest("PUT", "/books/1/tags", bytes.NewBufferString(tt.body))
+
+			assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+			var response dto.ErrorResponse
+			suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+			suite.Require().Len(response.Errors, 1)
+			assert.Equal(suite.T(), tt.field, response.Errors[0].Field)
+			assert.Equal(suite.T(), tt.rule, response.Errors[0].Rule)
+		})
+	}
+	suite.mockRepo.AssertNotCalled(suite.T(), "SetTags", mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestSetBookTags_NotFound() {
+	// Arrange
+	suite.mockRepo.On("SetTags", uint(999), []string{"classic"}).Return(models.ErrNotFound)
+
+	// Act
+	w := suite.performRequest("PUT", "/books/999/tags", bytes.NewBufferString(`{"tags": ["classic"]}`))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeBookNotFound, "The requested book could not be found")
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestRateBook() {
+	// Arrange - 利用者のsubjectで評価する
+	suite.mockRepo.On("Rate", uint(1), "alice", 5).Return(nil)
+	suite.mockRepo.On("SummarizeRatings", []uint{1}).Return(map[uint]models.RatingSummary{1: {Count: 3, Average: 13.0 / 3}}, nil)
+
+	// Act
+	w := suite.performRequest("PUT", "/books/1/rating", bytes.NewBufferString(`{"score": 5}`))
+
+	// Assert - 評価後の要約を返す
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"count": 3, "average": 4.33}`, w.Body.String())
+	suite.mockRepo.AssertExpectations(suite.T())
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestRateBook_InvalidScore() {
+	for _, body := range []string{`{"score": 0}`, `{"score": 6}`, `{}`} {
+		suite.Run(body, func() {
+			w := suite.performRequest("PUT", "/books/1/rating", bytes.NewBufferString(body))
+
+			assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+			var response dto.ErrorResponse
+			suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(suite.T(), dto.CodeValidationFailed, response.Code)
+			assert.Equal(suite.T(), "score", response.Errors[0].Field)
+		})
+	}
+	suite.mockRepo.AssertNotCalled(suite.T(), "Rate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestRateBook_NotFound() {
+	// Arrange
+	suite.mockRepo.On("Rate", uint(999), "alice", 3).Return(models.ErrNotFound)
+
+	// Act
+	w := suite.performRequest("PUT", "/books/999/rating", bytes.NewBufferString(`{"score": 3}`))
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	suite.mockRepo.AssertNotCalled(suite.T(), "SummarizeRatings", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestRateBook_Anonymous() {
+	// Arrange - 認証が無効で利用者がいなければ、全員が同じ評価を共有しないよう拒否する
+	router := gin.New()
+	router.PUT("/books/:id/rating", suite.handler.RateBook)
+	req := httptest.NewRequest("PUT", "/books/1/rating", strings.NewReader(`{"score": 5}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	// Act
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusUnauthorized, w.Code)
+	assert.Equal(suite.T(), `Bearer realm="recomemento"`, w.Header().Get("WWW-Authenticate"))
+	suite.mockRepo.AssertNotCalled(suite.T(), "Rate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_UnknownField() {
+	// Act
+	w := suite.performRequest("GET", "/books?fields=id,price", nil)
+
+	// Assert - DBに問い合わせる前に400を返す
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	var response dto.ErrorResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(suite.T(), dto.CodeValidationFailed, response.Code)
+	suite.Require().Len(response.Errors, 1)
+	assert.Equal(suite.T(), "fields", response.Errors[0].Field)
+	assert.Equal(suite.T(), "listof", response.Errors[0].Rule)
+	assert.Equal(suite.T(), "fields must be a comma-separated list of: id,title,author,genre,purpose,description,isbn", response.Errors[0].Message)
+	suite.mockRepo.AssertNotCalled(suite.T(), "Find", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetBookByID_UnknownInclude_Japanese() {
+	// Act
+	w := suite.performRequestWithHeaders("GET", "/books/1?include=reviews", nil, map[string]string{"Accept-Language": "ja"})
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	var response dto.ErrorResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	suite.Require().Len(response.Errors, 1)
+	assert.Equal(suite.T(), "埋め込むリソースには次の値をカンマ区切りで指定してください: authors,tags,ratings", response.Errors[0].Message)
+	suite.mockRepo.AssertNotCalled(suite.T(), "GetByID", mock.Anything)
+}
+
+func (suite *BookHandlerExtendedTestSuite) TestGetAllBooks_IncludeAuthorsDatabaseError() {
+	// Arrange
+	suite.mockRepo.On("Find", models.BookFilter{}).Return([]models.Book{*suite.sampleBook()}, nil)
+	suite.mockRepo.On("CountByAuthor", mock.Anything).Return(nil, errors.New("database is locked"))
+
+	// Act
+	w := suite.performRequest("GET", "/books?include=authors", nil)
+
+	// Assert
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	testutil.AssertErrorResponse(suite.T(), w.Body.Bytes(), dto.CodeInternalError, "")
+}
+
+// ========== Helper Functions ==========
+
+// withPrincipal authenticates every request as principal
+func withPrincipal(principal *auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func (suite *BookHandlerExtendedTestSuite) performRequest(method, url string, body *bytes.Buffer) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body != nil {
+		req = httptest.NewRequest(method, url, body)
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, url, nil)
+	}
+	
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BookHandlerExtendedTestSuite) performRequestWithHeaders(method, url string, body *bytes.Buffer, headers map[string]string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body != nil {
+		req = httptest.NewRequest(method, url, body)
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, url, nil)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BookHandlerExtendedTestSuite) sampleBook() *models.Book {
+	return &models.Book{
+		ID: 1, Title: "Original Title", Author: "Original Author",
+		Genre: "Fiction", Purpose: "Entertainment", Description: "Original Description", Version: 1,
+	}
 }
 
 func stringPointer(s string) *string {
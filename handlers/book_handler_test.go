@@ -31,6 +31,27 @@ func (m *MockBookDatabase) GetAll() ([]models.Book, error) {
 	return args.Get(0).([]models.Book), args.Error(1)
 }
 
+func (m *MockBookDatabase) Find(filter models.BookFilter) ([]models.Book, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.Book), args.Error(1)
+}
+
+func (m *MockBookDatabase) Search(query string) ([]models.Book, error) {
+	args := m.Called(query)
+	return args.Get(0).([]models.Book), args.Error(1)
+}
+
+func (m *MockBookDatabase) Each(filter models.BookFilter, fn func(book *models.Book) error) error {
+	args := m.Called(filter)
+	books := args.Get(0).([]models.Book)
+	for i := range books {
+		if err := fn(&books[i]); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
 func (m *MockBookDatabase) GetByID(id uint) (*models.Book, error) {
 	args := m.Called(id)
 	return args.Get(0).(*models.Book), args.Error(1)
@@ -46,11 +67,71 @@ func (m *MockBookDatabase) Delete(id uint) (*models.Book, error) {
 	return args.Get(0).(*models.Book), args.Error(1)
 }
 
+func (m *MockBookDatabase) UpdateIfVersion(id uint, version uint, updates map[string]interface{}) (*models.Book, error) {
+	args := m.Called(id, version, updates)
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (m *MockBookDatabase) DeleteIfVersion(id uint, version uint) (*models.Book, error) {
+	args := m.Called(id, version)
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
 func (m *MockBookDatabase) FindByGenreAndPurpose(genre, purpose string) (*models.Book, error) {
 	args := m.Called(genre, purpose)
 	return args.Get(0).(*models.Book), args.Error(1)
 }
 
+func (m *MockBookDatabase) CountByAuthor(authors []string) (map[string]int64, error) {
+	args := m.Called(authors)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *MockBookDatabase) FindDuplicates(isbns, matchKeys []string) ([]models.Book, error) {
+	args := m.Called(isbns, matchKeys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Book), args.Error(1)
+}
+
+func (m *MockBookDatabase) SetTags(bookID uint, tags []string) error {
+	args := m.Called(bookID, tags)
+	return args.Error(0)
+}
+
+func (m *MockBookDatabase) FindTags(bookIDs []uint) (map[uint][]string, error) {
+	args := m.Called(bookIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uint][]string), args.Error(1)
+}
+
+func (m *MockBookDatabase) Rate(bookID uint, rater string, score int) error {
+	args := m.Called(bookID, rater, score)
+	return args.Error(0)
+}
+
+func (m *MockBookDatabase) SummarizeRatings(bookIDs []uint) (map[uint]models.RatingSummary, error) {
+	args := m.Called(bookIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uint]models.RatingSummary), args.Error(1)
+}
+
+func (m *MockBookDatabase) Transaction(fn func(repo models.BookDatabase) error) error {
+	args := m.Called()
+	if err := fn(m); err != nil {
+		return err
+	}
+	return args.Error(0)
+}
+
 func TestCreateBook(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -99,7 +180,7 @@ func TestGetAllBooks(t *testing.T) {
 		{ID: 2, Title: "Book 2", Author: "Author 2", Genre: "Technology", Purpose: "Learning", Description: "Description 2"},
 	}
 
-	mockRepo.On("GetAll").Return(expectedBooks, nil)
+	mockRepo.On("Find", models.BookFilter{}).Return(expectedBooks, nil)
 
 	req, _ := http.NewRequest("GET", "/books", nil)
 	w := httptest.NewRecorder()
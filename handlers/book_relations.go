@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetBookTags godoc
+// @Summary Replace the tags of a book
+// @Description Replace every tag of a book. Tags are lowercased and duplicates are removed; an empty list
+// @Description removes them all. Book responses embed them with include=tags.
+// @Tags books
+// @Accept json,xml,application/msgpack
+// @Produce json,xml,application/msgpack
+// @Param id path int true "Book ID"
+// @Param tags body dto.SetBookTagsRequest true "Tags of the book"
+// @Success 200 {object} dto.BookTagsResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /books/{id}/tags [put]
+func (h *BookHandler) SetBookTags(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		AbortWithProblem(c, errInvalidID())
+		return
+	}
+
+	var req dto.SetBookTagsRequest
+	if err := c.ShouldBindWith(&req, sanitizedBody); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+
+	tags := normalizeTags(req.Tags)
+	if err := h.bookRepo.SetTags(uint(id), tags); err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	respond(c, http.StatusOK, dto.BookTagsResponse{Tags: tags})
+}
+
+// normalizeTags lowercases sanitized tags, removes duplicates and sorts them by name
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized = append(normalized, strings.ToLower(tag))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// RateBook godoc
+// @Summary Rate a book
+// @Description Give a book a score from 1 to 5. Each user has one rating per book, which rating again
+// @Description replaces; API keys and unauthenticated callers cannot rate. Book responses embed the
+// @Description summary with include=ratings.
+// @Tags books
+// @Accept json,xml,application/msgpack
+// @Produce json,xml,application/msgpack
+// @Param id path int true "Book ID"
+// @Param rating body dto.RateBookRequest true "Rating"
+// @Success 200 {object} dto.RatingSummaryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Router /books/{id}/rating [put]
+func (h *BookHandler) RateBook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		AbortWithProblem(c, errInvalidID())
+		return
+	}
+
+	// Ratings are personal: without a principal, such as when authentication is
+	// disabled, every caller would share a single rating
+	principal, ok := auth.FromContext(c.Request.Context())
+	if !ok {
+		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+		AbortWithProblem(c, NewAppError(dto.CodeUnauthorized))
+		return
+	}
+
+	var req dto.RateBookRequest
+	if err := c.ShouldBindWith(&req, sanitizedBody); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+
+	if err := h.bookRepo.Rate(uint(id), principal.Subject, req.Score); err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	summaries, err := h.bookRepo.SummarizeRatings([]uint{uint(id)})
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+	respond(c, http.StatusOK, ratingSummaryResponse(summaries[uint(id)]))
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/i18n"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxBulkBytes caps the body of a bulk request, enough for the maximum of 1000
+// operations on books with fields at their default length limits
+const maxBulkBytes = 16 << 20
+
+// sanitizedBulkBody binds bulk requests like sanitizedBody binds single books. The
+// number of operations is only validated once decoded, so the size of the document is
+// capped while reading it.
+var sanitizedBulkBody binding.Binding = sanitizedBodyBinding{limit: maxBulkBytes}
+
+// errBulkAborted rolls back the transaction of an atomic bulk request
+var errBulkAborted = errors.New("bulk operation aborted")
+
+// bulkItem is a decoded bulk operation. err is set when the operation itself is invalid.
+type bulkItem struct {
+	op     dto.BulkOperation
+	create dto.CreateBookRequest
+	update dto.UpdateBookRequest
+	err    *AppError
+}
+
+// bulkOutcome is the result of applying a single bulk operation
+type bulkOutcome struct {
+	status int
+	book   *models.Book
+	err    *AppError
+}
+
+// BulkBooks godoc
+// @Summary Create, update and delete books in bulk
+// @Description Apply up to 1000 create, update and delete operations in order. In atomic mode (the default)
+// @Description every operation is rolled back if one fails; in best_effort mode the other operations are
+// @Description still applied. Each operation follows the same validation and version rules as the single-book
+// @Description endpoints and reports its own status. The response is 200 when every operation was applied
+// @Description and 207 otherwise.
+// @Tags books
+// @Accept json,xml,application/msgpack
+// @Produce json,xml,application/msgpack
+// @Param operations body dto.BulkRequest true "Operations to apply; each entry is a dto.BulkOperation"
+// @Success 200 {object} dto.BulkResponse
+// @Success 207 {object} dto.BulkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /books/bulk [post]
+func (h *BookHandler) BulkBooks(c *gin.Context) {
+	var req dto.BulkRequest
+	if err := c.ShouldBindWith(&req, sanitizedBulkBody); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = dto.BulkModeAtomic
+	}
+
+	format := requestFormat(c.GetHeader("Content-Type"))
+	items := make([]bulkItem, len(req.Operations))
+	for i, raw := range req.Operations {
+		items[i] = decodeBulkItem(format, raw)
+	}
+
+	var outcomes []bulkOutcome
+	if mode == dto.BulkModeAtomic {
+		var err error
+		outcomes, err = h.applyBulkAtomic(items)
+		if err != nil {
+			AbortWithProblem(c, err)
+			return
+		}
+	} else {
+		outcomes = make([]bulkOutcome, len(items))
+		for i, item := range items {
+			outcomes[i] = applyBulkItem(h.bookRepo, item)
+		}
+	}
+
+	localizer := i18n.Negotiate(c.GetHeader("Accept-Language"))
+	response := dto.BulkResponse{
+		Mode:    mode,
+		Results: make([]dto.BulkResult, len(outcomes)),
+	}
+	for i, outcome := range outcomes {
+		result := dto.BulkResult{
+			Index:  i,
+			Op:     items[i].op.Op,
+			Status: outcome.status,
+		}
+		if outcome.err != nil {
+			if outcome.err.Status >= http.StatusInternalServerError {
+				log.Printf("%s %s operation %d: %v", c.Request.Method, c.Request.URL.Path, i, outcome.err)
+			}
+			problem := outcome.err.Problem(localizer, fmt.Sprintf("%s#/operations/%d", c.Request.URL.Path, i))
+			result.Error = &problem
+			response.Failed++
+		} else {
+			result.Book = &dto.BookResponse{
+				ID:          outcome.book.ID,
+				Title:       outcome.book.Title,
+				Author:      outcome.book.Author,
+				Genre:       outcome.book.Genre,
+				Purpose:     outcome.book.Purpose,
+				Description: outcome.book.Description,
+				ISBN:        outcome.book.ISBN,
+			}
+			if items[i].op.Op != "delete" {
+				result.Version = outcome.book.Version
+			}
+			response.Succeeded++
+		}
+		response.Results[i] = result
+	}
+
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+		c.Header("Content-Language", localizer.Language())
+		c.Writer.Header().Add("Vary", "Accept-Language")
+	}
+	respond(c, status, response)
+}
+
+// applyBulkAtomic applies all items in one transaction. When an item fails, the
+// transaction is rolled back and every other item is reported as aborted. Invalid items
+// are detected before the transaction is started.
+func (h *BookHandler) applyBulkAtomic(items []bulkItem) ([]bulkOutcome, error) {
+	outcomes := make([]bulkOutcome, len(items))
+	failed := -1
+	for i, item := range items {
+		if item.err != nil {
+			failed = i
+			outcomes[i] = bulkOutcome{status: item.err.Status, err: item.err}
+			break
+		}
+	}
+
+	if failed < 0 {
+		err := h.bookRepo.Transaction(func(repo models.BookDatabase) error {
+			for i, item := range items {
+				outcomes[i] = applyBulkItem(repo, item)
+				if outcomes[i].err != nil {
+					failed = i
+					return errBulkAborted
+				}
+			}
+			return nil
+		})
+		if err != nil && failed < 0 {
+			return nil, err
+		}
+	}
+
+	if failed >= 0 {
+		for i := range outcomes {
+			if i != failed {
+				aborted := NewAppError(dto.CodeBulkAborted, failed)
+				outcomes[i] = bulkOutcome{status: aborted.Status, err: aborted}
+			}
+		}
+	}
+	return outcomes, nil
+}
+
+// applyBulkItem applies a single item against repo, following the same rules as the
+// corresponding single-book endpoint
+func applyBulkItem(repo models.BookDatabase, item bulkItem) bulkOutcome {
+	if item.err != nil {
+		return bulkOutcome{status: item.err.Status, err: item.err}
+	}
+
+	op := item.op
+	switch op.Op {
+	case "create":
+		book := &models.Book{
+			Title:       item.create.Title,
+			Author:      item.create.Author,
+			Genre:       item.create.Genre,
+			Purpose:     item.create.Purpose,
+			Description: item.create.Description,
+			ISBN:        item.create.ISBN,
+		}
+		if err := repo.Create(book); err != nil {
+			return bulkFailure(op, err)
+		}
+		return bulkOutcome{status: http.StatusCreated, book: book}
+
+	case "update":
+		current, err := repo.GetByID(op.ID)
+		if err != nil {
+			return bulkFailure(op, err)
+		}
+		if op.Version != 0 && current.Version != op.Version {
+			return bulkFailure(op, models.ErrVersionMismatch)
+		}
+
+		next := applyUpdateRequest(bookDocument(current), item.update)
+		sanitize(&next)
+		if err := binding.Validator.ValidateStruct(&next); err != nil {
+			appErr := bindError(err)
+			prefixFields(appErr, "book.")
+			return bulkOutcome{status: appErr.Status, err: appErr}
+		}
+
+		book, err := repo.UpdateIfVersion(op.ID, current.Version, changedBookFields(current, next))
+		if err != nil {
+			return bulkFailure(op, err)
+		}
+		return bulkOutcome{status: http.StatusOK, book: book}
+
+	default:
+		var book *models.Book
+		var err error
+		if op.Version != 0 {
+			book, err = repo.DeleteIfVersion(op.ID, op.Version)
+		} else {
+			book, err = repo.Delete(op.ID)
+		}
+		if err != nil {
+			return bulkFailure(op, err)
+		}
+		return bulkOutcome{status: http.StatusOK, book: book}
+	}
+}
+
+// bulkFailure classifies a repository error of a bulk operation
+func bulkFailure(op dto.BulkOperation, err error) bulkOutcome {
+	appErr := toAppError(err, op.Version != 0)
+	return bulkOutcome{status: appErr.Status, err: appErr}
+}
+
+// decodeBulkItem decodes and validates a single operation and its book payload, both in
+// the format of the request
+func decodeBulkItem(format *mediaFormat, raw dto.RawDocument) bulkItem {
+	var item bulkItem
+	if err := decodeSanitized(bytes.NewReader(raw), format, &item.op); err != nil {
+		item.err = bindError(err)
+		return item
+	}
+
+	var err error
+	switch item.op.Op {
+	case "create":
+		err = decodeSanitized(bytes.NewReader(item.op.Book), format, &item.create)
+	case "update":
+		err = decodeSanitized(bytes.NewReader(item.op.Book), format, &item.update)
+	}
+	if err != nil {
+		item.err = bindError(err)
+		prefixFields(item.err, "book.")
+	}
+	return item
+}
+
+// prefixFields qualifies the field names of a validation error with the member that
+// holds the validated document
+func prefixFields(appErr *AppError, prefix string) {
+	for i := range appErr.Fields {
+		appErr.Fields[i].Field = prefix + appErr.Fields[i].Field
+	}
+}
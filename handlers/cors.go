@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of CORSConfig for the lists left empty
+var (
+	// DefaultCORSMethods are the methods of the API
+	DefaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	// DefaultCORSHeaders are the request headers the API reads
+	DefaultCORSHeaders = []string{"Origin", "Content-Type", "Accept", "Accept-Language", "Authorization", "X-API-Key", "If-Match", "If-None-Match"}
+	// DefaultCORSExposedHeaders are the response headers the API sets for clients to read
+	DefaultCORSExposedHeaders = []string{"ETag", "Deprecation", "Sunset", "Link", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
+)
+
+// CORSConfig is the policy for cross-origin requests from browsers
+type CORSConfig struct {
+	// AllowOrigins are the origins allowed to call the API, such as
+	// "https://app.example.com". A single "*" in the host matches any non-empty part
+	// of it, as in "https://*.example.com" or "http://localhost:*"; "*" alone allows
+	// every origin. No origin is allowed when empty.
+	AllowOrigins []string
+	// AllowMethods are the methods allowed in preflights; DefaultCORSMethods when empty
+	AllowMethods []string
+	// AllowHeaders are the request headers allowed in preflights; DefaultCORSHeaders
+	// when empty
+	AllowHeaders []string
+	// ExposeHeaders are the response headers scripts may read;
+	// DefaultCORSExposedHeaders when empty
+	ExposeHeaders []string
+	// AllowCredentials lets browsers send cookies and Authorization headers. Browsers
+	// refuse it with a wildcard origin, so it cannot be combined with "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight; unannounced when zero
+	MaxAge time.Duration
+}
+
+// originPattern is an allowed origin, with the parts before and after its wildcard
+type originPattern struct {
+	prefix, suffix string
+	wildcard       bool
+}
+
+// matches reports whether origin, in lower case, matches the pattern
+func (p originPattern) matches(origin string) bool {
+	if !p.wildcard {
+		return origin == p.prefix
+	}
+	if len(origin) <= len(p.prefix)+len(p.suffix) || !strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	// The wildcard stands for host labels or a port, never for a path or credentials
+	return !strings.ContainsAny(origin[len(p.prefix):len(origin)-len(p.suffix)], "/:@")
+}
+
+// parseOriginPattern validates an allowed origin other than "*"
+func parseOriginPattern(origin string) (originPattern, error) {
+	origin = strings.ToLower(strings.TrimSpace(origin))
+	if strings.Count(origin, "*") > 1 {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: at most one wildcard is allowed", origin)
+	}
+	// Stand in for the wildcard with a value valid where it is, a port or a host label
+	placeholder := "wildcard"
+	if strings.Contains(origin, ":*") && !strings.Contains(origin, "://*") {
+		placeholder = "1"
+	}
+	u, err := url.Parse(strings.Replace(origin, "*", placeholder, 1))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: want <scheme>://<host>[:<port>]", origin)
+	}
+
+	prefix, suffix, wildcard := strings.Cut(origin, "*")
+	if wildcard && !strings.HasPrefix(prefix, u.Scheme+"://") {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: the wildcard must be in the host", origin)
+	}
+	return originPattern{prefix: prefix, suffix: suffix, wildcard: wildcard}, nil
+}
+
+// CORS returns middleware applying config to cross-origin requests. Preflights, the
+// OPTIONS requests carrying Origin and Access-Control-Request-Method, are answered
+// directly; other OPTIONS requests reach the routes. Requests from origins that are
+// not allowed are served without CORS headers, which makes browsers withhold the
+// response from the calling script.
+func CORS(config CORSConfig) (gin.HandlerFunc, error) {
+	var patterns []originPattern
+	anyOrigin := false
+	for _, origin := range config.AllowOrigins {
+		if strings.TrimSpace(origin) == "*" {
+			anyOrigin = true
+			continue
+		}
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	if anyOrigin && config.AllowCredentials {
+		return nil, errors.New("invalid CORS policy: credentials cannot be allowed for every origin; list the origins instead")
+	}
+
+	methods := strings.Join(orDefault(config.AllowMethods, DefaultCORSMethods), ", ")
+	headers := strings.Join(orDefault(config.AllowHeaders, DefaultCORSHeaders), ", ")
+	exposed := strings.Join(orDefault(config.ExposeHeaders, DefaultCORSExposedHeaders), ", ")
+	var maxAge string
+	if config.MaxAge > 0 {
+		maxAge = strconv.Itoa(ceilSeconds(config.MaxAge))
+	}
+
+	// allowOrigin returns the Access-Control-Allow-Origin for origin, or "" when not
+	// allowed. Without credentials, allowing every origin answers "*", which caches
+	// alike for all of them.
+	allowOrigin := func(origin string) string {
+		if anyOrigin {
+			return "*"
+		}
+		lower := strings.ToLower(origin)
+		for _, pattern := range patterns {
+			if pattern.matches(lower) {
+				return origin
+			}
+		}
+		return ""
+	}
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		origin := c.GetHeader("Origin")
+		if !anyOrigin {
+			// The response depends on the origin of the request
+			header.Add("Vary", "Origin")
+		}
+
+		preflight := c.Request.Method == http.MethodOptions && origin != "" && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed := ""
+		if origin != "" || anyOrigin {
+			allowed = allowOrigin(origin)
+		}
+		if allowed != "" {
+			header.Set("Access-Control-Allow-Origin", allowed)
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if allowed != "" {
+				header.Set("Access-Control-Expose-Headers", exposed)
+			}
+			c.Next()
+			return
+		}
+
+		if allowed != "" {
+			header.Set("Access-Control-Allow-Methods", methods)
+			header.Set("Access-Control-Allow-Headers", headers)
+			if maxAge != "" {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}, nil
+}
+
+// orDefault returns values, or def when values is empty
+func orDefault(values, def []string) []string {
+	if len(values) == 0 {
+		return def
+	}
+	return values
+}
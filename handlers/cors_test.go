@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCORSRouter serves GET and OPTIONS /books behind the CORS middleware of config
+func newCORSRouter(t *testing.T, config CORSConfig) *gin.Engine {
+	t.Helper()
+	cors, err := CORS(config)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(cors)
+	r.GET("/books", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.OPTIONS("/books", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+// serveCORS serves a request to r with the given headers as "key", "value" pairs
+func serveCORS(r http.Handler, method string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/books", nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	r := newCORSRouter(t, CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	w := serveCORS(r, "OPTIONS",
+		"Origin", "https://app.example.com",
+		"Access-Control-Request-Method", "PATCH",
+		"Access-Control-Request-Headers", "Content-Type, If-Match",
+	)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "PATCH")
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "If-Match")
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+}
+
+func TestCORS_PreflightFromDisallowedOrigin(t *testing.T) {
+	r := newCORSRouter(t, CORSConfig{AllowOrigins: []string{"https://app.example.com"}})
+
+	w := serveCORS(r, "OPTIONS", "Origin", "https://evil.example.net", "Access-Control-Request-Method", "DELETE")
+
+	// ヘッダーがなければブラウザーが本リクエストを送らない
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestCORS_OptionsWithoutPreflightReachesRoute(t *testing.T) {
+	r := newCORSRouter(t, CORSConfig{AllowOrigins: []string{"*"}})
+
+	for name, headers := range map[string][]string{
+		"Originなし":         {"Access-Control-Request-Method", "POST"},
+		"Request-Methodなし": {"Origin", "https://app.example.com"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := serveCORS(r, "OPTIONS", headers...)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+		})
+	}
+}
+
+func TestCORS_ActualRequest(t *testing.T) {
+	r := newCORSRouter(t, CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowCredentials: true,
+		ExposeHeaders:    []string{"ETag"},
+	})
+
+	w := serveCORS(r, "GET", "Origin", "https://app.example.com")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "ETag", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+
+	// 許可されていないオリジンにもレスポンスは返すが、CORSヘッダーは付けない
+	w = serveCORS(r, "GET", "Origin", "https://evil.example.net")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+}
+
+func TestCORS_ProblemKeepsVaryOrigin(t *testing.T) {
+	r := newCORSRouter(t, CORSConfig{AllowOrigins: []string{"https://app.example.com"}})
+	r.GET("/books/:id", func(c *gin.Context) { AbortWithProblem(c, models.ErrNotFound) })
+
+	req := httptest.NewRequest("GET", "/books/abc", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	// エラーのレスポンスもオリジンごとに異なるため、共有キャッシュが他のオリジンに返さないようにする
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, []string{"Origin", "Accept, Accept-Language"}, w.Header().Values("Vary"))
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	r := newCORSRouter(t, CORSConfig{AllowOrigins: []string{"*"}})
+
+	w := serveCORS(r, "GET", "Origin", "https://app.example.com")
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "ETag, Deprecation, Sunset, Link, RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Empty(t, w.Header().Get("Vary"))
+}
+
+func TestCORS_OriginPatterns(t *testing.T) {
+	r := newCORSRouter(t, CORSConfig{AllowOrigins: []string{"https://*.example.com", "http://localhost:*"}})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://staging.app.example.com", true},
+		{"https://APP.Example.com", true},
+		{"http://localhost:5173", true},
+		{"https://example.com", false},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.net", false},
+		{"https://evil.net/.example.com", false},
+		{"http://localhost", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			w := serveCORS(r, "GET", "Origin", tt.origin)
+			if tt.allowed {
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestCORS_NoOrigins(t *testing.T) {
+	// オリジンを設定しなければクロスオリジンのリクエストは許可しない
+	r := newCORSRouter(t, CORSConfig{})
+
+	w := serveCORS(r, "GET", "Origin", "https://app.example.com")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CORSConfig
+	}{
+		{"全オリジンと資格情報", CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}},
+		{"スキームなし", CORSConfig{AllowOrigins: []string{"app.example.com"}}},
+		{"パス付き", CORSConfig{AllowOrigins: []string{"https://app.example.com/books"}}},
+		{"複数のワイルドカード", CORSConfig{AllowOrigins: []string{"https://*.*.example.com"}}},
+		{"スキームのワイルドカード", CORSConfig{AllowOrigins: []string{"*://app.example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CORS(tt.config)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+)
+
+// Namespaces of Dublin Core documents
+const (
+	dcNamespace      = "http://purl.org/dc/elements/1.1/"
+	dcTermsNamespace = "http://purl.org/dc/terms/"
+	oaiDCNamespace   = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+)
+
+// dcRecord is a Dublin Core record: the oai_dc:dc element used by OAI-PMH and SRU. Books
+// map onto the record as follows:
+//
+//	dc:title           title
+//	dc:creator         author
+//	dc:subject         genre
+//	dc:description     description
+//	dcterms:audience   purpose
+//	dc:identifier      ISBN, as urn:isbn:<ISBN>
+//
+// The purpose has no simple Dublin Core element, so it is written as the DCMI term
+// audience. Only the first value of repeated elements is imported.
+type dcRecord struct {
+	Titles       []string `xml:"http://purl.org/dc/elements/1.1/ title"`
+	Creators     []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subjects     []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Descriptions []string `xml:"http://purl.org/dc/elements/1.1/ description"`
+	Identifiers  []string `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+	Audiences    []string `xml:"http://purl.org/dc/terms/ audience"`
+}
+
+// isDCRecord reports whether an element is a Dublin Core record. Any element named dc
+// is accepted, so records can be read from OAI-PMH and SRU responses as well.
+func isDCRecord(name xml.Name) bool {
+	return name.Local == "dc"
+}
+
+// decodeDublinCore decodes a Dublin Core record element
+func decodeDublinCore(decoder *xml.Decoder, start *xml.StartElement) (dto.CreateBookRequest, error) {
+	var record dcRecord
+	if err := decoder.DecodeElement(&record, start); err != nil {
+		return dto.CreateBookRequest{}, err
+	}
+
+	book := dto.CreateBookRequest{
+		Title:       first(record.Titles),
+		Author:      first(record.Creators),
+		Genre:       first(record.Subjects),
+		Purpose:     first(record.Audiences),
+		Description: first(record.Descriptions),
+	}
+	for _, identifier := range record.Identifiers {
+		if isbn, ok := isbnFromIdentifier(identifier); ok {
+			book.ISBN = isbn
+			break
+		}
+	}
+	return book, nil
+}
+
+// isbnFromIdentifier extracts the ISBN from identifiers such as "urn:isbn:9780743273565"
+// or "ISBN 978-0-7432-7356-5"
+func isbnFromIdentifier(identifier string) (string, bool) {
+	identifier = strings.TrimSpace(identifier)
+	for _, prefix := range []string{"urn:isbn:", "isbn:", "isbn "} {
+		if len(identifier) > len(prefix) && strings.EqualFold(identifier[:len(prefix)], prefix) {
+			return strings.TrimSpace(identifier[len(prefix):]), true
+		}
+	}
+	return "", false
+}
+
+// first returns the first of values, or ""
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// newDublinCoreBookEncoder writes a records element holding an oai_dc:dc record per book
+func newDublinCoreBookEncoder(w io.Writer) (*xmlBookEncoder, error) {
+	root := xml.StartElement{
+		Name: xml.Name{Local: "records"},
+		Attr: []xml.Attr{
+			xmlns("oai_dc", oaiDCNamespace),
+			xmlns("dc", dcNamespace),
+			xmlns("dcterms", dcTermsNamespace),
+		},
+	}
+	return newXMLBookEncoder(w, root, nil, encodeDublinCore)
+}
+
+// encodeDublinCore writes the Dublin Core record of a book
+func encodeDublinCore(encoder *xml.Encoder, book *models.Book) error {
+	start := xml.StartElement{Name: xml.Name{Local: "oai_dc:dc"}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	identifier := ""
+	if book.ISBN != "" {
+		identifier = "urn:isbn:" + book.ISBN
+	}
+	elements := []struct{ name, text string }{
+		{"dc:title", book.Title},
+		{"dc:creator", book.Author},
+		{"dc:subject", book.Genre},
+		{"dc:description", book.Description},
+		{"dc:type", "Text"},
+		{"dc:identifier", identifier},
+		{"dcterms:audience", book.Purpose},
+	}
+	for _, element := range elements {
+		if err := encodeXMLText(encoder, element.name, element.text); err != nil {
+			return err
+		}
+	}
+
+	if err := encoder.EncodeToken(start.End()); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
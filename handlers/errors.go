@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/i18n"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// problemTypePrefix prefixes the problem type URI derived from each error code
+const problemTypePrefix = "urn:recomemento:problem:"
+
+// problemContentType is the media type of RFC 7807 problem details documents
+const problemContentType = "application/problem+json"
+
+// problemStatuses lists the HTTP status of every error code
+var problemStatuses = map[string]int{
+	dto.CodeInvalidRequest:         http.StatusBadRequest,
+	dto.CodeValidationFailed:       http.StatusBadRequest,
+	dto.CodeInvalidID:              http.StatusBadRequest,
+	dto.CodeInvalidPatch:           http.StatusUnprocessableEntity,
+	dto.CodeBookNotFound:           http.StatusNotFound,
+	dto.CodeRecommendationNotFound: http.StatusNotFound,
+	dto.CodeRouteNotFound:          http.StatusNotFound,
+	dto.CodePreconditionFailed:     http.StatusPreconditionFailed,
+	dto.CodeConflict:               http.StatusConflict,
+	dto.CodeConstraintViolation:    http.StatusUnprocessableEntity,
+	dto.CodeInternalError:          http.StatusInternalServerError,
+	dto.CodeBulkAborted:            http.StatusFailedDependency,
+	dto.CodeInvalidImport:          http.StatusBadRequest,
+	dto.CodeUnsupportedFormat:      http.StatusUnsupportedMediaType,
+	dto.CodeRequestTooLarge:        http.StatusRequestEntityTooLarge,
+	dto.CodeUnauthorized:           http.StatusUnauthorized,
+	dto.CodeForbidden:              http.StatusForbidden,
+	dto.CodeInsufficientScope:      http.StatusForbidden,
+	dto.CodeAPIKeyNotFound:         http.StatusNotFound,
+	dto.CodeAPIKeyRevoked:          http.StatusConflict,
+	dto.CodeRateLimited:            http.StatusTooManyRequests,
+}
+
+// AppError is an error carrying everything needed to render a problem details response.
+// Title and detail come from the i18n catalog ("problem.<code>.title" / ".detail") in the
+// negotiated language; Args are the arguments of the detail message. Err holds the
+// underlying cause; it is logged but never sent to the client.
+type AppError struct {
+	Status int
+	Code   string
+	Args   []interface{}
+	Fields []dto.FieldError
+	Err    error
+
+	// Report is the report of the rows an import applied before it failed, if any
+	Report *dto.ImportReport
+
+	// messageKeys holds the preferred catalog key of each entry in Fields, if any
+	messageKeys []string
+}
+
+// NewAppError creates an AppError for one of the dto.Code* error codes
+func NewAppError(code string, args ...interface{}) *AppError {
+	status, ok := problemStatuses[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return &AppError{
+		Status: status,
+		Code:   code,
+		Args:   args,
+	}
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Code, e.Err)
+	}
+	return e.Code
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Problem returns the problem details document for this error in the localizer's language
+func (e *AppError) Problem(localizer *i18n.Localizer, instance string) dto.ErrorResponse {
+	problem := dto.ErrorResponse{
+		Type:     problemTypePrefix + e.Code,
+		Title:    localizer.T("problem." + e.Code + ".title"),
+		Status:   e.Status,
+		Detail:   localizer.T("problem."+e.Code+".detail", e.Args...),
+		Instance: instance,
+		Code:     e.Code,
+		Import:   e.Report,
+	}
+	for i, field := range e.Fields {
+		var key string
+		if i < len(e.messageKeys) {
+			key = e.messageKeys[i]
+		}
+		field.Message = fieldErrorMessage(localizer, field, key)
+		problem.Errors = append(problem.Errors, field)
+	}
+	return problem
+}
+
+// AbortWithProblem aborts the request with a problem details response in the format
+// negotiated from Accept (application/problem+json by default) and the language
+// negotiated from Accept-Language. Errors that are not AppErrors are classified
+// by toAppError.
+func AbortWithProblem(c *gin.Context, err error) {
+	appErr := toAppError(err, c.GetHeader("If-Match") != "")
+	if appErr.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, appErr)
+	}
+
+	localizer := i18n.Negotiate(c.GetHeader("Accept-Language"))
+	format := negotiateFormat(c.GetHeader("Accept"))
+	c.Header("Content-Type", format.problemType)
+	c.Header("Content-Language", localizer.Language())
+	c.Writer.Header().Add("Vary", "Accept, Accept-Language")
+	c.Abort()
+	c.Render(appErr.Status, format.renderer(appErr.Problem(localizer, c.Request.URL.Path)))
+}
+
+// RouteNotFound renders unknown routes as problem details
+func RouteNotFound(c *gin.Context) {
+	AbortWithProblem(c, NewAppError(dto.CodeRouteNotFound, c.Request.Method, c.Request.URL.Path))
+}
+
+// toAppError classifies an error. Repository errors are mapped onto their HTTP
+// semantics; anything else is treated as a server-side failure. conditional reports
+// whether the write carried a version precondition, which turns a version mismatch
+// into a failed precondition rather than a conflict.
+func toAppError(err error, conditional bool) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		appErr = NewAppError(dto.CodeRequestTooLarge, tooLarge.Limit)
+		appErr.Err = err
+		return appErr
+	}
+
+	switch {
+	case errors.Is(err, models.ErrVersionMismatch) && conditional:
+		appErr = NewAppError(dto.CodePreconditionFailed)
+	case errors.Is(err, models.ErrNotFound):
+		appErr = NewAppError(dto.CodeBookNotFound)
+	case errors.Is(err, models.ErrConflict):
+		appErr = NewAppError(dto.CodeConflict)
+	case errors.Is(err, models.ErrValidation):
+		appErr = NewAppError(dto.CodeConstraintViolation)
+	default:
+		appErr = NewAppError(dto.CodeInternalError)
+	}
+	appErr.Err = err
+	return appErr
+}
+
+// bindError converts an error from ShouldBind* or ValidateStruct into an AppError,
+// reporting validator failures per field and bodies over their size limit as such
+func bindError(err error) *AppError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return toAppError(err, false)
+	}
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		appErr := NewAppError(dto.CodeInvalidRequest, err.Error())
+		appErr.Err = err
+		return appErr
+	}
+
+	appErr := NewAppError(dto.CodeValidationFailed)
+	appErr.Err = err
+	for _, fe := range validationErrs {
+		appErr.Fields = append(appErr.Fields, dto.FieldError{
+			Field: fe.Field(),
+			Rule:  fe.Tag(),
+			Param: ruleParam(fe),
+		})
+
+		// Length rules on collections count entries rather than characters
+		var key string
+		switch fe.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			key = "validation." + fe.Tag() + ".items"
+		}
+		appErr.messageKeys = append(appErr.messageKeys, key)
+	}
+	return appErr
+}
+
+// fieldErrorMessage describes a single validator failure using the preferred key if the
+// catalog has it, then the "validation.<rule>" message and finally "validation.default"
+func fieldErrorMessage(localizer *i18n.Localizer, field dto.FieldError, key string) string {
+	if key == "" || !localizer.Has(key) {
+		key = "validation." + field.Rule
+	}
+	if !localizer.Has(key) {
+		key = "validation.default"
+	}
+
+	label := field.Field
+	if localizer.Has("field." + field.Field) {
+		label = localizer.T("field." + field.Field)
+	}
+	return localizer.T(key, label, field.Param, field.Rule)
+}
+
+// errInvalidVersion is returned when a write is made conditional on version 0, which no
+// book has: versions start at 1
+func errInvalidVersion() *AppError {
+	appErr := NewAppError(dto.CodeValidationFailed)
+	appErr.Fields = []dto.FieldError{{Field: "version", Rule: "min", Param: "1"}}
+	appErr.messageKeys = []string{"validation.min.number"}
+	return appErr
+}
+
+// errInvalidID is returned when the :id path parameter is not a valid book ID
+func errInvalidID() *AppError {
+	return NewAppError(dto.CodeInvalidID)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bookETag returns the strong entity tag for the current version of a book, in its JSON
+// representation with every field and nothing embedded
+func bookETag(book *models.Book) string {
+	return fmt.Sprintf("\"%d-%d\"", book.ID, book.Version)
+}
+
+// representationETag returns the strong entity tag of the representation of the current
+// version of a book in format. A strong tag promises identical bytes, so every other
+// representation, in another format or with other fields= and include=, is tagged
+// "<id>-<version>-<variant>" with a hash of what sets it apart.
+func representationETag(book *models.Book, format *mediaFormat, representation bookRepresentation) string {
+	variant := representation.key()
+	if format != formatJSON {
+		variant = format.mediaTypes[0] + ";" + variant
+	}
+	if variant == "" {
+		return bookETag(book)
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(variant))
+	return fmt.Sprintf("\"%d-%d-%08x\"", book.ID, book.Version, hash.Sum32())
+}
+
+// embeddedETag extends the tag of a representation embedding related resources with a
+// hash of them, since they change without the version of the book
+func embeddedETag(etag string, response dto.BookResponse) (string, error) {
+	embedded, err := json.Marshal([]any{response.Authors, response.Tags, response.Ratings})
+	if err != nil {
+		return "", err
+	}
+	hash := fnv.New32a()
+	hash.Write(embedded)
+	return fmt.Sprintf("%s-%08x\"", strings.TrimSuffix(etag, "\""), hash.Sum32()), nil
+}
+
+// etagMatches reports whether an If-None-Match header value matches the given tag. Weak
+// validators are compared by their opaque tag, as RFC 9110 requires.
+func etagMatches(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// versionMatches reports whether an If-Match header value matches the current version of
+// book, which the tag of any of its representations does. Weak tags never match, as
+// If-Match requires the strong comparison.
+func versionMatches(header string, book *models.Book) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	etag := bookETag(book)
+	variants := strings.TrimSuffix(etag, "\"") + "-"
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == etag || strings.HasPrefix(candidate, variants) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion evaluates the If-Match precondition of a write request and returns the
+// version the write must target, or 0 when the request is unconditional. The boolean is
+// false when an error response has already been written.
+func (h *BookHandler) ifMatchVersion(c *gin.Context, id uint) (uint, bool) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		return 0, true
+	}
+
+	book, err := h.bookRepo.GetByID(id)
+	if err != nil {
+		AbortWithProblem(c, err)
+		return 0, false
+	}
+
+	if !versionMatches(ifMatch, book) {
+		abortPreconditionFailed(c)
+		return 0, false
+	}
+
+	return book.Version, true
+}
+
+// abortPreconditionFailed writes the 412 response for a stale If-Match
+func abortPreconditionFailed(c *gin.Context) {
+	AbortWithProblem(c, NewAppError(dto.CodePreconditionFailed))
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// exportColumns are the columns of CSV and XLSX exports. They match the import columns,
+// so an export can be imported again; the id column is ignored by the importer.
+var exportColumns = []string{"id", "title", "author", "genre", "purpose", "description", "isbn"}
+
+// exportSheet is the name of the worksheet holding the books of an XLSX export
+const exportSheet = "Books"
+
+// exportFormat describes the file of an export format
+type exportFormat struct {
+	contentType string
+	extension   string
+}
+
+// exportFormats lists the file of every export format
+var exportFormats = map[string]exportFormat{
+	dto.ExportFormatCSV:        {"text/csv; charset=utf-8", "csv"},
+	dto.ExportFormatNDJSON:     {"application/x-ndjson", "ndjson"},
+	dto.ExportFormatXLSX:       {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+	dto.ExportFormatMARC:       {"application/marc", "mrc"},
+	dto.ExportFormatMARCXML:    {"application/marcxml+xml", "marc.xml"},
+	dto.ExportFormatDublinCore: {"application/xml", "dc.xml"},
+	dto.ExportFormatONIX:       {"application/xml", "onix.xml"},
+}
+
+// bookEncoder writes books in one of the export formats
+type bookEncoder interface {
+	encode(book *models.Book) error
+	// finish writes whatever the format needs after the last book
+	finish() error
+	// release frees the resources held by the encoder, whether or not it finished
+	release()
+}
+
+// ExportBooks godoc
+// @Summary Export books
+// @Description Download the books matching the same filters as GET /books as CSV (with a header row and a
+// @Description UTF-8 byte order mark), JSON Lines (one book object per line), an Excel workbook, MARC 21
+// @Description (ISO 2709 or MARCXML), Dublin Core XML or ONIX 3.0. Books are read from the database in batches
+// @Description and streamed to the client; every format except xlsx can be imported again with POST /books/import.
+// @Tags books
+// @Produce text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/marc,application/marcxml+xml,application/xml
+// @Param format query string false "Export format; defaults to csv" Enums(csv, ndjson, xlsx, marc, marcxml, dc, onix)
+// @Param genre query string false "Only books of this genre"
+// @Param purpose query string false "Only books with this purpose"
+// @Param author query string false "Only books whose author contains this text, ignoring case"
+// @Success 200 {file} file
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /books/export [get]
+func (h *BookHandler) ExportBooks(c *gin.Context) {
+	var query dto.ExportBooksQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+	if query.Format == "" {
+		query.Format = dto.ExportFormatCSV
+	}
+
+	response := &exportWriter{c: c, format: query.Format}
+	out := bufio.NewWriter(response)
+	encoder, err := newBookEncoder(query.Format, out)
+	if err == nil {
+		defer encoder.release()
+		err = h.bookRepo.Each(bookFilter(query.ListBooksQuery), encoder.encode)
+	}
+	if err == nil {
+		err = encoder.finish()
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+
+	if err != nil {
+		if !response.started {
+			AbortWithProblem(c, err)
+			return
+		}
+		// The status line has been sent, so the client can only notice the failure
+		// from the truncated body
+		log.Printf("%s %s: export aborted: %v", c.Request.Method, c.Request.URL.Path, err)
+		c.Abort()
+		return
+	}
+	response.start()
+}
+
+// exportWriter writes the export to the response. The headers are only sent with the
+// first byte, so that an error before anything was written is still reported as a
+// problem response.
+type exportWriter struct {
+	c       *gin.Context
+	format  string
+	started bool
+}
+
+func (w *exportWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	format := exportFormats[w.format]
+	w.c.Header("Content-Type", format.contentType)
+	w.c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="books.%s"`, format.extension))
+	w.c.Status(http.StatusOK)
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	w.start()
+	return w.c.Writer.Write(p)
+}
+
+// newBookEncoder creates an encoder writing format to w
+func newBookEncoder(format string, w io.Writer) (bookEncoder, error) {
+	switch format {
+	case dto.ExportFormatNDJSON:
+		return &ndjsonBookEncoder{encoder: json.NewEncoder(w)}, nil
+	case dto.ExportFormatXLSX:
+		return newXLSXBookEncoder(w)
+	case dto.ExportFormatMARC:
+		return &iso2709BookEncoder{out: w}, nil
+	case dto.ExportFormatMARCXML:
+		return newMARCXMLBookEncoder(w)
+	case dto.ExportFormatDublinCore:
+		return newDublinCoreBookEncoder(w)
+	case dto.ExportFormatONIX:
+		return newONIXBookEncoder(w)
+	default:
+		// A byte order mark makes spreadsheet applications read the file as UTF-8
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return nil, err
+		}
+		return &csvBookEncoder{writer: writer}, nil
+	}
+}
+
+// exportRecord returns the values of the export columns of book for the spreadsheet
+// formats
+func exportRecord(book *models.Book) []string {
+	return []string{
+		strconv.FormatUint(uint64(book.ID), 10),
+		book.Title,
+		book.Author,
+		book.Genre,
+		book.Purpose,
+		book.Description,
+		book.ISBN,
+	}
+}
+
+// formulaPrefixes are the characters that make spreadsheet applications evaluate a cell
+// as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula prefixes s with an apostrophe when spreadsheet applications opening a
+// CSV file would evaluate it as a formula, which they display as text instead
+func escapeFormula(s string) string {
+	if isFormula(s) {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeFormula reverts escapeFormula. Only an apostrophe before a formula prefix is
+// removed; any other leading apostrophe is part of the value.
+func unescapeFormula(s string) string {
+	if strings.HasPrefix(s, "'") && isFormula(s[1:]) {
+		return s[1:]
+	}
+	return s
+}
+
+// isFormula reports whether s starts with one of formulaPrefixes
+func isFormula(s string) bool {
+	return s != "" && strings.IndexByte(formulaPrefixes, s[0]) >= 0
+}
+
+type csvBookEncoder struct {
+	writer *csv.Writer
+}
+
+// encode writes the record of book with its text escaped by escapeFormula. Workbooks
+// need no escaping: their cells are typed, and text cells are never evaluated.
+func (e *csvBookEncoder) encode(book *models.Book) error {
+	record := exportRecord(book)
+	for i := 1; i < len(record); i++ {
+		record[i] = escapeFormula(record[i])
+	}
+	return e.writer.Write(record)
+}
+
+func (e *csvBookEncoder) finish() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvBookEncoder) release() {}
+
+type ndjsonBookEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonBookEncoder) encode(book *models.Book) error {
+	return e.encoder.Encode(dto.BookResponse{
+		ID:          book.ID,
+		Title:       book.Title,
+		Author:      book.Author,
+		Genre:       book.Genre,
+		Purpose:     book.Purpose,
+		Description: book.Description,
+		ISBN:        book.ISBN,
+	})
+}
+
+func (e *ndjsonBookEncoder) finish() error {
+	return nil
+}
+
+func (e *ndjsonBookEncoder) release() {}
+
+// xlsxBookEncoder writes a workbook with a single worksheet. A workbook is a zip archive
+// that can only be written once the last row is known; until then the stream writer
+// keeps the rows in a temporary file rather than in memory.
+type xlsxBookEncoder struct {
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	out    io.Writer
+	row    int
+}
+
+func newXLSXBookEncoder(w io.Writer) (*xlsxBookEncoder, error) {
+	file := excelize.NewFile()
+	if err := file.SetSheetName(file.GetSheetName(0), exportSheet); err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream, err := file.NewStreamWriter(exportSheet)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	e := &xlsxBookEncoder{file: file, stream: stream, out: w}
+	header := make([]interface{}, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column
+	}
+	if err := e.writeRow(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *xlsxBookEncoder) encode(book *models.Book) error {
+	record := exportRecord(book)
+	values := make([]interface{}, len(record))
+	values[0] = book.ID
+	for i := 1; i < len(record); i++ {
+		values[i] = record[i]
+	}
+	return e.writeRow(values)
+}
+
+func (e *xlsxBookEncoder) writeRow(values []interface{}) error {
+	e.row++
+	cell, err := excelize.CoordinatesToCellName(1, e.row)
+	if err != nil {
+		return err
+	}
+	return e.stream.SetRow(cell, values)
+}
+
+func (e *xlsxBookEncoder) finish() error {
+	if err := e.stream.Flush(); err != nil {
+		return err
+	}
+	return e.file.Write(e.out)
+}
+
+// release removes the temporary files of the stream writer
+func (e *xlsxBookEncoder) release() {
+	e.file.Close()
+}
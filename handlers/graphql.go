@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+	"recomemento-api-go/i18n"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// GraphQLHandler serves the book catalog over GraphQL. It shares the repository, the
+// sanitization and validation rules and the error codes of the REST API.
+type GraphQLHandler struct {
+	books  *BookHandler
+	schema graphql.Schema
+}
+
+// NewGraphQLHandler creates a GraphQL handler over bookRepo
+func NewGraphQLHandler(bookRepo models.BookDatabase) *GraphQLHandler {
+	h := &GraphQLHandler{books: NewBookHandler(bookRepo)}
+	schema, err := graphql.NewSchema(h.schemaConfig())
+	if err != nil {
+		// The schema is static, so this can only be a programming error
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	h.schema = schema
+	return h
+}
+
+// graphQLRequest is the body of a GraphQL request
+type graphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLState is the per-request state resolvers reach through the context
+type graphQLState struct {
+	localizer *i18n.Localizer
+	// authorCounts loads the number of books of each author
+	authorCounts *batchLoader[string, int64]
+	// authorBooks loads the books of each author
+	authorBooks *batchLoader[string, []models.Book]
+}
+
+type graphQLStateKey struct{}
+
+// Serve executes a GraphQL request. As with any GraphQL server, errors raised while
+// executing the operation are reported in the errors member of a 200 response; only a
+// body that is not a GraphQL request is answered with a problem. Bodies are limited to
+// maxBodyBytes like other bodies, and queries nested deeper than maxGraphQLDepth are
+// rejected before they run.
+func (h *GraphQLHandler) Serve(c *gin.Context) {
+	body, err := limitedBody(c.Request, maxBodyBytes)
+	if err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+	c.Request.Body = io.NopCloser(body)
+
+	var req graphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+	if err := checkQueryDepth(req.Query, maxGraphQLDepth); err != nil {
+		c.JSON(http.StatusOK, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	repo := h.books.bookRepo
+	state := &graphQLState{
+		localizer:    i18n.Negotiate(c.GetHeader("Accept-Language")),
+		authorCounts: newBatchLoader(repo.CountByAuthor),
+		authorBooks: newBatchLoader(func(authors []string) (map[string][]models.Book, error) {
+			books, err := repo.Find(models.BookFilter{Authors: authors})
+			if err != nil {
+				return nil, err
+			}
+			byAuthor := make(map[string][]models.Book, len(authors))
+			for _, book := range books {
+				byAuthor[book.Author] = append(byAuthor[book.Author], book)
+			}
+			return byAuthor, nil
+		}),
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        context.WithValue(c.Request.Context(), graphQLStateKey{}, state),
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// maxGraphQLDepth limits how deeply the selections of a query may nest, as books and
+// their authors can otherwise be nested without end. It leaves room for the
+// introspection query of GraphQL tools.
+const maxGraphQLDepth = 15
+
+// checkQueryDepth returns an error when the selections of an operation in query nest
+// deeper than limit. Queries that do not parse are left to graphql.Do to report.
+func checkQueryDepth(query string, limit int) error {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return nil
+	}
+
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	measure := &depthMeasure{fragments: fragments, depths: map[string]int{}, visiting: map[string]bool{}}
+	for _, definition := range doc.Definitions {
+		if operation, ok := definition.(*ast.OperationDefinition); ok {
+			if depth := measure.selectionSet(operation.SelectionSet); depth > limit {
+				return fmt.Errorf("query depth %d exceeds the limit of %d", depth, limit)
+			}
+		}
+	}
+	return nil
+}
+
+// depthMeasure measures the depth of selection sets, following fragment spreads. The
+// depth of each fragment is measured once; spreads that cycle back to a fragment being
+// measured add nothing, as validation rejects them anyway.
+type depthMeasure struct {
+	fragments map[string]*ast.FragmentDefinition
+	depths    map[string]int
+	visiting  map[string]bool
+}
+
+func (m *depthMeasure) selectionSet(set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+	depth := 0
+	for _, selection := range set.Selections {
+		var d int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d = 1 + m.selectionSet(selection.SelectionSet)
+		case *ast.InlineFragment:
+			d = m.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			d = m.fragment(selection.Name)
+		}
+		depth = max(depth, d)
+	}
+	return depth
+}
+
+func (m *depthMeasure) fragment(name *ast.Name) int {
+	if name == nil {
+		return 0
+	}
+	if depth, ok := m.depths[name.Value]; ok {
+		return depth
+	}
+	fragment, ok := m.fragments[name.Value]
+	if !ok || m.visiting[name.Value] {
+		return 0
+	}
+	m.visiting[name.Value] = true
+	depth := m.selectionSet(fragment.SelectionSet)
+	delete(m.visiting, name.Value)
+	m.depths[name.Value] = depth
+	return depth
+}
+
+// stateOf returns the request state of a resolver
+func stateOf(p graphql.ResolveParams) *graphQLState {
+	return p.Context.Value(graphQLStateKey{}).(*graphQLState)
+}
+
+// graphQLError reports an AppError as a GraphQL error. The message is the localized
+// problem detail; the code, the HTTP status the REST API would answer with and any field
+// errors are extensions.
+type graphQLError struct {
+	problem dto.ErrorResponse
+}
+
+func (e graphQLError) Error() string {
+	return e.problem.Detail
+}
+
+func (e graphQLError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"code":   e.problem.Code,
+		"status": e.problem.Status,
+	}
+	if len(e.problem.Errors) > 0 {
+		extensions["errors"] = e.problem.Errors
+	}
+	return extensions
+}
+
+// fail converts err into a GraphQL error the way AbortWithProblem converts it into a
+// problem. conditional reports whether the write carried a version precondition.
+func fail(p graphql.ResolveParams, err error, conditional bool) error {
+	appErr := toAppError(err, conditional)
+	if appErr.Status >= http.StatusInternalServerError {
+		log.Printf("graphql %s: %v", p.Info.FieldName, appErr)
+	}
+	return graphQLError{problem: appErr.Problem(stateOf(p).localizer, "")}
+}
+
+// schemaConfig describes the schema. Book mirrors dto.BookResponse, plus the version used
+// for optimistic concurrency; authors and Author.books are loaded in batches per request.
+func (h *GraphQLHandler) schemaConfig() graphql.SchemaConfig {
+	authorType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Author",
+		Description: "An author of books in the catalog",
+		// Filled in below, once Book exists
+		Fields: graphql.Fields{},
+	})
+
+	bookType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Book",
+		Description: "A book of the catalog",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"title":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"author":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"genre":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"purpose":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"description": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"isbn": &graphql.Field{
+				Type:        graphql.String,
+				Description: "ISBN of the book, or null when unknown",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if isbn := p.Source.(*models.Book).ISBN; isbn != "" {
+						return isbn, nil
+					}
+					return nil, nil
+				},
+			},
+			"version": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Version to pass to updateBook and deleteBook to make them conditional",
+			},
+			"authors": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(authorType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return []string{p.Source.(*models.Book).Author}, nil
+				},
+			},
+		},
+	})
+
+	// Author is resolved from the author's name
+	authorType.AddFieldConfig("name", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(string), nil
+		},
+	})
+	authorType.AddFieldConfig("bookCount", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "Number of books by the author in the catalog",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			count := stateOf(p).authorCounts.load(p.Source.(string))
+			return func() (interface{}, error) {
+				n, err := count()
+				if err != nil {
+					return nil, fail(p, err, false)
+				}
+				return n, nil
+			}, nil
+		},
+	})
+	authorType.AddFieldConfig("books", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+		Description: "Books by the author, ordered by ID",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			books := stateOf(p).authorBooks.load(p.Source.(string))
+			return func() (interface{}, error) {
+				result, err := books()
+				if err != nil {
+					return nil, fail(p, err, false)
+				}
+				return bookPointers(result), nil
+			}, nil
+		},
+	})
+
+	createInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateBookInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"author":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"genre":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"purpose":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"description": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"isbn":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+	updateInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "UpdateBookInput",
+		Description: "Fields to change; omitted fields are left untouched",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"author":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"genre":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"purpose":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"description": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"isbn":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	bookList := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType)))
+	idArg := &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}
+	versionArg := &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "Only apply the change if the book is still at this version",
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"book": &graphql.Field{
+				Type:        bookType,
+				Description: "A book by ID, or null when it does not exist",
+				Args:        graphql.FieldConfigArgument{"id": idArg},
+				Resolve:     h.resolveBook,
+			},
+			"books": &graphql.Field{
+				Type:        bookList,
+				Description: "Books ordered by ID, optionally filtered like GET /books",
+				Args: graphql.FieldConfigArgument{
+					"genre":   &graphql.ArgumentConfig{Type: graphql.String},
+					"purpose": &graphql.ArgumentConfig{Type: graphql.String},
+					"author":  &graphql.ArgumentConfig{Type: graphql.String, Description: "Substring of the author, ignoring case"},
+				},
+				Resolve: h.resolveBooks,
+			},
+			"search": &graphql.Field{
+				Type:        bookList,
+				Description: "Books whose title, author, genre or description contain every word of the query",
+				Args: graphql.FieldConfigArgument{
+					"query": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveSearch,
+			},
+			"recommendation": &graphql.Field{
+				Type:        bookType,
+				Description: "A book of the genre with the purpose, or null when there is none",
+				Args: graphql.FieldConfigArgument{
+					"genre":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"purpose": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveRecommendation,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createBook": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createInput)},
+				},
+				Resolve: h.resolveCreateBook,
+			},
+			"updateBook": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{
+					"id":      idArg,
+					"input":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateInput)},
+					"version": versionArg,
+				},
+				Resolve: h.resolveUpdateBook,
+			},
+			"deleteBook": &graphql.Field{
+				Type:        bookType,
+				Description: "Deletes a book and returns it as it was",
+				Args: graphql.FieldConfigArgument{
+					"id":      idArg,
+					"version": versionArg,
+				},
+				Resolve: h.resolveDeleteBook,
+			},
+		},
+	})
+
+	return graphql.SchemaConfig{Query: query, Mutation: mutation}
+}
+
+func (h *GraphQLHandler) resolveBook(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArgument(p)
+	if err != nil {
+		return nil, err
+	}
+	book, err := h.books.bookRepo.GetByID(id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fail(p, err, false)
+	}
+	return book, nil
+}
+
+func (h *GraphQLHandler) resolveBooks(p graphql.ResolveParams) (interface{}, error) {
+	query := dto.ListBooksQuery{
+		Genre:   stringArgument(p, "genre"),
+		Purpose: stringArgument(p, "purpose"),
+		Author:  stringArgument(p, "author"),
+	}
+	if err := binding.Validator.ValidateStruct(&query); err != nil {
+		return nil, fail(p, bindError(err), false)
+	}
+	books, err := h.books.bookRepo.Find(bookFilter(query))
+	if err != nil {
+		return nil, fail(p, err, false)
+	}
+	return bookPointers(books), nil
+}
+
+func (h *GraphQLHandler) resolveSearch(p graphql.ResolveParams) (interface{}, error) {
+	books, err := h.books.bookRepo.Search(stringArgument(p, "query"))
+	if err != nil {
+		return nil, fail(p, err, false)
+	}
+	return bookPointers(books), nil
+}
+
+func (h *GraphQLHandler) resolveRecommendation(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePermission(p.Context, auth.Recommend); err != nil {
+		return nil, fail(p, err, false)
+	}
+
+	req := dto.RecommendBookRequest{
+		Genre:   stringArgument(p, "genre"),
+		Purpose: stringArgument(p, "purpose"),
+	}
+	sanitize(&req)
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, fail(p, bindError(err), false)
+	}
+
+	book, err := h.books.bookRepo.FindByGenreAndPurpose(req.Genre, req.Purpose)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fail(p, err, false)
+	}
+	return book, nil
+}
+
+func (h *GraphQLHandler) resolveCreateBook(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePermission(p.Context, auth.WriteBooks); err != nil {
+		return nil, fail(p, err, false)
+	}
+
+	input, _ := p.Args["input"].(map[string]interface{})
+	req := dto.CreateBookRequest{
+		Title:       stringField(input, "title"),
+		Author:      stringField(input, "author"),
+		Genre:       stringField(input, "genre"),
+		Purpose:     stringField(input, "purpose"),
+		Description: stringField(input, "description"),
+		ISBN:        stringField(input, "isbn"),
+	}
+	sanitize(&req)
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, fail(p, bindError(err), false)
+	}
+
+	book := &models.Book{
+		Title:       req.Title,
+		Author:      req.Author,
+		Genre:       req.Genre,
+		Purpose:     req.Purpose,
+		Description: req.Description,
+		ISBN:        req.ISBN,
+	}
+	if err := h.books.bookRepo.Create(book); err != nil {
+		return nil, fail(p, err, false)
+	}
+	return book, nil
+}
+
+func (h *GraphQLHandler) resolveUpdateBook(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePermission(p.Context, auth.WriteBooks); err != nil {
+		return nil, fail(p, err, false)
+	}
+
+	id, err := idArgument(p)
+	if err != nil {
+		return nil, err
+	}
+
+	input, _ := p.Args["input"].(map[string]interface{})
+	var req dto.UpdateBookRequest
+	for field, target := range map[string]**string{
+		"title":       &req.Title,
+		"author":      &req.Author,
+		"genre":       &req.Genre,
+		"purpose":     &req.Purpose,
+		"description": &req.Description,
+		"isbn":        &req.ISBN,
+	} {
+		if value, ok := input[field].(string); ok {
+			*target = &value
+		}
+	}
+
+	version, conditional, err := versionArgument(p)
+	if err != nil {
+		return nil, err
+	}
+	var precondition func(current *models.Book) bool
+	if conditional {
+		precondition = func(current *models.Book) bool {
+			return current.Version == version
+		}
+	}
+
+	book, err := h.books.changeBook(id, precondition, func(current dto.ReplaceBookRequest) (dto.ReplaceBookRequest, error) {
+		return applyUpdateRequest(current, req), nil
+	})
+	if err != nil {
+		return nil, fail(p, err, conditional)
+	}
+	return book, nil
+}
+
+func (h *GraphQLHandler) resolveDeleteBook(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePermission(p.Context, auth.WriteBooks); err != nil {
+		return nil, fail(p, err, false)
+	}
+
+	id, err := idArgument(p)
+	if err != nil {
+		return nil, err
+	}
+
+	version, conditional, err := versionArgument(p)
+	if err != nil {
+		return nil, err
+	}
+	var book *models.Book
+	if conditional {
+		book, err = h.books.bookRepo.DeleteIfVersion(id, version)
+	} else {
+		book, err = h.books.bookRepo.Delete(id)
+	}
+	if err != nil {
+		return nil, fail(p, err, conditional)
+	}
+	return book, nil
+}
+
+// idArgument parses the id argument of a field
+func idArgument(p graphql.ResolveParams) (uint, error) {
+	id, err := strconv.ParseUint(stringArgument(p, "id"), 10, 32)
+	if err != nil {
+		return 0, fail(p, errInvalidID(), false)
+	}
+	return uint(id), nil
+}
+
+// versionArgument returns the version argument of a field and whether it was given.
+// Versions start at 1, so a smaller one is rejected rather than wrapped around or
+// taken as no condition.
+func versionArgument(p graphql.ResolveParams) (uint, bool, error) {
+	version, ok := p.Args["version"].(int)
+	if !ok {
+		return 0, false, nil
+	}
+	if version < 1 {
+		return 0, false, fail(p, errInvalidVersion(), false)
+	}
+	return uint(version), true, nil
+}
+
+// stringArgument returns a string argument of a field, or "" when it was not given
+func stringArgument(p graphql.ResolveParams, name string) string {
+	return stringField(p.Args, name)
+}
+
+// stringField returns a string member of an argument or input object, or ""
+func stringField(values map[string]interface{}, name string) string {
+	value, _ := values[name].(string)
+	return value
+}
+
+// bookPointers returns pointers to the elements of books, the source type of Book
+func bookPointers(books []models.Book) []*models.Book {
+	pointers := make([]*models.Book, len(books))
+	for i := range books {
+		pointers[i] = &books[i]
+	}
+	return pointers
+}
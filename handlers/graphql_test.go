@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type graphQLTestResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// postGraphQL sends a GraphQL request to a handler over mockRepo
+func postGraphQL(t *testing.T, mockRepo *MockBookDatabase, body interface{}, headers ...string) (*httptest.ResponseRecorder, graphQLTestResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/graphql", NewGraphQLHandler(mockRepo).Serve)
+	return postGraphQLTo(t, r, body, headers...)
+}
+
+// postGraphQLTo sends a GraphQL request to the /graphql route of r
+func postGraphQLTo(t *testing.T, r http.Handler, body interface{}, headers ...string) (*httptest.ResponseRecorder, graphQLTestResponse) {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response graphQLTestResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	}
+	return w, response
+}
+
+func TestGraphQL_Book(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("GetByID", uint(1)).Return(&models.Book{
+		ID: 1, Title: "Go入門", Author: "山田太郎", Genre: "技術書", Purpose: "学習", Description: "Goの入門書", Version: 3,
+	}, nil)
+
+	w, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `{ book(id: "1") { id title author genre purpose description isbn version } }`,
+	})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"id":"1","title":"Go入門","author":"山田太郎","genre":"技術書","purpose":"学習","description":"Goの入門書","isbn":null,"version":3}`, string(response.Data["book"]))
+}
+
+func TestGraphQL_BookNotFound(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("GetByID", uint(999)).Return((*models.Book)(nil), models.ErrNotFound)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `{ book(id: "999") { id } }`,
+	})
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `null`, string(response.Data["book"]))
+}
+
+func TestGraphQL_InvalidID(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `{ book(id: "abc") { id } }`,
+	})
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, dto.CodeInvalidID, response.Errors[0].Extensions["code"])
+	assert.Equal(t, float64(http.StatusBadRequest), response.Errors[0].Extensions["status"])
+	mockRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+}
+
+func TestGraphQL_BooksWithVariables(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Find", models.BookFilter{Genre: "技術書"}).Return([]models.Book{
+		{ID: 1, Title: "Go入門", Genre: "技術書"},
+		{ID: 2, Title: "Go実践", Genre: "技術書"},
+	}, nil)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query":     `query Books($genre: String) { books(genre: $genre) { id title } }`,
+		"variables": map[string]interface{}{"genre": "技術書"},
+	})
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `[{"id":"1","title":"Go入門"},{"id":"2","title":"Go実践"}]`, string(response.Data["books"]))
+}
+
+func TestGraphQL_Search(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Search", "go 入門").Return([]models.Book{{ID: 1, Title: "Go入門"}}, nil)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `{ search(query: "go 入門") { title } }`,
+	})
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `[{"title":"Go入門"}]`, string(response.Data["search"]))
+}
+
+func TestGraphQL_Recommendation(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("FindByGenreAndPurpose", "技術書", "学習").Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	mockRepo.On("FindByGenreAndPurpose", "絵本", "学習").Return((*models.Book)(nil), models.ErrNotFound)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `{
+			found: recommendation(genre: " 技術書 ", purpose: "学習") { title }
+			missing: recommendation(genre: "絵本", purpose: "学習") { title }
+		}`,
+	})
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"title":"Go入門"}`, string(response.Data["found"]))
+	assert.JSONEq(t, `null`, string(response.Data["missing"]))
+}
+
+func TestGraphQL_NestedAuthorsAreBatched(t *testing.T) {
+	// 一覧の各書籍の著者情報は、書籍の数によらず1回の問い合わせでまとめて取得する
+	mockRepo := new(MockBookDatabase)
+	books := []models.Book{
+		{ID: 1, Title: "A", Author: "山田太郎"},
+		{ID: 2, Title: "B", Author: "佐藤花子"},
+		{ID: 3, Title: "C", Author: "山田太郎"},
+	}
+	mockRepo.On("Find", models.BookFilter{}).Return(books, nil).Once()
+	mockRepo.On("CountByAuthor", []string{"山田太郎", "佐藤花子"}).Return(map[string]int64{"山田太郎": 2, "佐藤花子": 1}, nil).Once()
+	mockRepo.On("Find", models.BookFilter{Authors: []string{"山田太郎", "佐藤花子"}}).Return(books, nil).Once()
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `{ books { id authors { name bookCount books { id } } } }`,
+	})
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `[
+		{"id":"1","authors":[{"name":"山田太郎","bookCount":2,"books":[{"id":"1"},{"id":"3"}]}]},
+		{"id":"2","authors":[{"name":"佐藤花子","bookCount":1,"books":[{"id":"2"}]}]},
+		{"id":"3","authors":[{"name":"山田太郎","bookCount":2,"books":[{"id":"1"},{"id":"3"}]}]}
+	]`, string(response.Data["books"]))
+	mockRepo.AssertNumberOfCalls(t, "CountByAuthor", 1)
+	mockRepo.AssertNumberOfCalls(t, "Find", 2)
+}
+
+func TestGraphQL_LoaderErrorIsReported(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Find", models.BookFilter{}).Return([]models.Book{{ID: 1, Author: "山田太郎"}}, nil)
+	mockRepo.On("CountByAuthor", []string{"山田太郎"}).Return(nil, errors.New("database error"))
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `{ books { authors { bookCount } } }`,
+	})
+
+	require.NotEmpty(t, response.Errors)
+	assert.Equal(t, []interface{}{"books", float64(0), "authors", float64(0), "bookCount"}, response.Errors[0].Path)
+	assert.NotContains(t, response.Errors[0].Message, "database error")
+}
+
+func TestGraphQL_CreateBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Title == "Go入門" && book.ISBN == ""
+	})).Return(nil)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `mutation Create($input: CreateBookInput!) { createBook(input: $input) { id title version } }`,
+		"variables": map[string]interface{}{"input": map[string]interface{}{
+			"title": "  Go入門  ", "author": "山田太郎", "genre": "技術書", "purpose": "学習", "description": "Goの入門書",
+		}},
+	})
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"id":"1","title":"Go入門","version":0}`, string(response.Data["createBook"]))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGraphQL_CreateBookValidationError(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `mutation { createBook(input: {title: "   ", author: "山田太郎", genre: "技術書", purpose: "学習", description: "説明"}) { id } }`,
+	}, "Accept-Language", "ja")
+
+	require.Len(t, response.Errors, 1)
+	extensions := response.Errors[0].Extensions
+	assert.Equal(t, dto.CodeValidationFailed, extensions["code"])
+	assert.Equal(t, float64(http.StatusBadRequest), extensions["status"])
+	fieldErrors := extensions["errors"].([]interface{})
+	require.Len(t, fieldErrors, 1)
+	assert.Equal(t, "title", fieldErrors[0].(map[string]interface{})["field"])
+	assert.Equal(t, "required", fieldErrors[0].(map[string]interface{})["rule"])
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestGraphQL_UpdateBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	current := &models.Book{ID: 1, Title: "Old", Author: "山田太郎", Genre: "技術書", Purpose: "学習", Description: "説明", Version: 2}
+	mockRepo.On("GetByID", uint(1)).Return(current, nil)
+	mockRepo.On("UpdateIfVersion", uint(1), uint(2), map[string]interface{}{"title": "New"}).
+		Return(&models.Book{ID: 1, Title: "New", Version: 3}, nil)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `mutation { updateBook(id: "1", version: 2, input: {title: "New"}) { title version } }`,
+	})
+
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"title":"New","version":3}`, string(response.Data["updateBook"]))
+}
+
+func TestGraphQL_UpdateBookStaleVersion(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("GetByID", uint(1)).Return(&models.Book{ID: 1, Title: "Old", Version: 3}, nil)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `mutation { updateBook(id: "1", version: 2, input: {title: "New"}) { title } }`,
+	})
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, dto.CodePreconditionFailed, response.Errors[0].Extensions["code"])
+	mockRepo.AssertNotCalled(t, "UpdateIfVersion", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGraphQL_DeleteBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Delete", uint(1)).Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	mockRepo.On("DeleteIfVersion", uint(2), uint(5)).Return((*models.Book)(nil), models.ErrVersionMismatch)
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `mutation {
+			deleted: deleteBook(id: "1") { title }
+			stale: deleteBook(id: "2", version: 5) { title }
+		}`,
+	})
+
+	assert.JSONEq(t, `{"title":"Go入門"}`, string(response.Data["deleted"]))
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, []interface{}{"stale"}, response.Errors[0].Path)
+	assert.Equal(t, dto.CodePreconditionFailed, response.Errors[0].Extensions["code"])
+}
+
+func TestGraphQL_InvalidVersion(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+
+	// 0 や負のバージョンは無条件の書き込みにも巨大な uint にもならない
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{
+		"query": `mutation {
+			zero: deleteBook(id: "1", version: 0) { title }
+			negative: deleteBook(id: "1", version: -1) { title }
+			update: updateBook(id: "1", version: 0, input: {title: "New"}) { title }
+		}`,
+	})
+
+	require.Len(t, response.Errors, 3)
+	for _, gqlErr := range response.Errors {
+		assert.Equal(t, dto.CodeValidationFailed, gqlErr.Extensions["code"])
+		fieldErrors := gqlErr.Extensions["errors"].([]interface{})
+		require.Len(t, fieldErrors, 1)
+		assert.Equal(t, "version", fieldErrors[0].(map[string]interface{})["field"])
+	}
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything)
+	mockRepo.AssertNotCalled(t, "DeleteIfVersion", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+}
+
+func TestGraphQL_InvalidRequest(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+
+	w, _ := postGraphQL(t, mockRepo, map[string]interface{}{"variables": map[string]interface{}{}})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
+
+func TestGraphQL_SyntaxError(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+
+	w, response := postGraphQL(t, mockRepo, map[string]interface{}{"query": `{ books { id `})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, response.Errors)
+}
+
+func TestGraphQL_TooDeep(t *testing.T) {
+	// 書籍と著者を交互に入れ子にした深すぎるクエリは実行しない
+	mockRepo := new(MockBookDatabase)
+	query := "id"
+	for i := 0; i < 8; i++ {
+		query = "books { authors { " + query + " } }"
+	}
+
+	w, response := postGraphQL(t, mockRepo, map[string]interface{}{"query": "{ " + query + " }"})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "query depth 17 exceeds the limit of 15", response.Errors[0].Message)
+	assert.Nil(t, response.Data)
+	mockRepo.AssertNotCalled(t, "Find", mock.Anything)
+}
+
+func TestGraphQL_TooDeepThroughFragments(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	query := `{ books { ...F8 } }
+		fragment F0 on Book { id }`
+	for i := 1; i <= 8; i++ {
+		query += fmt.Sprintf("\nfragment F%d on Book { authors { books { ...F%d } } }", i, i-1)
+	}
+
+	_, response := postGraphQL(t, mockRepo, map[string]interface{}{"query": query})
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "query depth 18 exceeds the limit of 15", response.Errors[0].Message)
+	mockRepo.AssertNotCalled(t, "Find", mock.Anything)
+}
+
+func TestGraphQL_Introspection(t *testing.T) {
+	// GraphQLのツールが送るイントロスペクションのクエリは深さの上限に収まる
+	_, response := postGraphQL(t, new(MockBookDatabase), map[string]interface{}{"query": testutil.IntrospectionQuery})
+
+	assert.Empty(t, response.Errors)
+	assert.Contains(t, response.Data, "__schema")
+}
+
+func TestGraphQL_TooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/graphql", NewGraphQLHandler(new(MockBookDatabase)).Serve)
+	body := `{"query": "{ books { id } }", "variables": {"padding": "` + strings.Repeat("a", maxBodyBytes) + `"}}`
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, dto.CodeRequestTooLarge, errorCode(t, w))
+}
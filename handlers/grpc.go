@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/i18n"
+	"recomemento-api-go/models"
+	bookv1 "recomemento-api-go/proto/book/v1"
+
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// grpcErrorDomain is the domain of the ErrorInfo detail attached to every error
+const grpcErrorDomain = "recomemento"
+
+// exportChunkSize is the size of the data of each ExportChunk
+const exportChunkSize = 32 * 1024
+
+// grpcCodes lists the gRPC status code of every error code. Codes missing here are
+// reported as Internal.
+var grpcCodes = map[string]codes.Code{
+	dto.CodeInvalidRequest:         codes.InvalidArgument,
+	dto.CodeValidationFailed:       codes.InvalidArgument,
+	dto.CodeInvalidID:              codes.InvalidArgument,
+	dto.CodeInvalidPatch:           codes.InvalidArgument,
+	dto.CodeBookNotFound:           codes.NotFound,
+	dto.CodeRecommendationNotFound: codes.NotFound,
+	dto.CodePreconditionFailed:     codes.FailedPrecondition,
+	dto.CodeConflict:               codes.Aborted,
+	dto.CodeConstraintViolation:    codes.FailedPrecondition,
+	dto.CodeInternalError:          codes.Internal,
+	dto.CodeUnsupportedFormat:      codes.InvalidArgument,
+	dto.CodeUnauthorized:           codes.Unauthenticated,
+	dto.CodeForbidden:              codes.PermissionDenied,
+	dto.CodeInsufficientScope:      codes.PermissionDenied,
+	dto.CodeRateLimited:            codes.ResourceExhausted,
+}
+
+// GRPCBookService implements the BookService of proto/book/v1 over the same repository,
+// sanitization, validation and error codes as the REST API
+type GRPCBookService struct {
+	bookv1.UnimplementedBookServiceServer
+	books *BookHandler
+}
+
+// NewGRPCBookService creates a BookService over bookRepo
+func NewGRPCBookService(bookRepo models.BookDatabase) *GRPCBookService {
+	return &GRPCBookService{books: NewBookHandler(bookRepo)}
+}
+
+// CreateBook creates a book
+func (s *GRPCBookService) CreateBook(ctx context.Context, in *bookv1.CreateBookRequest) (*bookv1.Book, error) {
+	req := dto.CreateBookRequest{
+		Title:       in.GetTitle(),
+		Author:      in.GetAuthor(),
+		Genre:       in.GetGenre(),
+		Purpose:     in.GetPurpose(),
+		Description: in.GetDescription(),
+		ISBN:        in.GetIsbn(),
+	}
+	sanitize(&req)
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, grpcError(ctx, "CreateBook", bindError(err), false)
+	}
+
+	book := &models.Book{
+		Title:       req.Title,
+		Author:      req.Author,
+		Genre:       req.Genre,
+		Purpose:     req.Purpose,
+		Description: req.Description,
+		ISBN:        req.ISBN,
+	}
+	if err := s.books.bookRepo.Create(book); err != nil {
+		return nil, grpcError(ctx, "CreateBook", err, false)
+	}
+	return protoBook(book), nil
+}
+
+// GetBook returns a book by ID
+func (s *GRPCBookService) GetBook(ctx context.Context, in *bookv1.GetBookRequest) (*bookv1.Book, error) {
+	book, err := s.books.bookRepo.GetByID(uint(in.GetId()))
+	if err != nil {
+		return nil, grpcError(ctx, "GetBook", err, false)
+	}
+	return protoBook(book), nil
+}
+
+// ListBooks streams the books matching the filter, reading them from the database in
+// batches so that the whole catalog is never held in memory
+func (s *GRPCBookService) ListBooks(in *bookv1.ListBooksRequest, stream grpc.ServerStreamingServer[bookv1.Book]) error {
+	ctx := stream.Context()
+	query := dto.ListBooksQuery{Genre: in.GetGenre(), Purpose: in.GetPurpose(), Author: in.GetAuthor()}
+	if err := binding.Validator.ValidateStruct(&query); err != nil {
+		return grpcError(ctx, "ListBooks", bindError(err), false)
+	}
+
+	err := s.books.bookRepo.Each(bookFilter(query), func(book *models.Book) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return stream.Send(protoBook(book))
+	})
+	if err != nil {
+		return streamError(ctx, "ListBooks", err)
+	}
+	return nil
+}
+
+// UpdateBook changes the fields that are set. With a version, the book is only changed
+// if it is still at that version; without one, concurrent changes are retried.
+func (s *GRPCBookService) UpdateBook(ctx context.Context, in *bookv1.UpdateBookRequest) (*bookv1.Book, error) {
+	if in.Version != nil && in.GetVersion() == 0 {
+		return nil, grpcError(ctx, "UpdateBook", errInvalidVersion(), false)
+	}
+	req := dto.UpdateBookRequest{
+		Title:       in.Title,
+		Author:      in.Author,
+		Genre:       in.Genre,
+		Purpose:     in.Purpose,
+		Description: in.Description,
+		ISBN:        in.Isbn,
+	}
+
+	var precondition func(current *models.Book) bool
+	if in.Version != nil {
+		precondition = func(current *models.Book) bool {
+			return current.Version == uint(in.GetVersion())
+		}
+	}
+
+	book, err := s.books.changeBook(uint(in.GetId()), precondition, func(current dto.ReplaceBookRequest) (dto.ReplaceBookRequest, error) {
+		return applyUpdateRequest(current, req), nil
+	})
+	if err != nil {
+		return nil, grpcError(ctx, "UpdateBook", err, in.Version != nil)
+	}
+	return protoBook(book), nil
+}
+
+// DeleteBook deletes a book and returns it as it was. With a version, the book is only
+// deleted if it is still at that version.
+func (s *GRPCBookService) DeleteBook(ctx context.Context, in *bookv1.DeleteBookRequest) (*bookv1.Book, error) {
+	if in.Version != nil && in.GetVersion() == 0 {
+		return nil, grpcError(ctx, "DeleteBook", errInvalidVersion(), false)
+	}
+	var book *models.Book
+	var err error
+	if in.Version != nil {
+		book, err = s.books.bookRepo.DeleteIfVersion(uint(in.GetId()), uint(in.GetVersion()))
+	} else {
+		book, err = s.books.bookRepo.Delete(uint(in.GetId()))
+	}
+	if err != nil {
+		return nil, grpcError(ctx, "DeleteBook", err, in.Version != nil)
+	}
+	return protoBook(book), nil
+}
+
+// RecommendBook returns a book of the genre with the purpose
+func (s *GRPCBookService) RecommendBook(ctx context.Context, in *bookv1.RecommendBookRequest) (*bookv1.Book, error) {
+	req := dto.RecommendBookRequest{Genre: in.GetGenre(), Purpose: in.GetPurpose()}
+	sanitize(&req)
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, grpcError(ctx, "RecommendBook", bindError(err), false)
+	}
+
+	book, err := s.books.bookRepo.FindByGenreAndPurpose(req.Genre, req.Purpose)
+	if errors.Is(err, models.ErrNotFound) {
+		err = NewAppError(dto.CodeRecommendationNotFound)
+	}
+	if err != nil {
+		return nil, grpcError(ctx, "RecommendBook", err, false)
+	}
+	return protoBook(book), nil
+}
+
+// SearchBooks returns the books containing every word of the query
+func (s *GRPCBookService) SearchBooks(ctx context.Context, in *bookv1.SearchBooksRequest) (*bookv1.SearchBooksResponse, error) {
+	books, err := s.books.bookRepo.Search(in.GetQuery())
+	if err != nil {
+		return nil, grpcError(ctx, "SearchBooks", err, false)
+	}
+
+	response := &bookv1.SearchBooksResponse{Books: make([]*bookv1.Book, len(books))}
+	for i := range books {
+		response.Books[i] = protoBook(&books[i])
+	}
+	return response, nil
+}
+
+// ExportBooks streams an export file in the same formats as GET /books/export. The
+// content type and file name are sent with the first chunk.
+func (s *GRPCBookService) ExportBooks(in *bookv1.ExportBooksRequest, stream grpc.ServerStreamingServer[bookv1.ExportChunk]) error {
+	ctx := stream.Context()
+	query := dto.ExportBooksQuery{
+		ListBooksQuery: dto.ListBooksQuery{Genre: in.GetGenre(), Purpose: in.GetPurpose(), Author: in.GetAuthor()},
+		Format:         in.GetFormat(),
+	}
+	if err := binding.Validator.ValidateStruct(&query); err != nil {
+		return grpcError(ctx, "ExportBooks", bindError(err), false)
+	}
+	if query.Format == "" {
+		query.Format = dto.ExportFormatCSV
+	}
+
+	chunks := &exportChunkWriter{stream: stream, format: exportFormats[query.Format]}
+	out := bufio.NewWriterSize(chunks, exportChunkSize)
+	encoder, err := newBookEncoder(query.Format, out)
+	if err == nil {
+		defer encoder.release()
+		err = s.books.bookRepo.Each(bookFilter(query.ListBooksQuery), func(book *models.Book) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return encoder.encode(book)
+		})
+	}
+	if err == nil {
+		err = encoder.finish()
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil && !chunks.started {
+		// An empty export still tells the client what it would have received
+		err = chunks.send(nil)
+	}
+	if err != nil {
+		return streamError(ctx, "ExportBooks", err)
+	}
+	return nil
+}
+
+// exportChunkWriter sends what is written to it as ExportChunks
+type exportChunkWriter struct {
+	stream  grpc.ServerStreamingServer[bookv1.ExportChunk]
+	format  exportFormat
+	started bool
+}
+
+// Write sends a copy of p: the bufio.Writer in front reuses p once Write returns, while
+// gRPC may still hold on to the message, for example in stats handlers.
+func (w *exportChunkWriter) Write(p []byte) (int, error) {
+	if err := w.send(bytes.Clone(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *exportChunkWriter) send(data []byte) error {
+	chunk := &bookv1.ExportChunk{Data: data}
+	if !w.started {
+		w.started = true
+		chunk.ContentType = w.format.contentType
+		chunk.Filename = "books." + w.format.extension
+	}
+	return w.stream.Send(chunk)
+}
+
+// protoBook converts a book into its protobuf message
+func protoBook(book *models.Book) *bookv1.Book {
+	return &bookv1.Book{
+		Id:          uint32(book.ID),
+		Title:       book.Title,
+		Author:      book.Author,
+		Genre:       book.Genre,
+		Purpose:     book.Purpose,
+		Description: book.Description,
+		Isbn:        book.ISBN,
+		Version:     uint32(book.Version),
+	}
+}
+
+// streamError reports an error of a streaming method. Errors of the stream itself, such
+// as the client going away, are returned as they are.
+func streamError(ctx context.Context, method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	return grpcError(ctx, method, err, false)
+}
+
+// grpcError converts err into a gRPC status the way AbortWithProblem converts it into a
+// problem. The message is the localized problem detail in the language of the
+// accept-language metadata; the details carry the error code as an ErrorInfo reason,
+// the field errors as a BadRequest and the localized message.
+func grpcError(ctx context.Context, method string, err error, conditional bool) error {
+	appErr := toAppError(err, conditional)
+	if appErr.Status >= http.StatusInternalServerError {
+		log.Printf("grpc %s: %v", method, appErr)
+	}
+
+	var acceptLanguage string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("accept-language"); len(values) > 0 {
+			acceptLanguage = values[0]
+		}
+	}
+	localizer := i18n.Negotiate(acceptLanguage)
+	problem := appErr.Problem(localizer, "")
+
+	code, ok := grpcCodes[problem.Code]
+	if !ok {
+		code = codes.Internal
+	}
+
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Reason:   problem.Code,
+			Domain:   grpcErrorDomain,
+			Metadata: map[string]string{"http_status": fmt.Sprint(problem.Status)},
+		},
+		&errdetails.LocalizedMessage{Locale: localizer.Language(), Message: problem.Detail},
+	}
+	if len(problem.Errors) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range problem.Errors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Message,
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	st := status.New(code, problem.Detail)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+	bookv1 "recomemento-api-go/proto/book/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCTestClient serves a BookService over mockRepo in memory and returns a client
+func newGRPCTestClient(t *testing.T, mockRepo *MockBookDatabase, opts ...grpc.ServerOption) bookv1.BookServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	bookv1.RegisterBookServiceServer(server, NewGRPCBookService(mockRepo))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return bookv1.NewBookServiceClient(conn)
+}
+
+// errorInfoReason returns the reason of the ErrorInfo detail of err
+func errorInfoReason(t *testing.T, err error) string {
+	t.Helper()
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return ""
+}
+
+func TestGRPC_CreateBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Create", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Title == "Go入門" && book.ISBN == "9784873119038"
+	})).Return(nil)
+	client := newGRPCTestClient(t, mockRepo)
+
+	book, err := client.CreateBook(context.Background(), &bookv1.CreateBookRequest{
+		Title: "  <b>Go入門</b> ", Author: "山田太郎", Genre: "技術書", Purpose: "学習", Description: "Goの入門書", Isbn: "978-4-87311-903-8",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), book.GetId())
+	assert.Equal(t, "Go入門", book.GetTitle())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGRPC_CreateBookValidationError(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	client := newGRPCTestClient(t, mockRepo)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", "ja")
+	_, err := client.CreateBook(ctx, &bookv1.CreateBookRequest{
+		Title: "   ", Author: "山田太郎", Genre: "技術書", Purpose: "学習", Description: "説明",
+	})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, dto.CodeValidationFailed, errorInfoReason(t, err))
+	var violations []*errdetails.BadRequest_FieldViolation
+	var locale string
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			violations = d.GetFieldViolations()
+		case *errdetails.LocalizedMessage:
+			locale = d.GetLocale()
+		}
+	}
+	require.Len(t, violations, 1)
+	assert.Equal(t, "title", violations[0].GetField())
+	assert.Equal(t, "ja", locale)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestGRPC_GetBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("GetByID", uint(1)).Return(&models.Book{ID: 1, Title: "Go入門", Version: 2}, nil)
+	mockRepo.On("GetByID", uint(999)).Return((*models.Book)(nil), models.ErrNotFound)
+	client := newGRPCTestClient(t, mockRepo)
+
+	book, err := client.GetBook(context.Background(), &bookv1.GetBookRequest{Id: 1})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(&bookv1.Book{Id: 1, Title: "Go入門", Version: 2}, book))
+
+	_, err = client.GetBook(context.Background(), &bookv1.GetBookRequest{Id: 999})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, dto.CodeBookNotFound, errorInfoReason(t, err))
+}
+
+func TestGRPC_GetBookInternalErrorHidesCause(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("GetByID", uint(1)).Return((*models.Book)(nil), errors.New("disk I/O error"))
+	client := newGRPCTestClient(t, mockRepo)
+
+	_, err := client.GetBook(context.Background(), &bookv1.GetBookRequest{Id: 1})
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.NotContains(t, status.Convert(err).Message(), "disk")
+}
+
+func TestGRPC_ListBooksStreams(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Each", models.BookFilter{Genre: "技術書"}).Return([]models.Book{
+		{ID: 1, Title: "A"}, {ID: 2, Title: "B"}, {ID: 3, Title: "C"},
+	}, nil)
+	client := newGRPCTestClient(t, mockRepo)
+
+	stream, err := client.ListBooks(context.Background(), &bookv1.ListBooksRequest{Genre: "技術書"})
+	require.NoError(t, err)
+
+	var titles []string
+	for {
+		book, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		titles = append(titles, book.GetTitle())
+	}
+	assert.Equal(t, []string{"A", "B", "C"}, titles)
+}
+
+func TestGRPC_ListBooksError(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Each", models.BookFilter{}).Return([]models.Book{{ID: 1}}, errors.New("database error"))
+	client := newGRPCTestClient(t, mockRepo)
+
+	stream, err := client.ListBooks(context.Background(), &bookv1.ListBooksRequest{})
+	require.NoError(t, err)
+
+	// 途中まで送信した後のエラーもステータスとして届く
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestGRPC_UpdateBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	current := &models.Book{ID: 1, Title: "Old", Author: "山田太郎", Genre: "技術書", Purpose: "学習", Description: "説明", Version: 2}
+	mockRepo.On("GetByID", uint(1)).Return(current, nil)
+	mockRepo.On("UpdateIfVersion", uint(1), uint(2), map[string]interface{}{"title": "New"}).
+		Return(&models.Book{ID: 1, Title: "New", Version: 3}, nil)
+	client := newGRPCTestClient(t, mockRepo)
+
+	book, err := client.UpdateBook(context.Background(), &bookv1.UpdateBookRequest{Id: 1, Title: proto.String("New"), Version: proto.Uint32(2)})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), book.GetVersion())
+
+	_, err = client.UpdateBook(context.Background(), &bookv1.UpdateBookRequest{Id: 1, Title: proto.String("New"), Version: proto.Uint32(1)})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, dto.CodePreconditionFailed, errorInfoReason(t, err))
+
+	_, err = client.UpdateBook(context.Background(), &bookv1.UpdateBookRequest{Id: 1, Title: proto.String("New"), Version: proto.Uint32(0)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPC_DeleteBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Delete", uint(1)).Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	mockRepo.On("DeleteIfVersion", uint(2), uint(5)).Return((*models.Book)(nil), models.ErrVersionMismatch)
+	client := newGRPCTestClient(t, mockRepo)
+
+	book, err := client.DeleteBook(context.Background(), &bookv1.DeleteBookRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "Go入門", book.GetTitle())
+
+	_, err = client.DeleteBook(context.Background(), &bookv1.DeleteBookRequest{Id: 2, Version: proto.Uint32(5)})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// バージョン0を指定しても無条件の削除にはならない
+	_, err = client.DeleteBook(context.Background(), &bookv1.DeleteBookRequest{Id: 1, Version: proto.Uint32(0)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, dto.CodeValidationFailed, errorInfoReason(t, err))
+	mockRepo.AssertNumberOfCalls(t, "Delete", 1)
+	mockRepo.AssertNotCalled(t, "DeleteIfVersion", uint(1), uint(0))
+}
+
+func TestGRPC_RecommendBook(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("FindByGenreAndPurpose", "技術書", "学習").Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	mockRepo.On("FindByGenreAndPurpose", "絵本", "学習").Return((*models.Book)(nil), models.ErrNotFound)
+	client := newGRPCTestClient(t, mockRepo)
+
+	book, err := client.RecommendBook(context.Background(), &bookv1.RecommendBookRequest{Genre: " 技術書 ", Purpose: "学習"})
+	require.NoError(t, err)
+	assert.Equal(t, "Go入門", book.GetTitle())
+
+	_, err = client.RecommendBook(context.Background(), &bookv1.RecommendBookRequest{Genre: "絵本", Purpose: "学習"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, dto.CodeRecommendationNotFound, errorInfoReason(t, err))
+}
+
+func TestGRPC_SearchBooks(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Search", "go").Return([]models.Book{{ID: 1, Title: "Go入門"}, {ID: 2, Title: "Go実践"}}, nil)
+	client := newGRPCTestClient(t, mockRepo)
+
+	response, err := client.SearchBooks(context.Background(), &bookv1.SearchBooksRequest{Query: "go"})
+
+	require.NoError(t, err)
+	require.Len(t, response.GetBooks(), 2)
+	assert.Equal(t, "Go実践", response.GetBooks()[1].GetTitle())
+}
+
+func TestGRPC_ExportBooks(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Each", models.BookFilter{}).Return([]models.Book{
+		{ID: 1, Title: "Go入門", Author: "山田太郎", Genre: "技術書", Purpose: "学習", Description: "説明"},
+	}, nil)
+	client := newGRPCTestClient(t, mockRepo)
+
+	stream, err := client.ExportBooks(context.Background(), &bookv1.ExportBooksRequest{Format: "ndjson"})
+	require.NoError(t, err)
+
+	var chunks []*bookv1.ExportChunk
+	var data strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+		data.Write(chunk.GetData())
+	}
+	require.NotEmpty(t, chunks)
+	assert.Equal(t, "application/x-ndjson", chunks[0].GetContentType())
+	assert.Equal(t, "books.ndjson", chunks[0].GetFilename())
+	assert.Contains(t, data.String(), `"title":"Go入門"`)
+}
+
+// retainingExportStream keeps every chunk sent, as a stream whose messages are read
+// after Send returns would
+type retainingExportStream struct {
+	grpc.ServerStreamingServer[bookv1.ExportChunk]
+	chunks []*bookv1.ExportChunk
+}
+
+func (s *retainingExportStream) Send(chunk *bookv1.ExportChunk) error {
+	s.chunks = append(s.chunks, chunk)
+	return nil
+}
+
+func TestExportChunkWriter_CopiesData(t *testing.T) {
+	// bufioはWriteから戻るとバッファを再利用するため、送ったチャンクは書き換えられない
+	stream := &retainingExportStream{}
+	out := bufio.NewWriterSize(&exportChunkWriter{stream: stream, format: exportFormats["ndjson"]}, 16)
+
+	_, err := out.WriteString(strings.Repeat("a", 16) + strings.Repeat("b", 16))
+	require.NoError(t, err)
+	require.NoError(t, out.Flush())
+
+	require.Len(t, stream.chunks, 2)
+	assert.Equal(t, strings.Repeat("a", 16), string(stream.chunks[0].GetData()))
+	assert.Equal(t, strings.Repeat("b", 16), string(stream.chunks[1].GetData()))
+}
+
+func TestGRPC_ExportBooksEmpty(t *testing.T) {
+	// 対象の本がない場合も形式がわかるように1つのチャンクを送る
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("Each", models.BookFilter{}).Return([]models.Book{}, nil)
+	client := newGRPCTestClient(t, mockRepo)
+
+	stream, err := client.ExportBooks(context.Background(), &bookv1.ExportBooksRequest{Format: "ndjson"})
+	require.NoError(t, err)
+
+	chunk, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-ndjson", chunk.GetContentType())
+	assert.Empty(t, chunk.GetData())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestGRPC_ExportBooksInvalidFormat(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	client := newGRPCTestClient(t, mockRepo)
+
+	stream, err := client.ExportBooks(context.Background(), &bookv1.ExportBooksRequest{Format: "pdf"})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, dto.CodeValidationFailed, errorInfoReason(t, err))
+	mockRepo.AssertNotCalled(t, "Each", mock.Anything)
+}
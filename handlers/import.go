@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/i18n"
+	"recomemento-api-go/matchkey"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Formats accepted by the importer
+const (
+	ImportFormatCSV        = "csv"
+	ImportFormatNDJSON     = "ndjson"
+	ImportFormatMARC       = "marc"
+	ImportFormatMARCXML    = "marcxml"
+	ImportFormatDublinCore = "dc"
+	ImportFormatONIX       = "onix"
+)
+
+// ImportFormats lists every format accepted by the importer
+var ImportFormats = []string{
+	ImportFormatCSV,
+	ImportFormatNDJSON,
+	ImportFormatMARC,
+	ImportFormatMARCXML,
+	ImportFormatDublinCore,
+	ImportFormatONIX,
+}
+
+// Limits of an import
+const (
+	// maxImportBytes caps the body of an import request
+	maxImportBytes = 64 << 20
+	// maxImportLineBytes caps a line of JSON Lines; longer lines are reported as
+	// unreadable rows
+	maxImportLineBytes = 1 << 20
+	// importBatchSize is the number of rows whose duplicates are looked up at a time
+	importBatchSize = 500
+)
+
+// importColumns are the book fields that import columns and members are mapped onto
+var importColumns = []string{"title", "author", "genre", "purpose", "description", "isbn"}
+
+// requiredImportColumns must be present in the header of a CSV file
+var requiredImportColumns = []string{"title", "author", "genre", "purpose", "description"}
+
+// ImportOptions controls how ImportBooksFrom reads and applies a file
+type ImportOptions struct {
+	// Format is one of ImportFormats
+	Format string
+	// DryRun validates and dedupes every row without creating any book
+	DryRun bool
+}
+
+// importRow is a single record read from an import file
+type importRow struct {
+	line int
+	book dto.CreateBookRequest
+	// err is set when the record could not be parsed
+	err error
+}
+
+// importReader yields the records of an import file; it returns io.EOF at the end
+type importReader interface {
+	next() (importRow, error)
+}
+
+// ImportBooks godoc
+// @Summary Import books
+// @Description Stream books from a CSV file (with a header row naming the columns title, author, genre,
+// @Description purpose, description and optionally isbn), from JSON Lines (one book object per line) or from
+// @Description the library and publishing interchange formats MARC 21 (ISO 2709 or MARCXML), Dublin Core XML
+// @Description and ONIX 3.0. Every row is validated like POST /books. Rows whose ISBN or normalized title and
+// @Description author match an existing book or an earlier row are skipped as duplicates. With dry_run=true
+// @Description nothing is written. The report lists every row that was not imported. Bodies are limited to
+// @Description 64 MiB and JSON Lines to 1 MiB per line.
+// @Tags books
+// @Accept text/csv,application/x-ndjson,application/marc,application/marcxml+xml,application/xml
+// @Produce json,xml,application/msgpack
+// @Param format query string false "Format of the body; defaults to the Content-Type" Enums(csv, ndjson, marc, marcxml, dc, onix)
+// @Param dry_run query bool false "Validate without creating books"
+// @Success 200 {object} dto.ImportReport
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 415 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Router /books/import [post]
+func (h *BookHandler) ImportBooks(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = importFormatFromContentType(c.GetHeader("Content-Type"))
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		AbortWithProblem(c, bindError(err))
+		return
+	}
+
+	if c.Request.ContentLength > maxImportBytes {
+		AbortWithProblem(c, NewAppError(dto.CodeRequestTooLarge, int64(maxImportBytes)))
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	localizer := i18n.Negotiate(c.GetHeader("Accept-Language"))
+	report, err := ImportBooksFrom(h.bookRepo, body, ImportOptions{Format: format, DryRun: dryRun}, localizer)
+	if err != nil {
+		appErr := toAppError(err, false)
+		appErr.Report = report
+		AbortWithProblem(c, appErr)
+		return
+	}
+
+	if len(report.Rows) > 0 {
+		c.Header("Content-Language", localizer.Language())
+		c.Writer.Header().Add("Vary", "Accept-Language")
+	}
+	respond(c, http.StatusOK, report)
+}
+
+// ImportBooksFrom reads books from r, validates and dedupes every row and creates the
+// new, valid ones unless opts.DryRun is set. Problems with single rows are listed in the
+// report, localized with localizer; an error is only returned when the file as a whole
+// cannot be imported. Rows are read in batches, and the existing books each batch may
+// duplicate are looked up before its rows are applied. Batches are applied as they are
+// read, so when reading fails partway through, the rows before the failure have been
+// applied and their report is returned along with the error.
+func ImportBooksFrom(repo models.BookDatabase, r io.Reader, opts ImportOptions, localizer *i18n.Localizer) (*dto.ImportReport, error) {
+	reader, err := newImportReader(opts.Format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	index := newImportIndex()
+	report := &dto.ImportReport{DryRun: opts.DryRun, Rows: []dto.ImportRowResult{}}
+	for {
+		batch, readErr := readImportBatch(reader, importBatchSize)
+		if err := index.load(repo, batch); err != nil {
+			return report, err
+		}
+
+		for _, row := range batch {
+			report.Total++
+			result := importBook(repo, index, row, opts.DryRun, localizer)
+			switch result.Status {
+			case dto.ImportStatusCreated:
+				report.Created++
+				continue
+			case dto.ImportStatusDuplicate:
+				report.Duplicates++
+			case dto.ImportStatusInvalid:
+				report.Invalid++
+			case dto.ImportStatusFailed:
+				report.Failed++
+			}
+			report.Rows = append(report.Rows, result)
+		}
+		if errors.Is(readErr, io.EOF) {
+			return report, nil
+		}
+		if readErr != nil {
+			return report, readErr
+		}
+	}
+}
+
+// readImportBatch reads up to n rows and sanitizes the books that could be parsed. It
+// returns io.EOF with the last rows at the end of the file.
+func readImportBatch(reader importReader, n int) ([]importRow, error) {
+	batch := make([]importRow, 0, n)
+	for len(batch) < n {
+		row, err := reader.next()
+		if err != nil {
+			return batch, err
+		}
+		if row.err == nil {
+			sanitize(&row.book)
+		}
+		batch = append(batch, row)
+	}
+	return batch, nil
+}
+
+// newImportReader creates a reader for the records of format read from r
+func newImportReader(format string, r io.Reader) (importReader, error) {
+	switch format {
+	case ImportFormatCSV:
+		return newCSVImportReader(r)
+	case ImportFormatNDJSON:
+		return &ndjsonImportReader{reader: bufio.NewReaderSize(r, maxImportLineBytes)}, nil
+	case ImportFormatMARC:
+		return &marcImportReader{reader: bufio.NewReader(r)}, nil
+	case ImportFormatMARCXML:
+		return newXMLImportReader(r, isMARCXMLRecord, decodeMARCXML), nil
+	case ImportFormatDublinCore:
+		return newXMLImportReader(r, isDCRecord, decodeDublinCore), nil
+	case ImportFormatONIX:
+		return newXMLImportReader(r, isONIXProduct, decodeONIX), nil
+	default:
+		return nil, NewAppError(dto.CodeUnsupportedFormat, format, strings.Join(ImportFormats, ", "))
+	}
+}
+
+// importBook validates, dedupes and, unless dryRun is set, creates a single row read
+// by readImportBatch
+func importBook(repo models.BookDatabase, index *importIndex, row importRow, dryRun bool, localizer *i18n.Localizer) dto.ImportRowResult {
+	result := dto.ImportRowResult{Line: row.line, Title: row.book.Title}
+	if row.err != nil {
+		result.Status = dto.ImportStatusInvalid
+		result.Message = localizer.T("import.unreadable", row.err.Error())
+		return result
+	}
+
+	book := row.book
+	if err := binding.Validator.ValidateStruct(&book); err != nil {
+		problem := bindError(err).Problem(localizer, "")
+		result.Status = dto.ImportStatusInvalid
+		result.Message = problem.Detail
+		result.Errors = problem.Errors
+		return result
+	}
+
+	key := matchkey.Book(book.Title, book.Author)
+	if match, ok := index.find(book.ISBN, key); ok {
+		result.Status = dto.ImportStatusDuplicate
+		result.DuplicateOf = match.id
+		result.DuplicateOfLine = match.line
+		if match.id != 0 {
+			result.Message = localizer.T("import.duplicate_book", match.id)
+		} else {
+			result.Message = localizer.T("import.duplicate_line", match.line)
+		}
+		return result
+	}
+
+	created := importMatch{line: row.line}
+	if !dryRun {
+		model := &models.Book{
+			Title:       book.Title,
+			Author:      book.Author,
+			Genre:       book.Genre,
+			Purpose:     book.Purpose,
+			Description: book.Description,
+			ISBN:        book.ISBN,
+		}
+		if err := repo.Create(model); err != nil {
+			problem := toAppError(err, false).Problem(localizer, "")
+			result.Status = dto.ImportStatusFailed
+			result.Message = problem.Detail
+			return result
+		}
+		created.id = model.ID
+	}
+
+	index.add(book.ISBN, key, created)
+	result.Status = dto.ImportStatusCreated
+	return result
+}
+
+// importFormatFromContentType maps the media type of an import body onto its format
+func importFormatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return ImportFormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/json-lines":
+		return ImportFormatNDJSON
+	case "application/marc":
+		return ImportFormatMARC
+	case "application/marcxml+xml":
+		return ImportFormatMARCXML
+	default:
+		return mediaType
+	}
+}
+
+// csvImportReader reads books from CSV with a header row naming the columns
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[int]string
+}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, NewAppError(dto.CodeInvalidImport, strings.Join(requiredImportColumns, ", "))
+	}
+	if err != nil {
+		appErr := NewAppError(dto.CodeInvalidRequest, err.Error())
+		appErr.Err = err
+		return nil, appErr
+	}
+
+	columns := make(map[int]string)
+	present := make(map[string]bool)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for _, column := range importColumns {
+			if name == column && !present[column] {
+				columns[i] = column
+				present[column] = true
+			}
+		}
+	}
+
+	var missing []string
+	for _, column := range requiredImportColumns {
+		if !present[column] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, NewAppError(dto.CodeInvalidImport, strings.Join(missing, ", "))
+	}
+
+	// Rows are matched to the header by position, so every row must have as many fields
+	reader.FieldsPerRecord = len(header)
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvImportReader) next() (importRow, error) {
+	record, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return importRow{}, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRow{line: parseErr.StartLine, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	row := importRow{line: line}
+	for i, value := range record {
+		// Exports escape the values that spreadsheets would evaluate as formulas
+		value = unescapeFormula(value)
+		switch r.columns[i] {
+		case "title":
+			row.book.Title = value
+		case "author":
+			row.book.Author = value
+		case "genre":
+			row.book.Genre = value
+		case "purpose":
+			row.book.Purpose = value
+		case "description":
+			row.book.Description = value
+		case "isbn":
+			row.book.ISBN = value
+		}
+	}
+	return row, nil
+}
+
+// ndjsonImportReader reads one JSON book object per line. Blank lines are skipped and
+// members that are not book fields are ignored. Lines longer than the buffer of reader
+// are skipped and reported as unreadable.
+type ndjsonImportReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (r *ndjsonImportReader) next() (importRow, error) {
+	for {
+		data, err := r.reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			r.line++
+			if err := r.skipLine(); err != nil {
+				return importRow{}, err
+			}
+			return importRow{line: r.line, err: fmt.Errorf("line is longer than %d bytes", r.reader.Size())}, nil
+		}
+		if len(data) == 0 && err != nil {
+			return importRow{}, err
+		}
+		r.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		row := importRow{line: r.line}
+		row.err = json.Unmarshal(data, &row.book)
+		return row, nil
+	}
+}
+
+// skipLine discards the rest of the current line
+func (r *ndjsonImportReader) skipLine() error {
+	for {
+		_, err := r.reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+}
+
+// importMatch identifies the book or earlier row a row duplicates. id is zero for rows
+// that were not written, as in a dry run.
+type importMatch struct {
+	id   uint
+	line int
+}
+
+// importIndex finds duplicates among the existing books and the rows imported so far.
+// Rows are matched by ISBN and by matchkey.Book of their title and author; the existing
+// books are loaded for each batch of rows.
+type importIndex struct {
+	byISBN     map[string]importMatch
+	byMatchKey map[string]importMatch
+}
+
+func newImportIndex() *importIndex {
+	return &importIndex{
+		byISBN:     make(map[string]importMatch),
+		byMatchKey: make(map[string]importMatch),
+	}
+}
+
+// load adds the existing books that rows may duplicate
+func (ix *importIndex) load(repo models.BookDatabase, rows []importRow) error {
+	var isbns, keys []string
+	for _, row := range rows {
+		if row.err != nil {
+			continue
+		}
+		if row.book.ISBN != "" {
+			isbns = append(isbns, row.book.ISBN)
+		}
+		keys = append(keys, matchkey.Book(row.book.Title, row.book.Author))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	books, err := repo.FindDuplicates(isbns, keys)
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		ix.add(normalizeISBN(book.ISBN), book.MatchKey, importMatch{id: book.ID})
+	}
+	return nil
+}
+
+func (ix *importIndex) find(isbn, key string) (importMatch, bool) {
+	if isbn != "" {
+		if match, ok := ix.byISBN[isbn]; ok {
+			return match, true
+		}
+	}
+	match, ok := ix.byMatchKey[key]
+	return match, ok
+}
+
+func (ix *importIndex) add(isbn, key string, match importMatch) {
+	if isbn != "" {
+		ix.byISBN[isbn] = match
+	}
+	ix.byMatchKey[key] = match
+}
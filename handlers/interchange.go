@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	"golang.org/x/net/html/charset"
+)
+
+// xmlImportReader reads the records of an XML interchange format (MARCXML, Dublin Core,
+// ONIX) one element at a time, so that only a single record is held in memory. Rows are
+// numbered by the line the record element starts on.
+type xmlImportReader struct {
+	decoder *xml.Decoder
+	// record reports whether an element holds a record
+	record func(name xml.Name) bool
+	// decode reads the book from a record element
+	decode func(decoder *xml.Decoder, start *xml.StartElement) (dto.CreateBookRequest, error)
+	// done is set once the document is malformed; nothing after that point can be read
+	done bool
+}
+
+func newXMLImportReader(r io.Reader, record func(name xml.Name) bool,
+	decode func(decoder *xml.Decoder, start *xml.StartElement) (dto.CreateBookRequest, error)) *xmlImportReader {
+	decoder := xml.NewDecoder(r)
+	// Partner files are not always UTF-8 and ONIX feeds often use HTML entities
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Entity = xml.HTMLEntity
+	return &xmlImportReader{decoder: decoder, record: record, decode: decode}
+}
+
+func (r *xmlImportReader) next() (importRow, error) {
+	if r.done {
+		return importRow{}, io.EOF
+	}
+	for {
+		token, err := r.decoder.Token()
+		line, _ := r.decoder.InputPos()
+		if errors.Is(err, io.EOF) {
+			return importRow{}, io.EOF
+		}
+
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			r.done = true
+			return importRow{line: syntaxErr.Line, err: err}, nil
+		}
+		if err != nil {
+			r.done = true
+			return importRow{line: line, err: err}, nil
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || !r.record(start.Name) {
+			continue
+		}
+
+		row := importRow{line: line}
+		row.book, row.err = r.decode(r.decoder, &start)
+		if errors.As(row.err, &syntaxErr) {
+			r.done = true
+		}
+		return row, nil
+	}
+}
+
+// xmlBookEncoder writes books as the record elements of an XML document
+type xmlBookEncoder struct {
+	encoder *xml.Encoder
+	root    xml.StartElement
+	record  func(encoder *xml.Encoder, book *models.Book) error
+}
+
+// newXMLBookEncoder writes the XML declaration, the root element and, unless it is nil,
+// head to w. record writes the element of a single book.
+func newXMLBookEncoder(w io.Writer, root xml.StartElement, head interface{},
+	record func(encoder *xml.Encoder, book *models.Book) error) (*xmlBookEncoder, error) {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return nil, err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.EncodeToken(root); err != nil {
+		return nil, err
+	}
+	if head != nil {
+		if err := encoder.Encode(head); err != nil {
+			return nil, err
+		}
+	}
+	return &xmlBookEncoder{encoder: encoder, root: root, record: record}, nil
+}
+
+func (e *xmlBookEncoder) encode(book *models.Book) error {
+	return e.record(e.encoder, book)
+}
+
+func (e *xmlBookEncoder) finish() error {
+	if err := e.encoder.EncodeToken(e.root.End()); err != nil {
+		return err
+	}
+	return e.encoder.Flush()
+}
+
+func (e *xmlBookEncoder) release() {}
+
+// xmlns returns the attribute declaring the default namespace, or a prefix for it
+func xmlns(prefix, namespace string) xml.Attr {
+	name := "xmlns"
+	if prefix != "" {
+		name += ":" + prefix
+	}
+	return xml.Attr{Name: xml.Name{Local: name}, Value: namespace}
+}
+
+// encodeXMLText writes an element holding text, unless the text is empty
+func encodeXMLText(encoder *xml.Encoder, name, text string) error {
+	if text == "" {
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+		return err
+	}
+	return encoder.EncodeToken(start.End())
+}
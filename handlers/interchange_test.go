@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+// interchangeBooks は往復テスト用の書籍（記号・改行・日本語を含む）
+var interchangeBooks = []models.Book{
+	{
+		ID: 1, Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", Genre: "Fiction", Purpose: "Entertainment",
+		Description: "Jay Gatsby & Daisy <Buchanan>\nin \"West Egg\"", ISBN: "9780743273565",
+	},
+	{
+		ID: 2, Title: "吾輩は猫である", Author: "夏目, 漱石", Genre: "小説", Purpose: "娯楽",
+		Description: "猫の視点から人間社会を風刺した長編小説", ISBN: "080442957X",
+	},
+	{
+		ID: 3, Title: "Clean Code", Author: "Robert C. Martin", Genre: "Technology", Purpose: "Learning",
+		Description: "A handbook of agile software craftsmanship",
+	},
+}
+
+// readImportRows は importReader から全ての行を読み込む
+func readImportRows(t *testing.T, format string, r io.Reader) []importRow {
+	t.Helper()
+	reader, err := newImportReader(format, r)
+	require.NoError(t, err)
+
+	var rows []importRow
+	for {
+		row, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestInterchange_RoundTrip(t *testing.T) {
+	formats := []string{
+		dto.ExportFormatCSV,
+		dto.ExportFormatNDJSON,
+		dto.ExportFormatMARC,
+		dto.ExportFormatMARCXML,
+		dto.ExportFormatDublinCore,
+		dto.ExportFormatONIX,
+	}
+
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			// エクスポート
+			var buf bytes.Buffer
+			encoder, err := newBookEncoder(format, &buf)
+			require.NoError(t, err)
+			defer encoder.release()
+			for i := range interchangeBooks {
+				require.NoError(t, encoder.encode(&interchangeBooks[i]))
+			}
+			require.NoError(t, encoder.finish())
+
+			// インポートして元の書籍と一致すること
+			rows := readImportRows(t, format, &buf)
+			require.Len(t, rows, len(interchangeBooks))
+			for i, row := range rows {
+				book := interchangeBooks[i]
+				assert.NoError(t, row.err)
+				assert.Equal(t, dto.CreateBookRequest{
+					Title:       book.Title,
+					Author:      book.Author,
+					Genre:       book.Genre,
+					Purpose:     book.Purpose,
+					Description: book.Description,
+					ISBN:        book.ISBN,
+				}, row.book)
+			}
+		})
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		value   string
+		escaped string
+	}{
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1", "'+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"'Salem's Lot", "'Salem's Lot"},
+		{"''", "''"},
+		{"Go入門", "Go入門"},
+		{"a=b", "a=b"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.escaped, escapeFormula(tt.value))
+			assert.Equal(t, tt.value, unescapeFormula(tt.escaped))
+		})
+	}
+
+	// 数式の記号が続かないアポストロフィは値の一部として残す
+	assert.Equal(t, "'quoted'", unescapeFormula("'quoted'"))
+	assert.Equal(t, "''=1", unescapeFormula("''=1"))
+}
+
+func TestExport_EscapesFormulas(t *testing.T) {
+	// 表計算ソフトが数式として評価する値は CSV でエスケープする（CSV インジェクション対策）
+	book := models.Book{
+		ID: 1, Title: "=HYPERLINK(\"http://evil.example\",\"click\")", Author: "@SUM(1+1)", Genre: "+Fiction",
+		Purpose: "-Learning", Description: "'quoted'", ISBN: "9780743273565",
+	}
+
+	encode := func(format string) *bytes.Buffer {
+		var buf bytes.Buffer
+		encoder, err := newBookEncoder(format, &buf)
+		require.NoError(t, err)
+		defer encoder.release()
+		require.NoError(t, encoder.encode(&book))
+		require.NoError(t, encoder.finish())
+		return &buf
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		body := encode(dto.ExportFormatCSV)
+		records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(body.String(), "\ufeff"))).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1", "'" + book.Title, "'@SUM(1+1)", "'+Fiction", "'-Learning", "'quoted'", "9780743273565"}, records[1])
+
+		// インポートすると元の値に戻る
+		rows := readImportRows(t, dto.ExportFormatCSV, body)
+		require.Len(t, rows, 1)
+		assert.Equal(t, book.Title, rows[0].book.Title)
+		assert.Equal(t, book.Description, rows[0].book.Description)
+	})
+
+	t.Run("XLSX", func(t *testing.T) {
+		file, err := excelize.OpenReader(encode(dto.ExportFormatXLSX))
+		require.NoError(t, err)
+		defer file.Close()
+		rows, err := file.GetRows(exportSheet)
+		require.NoError(t, err)
+		// セルは文字列として書かれ評価されないため、値はそのまま
+		assert.Equal(t, []string{"1", book.Title, book.Author, book.Genre, book.Purpose, book.Description, book.ISBN}, rows[1])
+		cellType, err := file.GetCellType(exportSheet, "B2")
+		require.NoError(t, err)
+		assert.NotEqual(t, excelize.CellTypeFormula, cellType)
+		formula, err := file.GetCellFormula(exportSheet, "B2")
+		require.NoError(t, err)
+		assert.Empty(t, formula)
+	})
+}
+
+func TestISO2709_Layout(t *testing.T) {
+	data, err := encodeISO2709(marcFromBook(&interchangeBooks[2]))
+	require.NoError(t, err)
+
+	// リーダーのレコード長・基底アドレスと、フィールド・レコードの終端記号
+	leader := string(data[:24])
+	length, err := strconv.Atoi(leader[:5])
+	require.NoError(t, err)
+	baseAddress, err := strconv.Atoi(leader[12:17])
+	require.NoError(t, err)
+	assert.Equal(t, "nam a22", leader[5:12])
+	assert.Equal(t, "   4500", leader[17:])
+	assert.Equal(t, len(data), length)
+	assert.Equal(t, byte(marcFieldTerminator), data[baseAddress-1])
+	assert.Equal(t, byte(marcRecordTerminator), data[len(data)-1])
+	assert.Equal(t, "001000200000", string(data[24:36]))
+}
+
+func TestISO2709_LongDescription(t *testing.T) {
+	// 1フィールドの上限を超える説明文は、エクスポート全体を中断せず文字の境界で切り詰める
+	book := interchangeBooks[1]
+	book.Description = strings.Repeat("猫", 4000)
+	var out bytes.Buffer
+	encoder := &iso2709BookEncoder{out: &out}
+
+	require.NoError(t, encoder.encode(&book))
+	require.NoError(t, encoder.encode(&interchangeBooks[2]))
+
+	rows := readImportRows(t, dto.ExportFormatMARC, &out)
+	require.Len(t, rows, 2)
+	description := rows[0].book.Description
+	assert.True(t, utf8.ValidString(description))
+	assert.True(t, strings.HasPrefix(book.Description, description))
+	assert.Greater(t, len(description), marcMaxFieldLength-10)
+	assert.LessOrEqual(t, len(description), marcMaxFieldLength-5)
+	assert.Equal(t, book.Title, rows[0].book.Title)
+	assert.Equal(t, interchangeBooks[2].Title, rows[1].book.Title)
+}
+
+func TestMARCXML_CatalogRecord(t *testing.T) {
+	// 図書館のカタログから出力された典型的なレコード（ISBD区切り記号、650の件名、020の限定語）
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<marc:collection xmlns:marc="http://www.loc.gov/MARC21/slim">
+  <marc:record>
+    <marc:leader>01142cam  2200301 a 4500</marc:leader>
+    <marc:controlfield tag="001">   92005291 </marc:controlfield>
+    <marc:datafield tag="020" ind1=" " ind2=" ">
+      <marc:subfield code="a">0152038655 (pbk.) :</marc:subfield>
+      <marc:subfield code="c">$15.95</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="100" ind1="1" ind2=" ">
+      <marc:subfield code="a">Sandburg, Carl,</marc:subfield>
+      <marc:subfield code="d">1878-1967.</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="245" ind1="1" ind2="0">
+      <marc:subfield code="a">Arithmetic /</marc:subfield>
+      <marc:subfield code="c">Carl Sandburg ; illustrated as an anamorphic adventure by Ted Rand.</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="520" ind1=" " ind2=" ">
+      <marc:subfield code="a">A poem about numbers and their characteristics.</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="521" ind1=" " ind2=" ">
+      <marc:subfield code="a">Learning</marc:subfield>
+    </marc:datafield>
+    <marc:datafield tag="650" ind1=" " ind2="0">
+      <marc:subfield code="a">Arithmetic</marc:subfield>
+      <marc:subfield code="x">Juvenile poetry.</marc:subfield>
+    </marc:datafield>
+  </marc:record>
+</marc:collection>`
+
+	rows := readImportRows(t, ImportFormatMARCXML, strings.NewReader(input))
+
+	require.Len(t, rows, 1)
+	assert.NoError(t, rows[0].err)
+	assert.Equal(t, 3, rows[0].line)
+	assert.Equal(t, dto.CreateBookRequest{
+		Title:       "Arithmetic",
+		Author:      "Sandburg, Carl",
+		Genre:       "Arithmetic",
+		Purpose:     "Learning",
+		Description: "A poem about numbers and their characteristics.",
+		ISBN:        "0152038655",
+	}, rows[0].book)
+}
+
+func TestTrimISBD(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"The great Gatsby /", "The great Gatsby"},
+		{"Sandburg, Carl,", "Sandburg, Carl"},
+		{"Fiction.", "Fiction"},
+		{"Smith, J.", "Smith, J."},
+		{"Learning : ", "Learning"},
+		{"吾輩は猫である", "吾輩は猫である"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, trimISBD(tt.input))
+		})
+	}
+}
+
+func TestISO2709_InvalidRecords(t *testing.T) {
+	valid, err := encodeISO2709(marcFromBook(&interchangeBooks[0]))
+	require.NoError(t, err)
+
+	marc8 := append([]byte(nil), valid...)
+	marc8[9] = ' '
+
+	// 改行区切り、MARC-8のレコード、途中で切れたレコード
+	input := bytes.Join([][]byte{valid, marc8, valid[:40]}, []byte("\n"))
+	rows := readImportRows(t, ImportFormatMARC, bytes.NewReader(input))
+
+	require.Len(t, rows, 3)
+	assert.NoError(t, rows[0].err)
+	assert.Equal(t, "The Great Gatsby", rows[0].book.Title)
+	assert.ErrorContains(t, rows[1].err, "MARC-8")
+	assert.Equal(t, 2, rows[1].line)
+	assert.ErrorContains(t, rows[2].err, "truncated")
+	assert.Equal(t, 3, rows[2].line)
+}
+
+func TestISO2709_MultibyteSubfieldCode(t *testing.T) {
+	data, err := encodeISO2709(&marcRecord{DataFields: []marcDataField{{
+		Tag: "245", Ind1: "1", Ind2: "0",
+		Subfields: []marcSubfield{{Code: "é", Value: "値"}, {Code: "a", Value: "坊っちゃん"}},
+	}}})
+	require.NoError(t, err)
+
+	// 複数バイトの文字のコードを途中で分割しない
+	record, err := decodeISO2709(data)
+	require.NoError(t, err)
+	require.Len(t, record.DataFields, 1)
+	assert.Equal(t, []marcSubfield{{Code: "é", Value: "値"}, {Code: "a", Value: "坊っちゃん"}}, record.DataFields[0].Subfields)
+}
+
+func TestISO2709_MalformedDirectory(t *testing.T) {
+	valid, err := encodeISO2709(marcFromBook(&interchangeBooks[0]))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{"負の長さ", "245-99900000"},
+		{"符号付きの開始位置", "2450002+0000"},
+		{"長さが0", "245000000000"},
+		{"レコードの終わりを超える", "245999900000"},
+		{"数字以外", "245 00200000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte(nil), valid...)
+			copy(data[24:36], tt.entry)
+
+			// パニックせずにエラーを返す
+			record, err := decodeISO2709(data)
+
+			assert.Nil(t, record)
+			assert.ErrorContains(t, err, "invalid MARC directory entry")
+			rows := readImportRows(t, ImportFormatMARC, bytes.NewReader(data))
+			require.Len(t, rows, 1)
+			assert.ErrorContains(t, rows[0].err, "invalid MARC directory entry")
+		})
+	}
+}
+
+func TestDublinCore_OAIPMHResponse(t *testing.T) {
+	// OAI-PMH の ListRecords レスポンスからも読み込める
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<OAI-PMH xmlns="http://www.openarchives.org/OAI/2.0/">
+  <ListRecords>
+    <record>
+      <header><identifier>oai:example.org:1</identifier></header>
+      <metadata>
+        <oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/"
+                   xmlns:dc="http://purl.org/dc/elements/1.1/"
+                   xmlns:dcterms="http://purl.org/dc/terms/">
+          <dc:title>坊っちゃん</dc:title>
+          <dc:creator>夏目漱石</dc:creator>
+          <dc:creator>Another Creator</dc:creator>
+          <dc:subject>小説</dc:subject>
+          <dc:description>松山の中学校に赴任した青年教師の物語</dc:description>
+          <dc:identifier>https://example.org/books/1</dc:identifier>
+          <dc:identifier>ISBN 978-4-10-101003-7</dc:identifier>
+          <dcterms:audience>娯楽</dcterms:audience>
+        </oai_dc:dc>
+      </metadata>
+    </record>
+  </ListRecords>
+</OAI-PMH>`
+
+	rows := readImportRows(t, ImportFormatDublinCore, strings.NewReader(input))
+
+	require.Len(t, rows, 1)
+	assert.NoError(t, rows[0].err)
+	assert.Equal(t, dto.CreateBookRequest{
+		Title:       "坊っちゃん",
+		Author:      "夏目漱石",
+		Genre:       "小説",
+		Purpose:     "娯楽",
+		Description: "松山の中学校に赴任した青年教師の物語",
+		ISBN:        "978-4-10-101003-7",
+	}, rows[0].book)
+}
+
+func TestONIX_PublisherFeed(t *testing.T) {
+	// 出版社のフィード：タイトルの前置詞、XHTMLとCDATAの説明文、ISBN-13以外の識別子
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header><Sender><SenderName>Example Publishing</SenderName></Sender><SentDateTime>20240101</SentDateTime></Header>
+  <Product>
+    <RecordReference>com.example.1</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>01</ProductIDType><IDTypeName>SKU</IDTypeName><IDValue>A-1</IDValue></ProductIdentifier>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780306406157</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitlePrefix>The</TitlePrefix>
+          <TitleWithoutPrefix>Go Programming Language</TitleWithoutPrefix>
+          <Subtitle>Second Edition</Subtitle>
+        </TitleElement>
+      </TitleDetail>
+      <Contributor>
+        <SequenceNumber>1</SequenceNumber>
+        <ContributorRole>B01</ContributorRole>
+        <PersonName>Some Editor</PersonName>
+      </Contributor>
+      <Contributor>
+        <SequenceNumber>2</SequenceNumber>
+        <ContributorRole>A01</ContributorRole>
+        <PersonNameInverted>Donovan, Alan</PersonNameInverted>
+      </Contributor>
+      <Subject><SubjectSchemeIdentifier>10</SubjectSchemeIdentifier><SubjectCode>COM051010</SubjectCode></Subject>
+      <Subject><SubjectSchemeIdentifier>20</SubjectSchemeIdentifier><SubjectHeadingText>Technology</SubjectHeadingText></Subject>
+      <Audience>
+        <AudienceCodeType>02</AudienceCodeType>
+        <AudienceCodeTypeName>recomemento:purpose</AudienceCodeTypeName>
+        <AudienceCodeValue>Learning</AudienceCodeValue>
+      </Audience>
+    </DescriptiveDetail>
+    <CollateralDetail>
+      <TextContent>
+        <TextType>02</TextType><ContentAudience>00</ContentAudience>
+        <Text><![CDATA[<b>Short</b> description]]></Text>
+      </TextContent>
+      <TextContent>
+        <TextType>03</TextType><ContentAudience>00</ContentAudience>
+        <Text textformat="05"><p xmlns="http://www.w3.org/1999/xhtml">First &amp; <em>best</em>.</p><p xmlns="http://www.w3.org/1999/xhtml">Second&nbsp;paragraph.</p></Text>
+      </TextContent>
+    </CollateralDetail>
+  </Product>
+</ONIXMessage>`
+
+	rows := readImportRows(t, ImportFormatONIX, strings.NewReader(input))
+
+	require.Len(t, rows, 1)
+	assert.NoError(t, rows[0].err)
+	assert.Equal(t, dto.CreateBookRequest{
+		Title:       "The Go Programming Language: Second Edition",
+		Author:      "Donovan, Alan",
+		Genre:       "Technology",
+		Purpose:     "Learning",
+		Description: "First & best.\nSecond paragraph.",
+		ISBN:        "9780306406157",
+	}, rows[0].book)
+}
+
+func TestXMLImport_MalformedDocument(t *testing.T) {
+	// 壊れたXMLは読み取れない行として報告し、それ以降は読まない
+	input := `<collection xmlns="http://www.loc.gov/MARC21/slim">
+<record><datafield tag="245" ind1="0" ind2="0"><subfield code="a">First</subfield></datafield></record>
+<record><datafield tag="245"><subfield code="a">Broken</datafield></record>
+<record><datafield tag="245" ind1="0" ind2="0"><subfield code="a">Never read</subfield></datafield></record>
+</collection>`
+
+	rows := readImportRows(t, ImportFormatMARCXML, strings.NewReader(input))
+
+	require.Len(t, rows, 2)
+	assert.Equal(t, "First", rows[0].book.Title)
+	assert.Error(t, rows[1].err)
+	assert.Equal(t, 3, rows[1].line)
+}
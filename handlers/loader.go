@@ -0,0 +1,74 @@
+package handlers
+
+import "sync"
+
+// batchLoader collects the keys a GraphQL request asks for and loads them together.
+// load registers a key and returns a thunk; the resolvers of one level of the query all
+// run before any thunk is called, so the first thunk fetches every key registered so far
+// with a single call. Results are cached for the rest of the request.
+type batchLoader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	values  map[K]V
+	errs    map[K]error
+}
+
+func newBatchLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		fetch:  fetch,
+		queued: make(map[K]bool),
+		values: make(map[K]V),
+		errs:   make(map[K]error),
+	}
+}
+
+// load registers key for the next batch and returns a thunk yielding its value. Keys the
+// fetch function leaves out of its result yield the zero value.
+func (l *batchLoader[K, V]) load(key K) func() (V, error) {
+	l.mu.Lock()
+	if !l.known(key) {
+		l.pending = append(l.pending, key)
+		l.queued[key] = true
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.flush()
+		return l.values[key], l.errs[key]
+	}
+}
+
+// known reports whether key is loaded or waiting to be
+func (l *batchLoader[K, V]) known(key K) bool {
+	if _, ok := l.values[key]; ok {
+		return true
+	}
+	if _, ok := l.errs[key]; ok {
+		return true
+	}
+	return l.queued[key]
+}
+
+// flush fetches the pending keys. A failed fetch fails every key of the batch.
+func (l *batchLoader[K, V]) flush() {
+	if len(l.pending) == 0 {
+		return
+	}
+	keys := l.pending
+	l.pending = nil
+	clear(l.queued)
+
+	values, err := l.fetch(keys)
+	for _, key := range keys {
+		if err != nil {
+			l.errs[key] = err
+			continue
+		}
+		l.values[key] = values[key]
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchLoader_LoadsPendingKeysTogether(t *testing.T) {
+	var batches [][]string
+	loader := newBatchLoader(func(keys []string) (map[string]int, error) {
+		batches = append(batches, keys)
+		values := make(map[string]int, len(keys))
+		for _, key := range keys {
+			values[key] = len(key)
+		}
+		return values, nil
+	})
+
+	a := loader.load("a")
+	bb := loader.load("bb")
+	again := loader.load("a")
+
+	value, err := bb()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, value)
+	value, err = a()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+	value, err = again()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+
+	// 読み込み済みのキーは再取得しない
+	cached := loader.load("bb")
+	ccc := loader.load("ccc")
+	value, _ = cached()
+	assert.Equal(t, 2, value)
+	value, _ = ccc()
+	assert.Equal(t, 3, value)
+
+	assert.Equal(t, [][]string{{"a", "bb"}, {"ccc"}}, batches)
+}
+
+func TestBatchLoader_MissingKeyYieldsZeroValue(t *testing.T) {
+	loader := newBatchLoader(func(keys []string) (map[string]int, error) {
+		return map[string]int{}, nil
+	})
+
+	value, err := loader.load("unknown")()
+	assert.NoError(t, err)
+	assert.Zero(t, value)
+}
+
+func TestBatchLoader_ErrorFailsWholeBatch(t *testing.T) {
+	failure := errors.New("database error")
+	calls := 0
+	loader := newBatchLoader(func(keys []string) (map[string]int, error) {
+		calls++
+		return nil, failure
+	})
+
+	a := loader.load("a")
+	b := loader.load("b")
+
+	_, err := a()
+	assert.ErrorIs(t, err, failure)
+	_, err = b()
+	assert.ErrorIs(t, err, failure)
+	// 失敗もリクエスト中はキャッシュされる
+	_, err = loader.load("a")()
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+)
+
+// marcXMLNamespace is the namespace of MARCXML documents
+const marcXMLNamespace = "http://www.loc.gov/MARC21/slim"
+
+// Separators of an ISO 2709 record
+const (
+	marcSubfieldDelimiter = 0x1F
+	marcFieldTerminator   = 0x1E
+	marcRecordTerminator  = 0x1D
+)
+
+// ISO 2709 limits the length of a field to 4 digits and of a record to 5
+const (
+	marcMaxFieldLength  = 9999
+	marcMaxRecordLength = 99999
+)
+
+// marcRecord is a MARC 21 bibliographic record. The struct tags describe its MARCXML form;
+// encodeISO2709 and decodeISO2709 convert it to and from the binary form.
+//
+// Books map onto the record as follows:
+//
+//	001     book ID (export only)
+//	020 $a  ISBN
+//	100 $a  author (110 $a or the first 700 $a on import when there is no 100)
+//	245 $a  title ($b is appended as a subtitle on import)
+//	520 $a  description
+//	521 $a  purpose (target audience note)
+//	655 $a  genre (650 $a on import when there is no 655)
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// marcLeader returns a leader for a new, Unicode encoded monograph record with the
+// given record length and base address of data
+func marcLeader(length, baseAddress int) string {
+	return fmt.Sprintf("%05dnam a22%05d   4500", length, baseAddress)
+}
+
+// marcFromBook builds the record of a book
+func marcFromBook(book *models.Book) *marcRecord {
+	record := &marcRecord{
+		Leader:        marcLeader(0, 0),
+		ControlFields: []marcControlField{{Tag: "001", Value: strconv.FormatUint(uint64(book.ID), 10)}},
+	}
+	add := func(tag, ind1, ind2, value string) {
+		if value != "" {
+			record.DataFields = append(record.DataFields, marcDataField{
+				Tag: tag, Ind1: ind1, Ind2: ind2,
+				Subfields: []marcSubfield{{Code: "a", Value: value}},
+			})
+		}
+	}
+
+	// First indicator of 100: 1 for an inverted "Surname, Forename", 0 otherwise
+	nameIndicator := "0"
+	if strings.Contains(book.Author, ",") {
+		nameIndicator = "1"
+	}
+	titleIndicator := "0"
+	if book.Author != "" {
+		titleIndicator = "1"
+	}
+
+	add("020", " ", " ", book.ISBN)
+	add("100", nameIndicator, " ", book.Author)
+	add("245", titleIndicator, "0", book.Title)
+	add("520", " ", " ", book.Description)
+	add("521", " ", " ", book.Purpose)
+	add("655", " ", "4", book.Genre)
+	return record
+}
+
+// bookFromMARC reads the book fields from a record
+func bookFromMARC(record *marcRecord) dto.CreateBookRequest {
+	var book dto.CreateBookRequest
+
+	book.Title = trimISBD(record.subfield("245", "a"))
+	if subtitle := trimISBD(record.subfield("245", "b")); subtitle != "" {
+		book.Title += ": " + subtitle
+	}
+	book.Author = trimISBD(record.firstSubfield("a", "100", "110", "700"))
+	book.Genre = trimISBD(record.firstSubfield("a", "655", "650"))
+	book.Purpose = record.subfield("521", "a")
+	book.Description = record.subfield("520", "a")
+	if isbn := strings.Fields(record.subfield("020", "a")); len(isbn) > 0 {
+		// Qualifiers such as "(pbk.)" follow the number
+		book.ISBN = isbn[0]
+	}
+	return book
+}
+
+// subfield returns the first subfield code of the first field tag, or ""
+func (r *marcRecord) subfield(tag, code string) string {
+	for _, field := range r.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, subfield := range field.Subfields {
+			if subfield.Code == code {
+				return subfield.Value
+			}
+		}
+	}
+	return ""
+}
+
+// firstSubfield returns subfield code of the first of tags the record has
+func (r *marcRecord) firstSubfield(code string, tags ...string) string {
+	for _, tag := range tags {
+		if value := r.subfield(tag, code); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// trimISBD removes the ISBD punctuation cataloguers end title, name and subject
+// subfields with, as in "The great Gatsby /" or "Fitzgerald, F. Scott,". A final
+// period is kept after a capital letter, where it usually ends an initial.
+func trimISBD(s string) string {
+	s = strings.TrimRight(strings.TrimSpace(s), " /:;=,")
+	if strings.HasSuffix(s, ".") {
+		last, _ := utf8.DecodeLastRuneInString(s[:len(s)-1])
+		if !unicode.IsUpper(last) {
+			s = strings.TrimSpace(s[:len(s)-1])
+		}
+	}
+	return s
+}
+
+// encodeISO2709 returns the binary form of a record
+func encodeISO2709(record *marcRecord) ([]byte, error) {
+	var directory, data bytes.Buffer
+	entry := func(tag string, field []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("invalid MARC tag %q", tag)
+		}
+		if len(field) > marcMaxFieldLength {
+			return fmt.Errorf("MARC field %s is %d bytes long; the limit is %d", tag, len(field), marcMaxFieldLength)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(field), data.Len())
+		data.Write(field)
+		return nil
+	}
+
+	for _, field := range record.ControlFields {
+		if err := entry(field.Tag, append([]byte(field.Value), marcFieldTerminator)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range record.DataFields {
+		var b bytes.Buffer
+		b.WriteString(indicator(field.Ind1))
+		b.WriteString(indicator(field.Ind2))
+		for _, subfield := range field.Subfields {
+			b.WriteByte(marcSubfieldDelimiter)
+			b.WriteString(subfield.Code)
+			b.WriteString(subfield.Value)
+		}
+		b.WriteByte(marcFieldTerminator)
+		if err := entry(field.Tag, b.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	baseAddress := 24 + directory.Len() + 1
+	length := baseAddress + data.Len() + 1
+	if length > marcMaxRecordLength {
+		return nil, fmt.Errorf("MARC record is %d bytes long; the limit is %d", length, marcMaxRecordLength)
+	}
+
+	record.Leader = marcLeader(length, baseAddress)
+	out := make([]byte, 0, length)
+	out = append(out, record.Leader...)
+	out = append(out, directory.Bytes()...)
+	out = append(out, marcFieldTerminator)
+	out = append(out, data.Bytes()...)
+	return append(out, marcRecordTerminator), nil
+}
+
+// fitISO2709 shortens the data fields of record that are too long for ISO 2709 by
+// cutting the end of their last subfield at a character boundary. It returns the tags
+// of the shortened fields.
+func fitISO2709(record *marcRecord) []string {
+	var truncated []string
+	for i := range record.DataFields {
+		field := &record.DataFields[i]
+		// Two indicators and the field terminator
+		length := 3
+		for _, subfield := range field.Subfields {
+			length += 1 + len(subfield.Code) + len(subfield.Value)
+		}
+		if length <= marcMaxFieldLength || len(field.Subfields) == 0 {
+			continue
+		}
+
+		last := &field.Subfields[len(field.Subfields)-1]
+		end := max(len(last.Value)-(length-marcMaxFieldLength), 0)
+		for end > 0 && !utf8.RuneStart(last.Value[end]) {
+			end--
+		}
+		last.Value = last.Value[:end]
+		truncated = append(truncated, field.Tag)
+	}
+	return truncated
+}
+
+// indicator returns a MARC indicator, blank when unset
+func indicator(value string) string {
+	if len(value) != 1 {
+		return " "
+	}
+	return value
+}
+
+// decodeISO2709 parses the binary form of a single record, including its terminator
+func decodeISO2709(data []byte) (*marcRecord, error) {
+	if len(data) < 25 || data[len(data)-1] != marcRecordTerminator {
+		return nil, errors.New("truncated MARC record")
+	}
+	leader := string(data[:24])
+	if length, ok := marcNumber(data[:5]); !ok || length != len(data) {
+		return nil, fmt.Errorf("MARC record length %q does not match the %d bytes read", leader[:5], len(data))
+	}
+	if leader[9] != 'a' {
+		return nil, errors.New("MARC-8 records are not supported; convert the file to UTF-8 (leader position 09 = a)")
+	}
+	baseAddress, ok := marcNumber(data[12:17])
+	if !ok || baseAddress < 25 || baseAddress > len(data) || (baseAddress-25)%12 != 0 {
+		return nil, fmt.Errorf("invalid MARC base address %q", leader[12:17])
+	}
+
+	record := &marcRecord{Leader: leader}
+	directory := data[24 : baseAddress-1]
+	for i := 0; i < len(directory); i += 12 {
+		tag := string(directory[i : i+3])
+		length, ok1 := marcNumber(directory[i+3 : i+7])
+		start, ok2 := marcNumber(directory[i+7 : i+12])
+		end := baseAddress + start + length
+		if !ok1 || !ok2 || length < 1 || start < 0 || end > len(data)-1 {
+			return nil, fmt.Errorf("invalid MARC directory entry %q", directory[i:i+12])
+		}
+
+		field := bytes.TrimSuffix(data[baseAddress+start:end], []byte{marcFieldTerminator})
+		if !utf8.Valid(field) {
+			return nil, fmt.Errorf("MARC field %s is not valid UTF-8", tag)
+		}
+
+		if strings.HasPrefix(tag, "00") {
+			record.ControlFields = append(record.ControlFields, marcControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+		if len(field) < 2 {
+			return nil, fmt.Errorf("MARC field %s has no indicators", tag)
+		}
+		dataField := marcDataField{Tag: tag, Ind1: string(field[0]), Ind2: string(field[1])}
+		for _, subfield := range bytes.Split(field[2:], []byte{marcSubfieldDelimiter}) {
+			if len(subfield) == 0 {
+				continue
+			}
+			// The code is a single character, which may take several bytes in UTF-8
+			code, size := utf8.DecodeRune(subfield)
+			if code == utf8.RuneError {
+				return nil, fmt.Errorf("MARC field %s has an invalid subfield code", tag)
+			}
+			dataField.Subfields = append(dataField.Subfields, marcSubfield{
+				Code:  string(code),
+				Value: string(subfield[size:]),
+			})
+		}
+		record.DataFields = append(record.DataFields, dataField)
+	}
+	return record, nil
+}
+
+// marcNumber parses a numeric field of the leader or directory, which is made of ASCII
+// digits only; strconv.Atoi would also accept a sign
+func marcNumber(field []byte) (int, bool) {
+	n := 0
+	for _, b := range field {
+		if b < '0' || b > '9' {
+			return 0, false
+		}
+		n = n*10 + int(b-'0')
+	}
+	return n, len(field) > 0
+}
+
+// marcImportReader reads MARC 21 records in ISO 2709 form. Records have no lines, so
+// rows are numbered by record.
+type marcImportReader struct {
+	reader *bufio.Reader
+	record int
+}
+
+func (r *marcImportReader) next() (importRow, error) {
+	for {
+		data, err := r.reader.ReadBytes(marcRecordTerminator)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return importRow{}, err
+		}
+		// Some systems put a line break after every record
+		data = bytes.TrimLeft(data, " \t\r\n")
+		if len(data) == 0 {
+			if err != nil {
+				return importRow{}, err
+			}
+			continue
+		}
+
+		r.record++
+		row := importRow{line: r.record}
+		record, decodeErr := decodeISO2709(data)
+		if decodeErr != nil {
+			row.err = decodeErr
+		} else {
+			row.book = bookFromMARC(record)
+		}
+		return row, nil
+	}
+}
+
+// decodeMARCXML decodes a MARCXML record element
+func decodeMARCXML(decoder *xml.Decoder, start *xml.StartElement) (dto.CreateBookRequest, error) {
+	var record marcRecord
+	if err := decoder.DecodeElement(&record, start); err != nil {
+		return dto.CreateBookRequest{}, err
+	}
+	return bookFromMARC(&record), nil
+}
+
+// isMARCXMLRecord reports whether an element is a MARCXML record
+func isMARCXMLRecord(name xml.Name) bool {
+	return name.Local == "record" && (name.Space == marcXMLNamespace || name.Space == "")
+}
+
+// newMARCXMLBookEncoder writes a MARCXML collection holding a record per book
+func newMARCXMLBookEncoder(w io.Writer) (*xmlBookEncoder, error) {
+	root := xml.StartElement{
+		Name: xml.Name{Local: "collection"},
+		Attr: []xml.Attr{xmlns("", marcXMLNamespace)},
+	}
+	return newXMLBookEncoder(w, root, nil, func(encoder *xml.Encoder, book *models.Book) error {
+		return encoder.Encode(marcFromBook(book))
+	})
+}
+
+// iso2709BookEncoder writes MARC 21 records in ISO 2709 form
+type iso2709BookEncoder struct {
+	out io.Writer
+}
+
+func (e *iso2709BookEncoder) encode(book *models.Book) error {
+	record := marcFromBook(book)
+	// The export is streamed, so failing here would leave the client with a truncated
+	// file; a long description is cut to fit instead
+	for _, tag := range fitISO2709(record) {
+		log.Printf("book %d: MARC field %s truncated to %d bytes", book.ID, tag, marcMaxFieldLength)
+	}
+	data, err := encodeISO2709(record)
+	if err != nil {
+		return fmt.Errorf("book %d: %w", book.ID, err)
+	}
+	_, err = e.out.Write(data)
+	return err
+}
+
+func (e *iso2709BookEncoder) finish() error {
+	return nil
+}
+
+func (e *iso2709BookEncoder) release() {}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/ugorji/go/codec"
+)
+
+// mediaFormat is a representation the API reads request bodies in and writes responses in
+type mediaFormat struct {
+	// mediaTypes select the format in Accept and Content-Type headers; the first one is
+	// the canonical name
+	mediaTypes []string
+	// problemType is the Content-Type of problem details written in the format
+	problemType string
+}
+
+var (
+	formatJSON = &mediaFormat{
+		mediaTypes:  []string{"application/json", problemContentType},
+		problemType: problemContentType,
+	}
+	formatXML = &mediaFormat{
+		mediaTypes:  []string{"application/xml", "text/xml", "application/problem+xml"},
+		problemType: "application/problem+xml",
+	}
+	// MessagePack has no registered problem details type, so problems are plain MessagePack
+	// documents; clients tell them apart by the status code
+	formatMsgPack = &mediaFormat{
+		mediaTypes:  []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		problemType: "application/msgpack",
+	}
+)
+
+// mediaFormats lists the formats in the order of preference used to break ties
+var mediaFormats = []*mediaFormat{formatJSON, formatXML, formatMsgPack}
+
+// msgpackHandle writes MessagePack with the current spec's str and bin types, which
+// every maintained implementation reads, and reads strings as Go strings
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	return h
+}()
+
+// mediaRange is a single entry of an Accept header
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// negotiateFormat picks the response format from an Accept header (RFC 9110, section
+// 12.5.1). Each format gets the quality of the most specific range matching it; the
+// highest quality wins and ties go to the order of mediaFormats. JSON is used when the
+// header is missing or accepts none of the formats, rather than answering 406.
+func negotiateFormat(accept string) *mediaFormat {
+	ranges := parseAccept(accept)
+	best, bestQ := formatJSON, 0.0
+	for _, format := range mediaFormats {
+		if q := format.quality(ranges); q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// parseAccept returns the media ranges of an Accept header, skipping malformed ones
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "*" {
+			// Sent by some clients as a shorthand for */*
+			mediaType = "*/*"
+		}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// quality returns the quality of the most specific range matching one of the format's
+// media types, or 0 when none does
+func (f *mediaFormat) quality(ranges []mediaRange) float64 {
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		for _, mediaType := range f.mediaTypes {
+			typ, subtype, _ := strings.Cut(mediaType, "/")
+			s := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*" && r.subtype == "*":
+				s = 0
+			}
+			if s > specificity || (s == specificity && s >= 0 && r.q > quality) {
+				quality, specificity = r.q, s
+			}
+		}
+	}
+	return quality
+}
+
+// requestFormat returns the format of a request body from its Content-Type. Bodies
+// without one, or of a type no format claims, are read as JSON as they always were.
+func requestFormat(contentType string) *mediaFormat {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return formatJSON
+	}
+	for _, format := range mediaFormats {
+		for _, candidate := range format.mediaTypes {
+			if mediaType == candidate {
+				return format
+			}
+		}
+	}
+	return formatJSON
+}
+
+// decode reads a document in the format from r into obj
+func (f *mediaFormat) decode(r io.Reader, obj any) error {
+	switch f {
+	case formatXML:
+		return xml.NewDecoder(r).Decode(obj)
+	case formatMsgPack:
+		return codec.NewDecoder(r, msgpackHandle).Decode(obj)
+	default:
+		return json.NewDecoder(r).Decode(obj)
+	}
+}
+
+// renderer returns the gin renderer writing obj in the format
+func (f *mediaFormat) renderer(obj any) render.Render {
+	switch f {
+	case formatXML:
+		return render.XML{Data: obj}
+	case formatMsgPack:
+		return msgpackRender{data: obj}
+	default:
+		return render.JSON{Data: obj}
+	}
+}
+
+// respond writes obj with the given status in the format negotiated from the Accept header
+func respond(c *gin.Context, status int, obj any) {
+	varyAccept(c)
+	c.Render(status, negotiateFormat(c.GetHeader("Accept")).renderer(obj))
+}
+
+// varyAccept marks the response as negotiated from the Accept header, once
+func varyAccept(c *gin.Context) {
+	for _, vary := range c.Writer.Header().Values("Vary") {
+		if vary == "Accept" {
+			return
+		}
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+}
+
+// msgpackRender writes MessagePack with msgpackHandle. gin's own renderer uses the
+// legacy raw type for strings and labels the binary body with a charset.
+type msgpackRender struct {
+	data any
+}
+
+func (r msgpackRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return codec.NewEncoder(w, msgpackHandle).Encode(r.data)
+}
+
+func (r msgpackRender) WriteContentType(w http.ResponseWriter) {
+	if header := w.Header(); header.Get("Content-Type") == "" {
+		header.Set("Content-Type", formatMsgPack.mediaTypes[0])
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected *mediaFormat
+	}{
+		{"ヘッダーなしはJSON", "", formatJSON},
+		{"JSON", "application/json", formatJSON},
+		{"XML", "application/xml", formatXML},
+		{"text/xmlもXML", "text/xml", formatXML},
+		{"MessagePack", "application/msgpack", formatMsgPack},
+		{"MessagePackの別名", "application/vnd.msgpack", formatMsgPack},
+		{"パラメータと大文字小文字を無視", "Application/XML; charset=utf-8", formatXML},
+		{"q値の高い形式を選ぶ", "application/json;q=0.4, application/xml;q=0.8", formatXML},
+		{"ワイルドカードはJSON", "*/*", formatJSON},
+		{"具体的な指定がワイルドカードに優先", "application/*;q=0.9, application/json;q=0.1", formatXML},
+		{"q=0の形式は選ばない", "application/json;q=0, */*", formatXML},
+		{"対応する形式がなければJSON", "text/html", formatJSON},
+		{"すべて拒否されてもJSON", "*/*;q=0", formatJSON},
+		{"不正な範囲は読み飛ばす", "garbage;;, application/msgpack", formatMsgPack},
+		{"範囲外のq値は読み飛ばす", "application/json;q=2, application/xml;q=0.5", formatXML},
+		{"problem+jsonはJSON", "application/problem+json", formatJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Same(t, tt.expected, negotiateFormat(tt.accept))
+		})
+	}
+}
+
+func TestRequestFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		expected    *mediaFormat
+	}{
+		{"Content-TypeなしはJSON", "", formatJSON},
+		{"JSON", "application/json; charset=utf-8", formatJSON},
+		{"XML", "application/xml", formatXML},
+		{"text/xml", "text/xml; charset=utf-8", formatXML},
+		{"MessagePack", "application/x-msgpack", formatMsgPack},
+		{"未知の形式は従来どおりJSON", "text/plain", formatJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Same(t, tt.expected, requestFormat(tt.contentType))
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+)
+
+// onixNamespace is the namespace of ONIX for Books 3.0 messages with reference tags.
+// Messages with short tags are not supported.
+const onixNamespace = "http://ns.editeur.org/onix/3.0/reference"
+
+// Code list values used when reading and writing ONIX
+const (
+	onixNotificationConfirmed = "03"  // List 1: notification confirmed on publication
+	onixIDProprietary         = "01"  // List 5: proprietary product identifier
+	onixIDISBN10              = "02"  // List 5: ISBN-10
+	onixIDISBN13              = "15"  // List 5: ISBN-13
+	onixTitleDistinctive      = "01"  // List 15: distinctive title
+	onixTitleLevelProduct     = "01"  // List 149: product level title
+	onixRoleAuthor            = "A01" // List 17: by (author)
+	onixSubjectKeywords       = "20"  // List 27: keywords
+	onixAudienceProprietary   = "02"  // List 29: proprietary audience code
+	onixTextDescription       = "03"  // List 153: description
+	onixTextShortDescription  = "02"  // List 153: short description
+	onixContentAudienceAll    = "00"  // List 154: unrestricted
+
+	// onixPurposeAudience names the proprietary audience code scheme holding the purpose
+	onixPurposeAudience = "recomemento:purpose"
+)
+
+// onixProduct is the Product record of an ONIX message. Books map onto it as follows:
+//
+//	RecordReference                      book ID (export only)
+//	ProductIdentifier (15 or 02)         ISBN
+//	TitleDetail (01) / TitleElement      title; a TitlePrefix and a Subtitle are joined on import
+//	Contributor (A01)                    author
+//	Subject (20, keywords)               genre; the first subject of any scheme on import
+//	Audience (02, recomemento:purpose)   purpose
+//	TextContent (03 or 02)               description
+type onixProduct struct {
+	XMLName            xml.Name                `xml:"Product"`
+	RecordReference    string                  `xml:"RecordReference"`
+	NotificationType   string                  `xml:"NotificationType"`
+	ProductIdentifiers []onixProductIdentifier `xml:"ProductIdentifier"`
+	DescriptiveDetail  onixDescriptiveDetail   `xml:"DescriptiveDetail"`
+	CollateralDetail   *onixCollateralDetail   `xml:"CollateralDetail,omitempty"`
+}
+
+type onixProductIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDTypeName    string `xml:"IDTypeName,omitempty"`
+	IDValue       string `xml:"IDValue"`
+}
+
+type onixDescriptiveDetail struct {
+	ProductComposition string            `xml:"ProductComposition"`
+	ProductForm        string            `xml:"ProductForm"`
+	TitleDetails       []onixTitleDetail `xml:"TitleDetail"`
+	Contributors       []onixContributor `xml:"Contributor"`
+	Subjects           []onixSubject     `xml:"Subject"`
+	Audiences          []onixAudience    `xml:"Audience"`
+}
+
+type onixTitleDetail struct {
+	TitleType     string             `xml:"TitleType"`
+	TitleElements []onixTitleElement `xml:"TitleElement"`
+}
+
+type onixTitleElement struct {
+	TitleElementLevel  string `xml:"TitleElementLevel"`
+	TitleText          string `xml:"TitleText,omitempty"`
+	TitlePrefix        string `xml:"TitlePrefix,omitempty"`
+	TitleWithoutPrefix string `xml:"TitleWithoutPrefix,omitempty"`
+	Subtitle           string `xml:"Subtitle,omitempty"`
+}
+
+type onixContributor struct {
+	SequenceNumber     int      `xml:"SequenceNumber,omitempty"`
+	ContributorRoles   []string `xml:"ContributorRole"`
+	PersonName         string   `xml:"PersonName,omitempty"`
+	PersonNameInverted string   `xml:"PersonNameInverted,omitempty"`
+	CorporateName      string   `xml:"CorporateName,omitempty"`
+}
+
+type onixSubject struct {
+	SubjectSchemeIdentifier string `xml:"SubjectSchemeIdentifier"`
+	SubjectCode             string `xml:"SubjectCode,omitempty"`
+	SubjectHeadingText      string `xml:"SubjectHeadingText,omitempty"`
+}
+
+type onixAudience struct {
+	AudienceCodeType     string `xml:"AudienceCodeType"`
+	AudienceCodeTypeName string `xml:"AudienceCodeTypeName,omitempty"`
+	AudienceCodeValue    string `xml:"AudienceCodeValue"`
+}
+
+type onixCollateralDetail struct {
+	TextContents []onixTextContent `xml:"TextContent"`
+}
+
+type onixTextContent struct {
+	TextType        string   `xml:"TextType"`
+	ContentAudience string   `xml:"ContentAudience"`
+	Text            onixText `xml:"Text"`
+}
+
+// onixText is the text of a TextContent. Publishers send it as plain text, as escaped
+// HTML or as XHTML child elements; all of them are read as text, leaving any markup for
+// the sanitizer to remove.
+type onixText string
+
+// onixBlockElements end a line when XHTML text is read as plain text
+var onixBlockElements = map[string]bool{"p": true, "br": true, "div": true, "li": true}
+
+func (t *onixText) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	var b strings.Builder
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth > 0 && onixBlockElements[token.Name.Local] {
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			b.Write(token)
+		}
+	}
+	*t = onixText(strings.TrimSpace(b.String()))
+	return nil
+}
+
+// isONIXProduct reports whether an element is an ONIX product record
+func isONIXProduct(name xml.Name) bool {
+	return name.Local == "Product" && (name.Space == onixNamespace || name.Space == "")
+}
+
+// decodeONIX decodes an ONIX Product element
+func decodeONIX(decoder *xml.Decoder, start *xml.StartElement) (dto.CreateBookRequest, error) {
+	var product onixProduct
+	if err := decoder.DecodeElement(&product, start); err != nil {
+		return dto.CreateBookRequest{}, err
+	}
+	return bookFromONIX(&product), nil
+}
+
+// bookFromONIX reads the book fields from a product
+func bookFromONIX(product *onixProduct) dto.CreateBookRequest {
+	var book dto.CreateBookRequest
+	detail := product.DescriptiveDetail
+
+	for _, titleDetail := range detail.TitleDetails {
+		if titleDetail.TitleType != onixTitleDistinctive {
+			continue
+		}
+		for _, element := range titleDetail.TitleElements {
+			if element.TitleElementLevel != onixTitleLevelProduct {
+				continue
+			}
+			book.Title = element.TitleText
+			if book.Title == "" {
+				book.Title = strings.TrimSpace(element.TitlePrefix + " " + element.TitleWithoutPrefix)
+			}
+			if element.Subtitle != "" {
+				book.Title += ": " + element.Subtitle
+			}
+			break
+		}
+		break
+	}
+
+	for _, contributor := range detail.Contributors {
+		if !slices.Contains(contributor.ContributorRoles, onixRoleAuthor) {
+			continue
+		}
+		for _, name := range []string{contributor.PersonName, contributor.CorporateName, contributor.PersonNameInverted} {
+			if name != "" {
+				book.Author = name
+				break
+			}
+		}
+		break
+	}
+
+	for _, subject := range detail.Subjects {
+		if subject.SubjectHeadingText == "" {
+			continue
+		}
+		if book.Genre == "" || subject.SubjectSchemeIdentifier == onixSubjectKeywords {
+			book.Genre = subject.SubjectHeadingText
+		}
+		if subject.SubjectSchemeIdentifier == onixSubjectKeywords {
+			break
+		}
+	}
+
+	for _, audience := range detail.Audiences {
+		if audience.AudienceCodeType == onixAudienceProprietary && audience.AudienceCodeTypeName == onixPurposeAudience {
+			book.Purpose = audience.AudienceCodeValue
+			break
+		}
+	}
+
+	if product.CollateralDetail != nil {
+		for _, textType := range []string{onixTextDescription, onixTextShortDescription} {
+			for _, content := range product.CollateralDetail.TextContents {
+				if content.TextType == textType && book.Description == "" {
+					book.Description = string(content.Text)
+				}
+			}
+		}
+	}
+
+	for _, idType := range []string{onixIDISBN13, onixIDISBN10} {
+		for _, identifier := range product.ProductIdentifiers {
+			if identifier.ProductIDType == idType && book.ISBN == "" {
+				book.ISBN = identifier.IDValue
+			}
+		}
+	}
+	return book
+}
+
+// onixFromBook builds the product record of a book
+func onixFromBook(book *models.Book) *onixProduct {
+	product := &onixProduct{
+		RecordReference:  fmt.Sprintf("recomemento:book:%d", book.ID),
+		NotificationType: onixNotificationConfirmed,
+		DescriptiveDetail: onixDescriptiveDetail{
+			ProductComposition: "00", // List 2: single-component retail product
+			ProductForm:        "BA", // List 150: book, detail unspecified
+			TitleDetails: []onixTitleDetail{{
+				TitleType: onixTitleDistinctive,
+				TitleElements: []onixTitleElement{{
+					TitleElementLevel: onixTitleLevelProduct,
+					TitleText:         book.Title,
+				}},
+			}},
+			Contributors: []onixContributor{{
+				SequenceNumber:   1,
+				ContributorRoles: []string{onixRoleAuthor},
+				PersonName:       book.Author,
+			}},
+			Subjects: []onixSubject{{
+				SubjectSchemeIdentifier: onixSubjectKeywords,
+				SubjectHeadingText:      book.Genre,
+			}},
+			Audiences: []onixAudience{{
+				AudienceCodeType:     onixAudienceProprietary,
+				AudienceCodeTypeName: onixPurposeAudience,
+				AudienceCodeValue:    book.Purpose,
+			}},
+		},
+	}
+
+	// Every product needs an identifier; without an ISBN the book ID is used
+	switch len(book.ISBN) {
+	case 13:
+		product.ProductIdentifiers = []onixProductIdentifier{{ProductIDType: onixIDISBN13, IDValue: book.ISBN}}
+	case 10:
+		product.ProductIdentifiers = []onixProductIdentifier{{ProductIDType: onixIDISBN10, IDValue: book.ISBN}}
+	default:
+		product.ProductIdentifiers = []onixProductIdentifier{{
+			ProductIDType: onixIDProprietary,
+			IDTypeName:    "recomemento",
+			IDValue:       fmt.Sprint(book.ID),
+		}}
+	}
+
+	if book.Description != "" {
+		product.CollateralDetail = &onixCollateralDetail{TextContents: []onixTextContent{{
+			TextType:        onixTextDescription,
+			ContentAudience: onixContentAudienceAll,
+			Text:            onixText(book.Description),
+		}}}
+	}
+	return product
+}
+
+// onixHeader is the Header of an ONIX message
+type onixHeader struct {
+	XMLName      xml.Name `xml:"Header"`
+	SenderName   string   `xml:"Sender>SenderName"`
+	SentDateTime string   `xml:"SentDateTime"`
+}
+
+// newONIXBookEncoder writes an ONIX message holding a Product per book
+func newONIXBookEncoder(w io.Writer) (*xmlBookEncoder, error) {
+	root := xml.StartElement{
+		Name: xml.Name{Local: "ONIXMessage"},
+		Attr: []xml.Attr{
+			xmlns("", onixNamespace),
+			{Name: xml.Name{Local: "release"}, Value: "3.0"},
+		},
+	}
+	header := onixHeader{
+		SenderName:   "Recomemento",
+		SentDateTime: time.Now().UTC().Format("20060102T1504Z"),
+	}
+	return newXMLBookEncoder(w, root, header, func(encoder *xml.Encoder, book *models.Book) error {
+		return encoder.Encode(onixFromBook(book))
+	})
+}
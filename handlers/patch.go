@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	// mimeMergePatch is the media type of RFC 7396 JSON Merge Patch documents
+	mimeMergePatch = "application/merge-patch+json"
+	// mimeJSONPatch is the media type of RFC 6902 JSON Patch documents
+	mimeJSONPatch = "application/json-patch+json"
+)
+
+// maxPatchAttempts bounds how often an unconditional change is re-applied after
+// losing a race against a concurrent write
+const maxPatchAttempts = 3
+
+// bookChange derives the new full representation of a book from its current one
+type bookChange func(current dto.ReplaceBookRequest) (dto.ReplaceBookRequest, error)
+
+// bindBookPatch decodes a PATCH body according to its Content-Type. Plain JSON keeps the
+// UpdateBookRequest semantics where omitted fields are left untouched. Patch documents
+// are limited to maxBodyBytes like other bodies.
+func bindBookPatch(c *gin.Context) (bookChange, error) {
+	switch c.ContentType() {
+	case mimeMergePatch:
+		body, err := readLimitedBody(c.Request)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(body) {
+			return nil, errors.New("merge patch must be a valid JSON document")
+		}
+		return func(current dto.ReplaceBookRequest) (dto.ReplaceBookRequest, error) {
+			return applyToDocument(current, func(doc []byte) ([]byte, error) {
+				return jsonpatch.MergePatch(doc, body)
+			})
+		}, nil
+
+	case mimeJSONPatch:
+		body, err := readLimitedBody(c.Request)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, err
+		}
+		return func(current dto.ReplaceBookRequest) (dto.ReplaceBookRequest, error) {
+			return applyToDocument(current, patch.Apply)
+		}, nil
+
+	default:
+		var req dto.UpdateBookRequest
+		if err := c.ShouldBindWith(&req, sanitizedBody); err != nil {
+			return nil, err
+		}
+		return func(current dto.ReplaceBookRequest) (dto.ReplaceBookRequest, error) {
+			return applyUpdateRequest(current, req), nil
+		}, nil
+	}
+}
+
+// readLimitedBody reads the whole body of req, up to maxBodyBytes
+func readLimitedBody(req *http.Request) ([]byte, error) {
+	body, err := limitedBody(req, maxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(body)
+}
+
+// applyUpdateRequest overwrites the fields of current that are present in req
+func applyUpdateRequest(current dto.ReplaceBookRequest, req dto.UpdateBookRequest) dto.ReplaceBookRequest {
+	if req.Title != nil {
+		current.Title = *req.Title
+	}
+	if req.Author != nil {
+		current.Author = *req.Author
+	}
+	if req.Genre != nil {
+		current.Genre = *req.Genre
+	}
+	if req.Purpose != nil {
+		current.Purpose = *req.Purpose
+	}
+	if req.Description != nil {
+		current.Description = *req.Description
+	}
+	if req.ISBN != nil {
+		current.ISBN = *req.ISBN
+	}
+	return current
+}
+
+// applyToDocument runs a patch against the JSON form of a book and decodes the result,
+// rejecting members that are not part of the book representation
+func applyToDocument(current dto.ReplaceBookRequest, apply func(doc []byte) ([]byte, error)) (dto.ReplaceBookRequest, error) {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return dto.ReplaceBookRequest{}, err
+	}
+
+	patched, err := apply(doc)
+	if err != nil {
+		return dto.ReplaceBookRequest{}, err
+	}
+
+	var next dto.ReplaceBookRequest
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&next); err != nil {
+		return dto.ReplaceBookRequest{}, err
+	}
+	return next, nil
+}
+
+// bookDocument returns the patchable representation of a book
+func bookDocument(book *models.Book) dto.ReplaceBookRequest {
+	return dto.ReplaceBookRequest{
+		Title:       book.Title,
+		Author:      book.Author,
+		Genre:       book.Genre,
+		Purpose:     book.Purpose,
+		Description: book.Description,
+		ISBN:        book.ISBN,
+	}
+}
+
+// changedBookFields returns the column updates needed to turn current into next
+func changedBookFields(current *models.Book, next dto.ReplaceBookRequest) map[string]interface{} {
+	updates := make(map[string]interface{})
+	if next.Title != current.Title {
+		updates["title"] = next.Title
+	}
+	if next.Author != current.Author {
+		updates["author"] = next.Author
+	}
+	if next.Genre != current.Genre {
+		updates["genre"] = next.Genre
+	}
+	if next.Purpose != current.Purpose {
+		updates["purpose"] = next.Purpose
+	}
+	if next.Description != current.Description {
+		updates["description"] = next.Description
+	}
+	if next.ISBN != current.ISBN {
+		updates["isbn"] = next.ISBN
+	}
+	return updates
+}
+
+// applyBookChange applies a change to a book, conditionally on If-Match when the request
+// carries one, and writes the updated book
+func (h *BookHandler) applyBookChange(c *gin.Context, id uint, change bookChange) {
+	var precondition func(current *models.Book) bool
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		precondition = func(current *models.Book) bool {
+			return versionMatches(ifMatch, current)
+		}
+	}
+
+	book, err := h.changeBook(id, precondition, change)
+	if err != nil {
+		AbortWithProblem(c, err)
+		return
+	}
+
+	response := dto.BookResponse{
+		ID:          book.ID,
+		Title:       book.Title,
+		Author:      book.Author,
+		Genre:       book.Genre,
+		Purpose:     book.Purpose,
+		Description: book.Description,
+		ISBN:        book.ISBN,
+	}
+
+	c.Header("ETag", representationETag(book, negotiateFormat(c.GetHeader("Accept")), bookRepresentation{}))
+	respond(c, http.StatusOK, response)
+}
+
+// changeBook reads the book, applies the change, sanitizes and validates the result
+// against the same rules as creation and writes it conditionally on the version that was
+// read. Unless precondition is nil, it must hold for the book that was read and a
+// concurrent write fails the change; without one, lost races are retried.
+func (h *BookHandler) changeBook(id uint, precondition func(current *models.Book) bool, change bookChange) (*models.Book, error) {
+	for attempt := 1; ; attempt++ {
+		current, err := h.bookRepo.GetByID(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if precondition != nil && !precondition(current) {
+			return nil, NewAppError(dto.CodePreconditionFailed)
+		}
+
+		next, err := change(bookDocument(current))
+		if err != nil {
+			return nil, NewAppError(dto.CodeInvalidPatch, err.Error())
+		}
+
+		sanitize(&next)
+		if err := binding.Validator.ValidateStruct(&next); err != nil {
+			return nil, bindError(err)
+		}
+
+		book, err := h.bookRepo.UpdateIfVersion(id, current.Version, changedBookFields(current, next))
+		if errors.Is(err, models.ErrVersionMismatch) && precondition == nil && attempt < maxPatchAttempts {
+			continue
+		}
+		return book, err
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+	"recomemento-api-go/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RateLimits configures the limit of each class of operation. Each class has its own
+// bucket per client.
+type RateLimits struct {
+	// Default applies to every operation
+	Default ratelimit.Limit
+	// Recommend additionally applies to recommendations, the most expensive reads, so
+	// exhausting it leaves the other operations available
+	Recommend ratelimit.Limit
+	// IP applies to every request of an IP address before authentication, so that
+	// requests failing it, such as guesses of API keys, are limited too
+	IP ratelimit.Limit
+}
+
+// RateLimiter limits the requests of each client. Clients are identified by their API
+// key or user once authenticated, and by IP address otherwise. Every request is also
+// limited by IP address before authentication. A nil RateLimiter lets every request
+// through.
+type RateLimiter struct {
+	store  ratelimit.Store
+	limits RateLimits
+	now    func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter keeping its buckets in store
+func NewRateLimiter(store ratelimit.Store, limits RateLimits) *RateLimiter {
+	return &RateLimiter{store: store, limits: limits, now: time.Now}
+}
+
+// IP returns middleware applying the limit per IP address. It must run before
+// authentication, so that the requests it rejects are counted as well.
+func (l *RateLimiter) IP() gin.HandlerFunc {
+	if l == nil {
+		return l.middleware("ip", ratelimit.Limit{}, nil)
+	}
+	return l.middleware("ip", l.limits.IP, func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	})
+}
+
+// Default returns middleware applying the default limit. It must run after
+// authentication so that authenticated clients get buckets of their own.
+func (l *RateLimiter) Default() gin.HandlerFunc {
+	if l == nil {
+		return l.middleware("default", ratelimit.Limit{}, nil)
+	}
+	return l.middleware("default", l.limits.Default, principalClient)
+}
+
+// Recommend returns middleware applying the recommendation limit
+func (l *RateLimiter) Recommend() gin.HandlerFunc {
+	if l == nil {
+		return l.middleware("recommend", ratelimit.Limit{}, nil)
+	}
+	return l.middleware("recommend", l.limits.Recommend, principalClient)
+}
+
+// principalClient identifies the client of a request by its principal
+func principalClient(c *gin.Context) string {
+	return rateLimitClient(c.Request.Context(), c.ClientIP())
+}
+
+// middleware limits requests by the bucket of class for the client identified by
+// client. Every response carries the RateLimit-* headers of
+// draft-ietf-httpapi-ratelimit-headers, those of the last limit applied; rejected
+// requests are answered with 429 and Retry-After.
+func (l *RateLimiter) middleware(class string, limit ratelimit.Limit, client func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		result, ok := l.take(c.Request.Context(), class, limit, client(c))
+		if !ok {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+strconv.Itoa(ceilSeconds(limit.Period)))
+		header.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			AbortWithProblem(c, NewAppError(dto.CodeRateLimited, retryAfter))
+			return
+		}
+		c.Next()
+	}
+}
+
+// take takes a token from the bucket of client for class. Failures of the store are
+// logged and let the request through: an unavailable store should not take the API
+// down with it.
+func (l *RateLimiter) take(ctx context.Context, class string, limit ratelimit.Limit, client string) (ratelimit.Result, bool) {
+	result, err := l.store.Take(ctx, class+":"+client, limit, l.now())
+	if err != nil {
+		log.Printf("rate limit %s for %s: %v", class, client, err)
+		return ratelimit.Result{}, false
+	}
+	return result, true
+}
+
+// rateLimitClient identifies the client of a request for rate limiting
+func rateLimitClient(ctx context.Context, ip string) string {
+	if principal, ok := auth.FromContext(ctx); ok {
+		if principal.IsAPIKey() {
+			return "key:" + strconv.FormatUint(uint64(principal.APIKeyID), 10)
+		}
+		return "user:" + principal.Subject
+	}
+	return "ip:" + ip
+}
+
+// ceilSeconds rounds d up to whole seconds, as the rate limit headers express time
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// grpcRecommendMethod is the gRPC method limited like the recommend endpoint
+const grpcRecommendMethod = "/recomemento.book.v1.BookService/RecommendBook"
+
+// grpcLimit is a limit applied to gRPC calls
+type grpcLimit struct {
+	class string
+	limit ratelimit.Limit
+}
+
+// grpcLimits returns the limits of a gRPC method in the order they apply. Like the
+// recommend endpoint, recommendations count against the default limit as well.
+func (l *RateLimiter) grpcLimits(method string) []grpcLimit {
+	limits := []grpcLimit{{"default", l.limits.Default}}
+	if method == grpcRecommendMethod {
+		limits = append(limits, grpcLimit{"recommend", l.limits.Recommend})
+	}
+	return limits
+}
+
+// grpcPeerIP returns the IP address of the peer of a gRPC call
+func grpcPeerIP(ctx context.Context) string {
+	var ip string
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	return ip
+}
+
+// grpcTake takes a token for a gRPC call from the bucket of its principal, or of its
+// peer address when byIP is set, returning a ResourceExhausted status with a RetryInfo
+// detail when the client has none left
+func (l *RateLimiter) grpcTake(ctx context.Context, method string, byIP bool) error {
+	ip := grpcPeerIP(ctx)
+	limits, client := l.grpcLimits(method), rateLimitClient(ctx, ip)
+	if byIP {
+		limits, client = []grpcLimit{{"ip", l.limits.IP}}, "ip:"+ip
+	}
+
+	for _, limit := range limits {
+		if !limit.limit.Enabled() {
+			continue
+		}
+		result, ok := l.take(ctx, limit.class, limit.limit, client)
+		if ok && !result.Allowed {
+			return l.grpcRateLimited(ctx, method, result)
+		}
+	}
+	return nil
+}
+
+// grpcRateLimited returns the ResourceExhausted status of a call over its limit
+func (l *RateLimiter) grpcRateLimited(ctx context.Context, method string, result ratelimit.Result) error {
+	retryAfter := ceilSeconds(result.RetryAfter)
+	err := grpcError(ctx, method, NewAppError(dto.CodeRateLimited, retryAfter), false)
+	st := status.Convert(err)
+	if withRetry, detailErr := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Duration(retryAfter) * time.Second),
+	}); detailErr == nil {
+		st = withRetry
+	}
+	return st.Err()
+}
+
+// UnaryServerInterceptor limits unary gRPC calls like the HTTP middleware does requests.
+// It must be chained after authentication.
+func (l *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return l.unaryInterceptor(false)
+}
+
+// StreamServerInterceptor limits streaming gRPC calls; a stream takes a single token
+// however many messages it carries
+func (l *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return l.streamInterceptor(false)
+}
+
+// IPUnaryServerInterceptor limits unary gRPC calls per peer address like IP does
+// requests. It must be chained before authentication.
+func (l *RateLimiter) IPUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return l.unaryInterceptor(true)
+}
+
+// IPStreamServerInterceptor limits streaming gRPC calls per peer address. It must be
+// chained before authentication.
+func (l *RateLimiter) IPStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return l.streamInterceptor(true)
+}
+
+func (l *RateLimiter) unaryInterceptor(byIP bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if l != nil {
+			if err := l.grpcTake(ctx, info.FullMethod, byIP); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (l *RateLimiter) streamInterceptor(byIP bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if l != nil {
+			if err := l.grpcTake(stream.Context(), info.FullMethod, byIP); err != nil {
+				return err
+			}
+		}
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+	bookv1 "recomemento-api-go/proto/book/v1"
+	"recomemento-api-go/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTestRateLimiter creates a limiter over a memory store whose clock stands still at
+// the returned time until the test moves it
+func newTestRateLimiter(limits RateLimits) (*RateLimiter, *time.Time) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(ratelimit.NewMemoryStore(), limits)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+// newRateLimitedRouter serves /books and /books/recommend behind authenticator and
+// limiter, like registerAPIRoutes does
+func newRateLimitedRouter(authenticator *Authenticator, limiter *RateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(limiter.IP())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/books", authenticator.Require(auth.ReadBooks), limiter.Default(), ok)
+	r.POST("/books/recommend", authenticator.Require(auth.Recommend), limiter.Default(), limiter.Recommend(), ok)
+	return r
+}
+
+// serveRateLimited serves a request to r with the given headers as "key", "value" pairs
+func serveRateLimited(r http.Handler, method, url string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimiter_Headers(t *testing.T) {
+	limiter, _ := newTestRateLimiter(RateLimits{Default: ratelimit.Limit{Requests: 3, Period: time.Minute}})
+	r := newRateLimitedRouter(nil, limiter)
+
+	w := serveRateLimited(r, "GET", "/books")
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "3;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "20", w.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
+
+func TestRateLimiter_Rejects(t *testing.T) {
+	limiter, now := newTestRateLimiter(RateLimits{Default: ratelimit.Limit{Requests: 2, Period: time.Minute}})
+	r := newRateLimitedRouter(nil, limiter)
+
+	for i := 0; i < 2; i++ {
+		require.Equal(t, http.StatusNoContent, serveRateLimited(r, "GET", "/books").Code)
+	}
+	w := serveRateLimited(r, "GET", "/books", "Accept-Language", "ja")
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	var response dto.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, dto.CodeRateLimited, response.Code)
+	assert.Equal(t, "リクエスト数の上限を超えました。30 秒後に再試行してください", response.Detail)
+
+	// トークンが補充されれば再び通る
+	*now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusNoContent, serveRateLimited(r, "GET", "/books").Code)
+}
+
+func TestRateLimiter_KeysByClient(t *testing.T) {
+	verifier := fakeVerifier{
+		"reader-token": testVerifier["reader-token"],
+		"other-token":  {Subject: "other", Roles: []auth.Role{auth.RoleReader}},
+	}
+	apiKeys := fakeVerifier{
+		"rk_0123456789abcdef_secret": {Subject: "api-key:1", APIKeyID: 1, Scopes: []auth.Scope{auth.ScopeBooksRead}},
+	}
+	limiter, _ := newTestRateLimiter(RateLimits{Default: ratelimit.Limit{Requests: 1, Period: time.Minute}})
+	r := newRateLimitedRouter(NewAuthenticator(verifier, apiKeys), limiter)
+
+	clients := map[string][]string{
+		"ユーザー":   {"Authorization", "Bearer reader-token"},
+		"別のユーザー": {"Authorization", "Bearer other-token"},
+		"APIキー":  {"X-API-Key", "rk_0123456789abcdef_secret"},
+	}
+	for name, headers := range clients {
+		t.Run(name, func(t *testing.T) {
+			// クライアントごとにバケットが分かれる
+			assert.Equal(t, http.StatusNoContent, serveRateLimited(r, "GET", "/books", headers...).Code)
+			assert.Equal(t, http.StatusTooManyRequests, serveRateLimited(r, "GET", "/books", headers...).Code)
+		})
+	}
+}
+
+func TestRateLimiter_KeysAnonymousClientsByIP(t *testing.T) {
+	limiter, _ := newTestRateLimiter(RateLimits{Default: ratelimit.Limit{Requests: 1, Period: time.Minute}})
+	r := newRateLimitedRouter(nil, limiter)
+
+	assert.Equal(t, http.StatusNoContent, serveRateLimited(r, "GET", "/books").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveRateLimited(r, "GET", "/books").Code)
+
+	req := httptest.NewRequest("GET", "/books", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestRateLimiter_LimitsByIPBeforeAuthentication(t *testing.T) {
+	limiter, _ := newTestRateLimiter(RateLimits{
+		Default: ratelimit.Limit{Requests: 10, Period: time.Minute},
+		IP:      ratelimit.Limit{Requests: 3, Period: time.Minute},
+	})
+	r := newRateLimitedRouter(NewAuthenticator(testVerifier, nil), limiter)
+
+	// 認証に失敗するリクエストも IP アドレスごとに数えられる
+	for i := 0; i < 2; i++ {
+		w := serveRateLimited(r, "GET", "/books", "Authorization", "Bearer wrong-token")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+	}
+	w := serveRateLimited(r, "GET", "/books", "Authorization", "Bearer reader-token")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	// 認証後はクライアントごとの上限のヘッダーになる
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+
+	w = serveRateLimited(r, "GET", "/books", "Authorization", "Bearer wrong-token")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveRateLimited(r, "GET", "/books", "Authorization", "Bearer reader-token").Code)
+
+	// 別の IP アドレスは制限されない
+	req := httptest.NewRequest("GET", "/books", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRateLimiter_RecommendHasItsOwnLimit(t *testing.T) {
+	limiter, _ := newTestRateLimiter(RateLimits{
+		Default:   ratelimit.Limit{Requests: 5, Period: time.Minute},
+		Recommend: ratelimit.Limit{Requests: 1, Period: time.Minute},
+	})
+	r := newRateLimitedRouter(nil, limiter)
+
+	w := serveRateLimited(r, "POST", "/books/recommend")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, http.StatusTooManyRequests, serveRateLimited(r, "POST", "/books/recommend").Code)
+
+	// 推薦の上限に達しても他の操作は制限されない
+	assert.Equal(t, http.StatusNoContent, serveRateLimited(r, "GET", "/books").Code)
+}
+
+func TestRateLimiter_RecommendCountsAgainstDefault(t *testing.T) {
+	limiter, _ := newTestRateLimiter(RateLimits{
+		Default:   ratelimit.Limit{Requests: 2, Period: time.Minute},
+		Recommend: ratelimit.Limit{Requests: 5, Period: time.Minute},
+	})
+	r := newRateLimitedRouter(nil, limiter)
+
+	// 推薦は既定の上限も消費する
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusNoContent, serveRateLimited(r, "POST", "/books/recommend").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serveRateLimited(r, "POST", "/books/recommend").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveRateLimited(r, "GET", "/books").Code)
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	limiter, _ := newTestRateLimiter(RateLimits{})
+	for name, limiter := range map[string]*RateLimiter{"nil": nil, "上限なし": limiter} {
+		t.Run(name, func(t *testing.T) {
+			r := newRateLimitedRouter(nil, limiter)
+			for i := 0; i < 3; i++ {
+				w := serveRateLimited(r, "POST", "/books/recommend")
+				assert.Equal(t, http.StatusNoContent, w.Code)
+				assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+			}
+		})
+	}
+}
+
+// failingStore fails like a store whose backend is unavailable
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimiter_StoreFailureLetsRequestsThrough(t *testing.T) {
+	limiter := NewRateLimiter(failingStore{}, RateLimits{Default: ratelimit.Limit{Requests: 1, Period: time.Minute}})
+	r := newRateLimitedRouter(nil, limiter)
+
+	for i := 0; i < 2; i++ {
+		w := serveRateLimited(r, "GET", "/books")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestGRPC_RateLimit(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("GetByID", uint(1)).Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	mockRepo.On("FindByGenreAndPurpose", "技術書", "学習").Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	limiter, _ := newTestRateLimiter(RateLimits{
+		Default:   ratelimit.Limit{Requests: 5, Period: time.Minute},
+		Recommend: ratelimit.Limit{Requests: 1, Period: time.Minute},
+	})
+	authenticator := NewAuthenticator(testVerifier, nil)
+	client := newGRPCTestClient(t, mockRepo,
+		grpc.ChainUnaryInterceptor(authenticator.UnaryServerInterceptor(), limiter.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(authenticator.StreamServerInterceptor(), limiter.StreamServerInterceptor()),
+	)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer reader-token")
+	request := &bookv1.RecommendBookRequest{Genre: "技術書", Purpose: "学習"}
+
+	_, err := client.RecommendBook(ctx, request)
+	require.NoError(t, err)
+	_, err = client.RecommendBook(ctx, request)
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, dto.CodeRateLimited, errorInfoReason(t, err))
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = info
+		}
+	}
+	require.NotNil(t, retryInfo)
+	assert.Equal(t, time.Minute, retryInfo.GetRetryDelay().AsDuration())
+
+	// 他のメソッドは既定の上限で別に数えられる
+	_, err = client.GetBook(ctx, &bookv1.GetBookRequest{Id: 1})
+	assert.NoError(t, err)
+}
+
+func TestGRPC_RateLimit_RecommendCountsAgainstDefault(t *testing.T) {
+	mockRepo := new(MockBookDatabase)
+	mockRepo.On("FindByGenreAndPurpose", "技術書", "学習").Return(&models.Book{ID: 1, Title: "Go入門"}, nil)
+	limiter, _ := newTestRateLimiter(RateLimits{
+		Default:   ratelimit.Limit{Requests: 1, Period: time.Minute},
+		Recommend: ratelimit.Limit{Requests: 5, Period: time.Minute},
+	})
+	authenticator := NewAuthenticator(testVerifier, nil)
+	client := newGRPCTestClient(t, mockRepo,
+		grpc.ChainUnaryInterceptor(authenticator.UnaryServerInterceptor(), limiter.UnaryServerInterceptor()),
+	)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer reader-token")
+
+	_, err := client.RecommendBook(ctx, &bookv1.RecommendBookRequest{Genre: "技術書", Purpose: "学習"})
+	require.NoError(t, err)
+
+	// 推薦で既定の上限を使い切ると、他のメソッドも制限される
+	_, err = client.GetBook(ctx, &bookv1.GetBookRequest{Id: 1})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestGRPC_RateLimitByIPBeforeAuthentication(t *testing.T) {
+	limiter, _ := newTestRateLimiter(RateLimits{
+		Default: ratelimit.Limit{Requests: 10, Period: time.Minute},
+		IP:      ratelimit.Limit{Requests: 2, Period: time.Minute},
+	})
+	authenticator := NewAuthenticator(testVerifier, nil)
+	client := newGRPCTestClient(t, new(MockBookDatabase),
+		grpc.ChainUnaryInterceptor(limiter.IPUnaryServerInterceptor(), authenticator.UnaryServerInterceptor(), limiter.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(limiter.IPStreamServerInterceptor(), authenticator.StreamServerInterceptor(), limiter.StreamServerInterceptor()),
+	)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong-token")
+
+	// 認証に失敗する呼び出しも数えられる
+	for i := 0; i < 2; i++ {
+		_, err := client.GetBook(ctx, &bookv1.GetBookRequest{Id: 1})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	_, err := client.GetBook(ctx, &bookv1.GetBookRequest{Id: 1})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, dto.CodeRateLimited, errorInfoReason(t, err))
+}
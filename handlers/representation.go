@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"recomemento-api-go/dto"
+	"recomemento-api-go/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bookRepresentation describes the parts of a book a response carries, as requested with
+// the fields= and include= query parameters
+type bookRepresentation struct {
+	// fields holds the selected fields; nil selects all of them
+	fields map[string]bool
+	// authors, tags and ratings embed the related resources of the same name
+	authors bool
+	tags    bool
+	ratings bool
+}
+
+// bindBookRepresentation reads the fields= and include= query parameters
+func bindBookRepresentation(c *gin.Context) (bookRepresentation, error) {
+	var query dto.BookRepresentationQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return bookRepresentation{}, err
+	}
+
+	var representation bookRepresentation
+	if fields := splitList(query.Fields); len(fields) > 0 {
+		representation.fields = make(map[string]bool, len(fields))
+		for _, field := range fields {
+			representation.fields[field] = true
+		}
+	}
+	for _, include := range splitList(query.Include) {
+		switch include {
+		case dto.IncludeAuthors:
+			representation.authors = true
+		case dto.IncludeTags:
+			representation.tags = true
+		case dto.IncludeRatings:
+			representation.ratings = true
+		}
+	}
+	return representation, nil
+}
+
+// key identifies the representation: it is empty for every field with nothing embedded,
+// and the same for the same selection in any order
+func (r bookRepresentation) key() string {
+	var parts []string
+	if r.fields != nil {
+		fields := make([]string, 0, len(r.fields))
+		for field := range r.fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		parts = append(parts, "fields="+strings.Join(fields, ","))
+	}
+	var includes []string
+	if r.authors {
+		includes = append(includes, dto.IncludeAuthors)
+	}
+	if r.tags {
+		includes = append(includes, dto.IncludeTags)
+	}
+	if r.ratings {
+		includes = append(includes, dto.IncludeRatings)
+	}
+	if len(includes) > 0 {
+		parts = append(parts, "include="+strings.Join(includes, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// embeds reports whether the representation embeds any related resource
+func (r bookRepresentation) embeds() bool {
+	return r.authors || r.tags || r.ratings
+}
+
+// shape clears the fields of response that were not selected, which omits them
+func (r bookRepresentation) shape(response *dto.BookResponse) {
+	if r.fields == nil {
+		return
+	}
+	if !r.fields["id"] {
+		response.ID = 0
+	}
+	if !r.fields["title"] {
+		response.Title = ""
+	}
+	if !r.fields["author"] {
+		response.Author = ""
+	}
+	if !r.fields["genre"] {
+		response.Genre = ""
+	}
+	if !r.fields["purpose"] {
+		response.Purpose = ""
+	}
+	if !r.fields["description"] {
+		response.Description = ""
+	}
+	if !r.fields["isbn"] {
+		response.ISBN = ""
+	}
+}
+
+// embed adds the requested related resources to responses, the i-th of which belongs to
+// books[i]. Each kind of resource is loaded with a single query for all books.
+func (h *BookHandler) embed(r bookRepresentation, books []models.Book, responses []dto.BookResponse) error {
+	if len(books) == 0 {
+		return nil
+	}
+	if r.authors {
+		if err := h.embedAuthors(books, responses); err != nil {
+			return err
+		}
+	}
+	if r.tags {
+		if err := h.embedTags(books, responses); err != nil {
+			return err
+		}
+	}
+	if r.ratings {
+		if err := h.embedRatings(books, responses); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *BookHandler) embedAuthors(books []models.Book, responses []dto.BookResponse) error {
+	seen := make(map[string]bool, len(books))
+	var authors []string
+	for _, book := range books {
+		if !seen[book.Author] {
+			seen[book.Author] = true
+			authors = append(authors, book.Author)
+		}
+	}
+	counts, err := h.bookRepo.CountByAuthor(authors)
+	if err != nil {
+		return err
+	}
+	for i, book := range books {
+		responses[i].Authors = dto.AuthorList{{Name: book.Author, BookCount: counts[book.Author]}}
+	}
+	return nil
+}
+
+func (h *BookHandler) embedTags(books []models.Book, responses []dto.BookResponse) error {
+	tags, err := h.bookRepo.FindTags(bookIDs(books))
+	if err != nil {
+		return err
+	}
+	for i, book := range books {
+		responses[i].Tags = tags[book.ID]
+	}
+	return nil
+}
+
+func (h *BookHandler) embedRatings(books []models.Book, responses []dto.BookResponse) error {
+	summaries, err := h.bookRepo.SummarizeRatings(bookIDs(books))
+	if err != nil {
+		return err
+	}
+	for i, book := range books {
+		responses[i].Ratings = ratingSummaryResponse(summaries[book.ID])
+	}
+	return nil
+}
+
+// ratingSummaryResponse converts a rating summary, rounding the average to two decimals
+func ratingSummaryResponse(summary models.RatingSummary) *dto.RatingSummaryResponse {
+	return &dto.RatingSummaryResponse{
+		Count:   summary.Count,
+		Average: math.Round(summary.Average*100) / 100,
+	}
+}
+
+// bookIDs returns the IDs of books
+func bookIDs(books []models.Book) []uint {
+	ids := make([]uint, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	return ids
+}
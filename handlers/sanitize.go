@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Values of the `sanitize` struct tag
+const (
+	// sanitizeLine is for single-line fields: whitespace runs collapse to one space
+	sanitizeLine = "line"
+	// sanitizeText is for free text: line breaks and tabs are kept
+	sanitizeText = "text"
+	// sanitizeISBN removes the hyphens and spaces commonly used to group ISBN digits
+	sanitizeISBN = "isbn"
+)
+
+// maxBodyBytes caps the body of a request carrying a single book
+const maxBodyBytes = 1 << 20
+
+// sanitizedBody decodes a JSON, XML or MessagePack body according to its Content-Type,
+// sanitizes every field tagged with `sanitize` and only then validates, so that rules
+// such as required see the normalized value. Bodies over maxBodyBytes fail with an
+// *http.MaxBytesError.
+var sanitizedBody binding.Binding = sanitizedBodyBinding{limit: maxBodyBytes}
+
+type sanitizedBodyBinding struct {
+	// limit caps the size of the body in bytes
+	limit int64
+}
+
+func (sanitizedBodyBinding) Name() string {
+	return "body"
+}
+
+func (b sanitizedBodyBinding) Bind(req *http.Request, obj any) error {
+	body, err := limitedBody(req, b.limit)
+	if err != nil {
+		return err
+	}
+	return decodeSanitized(body, requestFormat(req.Header.Get("Content-Type")), obj)
+}
+
+// limitedBody returns the body of req, which fails with an *http.MaxBytesError once more
+// than limit bytes are read. Bodies announcing a larger Content-Length fail before
+// anything is read.
+func limitedBody(req *http.Request, limit int64) (io.Reader, error) {
+	if req == nil || req.Body == nil {
+		return nil, errors.New("invalid request")
+	}
+	if req.ContentLength > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	return http.MaxBytesReader(nil, req.Body, limit), nil
+}
+
+// decodeSanitized decodes a document in format from r into obj, sanitizes it and validates it
+func decodeSanitized(r io.Reader, format *mediaFormat, obj any) error {
+	if err := format.decode(r, obj); err != nil {
+		return err
+	}
+	sanitize(obj)
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// sanitize normalizes the string, *string and []string fields of the struct obj points
+// to according to their `sanitize` tag. Untagged fields are left alone.
+func sanitize(obj any) {
+	value := reflect.ValueOf(obj)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+	value = value.Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		mode := value.Type().Field(i).Tag.Get("sanitize")
+		if mode == "" {
+			continue
+		}
+
+		field := value.Field(i)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.String && field.CanSet() {
+			field.SetString(sanitizeString(field.String(), mode))
+		}
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+			for j := 0; j < field.Len(); j++ {
+				field.Index(j).SetString(sanitizeString(field.Index(j).String(), mode))
+			}
+		}
+	}
+}
+
+// sanitizeString removes markup and control characters from s, normalizes it to NFC
+// and trims surrounding whitespace
+func sanitizeString(s, mode string) string {
+	if mode == sanitizeISBN {
+		return normalizeISBN(s)
+	}
+
+	s = norm.NFC.String(stripHTML(s))
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	s = strings.Map(func(r rune) rune {
+		if mode == sanitizeText && (r == '\n' || r == '\t') {
+			return r
+		}
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	if mode == sanitizeLine {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	return strings.TrimSpace(s)
+}
+
+// normalizeISBN strips grouping characters from an ISBN and upper-cases the ISBN-10
+// check digit, so that equal ISBNs compare equal
+func normalizeISBN(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || unicode.IsSpace(r):
+			return -1
+		case r == 'x':
+			return 'X'
+		default:
+			return r
+		}
+	}, s)
+}
+
+// stripHTML returns the text content of s, dropping tags, comments and the contents of
+// script and style elements. Text that does not contain markup is returned unchanged.
+// Decoding entities can turn escaped text such as &lt;script&gt; into markup, so the
+// text is stripped again until it no longer changes; each pass that changes the text
+// shortens it.
+func stripHTML(s string) string {
+	for strings.ContainsAny(s, "<&") {
+		text := htmlText(s)
+		if text == s {
+			break
+		}
+		s = text
+	}
+	return s
+}
+
+// htmlText returns the text content of s with entities decoded
+func htmlText(s string) string {
+	var b strings.Builder
+	skip := 0
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return b.String()
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(tokenizer.Text())
+			}
+		case html.StartTagToken:
+			if isRawTextElement(tokenizer) {
+				skip++
+			}
+		case html.EndTagToken:
+			if isRawTextElement(tokenizer) && skip > 0 {
+				skip--
+			}
+		}
+	}
+}
+
+// isRawTextElement reports whether the current tag is one whose contents are not text
+func isRawTextElement(tokenizer *html.Tokenizer) bool {
+	name, _ := tokenizer.TagName()
+	switch atom.Lookup(name) {
+	case atom.Script, atom.Style:
+		return true
+	default:
+		return false
+	}
+}
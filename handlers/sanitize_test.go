@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeString(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		mode     string
+		expected string
+	}{
+		{"前後の空白を除去", "  Clean Code  ", sanitizeLine, "Clean Code"},
+		{"連続する空白と改行をまとめる", "Robert\n  C.\tMartin", sanitizeLine, "Robert C. Martin"},
+		{"制御文字を除去", "Clean\x00 Code\x1b", sanitizeLine, "Clean Code"},
+		{"HTMLタグを除去", "<p>Clean <b>Code</b></p>", sanitizeLine, "Clean Code"},
+		{"scriptの中身も除去", "Clean<script>alert(1)</script> Code", sanitizeLine, "Clean Code"},
+		{"実体参照を文字に戻す", "Tom &amp; Jerry", sanitizeLine, "Tom & Jerry"},
+		{"タグでない記号はそのまま", "1 < 2 & 3 > 2", sanitizeLine, "1 < 2 & 3 > 2"},
+		{"実体参照のタグも除去", "Clean &lt;script&gt;alert(1)&lt;/script&gt; Code", sanitizeLine, "Clean Code"},
+		{"二重の実体参照のタグも除去", "&amp;lt;b&amp;gt;Bold&amp;lt;/b&amp;gt;", sanitizeLine, "Bold"},
+		{"実体参照の記号はそのまま", "1 &lt; 2", sanitizeLine, "1 < 2"},
+		{"NFCに正規化", "Cafe\u0301", sanitizeLine, "Caf\u00e9"},
+		{"説明文は改行とタブを保持", "  Line 1\r\n\tLine 2\x07  ", sanitizeText, "Line 1\n\tLine 2"},
+		{"ISBNの区切りを除去", " 978-0-7432-7356-5 ", sanitizeISBN, "9780743273565"},
+		{"ISBN-10のチェックディジット", "0-8044-2957-x", sanitizeISBN, "080442957X"},
+		{"日本語はそのまま", "　吾輩は猫である　", sanitizeLine, "吾輩は猫である"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sanitizeString(tt.input, tt.mode))
+		})
+	}
+}
+
+func TestSanitize_OnlyTaggedFields(t *testing.T) {
+	title := "  New Title  "
+	req := struct {
+		Title *string `sanitize:"line"`
+		Empty *string `sanitize:"line"`
+		Raw   string
+	}{Title: &title, Raw: "  raw  "}
+
+	sanitize(&req)
+
+	assert.Equal(t, "New Title", *req.Title)
+	assert.Nil(t, req.Empty)
+	assert.Equal(t, "  raw  ", req.Raw)
+}
+
+func TestSanitize_StringSlices(t *testing.T) {
+	req := struct {
+		Tags []string `sanitize:"line"`
+		Raw  []string
+	}{Tags: []string{"  classic ", "<b>sci</b>\tfi"}, Raw: []string{"  raw  "}}
+
+	sanitize(&req)
+
+	assert.Equal(t, []string{"classic", "sci fi"}, req.Tags)
+	assert.Equal(t, []string{"  raw  "}, req.Raw)
+}
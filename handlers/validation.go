@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldLimits holds the maximum length of each book field, counted in characters
+type FieldLimits struct {
+	Title       int
+	Author      int
+	Genre       int
+	Purpose     int
+	Description int
+}
+
+// DefaultFieldLimits are the limits used unless SetFieldLimits is called
+var DefaultFieldLimits = FieldLimits{
+	Title:       200,
+	Author:      100,
+	Genre:       50,
+	Purpose:     50,
+	Description: 2000,
+}
+
+var (
+	fieldLimitsMu sync.RWMutex
+	fieldLimits   = DefaultFieldLimits
+)
+
+// SetFieldLimits replaces the limits enforced by the maxlen rule. Zero values keep
+// the default for that field.
+func SetFieldLimits(limits FieldLimits) {
+	if limits.Title <= 0 {
+		limits.Title = DefaultFieldLimits.Title
+	}
+	if limits.Author <= 0 {
+		limits.Author = DefaultFieldLimits.Author
+	}
+	if limits.Genre <= 0 {
+		limits.Genre = DefaultFieldLimits.Genre
+	}
+	if limits.Purpose <= 0 {
+		limits.Purpose = DefaultFieldLimits.Purpose
+	}
+	if limits.Description <= 0 {
+		limits.Description = DefaultFieldLimits.Description
+	}
+
+	fieldLimitsMu.Lock()
+	defer fieldLimitsMu.Unlock()
+	fieldLimits = limits
+}
+
+// fieldLimit returns the configured limit for a maxlen parameter such as "title"
+func fieldLimit(name string) (int, bool) {
+	fieldLimitsMu.RLock()
+	defer fieldLimitsMu.RUnlock()
+
+	switch name {
+	case "title":
+		return fieldLimits.Title, true
+	case "author":
+		return fieldLimits.Author, true
+	case "genre":
+		return fieldLimits.Genre, true
+	case "purpose":
+		return fieldLimits.Purpose, true
+	case "description":
+		return fieldLimits.Description, true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+		_ = v.RegisterValidation("maxlen", validateMaxLen)
+		_ = v.RegisterValidation("notblank", validateNotBlank)
+		_ = v.RegisterValidation("listof", validateListOf)
+		_ = v.RegisterValidation("future", validateFuture)
+	}
+}
+
+// jsonFieldName reports validation errors under the JSON name of a field so that
+// clients can map them back onto their request body
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	default:
+		return name
+	}
+}
+
+// validateMaxLen implements `maxlen=<field>`: the value may not exceed the configured
+// limit of that field. The limit is looked up on every call so it can be configured at
+// startup, and unlike the built-in max rule it is expressed in characters.
+func validateMaxLen(fl validator.FieldLevel) bool {
+	limit, ok := fieldLimit(fl.Param())
+	if !ok {
+		return false
+	}
+	return utf8.RuneCountInString(fl.Field().String()) <= limit
+}
+
+// validateNotBlank implements `notblank`: the value must contain something other than
+// whitespace
+func validateNotBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+// validateListOf implements `listof=<values>`: the value is a comma-separated list whose
+// entries are each one of the space-separated values. Empty entries are ignored.
+func validateListOf(fl validator.FieldLevel) bool {
+	allowed := strings.Fields(fl.Param())
+	for _, entry := range splitList(fl.Field().String()) {
+		if !slices.Contains(allowed, entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateFuture implements `future`: the time must be later than now
+func validateFuture(fl validator.FieldLevel) bool {
+	t, ok := fl.Field().Interface().(time.Time)
+	return ok && t.After(time.Now())
+}
+
+// splitList returns the non-empty, trimmed entries of a comma-separated list
+func splitList(s string) []string {
+	var entries []string
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// ruleParam returns the parameter reported to clients for a failed rule. For maxlen the
+// parameter names a field, so the configured limit is reported instead; listof reports its
+// values in the comma-separated form clients write them in.
+func ruleParam(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "maxlen":
+		if limit, ok := fieldLimit(fe.Param()); ok {
+			return strconv.Itoa(limit)
+		}
+	case "listof":
+		return strings.Join(strings.Fields(fe.Param()), ",")
+	}
+	return fe.Param()
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecation describes a deprecated group of routes
+type Deprecation struct {
+	// Since is when the routes were deprecated
+	Since time.Time
+	// Sunset is when the routes are expected to stop working; zero when not yet scheduled
+	Sunset time.Time
+	// Successor is the path prefix of the routes replacing them, such as "/v1"
+	Successor string
+}
+
+// Deprecated returns middleware announcing d on every response: the Deprecation header
+// of RFC 9745, the Sunset header of RFC 8594 once a date is set, and a Link to the same
+// resource, with the same query, under the successor prefix.
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", d.Since.Unix())
+	var sunset string
+	if !d.Sunset.IsZero() {
+		sunset = d.Sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		header.Set("Deprecation", deprecation)
+		if sunset != "" {
+			header.Set("Sunset", sunset)
+		}
+		if d.Successor != "" {
+			target := d.Successor + c.Request.URL.EscapedPath()
+			if query := c.Request.URL.RawQuery; query != "" {
+				target += "?" + query
+			}
+			header.Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", target))
+		}
+		c.Next()
+	}
+}
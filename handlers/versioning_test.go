@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	since := time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.April, 30, 0, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+
+	tests := []struct {
+		name        string
+		deprecation Deprecation
+		sunset      string
+		link        string
+	}{
+		{"Sunsetと後継バージョン", Deprecation{Since: since, Sunset: sunset, Successor: "/v1"}, "Thu, 29 Apr 2027 15:00:00 GMT", `</v1/books/1?fields=id>; rel="successor-version"`},
+		{"Sunset未定（クエリも引き継ぐ）", Deprecation{Since: since, Successor: "/v1"}, "", `</v1/books/1?fields=id>; rel="successor-version"`},
+		{"後継なし", Deprecation{Since: since}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/books/:id", Deprecated(tt.deprecation), func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/books/1?fields=id", nil))
+
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			assert.Equal(t, "@1792281600", w.Header().Get("Deprecation"))
+			assert.Equal(t, tt.sunset, w.Header().Get("Sunset"))
+			assert.Equal(t, tt.link, w.Header().Get("Link"))
+		})
+	}
+}
+
+func TestDeprecated_ProblemResponses(t *testing.T) {
+	// エラーレスポンスにも非推奨のヘッダーが付く
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/books/:id", Deprecated(Deprecation{Since: time.Now(), Successor: "/v1"}), func(c *gin.Context) {
+		AbortWithProblem(c, errInvalidID())
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/books/abc", nil))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Deprecation"))
+	assert.Equal(t, `</v1/books/abc>; rel="successor-version"`, w.Header().Get("Link"))
+}
@@ -0,0 +1,98 @@
+// Package i18n provides the message catalogs used for API responses and negotiates
+// the response language from the Accept-Language header.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Supported lists the languages that have a catalog. The first entry is used when the
+// client does not send Accept-Language or none of its languages are supported.
+var Supported = []language.Tag{language.English, language.Japanese}
+
+var (
+	matcher  = language.NewMatcher(Supported)
+	catalogs = loadCatalogs()
+)
+
+// Localizer looks up messages for a single negotiated language
+type Localizer struct {
+	lang     language.Tag
+	messages map[string]string
+}
+
+// Negotiate returns the localizer best matching an Accept-Language header value
+func Negotiate(acceptLanguage string) *Localizer {
+	index := 0
+	if tags, _, err := language.ParseAcceptLanguage(acceptLanguage); err == nil && len(tags) > 0 {
+		if _, i, confidence := matcher.Match(tags...); confidence != language.No {
+			index = i
+		}
+	}
+	return ForLanguage(Supported[index])
+}
+
+// ForLanguage returns the localizer for one of the supported languages
+func ForLanguage(lang language.Tag) *Localizer {
+	messages, ok := catalogs[lang]
+	if !ok {
+		lang = Supported[0]
+		messages = catalogs[lang]
+	}
+	return &Localizer{lang: lang, messages: messages}
+}
+
+// Language returns the BCP 47 tag of the localizer, suitable for Content-Language
+func (l *Localizer) Language() string {
+	return l.lang.String()
+}
+
+// Has reports whether the catalog defines a message for the key
+func (l *Localizer) Has(key string) bool {
+	_, ok := l.messages[key]
+	return ok
+}
+
+// T returns the message for key formatted with args. Messages that take arguments
+// use explicit argument indexes (%[1]s) so translations can reorder them. Unknown
+// keys fall back to the default language and finally to the key itself.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	message, ok := l.messages[key]
+	if !ok {
+		message, ok = catalogs[Supported[0]][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// loadCatalogs parses the embedded catalogs. They are part of the binary, so a broken
+// catalog is a programming error and panics at startup.
+func loadCatalogs() map[language.Tag]map[string]string {
+	result := make(map[language.Tag]map[string]string, len(Supported))
+	for _, lang := range Supported {
+		data, err := localeFiles.ReadFile(path.Join("locales", lang.String()+".json"))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: missing catalog for %s: %v", lang, err))
+		}
+
+		messages := make(map[string]string)
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog for %s: %v", lang, err))
+		}
+		result[lang] = messages
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		expected       string
+	}{
+		{"ヘッダーなしは英語", "", "en"},
+		{"日本語", "ja", "ja"},
+		{"地域付きの日本語", "ja-JP", "ja"},
+		{"q値による優先順位", "fr;q=1.0, ja;q=0.8, en;q=0.5", "ja"},
+		{"英語優先", "en-US,en;q=0.9,ja;q=0.8", "en"},
+		{"未対応の言語のみ", "fr, de", "en"},
+		{"不正なヘッダー", ";;;", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Negotiate(tt.acceptLanguage).Language())
+		})
+	}
+}
+
+func TestT_FormatsArguments(t *testing.T) {
+	ja := ForLanguage(language.Japanese)
+	en := ForLanguage(language.English)
+
+	assert.Equal(t, "タイトルは必須です", ja.T("validation.required", ja.T("field.title"), "", "required"))
+	assert.Equal(t, "title must be at most 200 characters", en.T("validation.max", "title", "200", "max"))
+}
+
+func TestT_UnknownKeyFallsBackToKey(t *testing.T) {
+	assert.Equal(t, "no.such.key", ForLanguage(language.Japanese).T("no.such.key"))
+}
+
+func TestCatalogs_HaveSameKeys(t *testing.T) {
+	// 翻訳漏れがないよう、全てのカタログが同じキーを持つことを確認
+	reference := catalogs[Supported[0]]
+	for _, lang := range Supported[1:] {
+		for key := range reference {
+			assert.Contains(t, catalogs[lang], key, "missing %s in %s catalog", key, lang)
+		}
+		for key := range catalogs[lang] {
+			assert.Contains(t, reference, key, "extra %s in %s catalog", key, lang)
+		}
+	}
+}
+
+func TestCatalogs_UseIndexedArguments(t *testing.T) {
+	// 翻訳で語順を入れ替えられるよう、引数は %[n]s 形式で参照する
+	for lang, messages := range catalogs {
+		for key, message := range messages {
+			withoutIndexed := strings.ReplaceAll(message, "%[", "")
+			assert.NotContains(t, withoutIndexed, "%s", "%s in %s catalog must use indexed arguments", key, lang)
+		}
+	}
+}
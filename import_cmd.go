@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"recomemento-api-go/config"
+	"recomemento-api-go/database"
+	"recomemento-api-go/handlers"
+	"recomemento-api-go/i18n"
+	"recomemento-api-go/models"
+)
+
+// runImport implements `import [flags] FILE`, the command line equivalent of
+// POST /books/import. The report is written to stdout as JSON and a summary to stderr.
+// It returns the process exit code.
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", strings.Join(handlers.ImportFormats, ", ")+" (default: from the file extension)")
+	dryRun := flags.Bool("dry-run", false, "validate and dedupe without creating books")
+	lang := flags.String("lang", os.Getenv("LANG"), "language of the report messages (en or ja)")
+	loader := config.NewLoader(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: recomemento-api import [flags] FILE\n\nImports books from a CSV, JSON Lines, MARC 21, Dublin Core or ONIX file; FILE - reads stdin.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = importFormatFromPath(path)
+	}
+	if !slices.Contains(handlers.ImportFormats, *format) {
+		log.Printf("import: unsupported format %q; use -format with one of %s", *format, strings.Join(handlers.ImportFormats, ", "))
+		return 2
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("import: %v", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Printf("import: invalid configuration:\n%v", err)
+		return 2
+	}
+	// The SQL log goes to stdout with the report, so only problems are logged unless
+	// configured otherwise
+	if cfg.Source("database.log_level") == "default" {
+		cfg.Database.LogLevel = "warn"
+	}
+	db, err := openDatabase(cfg.Database)
+	if err != nil {
+		log.Printf("import: failed to connect to database: %v", err)
+		return 1
+	}
+	defer database.Close(db)
+
+	// LANG values look like ja_JP.UTF-8
+	localizer := i18n.Negotiate(strings.ReplaceAll(strings.SplitN(*lang, ".", 2)[0], "_", "-"))
+	report, err := handlers.ImportBooksFrom(models.NewBookRepository(db), input, handlers.ImportOptions{
+		Format: *format,
+		DryRun: *dryRun,
+	}, localizer)
+	if err != nil {
+		var appErr *handlers.AppError
+		if errors.As(err, &appErr) {
+			problem := appErr.Problem(localizer, path)
+			log.Printf("import: %s: %s", problem.Title, problem.Detail)
+		} else {
+			log.Printf("import: %v", err)
+		}
+		if report == nil {
+			return 1
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("import: %v", err)
+		return 1
+	}
+	if err != nil {
+		// The report lists the rows before the failure, which have been applied
+		log.Printf("import: stopped after %d rows, %d created", report.Total, report.Created)
+		return 1
+	}
+
+	log.Printf("import: %d rows, %d created, %d duplicates, %d invalid, %d failed (dry run: %t)",
+		report.Total, report.Created, report.Duplicates, report.Invalid, report.Failed, report.DryRun)
+	return 0
+}
+
+// importFormatFromPath guesses the import format from a file extension. MARCXML, Dublin
+// Core and ONIX files are all .xml, so they need -format.
+func importFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return handlers.ImportFormatCSV
+	case ".ndjson", ".jsonl":
+		return handlers.ImportFormatNDJSON
+	case ".mrc", ".marc":
+		return handlers.ImportFormatMARC
+	default:
+		return ""
+	}
+}
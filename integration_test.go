@@ -2,21 +2,39 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"recomemento-api-go/auth"
+	"recomemento-api-go/client"
+	"recomemento-api-go/config"
 	"recomemento-api-go/database"
 	"recomemento-api-go/dto"
 	"recomemento-api-go/handlers"
 	"recomemento-api-go/models"
+	"recomemento-api-go/ratelimit"
+	bookv1 "recomemento-api-go/proto/book/v1"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 	"gorm.io/gorm"
 )
 
@@ -33,7 +51,7 @@ func (suite *IntegrationTestSuite) SetupSuite() {
 
 	// テスト用データベース初期化
 	dbPath := ":memory:"
-	db, err := database.InitDatabase(dbPath)
+	db, err := database.InitDatabase(dbPath, databaseOptions(config.Default().Database))
 	if err != nil {
 		suite.T().Fatal("Failed to connect to test database:", err)
 	}
@@ -42,23 +60,19 @@ func (suite *IntegrationTestSuite) SetupSuite() {
 	// リポジトリとハンドラーの初期化
 	bookRepo := models.NewBookRepository(db)
 	bookHandler := handlers.NewBookHandler(bookRepo)
+	graphQLHandler := handlers.NewGraphQLHandler(bookRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(models.NewAPIKeyRepository(db))
 
 	// ルーター設定
 	r := gin.New()
 	
 	// CORS設定
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		
-		c.Next()
-	})
+	cors, err := handlers.CORS(handlers.CORSConfig{AllowOrigins: []string{"*"}})
+	suite.Require().NoError(err)
+	r.Use(cors)
+
+	// 未定義ルート
+	r.NoRoute(handlers.RouteNotFound)
 
 	// ヘルスチェック
 	r.GET("/health", func(c *gin.Context) {
@@ -66,15 +80,7 @@ func (suite *IntegrationTestSuite) SetupSuite() {
 	})
 
 	// API routes
-	api := r.Group("/")
-	{
-		api.POST("/books", bookHandler.CreateBook)
-		api.GET("/books", bookHandler.GetAllBooks)
-		api.GET("/books/:id", bookHandler.GetBookByID)
-		api.PATCH("/books/:id", bookHandler.UpdateBook)
-		api.DELETE("/books/:id", bookHandler.DeleteBook)
-		api.POST("/books/recommend", bookHandler.RecommendBook)
-	}
+	registerAPIRoutes(r, bookHandler, graphQLHandler, apiKeyHandler, nil, nil, time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC))
 
 	suite.router = r
 }
@@ -325,7 +331,7 @@ func (suite *IntegrationTestSuite) TestErrorHandling() {
 	var errorResp1 dto.ErrorResponse
 	err := json.Unmarshal(w1.Body.Bytes(), &errorResp1)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Invalid request", errorResp1.Error)
+	assert.Equal(suite.T(), dto.CodeInvalidRequest, errorResp1.Code)
 
 	// 2. 存在しない本の取得
 	w2 := suite.performRequest("GET", "/books/999", nil)
@@ -334,7 +340,7 @@ func (suite *IntegrationTestSuite) TestErrorHandling() {
 	var errorResp2 dto.ErrorResponse
 	err = json.Unmarshal(w2.Body.Bytes(), &errorResp2)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Book not found", errorResp2.Error)
+	assert.Equal(suite.T(), dto.CodeBookNotFound, errorResp2.Code)
 
 	// 3. 無効なIDでの取得
 	w3 := suite.performRequest("GET", "/books/invalid-id", nil)
@@ -343,7 +349,7 @@ func (suite *IntegrationTestSuite) TestErrorHandling() {
 	var errorResp3 dto.ErrorResponse
 	err = json.Unmarshal(w3.Body.Bytes(), &errorResp3)
 	assert.NoError(suite.T(), err)
-	assert.Equal(suite.T(), "Invalid ID", errorResp3.Error)
+	assert.Equal(suite.T(), dto.CodeInvalidID, errorResp3.Code)
 
 	// 4. 存在しないジャンルでの推薦
 	recommendReq := dto.RecommendBookRequest{
@@ -440,6 +446,491 @@ func (suite *IntegrationTestSuite) TestDataPersistence() {
 	assert.Contains(suite.T(), titles, "Book 3")
 }
 
+// TestPatchSemantics はPATCH/PUTの各形式と楽観的排他制御をテスト
+func (suite *IntegrationTestSuite) TestPatchSemantics() {
+	// 1. 本を作成
+	createReq := dto.CreateBookRequest{
+		Title: "Patch Test", Author: "Author", Genre: "Fiction",
+		Purpose: "Entertainment", Description: "Original description",
+	}
+	body, _ := json.Marshal(createReq)
+	w := suite.performRequest("POST", "/books", bytes.NewBuffer(body))
+	assert.Equal(suite.T(), http.StatusCreated, w.Code)
+
+	var created dto.BookResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	url := fmt.Sprintf("/books/%d", created.ID)
+	firstETag := w.Header().Get("ETag")
+
+	// 2. JSON Merge Patch
+	req := httptest.NewRequest("PATCH", url, bytes.NewBufferString(`{"genre": "Classic"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"genre":"Classic"`)
+
+	// 3. JSON Patch
+	req = httptest.NewRequest("PATCH", url, bytes.NewBufferString(`[{"op": "copy", "from": "/title", "path": "/description"}]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"description":"Patch Test"`)
+
+	// 4. 古いETagでのPUTは412
+	replaceReq := dto.ReplaceBookRequest{
+		Title: "Replaced", Author: "Author", Genre: "Fiction",
+		Purpose: "Entertainment", Description: "Replaced description",
+	}
+	body, _ = json.Marshal(replaceReq)
+	req = httptest.NewRequest("PUT", url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", firstETag)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+
+	// 5. 最新のETagでのPUTは成功
+	w = suite.performRequest("GET", url, nil)
+	currentETag := w.Header().Get("ETag")
+	assert.NotEqual(suite.T(), firstETag, currentETag)
+
+	body, _ = json.Marshal(replaceReq)
+	req = httptest.NewRequest("PUT", url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", currentETag)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"title":"Replaced"`)
+}
+
+func (suite *IntegrationTestSuite) TestBulkOperations() {
+	// 1. 一括作成
+	body := `{"operations": [
+		{"op": "create", "book": {"title": "Bulk 1", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "First"}},
+		{"op": "create", "book": {"title": "Bulk 2", "author": "Author", "genre": "Fiction", "purpose": "Entertainment", "description": "Second"}}
+	]}`
+	w := suite.performRequest("POST", "/books/bulk", bytes.NewBufferString(body))
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	var created dto.BulkResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(suite.T(), 2, created.Succeeded)
+	first, second := created.Results[0].Book.ID, created.Results[1].Book.ID
+
+	// 2. atomicモードでは1件失敗すると全てロールバックされる
+	body = fmt.Sprintf(`{"operations": [
+		{"op": "update", "id": %d, "book": {"title": "Changed"}},
+		{"op": "delete", "id": %d},
+		{"op": "delete", "id": 99999}
+	]}`, first, second)
+	w = suite.performRequest("POST", "/books/bulk", bytes.NewBufferString(body))
+	assert.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+
+	var aborted dto.BulkResponse
+	json.Unmarshal(w.Body.Bytes(), &aborted)
+	assert.Equal(suite.T(), 3, aborted.Failed)
+	assert.Equal(suite.T(), dto.CodeBulkAborted, aborted.Results[0].Error.Code)
+	assert.Equal(suite.T(), dto.CodeBookNotFound, aborted.Results[2].Error.Code)
+
+	w = suite.performRequest("GET", fmt.Sprintf("/books/%d", first), nil)
+	assert.Contains(suite.T(), w.Body.String(), `"title":"Bulk 1"`)
+	w = suite.performRequest("GET", fmt.Sprintf("/books/%d", second), nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// 3. best_effortモードでは成功した操作だけが適用される
+	body = strings.Replace(body, `"operations"`, `"mode": "best_effort", "operations"`, 1)
+	w = suite.performRequest("POST", "/books/bulk", bytes.NewBufferString(body))
+	assert.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+
+	var partial dto.BulkResponse
+	json.Unmarshal(w.Body.Bytes(), &partial)
+	assert.Equal(suite.T(), 2, partial.Succeeded)
+	assert.Equal(suite.T(), 1, partial.Failed)
+	assert.Equal(suite.T(), uint(2), partial.Results[0].Version)
+
+	w = suite.performRequest("GET", fmt.Sprintf("/books/%d", first), nil)
+	assert.Contains(suite.T(), w.Body.String(), `"title":"Changed"`)
+	w = suite.performRequest("GET", fmt.Sprintf("/books/%d", second), nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *IntegrationTestSuite) TestImportBooks() {
+	csv := "title,author,genre,purpose,description,isbn\n" +
+		"Import 1,Author,Fiction,Entertainment,First,978-0-306-40615-7\n" +
+		"Import 2,Author,Fiction,Entertainment,Second,\n"
+
+	// 1. dry_runでは作成されない
+	req := httptest.NewRequest("POST", "/books/import?dry_run=true", bytes.NewBufferString(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"created":2`)
+
+	w = suite.performRequest("GET", "/books", nil)
+	assert.NotContains(suite.T(), w.Body.String(), "Import 1")
+
+	// 2. インポート
+	req = httptest.NewRequest("POST", "/books/import", bytes.NewBufferString(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"created":2`)
+
+	w = suite.performRequest("GET", "/books", nil)
+	assert.Contains(suite.T(), w.Body.String(), `"isbn":"9780306406157"`)
+
+	// 3. 同じファイルを再度インポートすると全て重複
+	req = httptest.NewRequest("POST", "/books/import", bytes.NewBufferString(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"created":0,"duplicates":2`)
+}
+
+func (suite *IntegrationTestSuite) TestExportBooks() {
+	csv := "title,author,genre,purpose,description\n" +
+		"Export 1,Natsume Soseki,Fiction,Entertainment,First\n" +
+		"Export 2,Dazai Osamu,Fiction,Entertainment,Second\n" +
+		"Export 3,Natsume Soseki,Technology,Learning,Third\n"
+	req := httptest.NewRequest("POST", "/books/import", bytes.NewBufferString(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	suite.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// 1. 一覧と同じフィルタが適用される
+	w := suite.performRequest("GET", "/books/export?format=ndjson&genre=Fiction&author=natsume", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), 1, strings.Count(w.Body.String(), "\n"))
+	assert.Contains(suite.T(), w.Body.String(), `"title":"Export 1"`)
+
+	w = suite.performRequest("GET", "/books?genre=Fiction&author=natsume", nil)
+	assert.Contains(suite.T(), w.Body.String(), `"title":"Export 1"`)
+	assert.NotContains(suite.T(), w.Body.String(), "Export 2")
+
+	// 2. CSVエクスポートはヘッダ行と全件を含む
+	w = suite.performRequest("GET", "/books/export", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.True(suite.T(), strings.HasPrefix(w.Body.String(), "\ufeffid,title,author,genre,purpose,description,isbn\n"))
+	assert.Equal(suite.T(), 4, strings.Count(w.Body.String(), "\n"))
+}
+
+func (suite *IntegrationTestSuite) TestSparseFieldsetsAndIncludes() {
+	csv := "title,author,genre,purpose,description\n" +
+		"Sparse 1,Natsume Soseki,Fiction,Entertainment,A long description\n" +
+		"Sparse 2,Natsume Soseki,Fiction,Learning,Another long description\n"
+	req := httptest.NewRequest("POST", "/books/import", bytes.NewBufferString(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	suite.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// 指定したフィールドと著者の情報だけを返す
+	w := suite.performRequest("GET", "/books?fields=title&include=authors", nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `[
+		{"title":"Sparse 1","authors":[{"name":"Natsume Soseki","book_count":2}]},
+		{"title":"Sparse 2","authors":[{"name":"Natsume Soseki","book_count":2}]}
+	]`, w.Body.String())
+}
+
+func (suite *IntegrationTestSuite) TestAPIVersioning() {
+	body := `{"title":"Versioned","author":"Author","genre":"Fiction","purpose":"Entertainment","description":"Description"}`
+
+	// 1. /v1 は非推奨ヘッダーなしで応答する
+	w := suite.performRequest("POST", "/v1/books", bytes.NewBufferString(body))
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	assert.Empty(suite.T(), w.Header().Get("Deprecation"))
+	var created dto.BookResponse
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = suite.performRequest("GET", fmt.Sprintf("/v1/books/%d", created.ID), nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Empty(suite.T(), w.Header().Get("Sunset"))
+
+	// 2. バージョンなしのパスは同じデータを返し、非推奨であることを示す
+	w = suite.performRequest("GET", fmt.Sprintf("/books/%d", created.ID), nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"title":"Versioned"`)
+	assert.Equal(suite.T(), "@1792281600", w.Header().Get("Deprecation"))
+	assert.Equal(suite.T(), "Fri, 30 Apr 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(suite.T(), fmt.Sprintf(`</v1/books/%d>; rel="successor-version"`, created.ID), w.Header().Get("Link"))
+
+	// 3. 存在しないバージョンは404
+	w = suite.performRequest("GET", "/v9/books", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *IntegrationTestSuite) TestInterchangeFormats() {
+	w := suite.performRequest("POST", "/books", bytes.NewBufferString(`{"title":"Interchange","author":"Author","genre":"Fiction","purpose":"Entertainment","description":"Description","isbn":"9780306406157"}`))
+	suite.Require().Equal(http.StatusCreated, w.Code)
+
+	// エクスポートしたファイルを再度インポートすると重複として検出される
+	for _, format := range []string{"marc", "marcxml", "dc", "onix"} {
+		exported := suite.performRequest("GET", "/books/export?format="+format, nil)
+		assert.Equal(suite.T(), http.StatusOK, exported.Code, format)
+
+		req := httptest.NewRequest("POST", "/books/import?format="+format, bytes.NewBuffer(exported.Body.Bytes()))
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		assert.Equal(suite.T(), http.StatusOK, w.Code, format)
+		assert.Contains(suite.T(), w.Body.String(), `"total":1,"created":0,"duplicates":1`, format)
+	}
+}
+
+func (suite *IntegrationTestSuite) TestGraphQL() {
+	// 1. ミューテーションで作成した本は REST からも見える
+	w := suite.performRequest("POST", "/graphql", bytes.NewBufferString(`{"query":"mutation { a: createBook(input: {title: \"GraphQL Book\", author: \"Graph Author\", genre: \"Technology\", purpose: \"Learning\", description: \"Queries\"}) { id } b: createBook(input: {title: \"Second Book\", author: \"Graph Author\", genre: \"Fiction\", purpose: \"Learning\", description: \"Stories\"}) { id } }"}`))
+	suite.Require().Equal(http.StatusOK, w.Code)
+	assert.NotContains(suite.T(), w.Body.String(), `"errors"`)
+	var created struct {
+		Data struct {
+			A struct{ ID string }
+		}
+	}
+	suite.Require().NoError(json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = suite.performRequest("GET", "/v1/books?author=graph", nil)
+	assert.Contains(suite.T(), w.Body.String(), `"title":"GraphQL Book"`)
+
+	// 2. 検索とネストした著者情報
+	w = suite.performRequest("POST", "/graphql", bytes.NewBufferString(`{"query":"{ search(query: \"graphql\") { title authors { name bookCount books { title } } } }"}`))
+	suite.Require().Equal(http.StatusOK, w.Code)
+	assert.JSONEq(suite.T(), `{"data":{"search":[{"title":"GraphQL Book","authors":[{"name":"Graph Author","bookCount":2,"books":[{"title":"GraphQL Book"},{"title":"Second Book"}]}]}]}}`, w.Body.String())
+
+	// 3. 古いバージョンでの更新は REST と同じコードで失敗する
+	stale := fmt.Sprintf(`{"query":"mutation { updateBook(id: \"%s\", version: 99, input: {title: \"Stale\"}) { title } }"}`, created.Data.A.ID)
+	w = suite.performRequest("POST", "/graphql", bytes.NewBufferString(stale))
+	suite.Require().Equal(http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"code":"PRECONDITION_FAILED"`)
+}
+
+func (suite *IntegrationTestSuite) TestGRPC() {
+	// 同じデータベースに対して gRPC サーバーを起動
+	listener := bufconn.Listen(1024 * 1024)
+	server := newGRPCServer(models.NewBookRepository(suite.db), nil, nil)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	suite.Require().NoError(err)
+	defer conn.Close()
+	client := bookv1.NewBookServiceClient(conn)
+	ctx := context.Background()
+
+	// 1. gRPC で作成した本は REST からも見える
+	created, err := client.CreateBook(ctx, &bookv1.CreateBookRequest{
+		Title: "gRPC Book", Author: "RPC Author", Genre: "Technology", Purpose: "Learning", Description: "Protocol buffers",
+	})
+	suite.Require().NoError(err)
+	w := suite.performRequest("GET", fmt.Sprintf("/v1/books/%d", created.GetId()), nil)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), `"title":"gRPC Book"`)
+
+	// 2. 一覧はストリームで届く
+	stream, err := client.ListBooks(ctx, &bookv1.ListBooksRequest{Author: "rpc"})
+	suite.Require().NoError(err)
+	var titles []string
+	for {
+		book, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		suite.Require().NoError(err)
+		titles = append(titles, book.GetTitle())
+	}
+	assert.Equal(suite.T(), []string{"gRPC Book"}, titles)
+
+	// 3. 削除後は NotFound
+	_, err = client.DeleteBook(ctx, &bookv1.DeleteBookRequest{Id: created.GetId(), Version: &created.Version})
+	suite.Require().NoError(err)
+	_, err = client.GetBook(ctx, &bookv1.GetBookRequest{Id: created.GetId()})
+	assert.Equal(suite.T(), codes.NotFound, status.Code(err))
+}
+
+func (suite *IntegrationTestSuite) TestClientSDK() {
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+	api, err := client.New(server.URL, client.WithLanguage("ja"))
+	suite.Require().NoError(err)
+	ctx := context.Background()
+
+	// 1. 作成・取得
+	created, err := api.CreateBook(ctx, dto.CreateBookRequest{
+		Title: "SDK Book", Author: "SDK Author", Genre: "Technology", Purpose: "Learning", Description: "Typed client",
+	})
+	suite.Require().NoError(err)
+	assert.NotEmpty(suite.T(), created.ETag)
+
+	fetched, err := api.GetBook(ctx, created.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), created.ETag, fetched.ETag)
+
+	books, err := api.ListBooks(ctx, dto.ListBooksQuery{Author: "sdk"})
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), books, 1)
+
+	// 2. 条件付き更新: 古いETagでは失敗する
+	title := "SDK Book 2"
+	updated, err := api.UpdateBook(ctx, created.ID, dto.UpdateBookRequest{Title: &title}, client.IfMatch(created.ETag))
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "SDK Book 2", updated.Title)
+	_, err = api.UpdateBook(ctx, created.ID, dto.UpdateBookRequest{Title: &title}, client.IfMatch(created.ETag))
+	assert.ErrorIs(suite.T(), err, client.ErrPreconditionFailed)
+
+	// 3. 推薦
+	recommended, err := api.Recommend(ctx, dto.RecommendBookRequest{Genre: "Technology", Purpose: "Learning"})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), created.ID, recommended.ID)
+
+	// 4. 検証エラーは日本語のメッセージ付きで返る
+	_, err = api.CreateBook(ctx, dto.CreateBookRequest{Title: "No author"})
+	var apiErr *client.Error
+	suite.Require().True(errors.As(err, &apiErr))
+	assert.Equal(suite.T(), dto.CodeValidationFailed, apiErr.Code)
+	assert.NotEmpty(suite.T(), apiErr.Errors)
+
+	// 5. 削除後は BOOK_NOT_FOUND
+	_, err = api.DeleteBook(ctx, created.ID, client.IfMatch(updated.ETag))
+	suite.Require().NoError(err)
+	_, err = api.GetBook(ctx, created.ID)
+	assert.ErrorIs(suite.T(), err, client.ErrBookNotFound)
+}
+
+func (suite *IntegrationTestSuite) TestAuthentication() {
+	// 認証を有効にしたルーターを同じデータベースで構築
+	secret := "integration-secret-0123456789abcdef"
+	verifier, err := auth.NewJWTVerifier(auth.JWTConfig{HMACSecret: secret, Issuer: "recomemento-test"})
+	suite.Require().NoError(err)
+	bookRepo := models.NewBookRepository(suite.db)
+	apiKeyRepo := models.NewAPIKeyRepository(suite.db)
+	apiKeys := handlers.NewAPIKeyVerifier(apiKeyRepo)
+	r := gin.New()
+	registerAPIRoutes(r, handlers.NewBookHandler(bookRepo), handlers.NewGraphQLHandler(bookRepo), handlers.NewAPIKeyHandler(apiKeyRepo), handlers.NewAuthenticator(verifier, apiKeys), nil, time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	token := func(roles ...string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":   "integration",
+			"iss":   "recomemento-test",
+			"roles": roles,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(secret))
+		suite.Require().NoError(err)
+		return signed
+	}
+	ctx := context.Background()
+
+	// 1. トークンなしでは読み取りもできない
+	anonymous, err := client.New(server.URL)
+	suite.Require().NoError(err)
+	_, err = anonymous.ListBooks(ctx, dto.ListBooksQuery{})
+	assert.ErrorIs(suite.T(), err, client.ErrUnauthorized)
+
+	// 2. reader は読めるが変更できない
+	reader, err := client.New(server.URL, client.WithBearerToken(token("reader")))
+	suite.Require().NoError(err)
+	_, err = reader.ListBooks(ctx, dto.ListBooksQuery{})
+	assert.NoError(suite.T(), err)
+	_, err = reader.CreateBook(ctx, dto.CreateBookRequest{
+		Title: "Protected Book", Author: "Auth Author", Genre: "Technology", Purpose: "Learning", Description: "Roles",
+	})
+	assert.ErrorIs(suite.T(), err, client.ErrForbidden)
+
+	// 3. editor は変更できる
+	editor, err := client.New(server.URL, client.WithBearerToken(token("editor")))
+	suite.Require().NoError(err)
+	created, err := editor.CreateBook(ctx, dto.CreateBookRequest{
+		Title: "Protected Book", Author: "Auth Author", Genre: "Technology", Purpose: "Learning", Description: "Roles",
+	})
+	suite.Require().NoError(err)
+	_, err = editor.DeleteBook(ctx, created.ID)
+	assert.NoError(suite.T(), err)
+
+	// 4. 旧パスと GraphQL も保護される
+	resp, err := http.Get(server.URL + "/books")
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(suite.T(), `Bearer realm="recomemento"`, resp.Header.Get("WWW-Authenticate"))
+
+	resp, err = http.Post(server.URL+"/graphql", "application/json", strings.NewReader(`{"query":"{ books { id } }"}`))
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+
+	// 5. 管理者が発行した API キーはスコープの範囲で使える
+	adminToken := token("admin")
+	req, err := http.NewRequest("POST", server.URL+"/v1/admin/api-keys", strings.NewReader(`{"name":"Partner","scopes":["books:read","recommend"]}`))
+	suite.Require().NoError(err)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	suite.Require().NoError(err)
+	var issued dto.APIKeyResponse
+	suite.Require().NoError(json.NewDecoder(resp.Body).Decode(&issued))
+	resp.Body.Close()
+	suite.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	partner, err := client.New(server.URL, client.WithAPIKey(issued.Key))
+	suite.Require().NoError(err)
+	_, err = partner.ListBooks(ctx, dto.ListBooksQuery{})
+	assert.NoError(suite.T(), err)
+	_, err = partner.CreateBook(ctx, dto.CreateBookRequest{
+		Title: "Partner Book", Author: "Partner", Genre: "Technology", Purpose: "Learning", Description: "Scopes",
+	})
+	assert.ErrorIs(suite.T(), err, client.ErrInsufficientScope)
+
+	apiKeys.Flush()
+	var stored models.APIKey
+	suite.Require().NoError(suite.db.First(&stored, issued.ID).Error)
+	// スコープが足りずに拒否された作成は数えない
+	assert.Equal(suite.T(), int64(1), stored.UsageCount)
+}
+
+// TestNewRouter_TrustedProxies は X-Forwarded-For を信頼するプロキシを限定できることをテスト
+func TestNewRouter_TrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := handlers.NewRateLimiter(ratelimit.NewMemoryStore(), handlers.RateLimits{
+		IP: ratelimit.Limit{Requests: 1, Period: time.Hour},
+	})
+	serve := func(r *gin.Engine, remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/books", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// プロキシを設定しなければ、偽の X-Forwarded-For で別のバケットは得られない
+	r, err := newRouter(nil)
+	require.NoError(t, err)
+	r.GET("/books", limiter.IP(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	assert.Equal(t, http.StatusNoContent, serve(r, "192.0.2.1:1234", "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, "192.0.2.1:1234", "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, "192.0.2.1:1234", "198.51.100.3"))
+
+	// 信頼するプロキシからのリクエストはクライアントの IP アドレスで数える
+	r, err = newRouter([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	r.GET("/books", limiter.IP(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	assert.Equal(t, http.StatusNoContent, serve(r, "10.0.0.5:1234", "203.0.113.1"))
+	assert.Equal(t, http.StatusNoContent, serve(r, "10.0.0.5:1234", "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, "10.0.0.6:1234", "203.0.113.2"))
+
+	_, err = newRouter([]string{"proxy.example.com"})
+	assert.Error(t, err)
+}
+
 // ========== Helper Functions ==========
 
 func (suite *IntegrationTestSuite) performRequest(method, url string, body *bytes.Buffer) *httptest.ResponseRecorder {
@@ -1,17 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"recomemento-api-go/auth"
+	"recomemento-api-go/config"
 	"recomemento-api-go/database"
 	_ "recomemento-api-go/docs" // Swagger docs
 	"recomemento-api-go/handlers"
+	"recomemento-api-go/migrations"
 	"recomemento-api-go/models"
+	"recomemento-api-go/ratelimit"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // @title Recomemento API
@@ -27,19 +42,41 @@ import (
 // @license.url https://opensource.org/licenses/MIT
 
 // @host localhost:3001
-// @BasePath /
+// @BasePath /v1
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT as "Bearer <token>", with the reader, editor or admin role in the roles claim. API keys are also accepted as bearer tokens.
+
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key issued by /admin/api-keys, granting the books:read, books:write or recommend scopes
 func main() {
-	// Database initialization
-	dbPath := "./data/books.db"
-	if dbURL := os.Getenv("DATABASE_URL"); dbURL != "" {
-		if dbURL == "file:./prisma/dev.db" {
-			dbPath = "./prisma/dev.db"
-		} else {
-			dbPath = dbURL
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
 		}
 	}
 
-	db, err := database.InitDatabase(dbPath)
+	// Configuration from the file, environment and flags
+	flags := flag.NewFlagSet("recomemento-api", flag.ExitOnError)
+	loader := config.NewLoader(flags)
+	flags.Parse(os.Args[1:])
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+
+	// Database initialization
+	db, err := openDatabase(cfg.Database)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -51,43 +88,59 @@ func main() {
 
 	// Initialize repositories
 	bookRepo := models.NewBookRepository(db)
+	apiKeyRepo := models.NewAPIKeyRepository(db)
+
+	// Field length limits for book payloads
+	handlers.SetFieldLimits(handlers.FieldLimits{
+		Title:       cfg.Books.MaxTitleLength,
+		Author:      cfg.Books.MaxAuthorLength,
+		Genre:       cfg.Books.MaxGenreLength,
+		Purpose:     cfg.Books.MaxPurposeLength,
+		Description: cfg.Books.MaxDescriptionLength,
+	})
+
+	// Authentication; the uses of API keys are written to the database periodically
+	apiKeys := handlers.NewAPIKeyVerifier(apiKeyRepo)
+	authenticator, err := newAuthenticator(cfg.Auth, apiKeys)
+	if err != nil {
+		log.Fatal("Failed to configure authentication:", err)
+	}
+
+	// Rate limiting per API key, user or IP
+	limiter := handlers.NewRateLimiter(ratelimit.NewMemoryStore(), handlers.RateLimits{
+		Default:   cfg.RateLimit.Default,
+		Recommend: cfg.RateLimit.Recommend,
+		IP:        cfg.RateLimit.IP,
+	})
 
 	// Initialize handlers
 	bookHandler := handlers.NewBookHandler(bookRepo)
+	graphQLHandler := handlers.NewGraphQLHandler(bookRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo)
 
 	// Initialize Gin router
-	r := gin.Default()
+	r, err := newRouter(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatal("Failed to configure trusted proxies:", err)
+	}
 
-	// Enable CORS
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		
-		c.Next()
-	})
+	// CORS policy for browsers
+	cors, err := newCORS(cfg.CORS)
+	if err != nil {
+		log.Fatal("Failed to configure CORS:", err)
+	}
+	r.Use(cors)
+
+	// Render unknown routes as problem details
+	r.NoRoute(handlers.RouteNotFound)
 
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok", "message": "Recomemento API is running"})
 	})
 
-	// API routes
-	api := r.Group("/")
-	{
-		// Book routes
-		api.POST("/books", bookHandler.CreateBook)
-		api.GET("/books", bookHandler.GetAllBooks)
-		api.GET("/books/:id", bookHandler.GetBookByID)
-		api.PATCH("/books/:id", bookHandler.UpdateBook)
-		api.DELETE("/books/:id", bookHandler.DeleteBook)
-		api.POST("/books/recommend", bookHandler.RecommendBook)
-	}
+	// API routes: /v1, the deprecated unversioned aliases and /graphql
+	registerAPIRoutes(r, bookHandler, graphQLHandler, apiKeyHandler, authenticator, limiter, cfg.Server.LegacyRoutesSunset)
 
 	// Swagger documentation
 	r.GET("/api-docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -98,17 +151,146 @@ func main() {
 		c.File("./docs/swagger.json")
 	})
 
-	// Get port from environment or default to 3001
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3001"
-	}
+	port := strconv.Itoa(cfg.Server.Port)
+
+	// Serve until SIGINT or SIGTERM, then finish the requests in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	usageCtx, stopUsage := context.WithCancel(context.Background())
+	usageDone := make(chan struct{})
+	go func() {
+		apiKeys.Run(usageCtx, apiKeyUsageInterval)
+		close(usageDone)
+	}()
+
+	// gRPC API on its own port, backed by the same repository
+	grpcPort := strconv.Itoa(cfg.Server.GRPCPort)
+	grpcDone := make(chan struct{})
+	go func() {
+		if err := serveGRPC(ctx, ":"+grpcPort, bookRepo, authenticator, limiter); err != nil {
+			log.Fatal("Failed to start gRPC server:", err)
+		}
+		close(grpcDone)
+	}()
+	log.Printf("gRPC server starting on port %s", grpcPort)
 
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Swagger UI available at: http://localhost:%s/api-docs/", port)
 	log.Printf("Health check available at: http://localhost:%s/health", port)
-	
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: HTTP server did not shut down cleanly: %v", err)
+	}
+	<-grpcDone
+
+	// The servers no longer take requests: write the last uses of API keys
+	stopUsage()
+	<-usageDone
+
+	if err := database.Close(db); err != nil {
+		log.Printf("Warning: failed to close database: %v", err)
+	}
+}
+
+// apiKeyUsageInterval is how often the uses of API keys are written to the database
+const apiKeyUsageInterval = 10 * time.Second
+
+// shutdownTimeout is how long the HTTP server waits for the requests in flight when
+// shutting down
+const shutdownTimeout = 30 * time.Second
+
+// newRouter creates the Gin engine. The client IP address, which anonymous requests
+// are rate limited by, is read from X-Forwarded-For and X-Real-IP only on requests
+// from trustedProxies; with none, it is always the address of the peer.
+func newRouter(trustedProxies []string) (*gin.Engine, error) {
+	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newCORS creates the CORS middleware of cfg
+func newCORS(cfg config.CORS) (gin.HandlerFunc, error) {
+	return handlers.CORS(handlers.CORSConfig{
+		AllowOrigins:     cfg.AllowedOrigins,
+		AllowCredentials: cfg.AllowCredentials,
+		ExposeHeaders:    cfg.ExposedHeaders,
+		MaxAge:           cfg.MaxAge,
+	})
+}
+
+// newAuthenticator configures the verification of bearer tokens by cfg and of API keys
+// by apiKeys. Without a JWT key, which administrators need to issue API keys,
+// the server refuses to start unless authentication is disabled, so that the API is
+// never exposed unauthenticated by accident.
+func newAuthenticator(cfg config.Auth, apiKeys *handlers.APIKeyVerifier) (*handlers.Authenticator, error) {
+	if cfg.Disabled {
+		log.Printf("Warning: authentication is disabled, every route is open")
+		return handlers.NewAuthenticator(nil, nil), nil
+	}
+
+	verifier, err := auth.NewJWTVerifier(auth.JWTConfig{
+		HMACSecret: cfg.JWTHS256Secret,
+		JWKSFile:   cfg.JWKSFile,
+		Issuer:     cfg.Issuer,
+		Audience:   cfg.Audience,
+		Leeway:     30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w (set JWT_HS256_SECRET or JWT_JWKS_FILE, or AUTH_DISABLED=true for local development)", err)
+	}
+	return handlers.NewAuthenticator(verifier, apiKeys), nil
+}
+
+// sqlLogLevels maps config.LogLevels to the levels of the SQL logger
+var sqlLogLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// openDatabase connects to the database of cfg and migrates it, unless migrations are
+// applied separately, in which case the schema must be up to date
+func openDatabase(cfg config.Database) (*gorm.DB, error) {
+	database.LogLevel = sqlLogLevels[cfg.LogLevel]
+	if cfg.AutoMigrate {
+		return database.InitDatabase(cfg.URL, databaseOptions(cfg))
+	}
+
+	db, err := database.Open(cfg.URL, databaseOptions(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if err := migrations.Check(db); err != nil {
+		database.Close(db)
+		return nil, err
+	}
+	return db, nil
+}
+
+// databaseOptions returns the connection settings of cfg
+func databaseOptions(cfg config.Database) database.Options {
+	return database.Options{
+		JournalMode:     cfg.SQLite.JournalMode,
+		Synchronous:     cfg.SQLite.Synchronous,
+		BusyTimeout:     cfg.SQLite.BusyTimeout,
+		ForeignKeys:     cfg.SQLite.ForeignKeys,
+		MaxOpenConns:    cfg.Pool.MaxOpenConns,
+		MaxIdleConns:    cfg.Pool.MaxIdleConns,
+		ConnMaxLifetime: cfg.Pool.ConnMaxLifetime,
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,30 @@
+// Package matchkey computes the keys that identify the books considered the same when
+// importing: compatibility forms and case are folded and punctuation and spacing are
+// ignored, so that "The Great Gatsby" by "F. Scott Fitzgerald" matches
+// "the great gatsby" by "F Scott  Fitzgerald".
+package matchkey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Book returns the key of a book by title and author. The normalized text is hashed so
+// that the key fits an indexed column of every database.
+func Book(title, author string) string {
+	sum := sha256.Sum256([]byte(normalize(title) + "\x00" + normalize(author)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalize folds s to the words made of its letters and numbers, separated by spaces
+func normalize(s string) string {
+	s = cases.Fold().String(norm.NFKC.String(s))
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
@@ -0,0 +1,29 @@
+package matchkey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBook(t *testing.T) {
+	key := Book("The Great Gatsby", "F. Scott Fitzgerald")
+
+	t.Run("大文字小文字・句読点・空白の違いは無視する", func(t *testing.T) {
+		assert.Equal(t, key, Book("the great gatsby", "F Scott  Fitzgerald"))
+		assert.Equal(t, key, Book("  THE GREAT GATSBY!", "f.scott fitzgerald"))
+	})
+
+	t.Run("互換文字は正規化する", func(t *testing.T) {
+		assert.Equal(t, Book("Go言語入門", "山田太郎"), Book("Ｇｏ言語入門", "山田太郎"))
+	})
+
+	t.Run("書名と著者の境界は区別する", func(t *testing.T) {
+		assert.NotEqual(t, Book("Gatsby F", "Scott"), Book("Gatsby", "F Scott"))
+	})
+
+	t.Run("インデックスできる固定長の鍵になる", func(t *testing.T) {
+		assert.Len(t, key, 64)
+		assert.NotEqual(t, key, Book("The Great Gatsby", "Someone Else"))
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"recomemento-api-go/config"
+	"recomemento-api-go/database"
+	"recomemento-api-go/migrations"
+)
+
+const migrateUsage = "Usage: recomemento-api migrate up|down|status [flags]"
+
+// runMigrate implements `migrate up|down|status [flags]`: up applies the pending
+// migrations, down reverts the last ones (-steps, 1 by default) and status lists every
+// migration with the time it was applied. It takes the flags of the server to find the
+// database, and returns the process exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	command := args[0]
+
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	steps := 1
+	if command == "down" {
+		flags.IntVar(&steps, "steps", 1, "number of migrations to revert, latest first")
+	}
+	loader := config.NewLoader(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), migrateUsage+"\n\nApplies (up), reverts (down) or lists (status) the versioned migrations of the\ndatabase schema.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || steps < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Printf("migrate: invalid configuration:\n%v", err)
+		return 2
+	}
+	// The SQL log would drown the report, so only problems are logged unless configured
+	// otherwise
+	if cfg.Source("database.log_level") == "default" {
+		cfg.Database.LogLevel = "warn"
+	}
+	database.LogLevel = sqlLogLevels[cfg.Database.LogLevel]
+	db, err := database.Open(cfg.Database.URL, databaseOptions(cfg.Database))
+	if err != nil {
+		log.Printf("migrate: failed to connect to database: %v", err)
+		return 1
+	}
+	defer database.Close(db)
+
+	switch command {
+	case "up":
+		applied, err := migrations.Up(db)
+		for _, migration := range applied {
+			fmt.Printf("Applied %d (%s)\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Printf("migrate: %v", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Printf("Already at version %d\n", migrations.Latest())
+		}
+	case "down":
+		reverted, err := migrations.Down(db, steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %d (%s)\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Printf("migrate: %v", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migration to revert")
+		}
+	case "status":
+		states, err := migrations.Status(db)
+		if err != nil {
+			log.Printf("migrate: %v", err)
+			return 1
+		}
+		printMigrationStatus(states)
+	}
+	return 0
+}
+
+// printMigrationStatus writes the states as a table to stdout
+func printMigrationStatus(states []migrations.State) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, state := range states {
+		applied := "pending"
+		if state.AppliedAt != nil {
+			applied = state.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		if state.Unknown {
+			applied += " (unknown to this build)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, state.Name, applied)
+	}
+	w.Flush()
+}
@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// initialSchema creates the books and api_keys tables. Databases created by AutoMigrate,
+// before migrations were versioned, already have them, but releases older than the
+// version and isbn columns of books lack those; they are added, so that every database
+// starts from the same schema.
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial schema",
+	Up: func(tx *gorm.DB) error {
+		return applyDDL(tx, initialSchemaDDL)
+	},
+	Down: func(tx *gorm.DB) error {
+		return exec(tx,
+			`DROP TABLE IF EXISTS api_keys`,
+			`DROP TABLE IF EXISTS books`,
+		)
+	},
+}
+
+// initialSchemaDDL is the schema of version 1 in each dialect, with the types that
+// AutoMigrate gave the models of the time
+var initialSchemaDDL = map[string]schemaDDL{
+	"sqlite": {
+		tables: []string{
+			`CREATE TABLE IF NOT EXISTS books (` +
+				`id integer PRIMARY KEY AUTOINCREMENT, title text NOT NULL, author text NOT NULL, ` +
+				`genre text NOT NULL, purpose text NOT NULL, description text NOT NULL, ` +
+				`isbn text NOT NULL DEFAULT '', version integer NOT NULL DEFAULT 1)`,
+			`CREATE TABLE IF NOT EXISTS api_keys (` +
+				`id integer PRIMARY KEY AUTOINCREMENT, name text NOT NULL, prefix text NOT NULL, ` +
+				`secret_hash text NOT NULL, scopes text NOT NULL, created_at datetime, expires_at datetime, ` +
+				`revoked_at datetime, last_used_at datetime, usage_count integer NOT NULL DEFAULT 0)`,
+		},
+		columns: []schemaObject{
+			{"books", "version", `ALTER TABLE books ADD COLUMN version integer NOT NULL DEFAULT 1`},
+			{"books", "isbn", `ALTER TABLE books ADD COLUMN isbn text NOT NULL DEFAULT ''`},
+		},
+		indexes: []schemaObject{
+			{"books", "idx_books_isbn", `CREATE INDEX idx_books_isbn ON books (isbn)`},
+			{"api_keys", "idx_api_keys_prefix", `CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix)`},
+		},
+	},
+	"postgres": {
+		tables: []string{
+			`CREATE TABLE IF NOT EXISTS books (` +
+				`id bigserial PRIMARY KEY, title text NOT NULL, author text NOT NULL, ` +
+				`genre text NOT NULL, purpose text NOT NULL, description text NOT NULL, ` +
+				`isbn text NOT NULL DEFAULT '', version bigint NOT NULL DEFAULT 1)`,
+			`CREATE TABLE IF NOT EXISTS api_keys (` +
+				`id bigserial PRIMARY KEY, name text NOT NULL, prefix text NOT NULL, ` +
+				`secret_hash text NOT NULL, scopes text NOT NULL, created_at timestamptz, expires_at timestamptz, ` +
+				`revoked_at timestamptz, last_used_at timestamptz, usage_count bigint NOT NULL DEFAULT 0)`,
+		},
+		columns: []schemaObject{
+			{"books", "version", `ALTER TABLE books ADD COLUMN version bigint NOT NULL DEFAULT 1`},
+			{"books", "isbn", `ALTER TABLE books ADD COLUMN isbn text NOT NULL DEFAULT ''`},
+		},
+		indexes: []schemaObject{
+			{"books", "idx_books_isbn", `CREATE INDEX idx_books_isbn ON books (isbn)`},
+			{"api_keys", "idx_api_keys_prefix", `CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix)`},
+		},
+	},
+	"mysql": {
+		tables: []string{
+			`CREATE TABLE IF NOT EXISTS books (` +
+				`id bigint unsigned AUTO_INCREMENT PRIMARY KEY, title longtext NOT NULL, author longtext NOT NULL, ` +
+				`genre longtext NOT NULL, purpose longtext NOT NULL, description longtext NOT NULL, ` +
+				`isbn varchar(191) NOT NULL DEFAULT '', version bigint unsigned NOT NULL DEFAULT 1)`,
+			`CREATE TABLE IF NOT EXISTS api_keys (` +
+				`id bigint unsigned AUTO_INCREMENT PRIMARY KEY, name longtext NOT NULL, prefix varchar(191) NOT NULL, ` +
+				`secret_hash longtext NOT NULL, scopes longtext NOT NULL, created_at datetime(3) NULL, ` +
+				`expires_at datetime(3) NULL, revoked_at datetime(3) NULL, last_used_at datetime(3) NULL, ` +
+				`usage_count bigint NOT NULL DEFAULT 0)`,
+		},
+		columns: []schemaObject{
+			{"books", "version", `ALTER TABLE books ADD COLUMN version bigint unsigned NOT NULL DEFAULT 1`},
+			{"books", "isbn", `ALTER TABLE books ADD COLUMN isbn varchar(191) NOT NULL DEFAULT ''`},
+		},
+		indexes: []schemaObject{
+			{"books", "idx_books_isbn", `CREATE INDEX idx_books_isbn ON books (isbn)`},
+			{"api_keys", "idx_api_keys_prefix", `CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix)`},
+		},
+	},
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// postgresBookSearch adds the search_vector column that BookDatabase.Search matches on
+// PostgreSQL. The column is generated from the searched fields, so it never has to be
+// written, and uses the simple configuration: words are lowercased but not stemmed,
+// whatever their language. Databases that started it before migrations were versioned
+// already have the column. Other databases search with LIKE and are left unchanged.
+var postgresBookSearch = Migration{
+	Version: 2,
+	Name:    "PostgreSQL book search",
+	Up: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() != "postgres" {
+			return nil
+		}
+		return exec(tx,
+			`ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (`+
+				`to_tsvector('simple', title || ' ' || author || ' ' || genre || ' ' || description)) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector)`,
+		)
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() != "postgres" {
+			return nil
+		}
+		return exec(tx,
+			`DROP INDEX IF EXISTS idx_books_search_vector`,
+			`ALTER TABLE books DROP COLUMN IF EXISTS search_vector`,
+		)
+	},
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"recomemento-api-go/matchkey"
+
+	"gorm.io/gorm"
+)
+
+// bookMatchKeys adds the indexed match_key column of books, which the importer looks
+// duplicates up by, and computes it for the existing books. Databases created by
+// AutoMigrate from a newer model may already have the column; only the books without a
+// key are updated.
+var bookMatchKeys = Migration{
+	Version: 3,
+	Name:    "book match keys",
+	Up: func(tx *gorm.DB) error {
+		if err := applyDDL(tx, bookMatchKeysDDL); err != nil {
+			return err
+		}
+
+		var batch []struct {
+			ID     uint
+			Title  string
+			Author string
+		}
+		return tx.Table("books").Select("id", "title", "author").Where("match_key = ''").
+			FindInBatches(&batch, 500, func(*gorm.DB, int) error {
+				for _, book := range batch {
+					err := tx.Table("books").Where("id = ?", book.ID).
+						Update("match_key", matchkey.Book(book.Title, book.Author)).Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		dropIndex := `DROP INDEX IF EXISTS idx_books_match_key`
+		if tx.Dialector.Name() == "mysql" {
+			dropIndex = `DROP INDEX idx_books_match_key ON books`
+		}
+		return exec(tx, dropIndex, `ALTER TABLE books DROP COLUMN match_key`)
+	},
+}
+
+// bookMatchKeysDDL is the schema of version 3 in each dialect
+var bookMatchKeysDDL = map[string]schemaDDL{
+	"sqlite": {
+		columns: []schemaObject{
+			{"books", "match_key", `ALTER TABLE books ADD COLUMN match_key text NOT NULL DEFAULT ''`},
+		},
+		indexes: []schemaObject{
+			{"books", "idx_books_match_key", `CREATE INDEX idx_books_match_key ON books (match_key)`},
+		},
+	},
+	"postgres": {
+		columns: []schemaObject{
+			{"books", "match_key", `ALTER TABLE books ADD COLUMN match_key text NOT NULL DEFAULT ''`},
+		},
+		indexes: []schemaObject{
+			{"books", "idx_books_match_key", `CREATE INDEX idx_books_match_key ON books (match_key)`},
+		},
+	},
+	"mysql": {
+		columns: []schemaObject{
+			{"books", "match_key", `ALTER TABLE books ADD COLUMN match_key varchar(191) NOT NULL DEFAULT ''`},
+		},
+		indexes: []schemaObject{
+			{"books", "idx_books_match_key", `CREATE INDEX idx_books_match_key ON books (match_key)`},
+		},
+	},
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// bookTagsAndRatings adds the tags of books and the ratings readers give them. Rows
+// are removed with their book by the repository.
+var bookTagsAndRatings = Migration{
+	Version: 4,
+	Name:    "book tags and ratings",
+	Up: func(tx *gorm.DB) error {
+		return applyDDL(tx, bookTagsAndRatingsDDL)
+	},
+	Down: func(tx *gorm.DB) error {
+		return exec(tx,
+			`DROP TABLE IF EXISTS book_ratings`,
+			`DROP TABLE IF EXISTS book_tags`,
+		)
+	},
+}
+
+// bookTagsAndRatingsDDL is the schema of version 4 in each dialect
+var bookTagsAndRatingsDDL = map[string]schemaDDL{
+	"sqlite": {
+		tables: []string{
+			`CREATE TABLE IF NOT EXISTS book_tags (` +
+				`book_id integer NOT NULL, name text NOT NULL, PRIMARY KEY (book_id, name))`,
+			`CREATE TABLE IF NOT EXISTS book_ratings (` +
+				`book_id integer NOT NULL, rater text NOT NULL, score integer NOT NULL, updated_at datetime, ` +
+				`PRIMARY KEY (book_id, rater))`,
+		},
+	},
+	"postgres": {
+		tables: []string{
+			`CREATE TABLE IF NOT EXISTS book_tags (` +
+				`book_id bigint NOT NULL, name text NOT NULL, PRIMARY KEY (book_id, name))`,
+			`CREATE TABLE IF NOT EXISTS book_ratings (` +
+				`book_id bigint NOT NULL, rater text NOT NULL, score bigint NOT NULL, updated_at timestamptz, ` +
+				`PRIMARY KEY (book_id, rater))`,
+		},
+	},
+	"mysql": {
+		tables: []string{
+			`CREATE TABLE IF NOT EXISTS book_tags (` +
+				`book_id bigint unsigned NOT NULL, name varchar(191) NOT NULL, PRIMARY KEY (book_id, name))`,
+			`CREATE TABLE IF NOT EXISTS book_ratings (` +
+				`book_id bigint unsigned NOT NULL, rater varchar(191) NOT NULL, score bigint NOT NULL, ` +
+				`updated_at datetime(3) NULL, PRIMARY KEY (book_id, rater))`,
+		},
+	},
+}
@@ -0,0 +1,338 @@
+// Package migrations versions the database schema. Every change to the schema is a
+// numbered migration that can be applied and reverted; the versions applied to a
+// database are recorded in its schema_migrations table.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNewerSchema is returned when the database has migrations applied that this build
+	// does not know, because a newer version of the application migrated it
+	ErrNewerSchema = errors.New("database schema is newer than this build")
+	// ErrPending is returned by Check when migrations remain to be applied
+	ErrPending = errors.New("database schema is out of date")
+)
+
+// Migration is a change to the schema. Up applies it and Down reverts it; both run in
+// a transaction with the recording of the version, except on MySQL, which commits DDL
+// statements immediately.
+type Migration struct {
+	// Version orders the migrations; it is never reused
+	Version int
+	// Name describes the change
+	Name string
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+// all lists the migrations in version order. New migrations are appended, in a file
+// named after their version, and never change once released.
+var all = []Migration{
+	initialSchema,
+	postgresBookSearch,
+	bookMatchKeys,
+	bookTagsAndRatings,
+}
+
+// All returns the migrations in version order
+func All() []Migration {
+	return append([]Migration(nil), all...)
+}
+
+// Latest returns the version of the last migration
+func Latest() int {
+	return all[len(all)-1].Version
+}
+
+// State is a migration with the time it was applied to a database
+type State struct {
+	Version int
+	Name    string
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+	// Unknown reports a version applied by a newer build
+	Unknown bool
+}
+
+// schemaMigration is a row of schema_migrations
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName specifies the table recording the applied migrations
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status returns the known migrations in version order, followed by the versions that
+// were applied by a newer build
+func Status(db *gorm.DB) ([]State, error) {
+	rows, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+
+	states := make([]State, 0, len(all))
+	known := make(map[int]bool, len(all))
+	for _, migration := range all {
+		state := State{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+		known[migration.Version] = true
+	}
+	for _, row := range rows {
+		if !known[row.Version] {
+			appliedAt := row.AppliedAt
+			states = append(states, State{Version: row.Version, Name: row.Name, AppliedAt: &appliedAt, Unknown: true})
+		}
+	}
+	return states, nil
+}
+
+// Check returns ErrNewerSchema when a newer build migrated the database and ErrPending
+// when migrations remain to be applied
+func Check(db *gorm.DB) error {
+	states, err := Status(db)
+	if err != nil {
+		return err
+	}
+	if err := checkNewer(states); err != nil {
+		return err
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			return fmt.Errorf("%w: migration %d (%s) is pending; run migrate up", ErrPending, state.Version, state.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies the pending migrations in version order and returns them. It refuses to
+// touch a database migrated by a newer build. Instances migrating the same database at
+// once take turns, and each migration is applied by only one of them.
+func Up(db *gorm.DB) (done []Migration, err error) {
+	err = withLock(db, func(db *gorm.DB) error {
+		states, err := Status(db)
+		if err != nil {
+			return err
+		}
+		if err := checkNewer(states); err != nil {
+			return err
+		}
+
+		for i, state := range states {
+			if state.AppliedAt != nil {
+				continue
+			}
+			migration := all[i]
+			applied := false
+			err := db.Transaction(func(tx *gorm.DB) error {
+				// On SQLite, which has no lock to take, another instance may have applied it
+				// since Status
+				if recorded, err := isRecorded(tx, migration.Version); err != nil || recorded {
+					return err
+				}
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				applied = true
+				return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+			}
+			if applied {
+				done = append(done, migration)
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, latest first, and returns them. It
+// refuses to touch a database migrated by a newer build.
+func Down(db *gorm.DB, steps int) (done []Migration, err error) {
+	err = withLock(db, func(db *gorm.DB) error {
+		states, err := Status(db)
+		if err != nil {
+			return err
+		}
+		if err := checkNewer(states); err != nil {
+			return err
+		}
+
+		for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+			if states[i].AppliedAt == nil {
+				continue
+			}
+			migration := all[i]
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{Version: migration.Version}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d (%s): %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// lockID identifies the advisory lock of the migrations on PostgreSQL; any constant
+// does, as long as nothing else uses it
+const lockID = 7_112_049_001
+
+// lockName is the name of the lock of the migrations on MySQL
+const lockName = "schema_migrations"
+
+// withLock runs fn holding a lock on the migrations of the database, on a connection of
+// its own, and waits for the instances holding it. The lock is a session lock, released
+// with the connection should the process die. SQLite has none; its writes are
+// serialized and Up checks for each migration in its transaction that no other instance
+// applied it.
+func withLock(db *gorm.DB, fn func(db *gorm.DB) error) error {
+	var lock, unlock string
+	switch db.Dialector.Name() {
+	case "postgres":
+		lock = fmt.Sprintf("SELECT pg_advisory_lock(%d)", lockID)
+		unlock = fmt.Sprintf("SELECT pg_advisory_unlock(%d)", lockID)
+	case "mysql":
+		lock = fmt.Sprintf("SELECT GET_LOCK('%s', -1)", lockName)
+		unlock = fmt.Sprintf("SELECT RELEASE_LOCK('%s')", lockName)
+	default:
+		return fn(db)
+	}
+
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec(lock).Error; err != nil {
+			return fmt.Errorf("locking the migrations: %w", err)
+		}
+		err := fn(conn)
+		if unlockErr := conn.Exec(unlock).Error; unlockErr != nil && err == nil {
+			err = fmt.Errorf("unlocking the migrations: %w", unlockErr)
+		}
+		return err
+	})
+}
+
+// isRecorded reports whether schema_migrations records version
+func isRecorded(tx *gorm.DB, version int) (bool, error) {
+	var count int64
+	err := tx.Model(&schemaMigration{}).Where("version = ?", version).Count(&count).Error
+	return count > 0, err
+}
+
+// schemaMigrationsDDL creates schema_migrations in each dialect
+var schemaMigrationsDDL = map[string]string{
+	"sqlite":   `CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name text NOT NULL, applied_at datetime NOT NULL)`,
+	"postgres": `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY, name text NOT NULL, applied_at timestamptz NOT NULL)`,
+	"mysql":    `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY, name varchar(255) NOT NULL, applied_at datetime(3) NOT NULL)`,
+}
+
+// appliedMigrations reads schema_migrations in version order, creating it on first use
+func appliedMigrations(db *gorm.DB) ([]schemaMigration, error) {
+	ddl, ok := schemaMigrationsDDL[db.Dialector.Name()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database %q", db.Dialector.Name())
+	}
+	if err := db.Exec(ddl).Error; err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	return rows, nil
+}
+
+// schemaDDL is the DDL of a migration in a dialect
+type schemaDDL struct {
+	// tables creates the tables that do not exist
+	tables []string
+	// columns adds the columns missing from existing tables
+	columns []schemaObject
+	// indexes creates the missing indexes
+	indexes []schemaObject
+}
+
+// schemaObject is a column or an index of table, with the statement creating it
+type schemaObject struct {
+	table     string
+	name      string
+	statement string
+}
+
+// dialectDDL returns the DDL of the dialect of tx
+func dialectDDL(tx *gorm.DB, ddl map[string]schemaDDL) (schemaDDL, error) {
+	schema, ok := ddl[tx.Dialector.Name()]
+	if !ok {
+		return schemaDDL{}, fmt.Errorf("unsupported database %q", tx.Dialector.Name())
+	}
+	return schema, nil
+}
+
+// applyDDL creates the tables, columns and indexes of the dialect of tx that do not
+// exist yet
+func applyDDL(tx *gorm.DB, ddl map[string]schemaDDL) error {
+	schema, err := dialectDDL(tx, ddl)
+	if err != nil {
+		return err
+	}
+	if err := exec(tx, schema.tables...); err != nil {
+		return err
+	}
+	for _, column := range schema.columns {
+		if !tx.Migrator().HasColumn(column.table, column.name) {
+			if err := exec(tx, column.statement); err != nil {
+				return err
+			}
+		}
+	}
+	for _, index := range schema.indexes {
+		if !tx.Migrator().HasIndex(index.table, index.name) {
+			if err := exec(tx, index.statement); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exec runs the SQL statements in order, stopping at the first error
+func exec(tx *gorm.DB, statements ...string) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNewer returns ErrNewerSchema when states include versions unknown to this build
+func checkNewer(states []State) error {
+	last := states[len(states)-1]
+	if !last.Unknown {
+		return nil
+	}
+	return fmt.Errorf("%w: the database is at version %d, this build knows versions up to %d; deploy a newer build or revert the migrations with it",
+		ErrNewerSchema, last.Version, Latest())
+}
@@ -0,0 +1,247 @@
+package migrations
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"recomemento-api-go/matchkey"
+	"recomemento-api-go/models"
+	"recomemento-api-go/testutil/pgtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSQLite opens an empty SQLite database in a temporary file
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "books.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	return db
+}
+
+// versions returns the versions of migrations
+func versions(migrations []Migration) []int {
+	result := []int{}
+	for _, migration := range migrations {
+		result = append(result, migration.Version)
+	}
+	return result
+}
+
+func TestAll_Ordered(t *testing.T) {
+	// バージョンは1から昇順で、すべてのマイグレーションは戻せる
+	for i, migration := range All() {
+		assert.Equal(t, i+1, migration.Version)
+		assert.NotEmpty(t, migration.Name)
+		assert.NotNil(t, migration.Up, migration.Name)
+		assert.NotNil(t, migration.Down, migration.Name)
+	}
+	assert.Equal(t, len(All()), Latest())
+}
+
+func TestUp(t *testing.T) {
+	db := openSQLite(t)
+
+	applied, err := Up(db)
+
+	require.NoError(t, err)
+	assert.Equal(t, versions(All()), versions(applied))
+	assert.NoError(t, Check(db))
+	states, err := Status(db)
+	require.NoError(t, err)
+	for _, state := range states {
+		assert.NotNil(t, state.AppliedAt, state.Name)
+		assert.False(t, state.Unknown)
+	}
+
+	// 適用済みのマイグレーションは再度適用しない
+	applied, err = Up(db)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+func TestUp_SchemaMatchesModels(t *testing.T) {
+	// モデルを変更したらマイグレーションを追加する
+	db := openSQLite(t)
+	_, err := Up(db)
+	require.NoError(t, err)
+
+	for _, model := range []interface{}{&models.Book{}, &models.APIKey{}, &models.BookTag{}, &models.BookRating{}} {
+		stmt := &gorm.Statement{DB: db}
+		require.NoError(t, stmt.Parse(model))
+		columns, err := db.Migrator().ColumnTypes(model)
+		require.NoError(t, err)
+
+		names := []string{}
+		for _, column := range columns {
+			names = append(names, column.Name())
+		}
+		assert.ElementsMatch(t, stmt.Schema.DBNames, names, stmt.Schema.Table)
+		for _, index := range stmt.Schema.ParseIndexes() {
+			assert.True(t, db.Migrator().HasIndex(model, index.Name), index.Name)
+		}
+	}
+}
+
+func TestUp_AdoptsAutoMigratedDatabase(t *testing.T) {
+	// バージョン管理以前にAutoMigrateで作られたデータベースはデータを保ったまま移行する
+	db := openSQLite(t)
+	require.NoError(t, db.AutoMigrate(&models.Book{}, &models.APIKey{}))
+	book := models.Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	require.NoError(t, db.Create(&book).Error)
+
+	applied, err := Up(db)
+
+	require.NoError(t, err)
+	assert.Equal(t, versions(All()), versions(applied))
+	var stored models.Book
+	require.NoError(t, db.First(&stored, book.ID).Error)
+	assert.Equal(t, book, stored)
+}
+
+func TestUp_AdoptsDatabaseOfOldRelease(t *testing.T) {
+	// version と isbn の列が追加される前のリリースのデータベースには列と索引を追加する
+	db := openSQLite(t)
+	require.NoError(t, db.Exec(`CREATE TABLE books (id integer PRIMARY KEY AUTOINCREMENT, title text NOT NULL, `+
+		`author text NOT NULL, genre text NOT NULL, purpose text NOT NULL, description text NOT NULL)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO books (title, author, genre, purpose, description) `+
+		`VALUES ('Title', 'Author', 'Fiction', 'Entertainment', 'Description')`).Error)
+
+	_, err := Up(db)
+
+	require.NoError(t, err)
+	var stored models.Book
+	require.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, uint(1), stored.Version)
+	assert.Equal(t, "", stored.ISBN)
+	assert.True(t, db.Migrator().HasIndex("books", "idx_books_isbn"))
+	assert.True(t, db.Migrator().HasIndex("api_keys", "idx_api_keys_prefix"))
+}
+
+func TestUp_ComputesMatchKeys(t *testing.T) {
+	// 重複検出の鍵の列がなかったデータベースでは既存の本の鍵を計算する
+	db := openSQLite(t)
+	_, err := Up(db)
+	_, err = Down(db, Latest()-bookMatchKeys.Version+1)
+	_, err = Down(db, 1)
+	require.NoError(t, err)
+	require.False(t, db.Migrator().HasColumn("books", "match_key"))
+	require.NoError(t, db.Exec(`INSERT INTO books (title, author, genre, purpose, description) `+
+		`VALUES ('The Great Gatsby', 'F. Scott Fitzgerald', 'Fiction', 'Entertainment', 'Description')`).Error)
+
+	_, err = Up(db)
+
+	require.NoError(t, err)
+	var stored models.Book
+	require.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, matchkey.Book("the great gatsby", "F Scott Fitzgerald"), stored.MatchKey)
+	assert.True(t, db.Migrator().HasIndex("books", "idx_books_match_key"))
+}
+
+func TestDown(t *testing.T) {
+	db := openSQLite(t)
+	_, err := Up(db)
+	require.NoError(t, err)
+
+	// Act - 最後のマイグレーションを戻す
+	reverted, err := Down(db, 1)
+
+	require.NoError(t, err)
+	assert.Equal(t, []int{Latest()}, versions(reverted))
+	assert.ErrorIs(t, Check(db), ErrPending)
+	states, err := Status(db)
+	require.NoError(t, err)
+	assert.Nil(t, states[len(states)-1].AppliedAt)
+
+	// Act - 残りをすべて戻す
+	reverted, err = Down(db, 10)
+
+	require.NoError(t, err)
+	assert.Len(t, reverted, Latest()-1)
+	assert.False(t, db.Migrator().HasTable("books"))
+	assert.False(t, db.Migrator().HasTable("api_keys"))
+	assert.False(t, db.Migrator().HasTable("book_tags"))
+	assert.False(t, db.Migrator().HasTable("book_ratings"))
+
+	// 戻した後は再び適用できる
+	applied, err := Up(db)
+	require.NoError(t, err)
+	assert.Equal(t, versions(All()), versions(applied))
+}
+
+func TestCheck_Pending(t *testing.T) {
+	err := Check(openSQLite(t))
+
+	assert.ErrorIs(t, err, ErrPending)
+	assert.Contains(t, err.Error(), "run migrate up")
+}
+
+func TestNewerSchema(t *testing.T) {
+	// 新しいビルドが適用したマイグレーションがあれば何もしない
+	db := openSQLite(t)
+	_, err := Up(db)
+	require.NoError(t, err)
+	newer := Latest() + 1
+	require.NoError(t, db.Create(&schemaMigration{Version: newer, Name: "from the future", AppliedAt: time.Now()}).Error)
+
+	_, err = Up(db)
+	assert.ErrorIs(t, err, ErrNewerSchema)
+	assert.ErrorIs(t, Check(db), ErrNewerSchema)
+	reverted, err := Down(db, 1)
+	assert.ErrorIs(t, err, ErrNewerSchema)
+	assert.Empty(t, reverted)
+	assert.True(t, db.Migrator().HasTable("books"))
+
+	states, err := Status(db)
+	require.NoError(t, err)
+	last := states[len(states)-1]
+	assert.Equal(t, newer, last.Version)
+	assert.Equal(t, "from the future", last.Name)
+	assert.True(t, last.Unknown)
+}
+
+func TestUpDown_Postgres(t *testing.T) {
+	db, err := gorm.Open(postgres.Open(pgtest.URL(t)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	_, err = Down(db, Latest())
+	require.NoError(t, err)
+
+	applied, err := Up(db)
+
+	require.NoError(t, err)
+	assert.Equal(t, versions(All()), versions(applied))
+	assert.True(t, db.Migrator().HasColumn("books", "search_vector"))
+	assert.True(t, db.Migrator().HasIndex("books", "idx_books_search_vector"))
+
+	reverted, err := Down(db, Latest())
+	require.NoError(t, err)
+	assert.Len(t, reverted, Latest())
+	assert.False(t, db.Migrator().HasTable("books"))
+
+	// 同時に起動したインスタンスは順番に移行し、各マイグレーションは一度だけ適用される
+	results := make(chan []Migration, 3)
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			applied, err := Up(db)
+			results <- applied
+			errs <- err
+		}()
+	}
+	total := 0
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-errs)
+		total += len(<-results)
+	}
+	assert.Equal(t, Latest(), total)
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey is a credential issued to a machine client. Only a hash of its secret is
+// stored; the key itself is shown once, when it is issued or rotated.
+type APIKey struct {
+	ID   uint   `gorm:"primaryKey;autoIncrement"`
+	Name string `gorm:"not null"`
+	// Prefix is the public part of the key, used to look it up
+	Prefix     string `gorm:"uniqueIndex;not null"`
+	SecretHash string `gorm:"not null"`
+	// Scopes is the space-separated list of granted scopes
+	Scopes     string `gorm:"not null"`
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	UsageCount int64 `gorm:"not null;default:0"`
+}
+
+// TableName specifies the table name for the APIKey model
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the granted scopes
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// Active reports whether the key may be used at now: it is neither revoked nor expired
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyDatabase interface for API key operations
+type APIKeyDatabase interface {
+	Create(key *APIKey) error
+	// List returns every key, revoked ones included, ordered by ID
+	List() ([]APIKey, error)
+	GetByID(id uint) (*APIKey, error)
+	GetByPrefix(prefix string) (*APIKey, error)
+	// Rotate replaces the prefix and secret hash of a key that has not been revoked and
+	// returns it as stored. Revoked keys fail with ErrAPIKeyRevoked.
+	Rotate(id uint, prefix, secretHash string) (*APIKey, error)
+	// Revoke marks a key as revoked at the given time and returns it. Revoking a revoked
+	// key keeps its original revocation time.
+	Revoke(id uint, at time.Time) (*APIKey, error)
+	// RecordUsage adds count uses of the key, the last of which at the given time
+	RecordUsage(id uint, count int64, at time.Time) error
+}
+
+// apiKeyRepository implements APIKeyDatabase
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *gorm.DB) APIKeyDatabase {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(key *APIKey) error {
+	return translateError(r.db, r.db.Create(key).Error)
+}
+
+func (r *apiKeyRepository) List() ([]APIKey, error) {
+	keys := []APIKey{}
+	err := r.db.Order("id").Find(&keys).Error
+	return keys, translateError(r.db, err)
+}
+
+func (r *apiKeyRepository) GetByID(id uint) (*APIKey, error) {
+	var key APIKey
+	if err := r.db.First(&key, id).Error; err != nil {
+		return nil, translateError(r.db, err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) GetByPrefix(prefix string) (*APIKey, error) {
+	var key APIKey
+	if err := r.db.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, translateError(r.db, err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) Rotate(id uint, prefix, secretHash string) (*APIKey, error) {
+	var key APIKey
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&key, id).Error; err != nil {
+			return err
+		}
+		if key.RevokedAt != nil {
+			return ErrAPIKeyRevoked
+		}
+
+		result := tx.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", id).
+			Updates(map[string]interface{}{"prefix": prefix, "secret_hash": secretHash})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAPIKeyRevoked
+		}
+
+		key = APIKey{}
+		return tx.First(&key, id).Error
+	})
+	if err != nil {
+		return nil, translateError(r.db, err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) Revoke(id uint, at time.Time) (*APIKey, error) {
+	var key APIKey
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", at).Error; err != nil {
+			return err
+		}
+		return tx.First(&key, id).Error
+	})
+	if err != nil {
+		return nil, translateError(r.db, err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) RecordUsage(id uint, count int64, at time.Time) error {
+	err := r.db.Model(&APIKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"usage_count":  gorm.Expr("usage_count + ?", count),
+		"last_used_at": at,
+	}).Error
+	return translateError(r.db, err)
+}
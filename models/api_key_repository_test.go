@@ -0,0 +1,150 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// APIKeyRepositoryTestSuite はAPIキーのリポジトリテストスイートを定義
+type APIKeyRepositoryTestSuite struct {
+	suite.Suite
+	db   *gorm.DB
+	repo APIKeyDatabase
+}
+
+func (suite *APIKeyRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		suite.T().Fatal("Failed to connect to test database:", err)
+	}
+	if err := db.AutoMigrate(&APIKey{}); err != nil {
+		suite.T().Fatal("Failed to migrate test database:", err)
+	}
+
+	suite.db = db
+	suite.repo = NewAPIKeyRepository(db)
+}
+
+func (suite *APIKeyRepositoryTestSuite) SetupTest() {
+	suite.db.Exec("DELETE FROM api_keys")
+}
+
+func (suite *APIKeyRepositoryTestSuite) createKey(prefix string) *APIKey {
+	key := &APIKey{Name: "Partner", Prefix: prefix, SecretHash: "hash-" + prefix, Scopes: "books:read recommend"}
+	suite.Require().NoError(suite.repo.Create(key))
+	return key
+}
+
+func (suite *APIKeyRepositoryTestSuite) TestCreateAndGet() {
+	key := suite.createKey("0123456789abcdef")
+
+	byID, err := suite.repo.GetByID(key.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []string{"books:read", "recommend"}, byID.ScopeList())
+	assert.False(suite.T(), byID.CreatedAt.IsZero())
+
+	byPrefix, err := suite.repo.GetByPrefix("0123456789abcdef")
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), key.ID, byPrefix.ID)
+
+	_, err = suite.repo.GetByPrefix("missing")
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+	_, err = suite.repo.GetByID(999)
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+}
+
+func (suite *APIKeyRepositoryTestSuite) TestCreate_DuplicatePrefix() {
+	suite.createKey("0123456789abcdef")
+
+	err := suite.repo.Create(&APIKey{Name: "Other", Prefix: "0123456789abcdef", SecretHash: "x", Scopes: "recommend"})
+
+	assert.ErrorIs(suite.T(), err, ErrConflict)
+}
+
+func (suite *APIKeyRepositoryTestSuite) TestList() {
+	first := suite.createKey("aaaaaaaaaaaaaaaa")
+	second := suite.createKey("bbbbbbbbbbbbbbbb")
+
+	keys, err := suite.repo.List()
+
+	suite.Require().NoError(err)
+	suite.Require().Len(keys, 2)
+	assert.Equal(suite.T(), first.ID, keys[0].ID)
+	assert.Equal(suite.T(), second.ID, keys[1].ID)
+}
+
+func (suite *APIKeyRepositoryTestSuite) TestRotate() {
+	key := suite.createKey("0123456789abcdef")
+
+	rotated, err := suite.repo.Rotate(key.ID, "fedcba9876543210", "new-hash")
+
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), "fedcba9876543210", rotated.Prefix)
+	assert.Equal(suite.T(), "new-hash", rotated.SecretHash)
+	assert.Equal(suite.T(), key.Scopes, rotated.Scopes)
+	_, err = suite.repo.GetByPrefix("0123456789abcdef")
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+
+	_, err = suite.repo.Rotate(999, "x", "y")
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+}
+
+func (suite *APIKeyRepositoryTestSuite) TestRevoke() {
+	key := suite.createKey("0123456789abcdef")
+	revokedAt := time.Date(2026, time.October, 1, 9, 0, 0, 0, time.UTC)
+
+	revoked, err := suite.repo.Revoke(key.ID, revokedAt)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(revoked.RevokedAt)
+	assert.True(suite.T(), revoked.RevokedAt.Equal(revokedAt))
+	assert.False(suite.T(), revoked.Active(time.Now()))
+
+	// 再度失効させても最初の失効日時を保つ
+	again, err := suite.repo.Revoke(key.ID, revokedAt.Add(time.Hour))
+	suite.Require().NoError(err)
+	assert.True(suite.T(), again.RevokedAt.Equal(revokedAt))
+
+	// 失効したキーはローテーションできない
+	_, err = suite.repo.Rotate(key.ID, "fedcba9876543210", "new-hash")
+	assert.ErrorIs(suite.T(), err, ErrAPIKeyRevoked)
+	assert.ErrorIs(suite.T(), err, ErrConflict)
+
+	_, err = suite.repo.Revoke(999, revokedAt)
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+}
+
+func (suite *APIKeyRepositoryTestSuite) TestRecordUsage() {
+	key := suite.createKey("0123456789abcdef")
+	usedAt := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	suite.Require().NoError(suite.repo.RecordUsage(key.ID, 1, usedAt.Add(-time.Hour)))
+	suite.Require().NoError(suite.repo.RecordUsage(key.ID, 3, usedAt))
+
+	used, err := suite.repo.GetByID(key.ID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(4), used.UsageCount)
+	suite.Require().NotNil(used.LastUsedAt)
+	assert.True(suite.T(), used.LastUsedAt.Equal(usedAt))
+}
+
+func TestAPIKey_Active(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.True(t, (&APIKey{}).Active(now))
+	assert.True(t, (&APIKey{ExpiresAt: &future}).Active(now))
+	assert.False(t, (&APIKey{ExpiresAt: &past}).Active(now))
+	assert.False(t, (&APIKey{RevokedAt: &past}).Active(now))
+}
+
+func TestAPIKeyRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(APIKeyRepositoryTestSuite))
+}
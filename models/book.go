@@ -1,6 +1,16 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"database/sql"
+	"strings"
+
+	"recomemento-api-go/matchkey"
+
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is the number of rows Each reads from the database at a time
+const exportBatchSize = 500
 
 // Book represents the book model
 type Book struct {
@@ -10,6 +20,11 @@ type Book struct {
 	Genre       string `json:"genre" gorm:"not null" binding:"required"`
 	Purpose     string `json:"purpose" gorm:"not null" binding:"required"`
 	Description string `json:"description" gorm:"not null" binding:"required"`
+	ISBN        string `json:"isbn" gorm:"column:isbn;index;not null;default:''"`
+	Version     uint   `json:"version" gorm:"not null;default:1"`
+	// MatchKey is the matchkey.Book of the title and author, kept up to date by the
+	// repository so that duplicates can be looked up by index
+	MatchKey string `json:"-" gorm:"column:match_key;index;not null;default:''"`
 }
 
 // TableName specifies the table name for the Book model
@@ -17,14 +32,98 @@ func (Book) TableName() string {
 	return "books"
 }
 
+// BeforeCreate sets the match key of a new book
+func (b *Book) BeforeCreate(tx *gorm.DB) error {
+	b.MatchKey = matchkey.Book(b.Title, b.Author)
+	return nil
+}
+
+// BookFilter restricts the books returned by Find and Each. Empty fields match every
+// book; genre and purpose must match exactly and author matches case-insensitively as a
+// substring. Authors matches books whose author is exactly one of the names.
+type BookFilter struct {
+	Genre   string
+	Purpose string
+	Author  string
+	Authors []string
+}
+
+// scope applies the filter to a query
+func (f BookFilter) scope(db *gorm.DB) *gorm.DB {
+	if f.Genre != "" {
+		db = db.Where("genre = ?", f.Genre)
+	}
+	if f.Purpose != "" {
+		db = db.Where("purpose = ?", f.Purpose)
+	}
+	if f.Author != "" {
+		db = db.Where("LOWER(author) LIKE ? ESCAPE '!'", "%"+escapeLike(strings.ToLower(f.Author))+"%")
+	}
+	if len(f.Authors) > 0 {
+		db = db.Where("author IN ?", f.Authors)
+	}
+	return db
+}
+
+// escapeLike escapes the LIKE wildcards in s with '!'. A backslash would have to be
+// written differently in MySQL, which treats it as an escape in string literals.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// prefixQuery quotes term as a tsquery matching the words starting with it. PostgreSQL
+// splits the quoted term into words itself, so "sci-fi" or "example.com" are matched as
+// they were indexed, and a term without any word matches nothing.
+func prefixQuery(term string) string {
+	return "'" + strings.NewReplacer("\\", "\\\\", "'", "''").Replace(term) + "':*"
+}
+
+// isPostgres reports whether db is a PostgreSQL connection
+func isPostgres(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
+
 // BookDatabase interface for book operations
 type BookDatabase interface {
 	Create(book *Book) error
 	GetAll() ([]Book, error)
+	// Find returns the books matching filter ordered by ID
+	Find(filter BookFilter) ([]Book, error)
+	// Search returns the books whose title, author, genre or description contain every
+	// whitespace-separated term of query, ignoring case, ordered by ID. A blank query
+	// matches nothing. On PostgreSQL the search is a full-text search: a term matches
+	// the words of the fields that start with it rather than any substring.
+	Search(query string) ([]Book, error)
+	// Each calls fn for every book matching filter in ID order, reading the table in
+	// batches so that the result set is never held in memory as a whole. Iteration stops
+	// at the first error returned by fn, which Each returns unchanged.
+	Each(filter BookFilter, fn func(book *Book) error) error
 	GetByID(id uint) (*Book, error)
 	Update(id uint, updates map[string]interface{}) (*Book, error)
 	Delete(id uint) (*Book, error)
+	UpdateIfVersion(id uint, version uint, updates map[string]interface{}) (*Book, error)
+	DeleteIfVersion(id uint, version uint) (*Book, error)
 	FindByGenreAndPurpose(genre, purpose string) (*Book, error)
+	// CountByAuthor returns how many books each of authors has. Authors without books
+	// are missing from the result.
+	CountByAuthor(authors []string) (map[string]int64, error)
+	// FindDuplicates returns the books whose ISBN is one of isbns or whose MatchKey is
+	// one of matchKeys, ordered by ID
+	FindDuplicates(isbns, matchKeys []string) ([]Book, error)
+	// SetTags replaces the tags of a book
+	SetTags(bookID uint, tags []string) error
+	// FindTags returns the tags of each of the books in name order. Books without tags
+	// are missing from the result.
+	FindTags(bookIDs []uint) (map[uint][]string, error)
+	// Rate records the score rater gives a book, replacing the earlier rating of rater.
+	// rater must not be empty.
+	Rate(bookID uint, rater string, score int) error
+	// SummarizeRatings returns the rating summary of each of the books. Books without
+	// ratings are missing from the result.
+	SummarizeRatings(bookIDs []uint) (map[uint]RatingSummary, error)
+	// Transaction runs fn with a repository bound to a single database transaction.
+	// The transaction is committed when fn returns nil and rolled back otherwise.
+	Transaction(fn func(repo BookDatabase) error) error
 }
 
 // bookRepository implements BookDatabase
@@ -38,59 +137,212 @@ func NewBookRepository(db *gorm.DB) BookDatabase {
 }
 
 func (r *bookRepository) Create(book *Book) error {
-	return r.db.Create(book).Error
+	return translateError(r.db, r.db.Create(book).Error)
 }
 
 func (r *bookRepository) GetAll() ([]Book, error) {
 	var books []Book
 	err := r.db.Find(&books).Error
-	return books, err
+	return books, translateError(r.db, err)
+}
+
+func (r *bookRepository) Find(filter BookFilter) ([]Book, error) {
+	var books []Book
+	err := r.db.Scopes(filter.scope).Order("id").Find(&books).Error
+	return books, translateError(r.db, err)
+}
+
+func (r *bookRepository) Search(query string) ([]Book, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	books := []Book{}
+	if len(terms) == 0 {
+		return books, nil
+	}
+
+	db := r.db
+	for _, term := range terms {
+		if isPostgres(r.db) {
+			// Matched on the indexed search_vector added by the migrations
+			db = db.Where("search_vector @@ to_tsquery('simple', ?)", prefixQuery(term))
+			continue
+		}
+		pattern := "%" + escapeLike(term) + "%"
+		db = db.Where("(LOWER(title) LIKE @p ESCAPE '!' OR LOWER(author) LIKE @p ESCAPE '!' OR "+
+			"LOWER(genre) LIKE @p ESCAPE '!' OR LOWER(description) LIKE @p ESCAPE '!')", sql.Named("p", pattern))
+	}
+	err := db.Order("id").Find(&books).Error
+	return books, translateError(r.db, err)
+}
+
+func (r *bookRepository) Each(filter BookFilter, fn func(book *Book) error) error {
+	var fnErr error
+	var batch []Book
+	err := r.db.Scopes(filter.scope).FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if fnErr = fn(&batch[i]); fnErr != nil {
+				return fnErr
+			}
+		}
+		return nil
+	}).Error
+	if fnErr != nil {
+		return fnErr
+	}
+	return translateError(r.db, err)
 }
 
 func (r *bookRepository) GetByID(id uint) (*Book, error) {
 	var book Book
 	err := r.db.First(&book, id).Error
 	if err != nil {
-		return nil, err
+		return nil, translateError(r.db, err)
 	}
 	return &book, nil
 }
 
 func (r *bookRepository) Update(id uint, updates map[string]interface{}) (*Book, error) {
+	return r.update(id, nil, updates)
+}
+
+func (r *bookRepository) Delete(id uint) (*Book, error) {
+	return r.delete(id, nil)
+}
+
+func (r *bookRepository) UpdateIfVersion(id uint, version uint, updates map[string]interface{}) (*Book, error) {
+	return r.update(id, &version, updates)
+}
+
+func (r *bookRepository) DeleteIfVersion(id uint, version uint) (*Book, error) {
+	return r.delete(id, &version)
+}
+
+// update applies the updates, bumps the version and returns the row as stored after the
+// write. A nil version skips the precondition check, while any other version, zero
+// included, must be the current one; the write itself is always guarded by the version
+// that was read inside the transaction.
+func (r *bookRepository) update(id uint, version *uint, updates map[string]interface{}) (*Book, error) {
 	var book Book
-	err := r.db.First(&book, id).Error
-	if err != nil {
-		return nil, err
-	}
-	
-	err = r.db.Model(&book).Updates(updates).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&book, id).Error; err != nil {
+			return err
+		}
+		if version != nil && book.Version != *version {
+			return ErrVersionMismatch
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		values := make(map[string]interface{}, len(updates)+1)
+		for column, value := range updates {
+			values[column] = value
+		}
+		values["version"] = gorm.Expr("version + 1")
+		title, author := book.Title, book.Author
+		if value, ok := updates["title"].(string); ok {
+			title = value
+		}
+		if value, ok := updates["author"].(string); ok {
+			author = value
+		}
+		values["match_key"] = matchkey.Book(title, author)
+
+		result := tx.Model(&Book{}).Where("id = ? AND version = ?", id, book.Version).Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		book = Book{}
+		return tx.First(&book, id).Error
+	})
 	if err != nil {
-		return nil, err
+		return nil, translateError(r.db, err)
 	}
-	
+
 	return &book, nil
 }
 
-func (r *bookRepository) Delete(id uint) (*Book, error) {
+// delete removes the book with its tags and ratings and returns it as it was before
+// deletion. Like update, it checks version unless it is nil.
+func (r *bookRepository) delete(id uint, version *uint) (*Book, error) {
 	var book Book
-	err := r.db.First(&book, id).Error
-	if err != nil {
-		return nil, err
-	}
-	
-	err = r.db.Delete(&book).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&book, id).Error; err != nil {
+			return err
+		}
+		if version != nil && book.Version != *version {
+			return ErrVersionMismatch
+		}
+
+		result := tx.Where("version = ?", book.Version).Delete(&book)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+		if err := tx.Where("book_id = ?", id).Delete(&BookTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("book_id = ?", id).Delete(&BookRating{}).Error
+	})
 	if err != nil {
-		return nil, err
+		return nil, translateError(r.db, err)
 	}
-	
+
 	return &book, nil
 }
 
+func (r *bookRepository) Transaction(fn func(repo BookDatabase) error) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&bookRepository{db: tx})
+	})
+	return translateError(r.db, err)
+}
+
 func (r *bookRepository) FindByGenreAndPurpose(genre, purpose string) (*Book, error) {
 	var book Book
 	err := r.db.Where("genre = ? AND purpose = ?", genre, purpose).First(&book).Error
 	if err != nil {
-		return nil, err
+		return nil, translateError(r.db, err)
 	}
 	return &book, nil
-} 
\ No newline at end of file
+}
+
+func (r *bookRepository) CountByAuthor(authors []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(authors))
+	if len(authors) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		Author string
+		Count  int64
+	}
+	err := r.db.Model(&Book{}).
+		Select("author, COUNT(*) AS count").
+		Where("author IN ?", authors).
+		Group("author").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, translateError(r.db, err)
+	}
+	for _, row := range rows {
+		counts[row.Author] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *bookRepository) FindDuplicates(isbns, matchKeys []string) ([]Book, error) {
+	books := []Book{}
+	if len(isbns) == 0 && len(matchKeys) == 0 {
+		return books, nil
+	}
+
+	// An empty list is rendered as IN (NULL), which matches nothing
+	err := r.db.Where("isbn IN ?", isbns).Or("match_key IN ?", matchKeys).Order("id").Find(&books).Error
+	return books, translateError(r.db, err)
+}
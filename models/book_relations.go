@@ -0,0 +1,121 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BookTag is a tag attached to a book
+type BookTag struct {
+	BookID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Name   string `gorm:"primaryKey"`
+}
+
+// TableName specifies the table name for the BookTag model
+func (BookTag) TableName() string {
+	return "book_tags"
+}
+
+// BookRating is the score a rater gave a book; each rater has one rating per book
+type BookRating struct {
+	BookID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Rater     string `gorm:"primaryKey"`
+	Score     int    `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// TableName specifies the table name for the BookRating model
+func (BookRating) TableName() string {
+	return "book_ratings"
+}
+
+// RatingSummary aggregates the ratings of a book
+type RatingSummary struct {
+	// Count is the number of ratings
+	Count int64
+	// Average is the mean score, or zero without ratings
+	Average float64
+}
+
+func (r *bookRepository) SetTags(bookID uint, tags []string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&Book{}, bookID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("book_id = ?", bookID).Delete(&BookTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+
+		rows := make([]BookTag, len(tags))
+		for i, tag := range tags {
+			rows[i] = BookTag{BookID: bookID, Name: tag}
+		}
+		return tx.Create(&rows).Error
+	})
+	return translateError(r.db, err)
+}
+
+func (r *bookRepository) FindTags(bookIDs []uint) (map[uint][]string, error) {
+	tags := make(map[uint][]string, len(bookIDs))
+	if len(bookIDs) == 0 {
+		return tags, nil
+	}
+
+	var rows []BookTag
+	err := r.db.Where("book_id IN ?", bookIDs).Order("book_id, name").Find(&rows).Error
+	if err != nil {
+		return nil, translateError(r.db, err)
+	}
+	for _, row := range rows {
+		tags[row.BookID] = append(tags[row.BookID], row.Name)
+	}
+	return tags, nil
+}
+
+func (r *bookRepository) Rate(bookID uint, rater string, score int) error {
+	// Anonymous callers would all share a single rating
+	if rater == "" {
+		return fmt.Errorf("%w: rating without a rater", ErrValidation)
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&Book{}, bookID).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "book_id"}, {Name: "rater"}},
+			DoUpdates: clause.AssignmentColumns([]string{"score", "updated_at"}),
+		}).Create(&BookRating{BookID: bookID, Rater: rater, Score: score}).Error
+	})
+	return translateError(r.db, err)
+}
+
+func (r *bookRepository) SummarizeRatings(bookIDs []uint) (map[uint]RatingSummary, error) {
+	summaries := make(map[uint]RatingSummary, len(bookIDs))
+	if len(bookIDs) == 0 {
+		return summaries, nil
+	}
+
+	var rows []struct {
+		BookID  uint
+		Count   int64
+		Average float64
+	}
+	err := r.db.Model(&BookRating{}).
+		Select("book_id, COUNT(*) AS count, AVG(score) AS average").
+		Where("book_id IN ?", bookIDs).
+		Group("book_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, translateError(r.db, err)
+	}
+	for _, row := range rows {
+		summaries[row.BookID] = RatingSummary{Count: row.Count, Average: row.Average}
+	}
+	return summaries, nil
+}
@@ -1,11 +1,19 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"recomemento-api-go/matchkey"
+	"recomemento-api-go/migrations"
+	"recomemento-api-go/testutil/pgtest"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -16,12 +24,18 @@ type BookRepositoryTestSuite struct {
 	suite.Suite
 	db   *gorm.DB
 	repo BookDatabase
+	// postgresURL は空でなければSQLiteの代わりに使うPostgreSQLのURL
+	postgresURL string
 }
 
 // SetupSuite はテストスイート開始時に実行される
 func (suite *BookRepositoryTestSuite) SetupSuite() {
 	// テスト用のインメモリSQLiteデータベースを作成
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+	dialector := sqlite.Open(":memory:")
+	if suite.postgresURL != "" {
+		dialector = postgres.Open(suite.postgresURL)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	
@@ -30,7 +44,7 @@ func (suite *BookRepositoryTestSuite) SetupSuite() {
 	}
 
 	// マイグレーション実行
-	err = db.AutoMigrate(&Book{})
+	_, err = migrations.Up(db)
 	if err != nil {
 		suite.T().Fatal("Failed to migrate test database:", err)
 	}
@@ -43,6 +57,8 @@ func (suite *BookRepositoryTestSuite) SetupSuite() {
 func (suite *BookRepositoryTestSuite) SetupTest() {
 	// 各テスト前にテーブルをクリア
 	suite.db.Exec("DELETE FROM books")
+	suite.db.Exec("DELETE FROM book_tags")
+	suite.db.Exec("DELETE FROM book_ratings")
 }
 
 // ========== Create Tests ==========
@@ -151,7 +167,7 @@ func (suite *BookRepositoryTestSuite) TestGetByID_NotFound() {
 	result, err := suite.repo.GetByID(999)
 
 	// Assert
-	assert.Error(suite.T(), err)
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
 	assert.Nil(suite.T(), result)
 }
 
@@ -226,6 +242,190 @@ func (suite *BookRepositoryTestSuite) TestGetAll_LargeDataset() {
 	assert.Len(suite.T(), result, booksCount)
 }
 
+// ========== Find / Each Tests ==========
+
+func (suite *BookRepositoryTestSuite) TestFind_Filters() {
+	// Arrange
+	books := []Book{
+		{Title: "Book 1", Author: "John Smith", Genre: "Fiction", Purpose: "Entertainment", Description: "Description 1"},
+		{Title: "Book 2", Author: "Jane SMITHSON", Genre: "Fiction", Purpose: "Learning", Description: "Description 2"},
+		{Title: "Book 3", Author: "Smith", Genre: "Technology", Purpose: "Learning", Description: "Description 3"},
+		{Title: "Book 4", Author: "100%_Author", Genre: "Fiction", Purpose: "Learning", Description: "Description 4"},
+	}
+	for _, book := range books {
+		suite.db.Create(&book)
+	}
+
+	cases := []struct {
+		name   string
+		filter BookFilter
+		titles []string
+	}{
+		{"フィルタなし", BookFilter{}, []string{"Book 1", "Book 2", "Book 3", "Book 4"}},
+		{"ジャンル", BookFilter{Genre: "Fiction"}, []string{"Book 1", "Book 2", "Book 4"}},
+		{"ジャンルと目的", BookFilter{Genre: "Fiction", Purpose: "Learning"}, []string{"Book 2", "Book 4"}},
+		{"著者は大文字小文字を区別しない部分一致", BookFilter{Author: "smith"}, []string{"Book 1", "Book 2", "Book 3"}},
+		{"著者のワイルドカードはエスケープされる", BookFilter{Author: "0%_a"}, []string{"Book 4"}},
+		{"著者の % は任意の文字列に一致しない", BookFilter{Author: "%"}, []string{"Book 4"}},
+		{"著者の完全一致のいずれか", BookFilter{Authors: []string{"Smith", "100%_Author"}}, []string{"Book 3", "Book 4"}},
+		{"一致なし", BookFilter{Genre: "Unknown"}, []string{}},
+	}
+	for _, tc := range cases {
+		suite.Run(tc.name, func() {
+			// Act
+			result, err := suite.repo.Find(tc.filter)
+
+			// Assert
+			assert.NoError(suite.T(), err)
+			titles := []string{}
+			for _, book := range result {
+				titles = append(titles, book.Title)
+			}
+			assert.Equal(suite.T(), tc.titles, titles)
+		})
+	}
+}
+
+func (suite *BookRepositoryTestSuite) TestSearch() {
+	// Arrange
+	books := []Book{
+		{Title: "Go Programming", Author: "John Smith", Genre: "Technology", Purpose: "Learning", Description: "Concurrency in practice"},
+		{Title: "Cooking Basics", Author: "Jane Doe", Genre: "Lifestyle", Purpose: "Learning", Description: "Recipes for beginners"},
+		{Title: "Discount 50%", Author: "Sale_Writer", Genre: "Business", Purpose: "Learning", Description: "Pricing"},
+		{Title: "Yahoo!", Author: `Back\Slash`, Genre: "Humor", Purpose: "Entertainment", Description: "Shouting"},
+	}
+	for _, book := range books {
+		suite.db.Create(&book)
+	}
+
+	cases := []struct {
+		name   string
+		query  string
+		titles []string
+	}{
+		{"タイトルは大文字小文字を区別しない", "go", []string{"Go Programming"}},
+		{"説明文に一致", "recipes", []string{"Cooking Basics"}},
+		{"ジャンルに一致", "lifestyle", []string{"Cooking Basics"}},
+		{"すべての語に一致する本のみ", "smith concurrency", []string{"Go Programming"}},
+		{"一部の語しか一致しない本は含まない", "smith recipes", []string{}},
+		{"ワイルドカードはエスケープされる", "50%", []string{"Discount 50%"}},
+		{"_ は任意の1文字に一致しない", "e_w", []string{"Discount 50%"}},
+		{"エスケープ文字の ! もそのまま一致", "o!", []string{"Yahoo!"}},
+		{"バックスラッシュもそのまま一致", `k\s`, []string{"Yahoo!"}},
+		{"空のクエリは何にも一致しない", "   ", []string{}},
+		{"語の先頭に一致", "progr concurr", []string{"Go Programming"}},
+		{"語を含まない語は何にも一致しない", "%%", []string{}},
+	}
+	for _, tc := range cases {
+		suite.Run(tc.name, func() {
+			if (tc.query == "e_w" || tc.query == "o!" || tc.query == `k\s`) && suite.postgresURL != "" {
+				suite.T().Skip("PostgreSQLは全文検索のため部分文字列には一致しない")
+			}
+
+			// Act
+			result, err := suite.repo.Search(tc.query)
+
+			// Assert
+			assert.NoError(suite.T(), err)
+			titles := []string{}
+			for _, book := range result {
+				titles = append(titles, book.Title)
+			}
+			assert.Equal(suite.T(), tc.titles, titles)
+		})
+	}
+}
+
+func (suite *BookRepositoryTestSuite) TestSearch_FullText() {
+	if suite.postgresURL == "" {
+		suite.T().Skip("全文検索はPostgreSQLのみ")
+	}
+
+	// Arrange
+	books := []Book{
+		{Title: "Go Programming", Author: "John O'Brien", Genre: "Technology", Purpose: "Learning", Description: "Concurrency in practice"},
+		{Title: "Space Opera", Author: "Jane Doe", Genre: "Sci-Fi", Purpose: "Entertainment", Description: "Fleets at war"},
+	}
+	for _, book := range books {
+		suite.db.Create(&book)
+	}
+
+	cases := []struct {
+		name   string
+		query  string
+		titles []string
+	}{
+		{"語の途中には一致しない", "gramming", []string{}},
+		{"ハイフンでつながった語", "sci-fi", []string{"Space Opera"}},
+		{"ハイフンでつながった語の一部", "fi", []string{"Space Opera"}},
+		{"引用符を含む語", "o'brien", []string{"Go Programming"}},
+		{"バックスラッシュ", `war\`, []string{"Space Opera"}},
+	}
+	for _, tc := range cases {
+		suite.Run(tc.name, func() {
+			// Act
+			result, err := suite.repo.Search(tc.query)
+
+			// Assert
+			assert.NoError(suite.T(), err)
+			titles := []string{}
+			for _, book := range result {
+				titles = append(titles, book.Title)
+			}
+			assert.Equal(suite.T(), tc.titles, titles)
+		})
+	}
+}
+
+func (suite *BookRepositoryTestSuite) TestEach_VisitsEveryBookAcrossBatches() {
+	// Arrange - バッチサイズを超える件数を挿入
+	booksCount := exportBatchSize*2 + 1
+	books := make([]Book, booksCount)
+	for i := range books {
+		books[i] = Book{
+			Title:       fmt.Sprintf("Book %d", i+1),
+			Author:      "Author",
+			Genre:       "Fiction",
+			Purpose:     "Entertainment",
+			Description: "Description",
+		}
+	}
+	suite.db.CreateInBatches(books, 200)
+
+	// Act
+	var ids []uint
+	err := suite.repo.Each(BookFilter{Genre: "Fiction"}, func(book *Book) error {
+		ids = append(ids, book.ID)
+		return nil
+	})
+
+	// Assert - ID順に全件を1回ずつ渡す
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), ids, booksCount)
+	for i := 1; i < len(ids); i++ {
+		assert.Less(suite.T(), ids[i-1], ids[i])
+	}
+}
+
+func (suite *BookRepositoryTestSuite) TestEach_StopsOnCallbackError() {
+	// Arrange
+	for i := 1; i <= 3; i++ {
+		suite.db.Create(&Book{Title: fmt.Sprintf("Book %d", i), Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"})
+	}
+	stop := errors.New("client went away")
+
+	// Act
+	visited := 0
+	err := suite.repo.Each(BookFilter{}, func(book *Book) error {
+		visited++
+		return stop
+	})
+
+	// Assert - コールバックのエラーはそのまま返す
+	assert.Same(suite.T(), stop, err)
+	assert.Equal(suite.T(), 1, visited)
+}
+
 // ========== Update Tests ==========
 
 func (suite *BookRepositoryTestSuite) TestUpdate_Success() {
@@ -297,7 +497,7 @@ func (suite *BookRepositoryTestSuite) TestUpdate_NotFound() {
 	result, err := suite.repo.Update(999, updates)
 
 	// Assert
-	assert.Error(suite.T(), err)
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
 	assert.Nil(suite.T(), result)
 }
 
@@ -325,6 +525,126 @@ func (suite *BookRepositoryTestSuite) TestUpdate_EmptyUpdates() {
 	assert.Equal(suite.T(), book.Author, result.Author)
 }
 
+func (suite *BookRepositoryTestSuite) TestUpdate_IncrementsVersion() {
+	// Arrange
+	book := Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	suite.db.Create(&book)
+	assert.Equal(suite.T(), uint(1), book.Version)
+
+	// Act
+	result, err := suite.repo.Update(book.ID, map[string]interface{}{"title": "New Title"})
+
+	// Assert
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), uint(2), result.Version)
+
+	var fromDB Book
+	suite.db.First(&fromDB, book.ID)
+	assert.Equal(suite.T(), uint(2), fromDB.Version)
+}
+
+func (suite *BookRepositoryTestSuite) TestUpdateIfVersion_StaleVersion() {
+	// Arrange - 2つのタブが同じバージョンを読み込んだ状態
+	book := Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	suite.db.Create(&book)
+
+	_, err := suite.repo.UpdateIfVersion(book.ID, 1, map[string]interface{}{"title": "First Tab"})
+	assert.NoError(suite.T(), err)
+
+	// Act - 古いバージョンで更新を試みる
+	result, err := suite.repo.UpdateIfVersion(book.ID, 1, map[string]interface{}{"title": "Second Tab"})
+
+	// Assert
+	assert.ErrorIs(suite.T(), err, ErrVersionMismatch)
+	assert.Nil(suite.T(), result)
+
+	var fromDB Book
+	suite.db.First(&fromDB, book.ID)
+	assert.Equal(suite.T(), "First Tab", fromDB.Title)
+}
+
+func (suite *BookRepositoryTestSuite) TestUpdate_ReturnsStoredRow() {
+	// Arrange
+	book := Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	suite.db.Create(&book)
+
+	// Act
+	result, err := suite.repo.Update(book.ID, map[string]interface{}{"genre": "Classic"})
+
+	// Assert - 返り値は更新後にDBから読み直した行と一致する
+	assert.NoError(suite.T(), err)
+
+	var fromDB Book
+	suite.db.First(&fromDB, book.ID)
+	assert.Equal(suite.T(), fromDB, *result)
+}
+
+func (suite *BookRepositoryTestSuite) TestCreate_DuplicateKey() {
+	// Arrange
+	book := &Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	assert.NoError(suite.T(), suite.repo.Create(book))
+
+	// Act - 同じ主キーで作成
+	duplicate := &Book{ID: book.ID, Title: "Other", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	err := suite.repo.Create(duplicate)
+
+	// Assert
+	assert.ErrorIs(suite.T(), err, ErrConflict)
+}
+
+func (suite *BookRepositoryTestSuite) TestVersionMismatch_IsConflict() {
+	assert.ErrorIs(suite.T(), ErrVersionMismatch, ErrConflict)
+}
+
+func (suite *BookRepositoryTestSuite) TestTransaction_Commit() {
+	// Act
+	err := suite.repo.Transaction(func(repo BookDatabase) error {
+		book := &Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+		if err := repo.Create(book); err != nil {
+			return err
+		}
+		_, err := repo.Update(book.ID, map[string]interface{}{"title": "Updated"})
+		return err
+	})
+
+	// Assert
+	assert.NoError(suite.T(), err)
+
+	var books []Book
+	suite.db.Find(&books)
+	assert.Len(suite.T(), books, 1)
+	assert.Equal(suite.T(), "Updated", books[0].Title)
+	assert.Equal(suite.T(), uint(2), books[0].Version)
+}
+
+func (suite *BookRepositoryTestSuite) TestTransaction_RollbackOnError() {
+	// Arrange
+	existing := Book{Title: "Existing", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	suite.db.Create(&existing)
+
+	// Act - 作成・更新の後に失敗した場合は全て取り消される
+	err := suite.repo.Transaction(func(repo BookDatabase) error {
+		book := &Book{Title: "New", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+		if err := repo.Create(book); err != nil {
+			return err
+		}
+		if _, err := repo.Update(existing.ID, map[string]interface{}{"title": "Changed"}); err != nil {
+			return err
+		}
+		_, err := repo.Delete(9999)
+		return err
+	})
+
+	// Assert
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+
+	var books []Book
+	suite.db.Find(&books)
+	assert.Len(suite.T(), books, 1)
+	assert.Equal(suite.T(), "Existing", books[0].Title)
+	assert.Equal(suite.T(), uint(1), books[0].Version)
+}
+
 // ========== Delete Tests ==========
 
 func (suite *BookRepositoryTestSuite) TestDelete_Success() {
@@ -357,7 +677,7 @@ func (suite *BookRepositoryTestSuite) TestDelete_NotFound() {
 	result, err := suite.repo.Delete(999)
 
 	// Assert
-	assert.Error(suite.T(), err)
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
 	assert.Nil(suite.T(), result)
 }
 
@@ -386,6 +706,44 @@ func (suite *BookRepositoryTestSuite) TestDelete_MultipleAndRetrieve() {
 	assert.Len(suite.T(), allBooks, 2)
 }
 
+func (suite *BookRepositoryTestSuite) TestDeleteIfVersion_StaleVersion() {
+	// Arrange
+	book := Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	suite.db.Create(&book)
+	suite.repo.Update(book.ID, map[string]interface{}{"title": "Changed"})
+
+	// Act
+	result, err := suite.repo.DeleteIfVersion(book.ID, 1)
+
+	// Assert
+	assert.ErrorIs(suite.T(), err, ErrVersionMismatch)
+	assert.Nil(suite.T(), result)
+
+	var count int64
+	suite.db.Model(&Book{}).Count(&count)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func (suite *BookRepositoryTestSuite) TestIfVersion_ZeroVersionIsChecked() {
+	// Arrange
+	book := Book{Title: "Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	suite.db.Create(&book)
+
+	// Act - バージョン0の条件付き書き込みも無条件にはならない
+	updated, updateErr := suite.repo.UpdateIfVersion(book.ID, 0, map[string]interface{}{"title": "Changed"})
+	deleted, deleteErr := suite.repo.DeleteIfVersion(book.ID, 0)
+
+	// Assert
+	assert.ErrorIs(suite.T(), updateErr, ErrVersionMismatch)
+	assert.Nil(suite.T(), updated)
+	assert.ErrorIs(suite.T(), deleteErr, ErrVersionMismatch)
+	assert.Nil(suite.T(), deleted)
+
+	var fromDB Book
+	suite.Require().NoError(suite.db.First(&fromDB, book.ID).Error)
+	assert.Equal(suite.T(), "Title", fromDB.Title)
+}
+
 // ========== FindByGenreAndPurpose Tests ==========
 
 func (suite *BookRepositoryTestSuite) TestFindByGenreAndPurpose_Success() {
@@ -425,7 +783,7 @@ func (suite *BookRepositoryTestSuite) TestFindByGenreAndPurpose_NotFound() {
 	result, err := suite.repo.FindByGenreAndPurpose("NonExistent", "Purpose")
 
 	// Assert
-	assert.Error(suite.T(), err)
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
 	assert.Nil(suite.T(), result)
 }
 
@@ -470,6 +828,179 @@ func (suite *BookRepositoryTestSuite) TestFindByGenreAndPurpose_MultipleMatches(
 
 // ========== Edge Cases ==========
 
+func (suite *BookRepositoryTestSuite) TestCountByAuthor() {
+	// Arrange
+	books := []Book{
+		{Title: "Book 1", Author: "John Smith", Genre: "Fiction", Purpose: "Entertainment", Description: "Description 1"},
+		{Title: "Book 2", Author: "John Smith", Genre: "Fiction", Purpose: "Learning", Description: "Description 2"},
+		{Title: "Book 3", Author: "Jane Doe", Genre: "Technology", Purpose: "Learning", Description: "Description 3"},
+	}
+	for _, book := range books {
+		suite.db.Create(&book)
+	}
+
+	// Act
+	counts, err := suite.repo.CountByAuthor([]string{"John Smith", "Jane Doe", "Nobody"})
+
+	// Assert - 本のない著者は結果に含まれない
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]int64{"John Smith": 2, "Jane Doe": 1}, counts)
+}
+
+func (suite *BookRepositoryTestSuite) TestCountByAuthor_NoAuthors() {
+	// Act
+	counts, err := suite.repo.CountByAuthor(nil)
+
+	// Assert
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), counts)
+}
+
+func (suite *BookRepositoryTestSuite) TestFindDuplicates() {
+	// Arrange
+	books := []Book{
+		{Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", Genre: "Fiction", Purpose: "Entertainment", Description: "Description 1", ISBN: "9780743273565"},
+		{Title: "Clean Code", Author: "Robert C. Martin", Genre: "Technology", Purpose: "Learning", Description: "Description 2"},
+		{Title: "Dune", Author: "Frank Herbert", Genre: "Fiction", Purpose: "Entertainment", Description: "Description 3"},
+	}
+	for i := range books {
+		suite.Require().NoError(suite.db.Create(&books[i]).Error)
+	}
+
+	// Act - ISBNと正規化した書名・著者のどちらかが一致する本を返す
+	found, err := suite.repo.FindDuplicates(
+		[]string{"9780743273565", "9780000000002"},
+		[]string{matchkey.Book("clean code", "Robert C Martin")},
+	)
+
+	// Assert
+	suite.Require().NoError(err)
+	suite.Require().Len(found, 2)
+	assert.Equal(suite.T(), books[0].ID, found[0].ID)
+	assert.Equal(suite.T(), books[1].ID, found[1].ID)
+
+	// 条件がなければ何も返さない
+	found, err = suite.repo.FindDuplicates(nil, nil)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), found)
+	found, err = suite.repo.FindDuplicates([]string{"9780743273565"}, nil)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), found, 1)
+}
+
+func (suite *BookRepositoryTestSuite) TestUpdate_KeepsMatchKey() {
+	// Arrange
+	book := Book{Title: "Old Title", Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+	suite.Require().NoError(suite.db.Create(&book).Error)
+	assert.Equal(suite.T(), matchkey.Book("Old Title", "Author"), book.MatchKey)
+
+	// Act
+	updated, err := suite.repo.Update(book.ID, map[string]interface{}{"title": "New Title"})
+
+	// Assert - 書名を変更すると重複検出の鍵も更新される
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), matchkey.Book("New Title", "Author"), updated.MatchKey)
+	found, err := suite.repo.FindDuplicates(nil, []string{matchkey.Book("new title", "author")})
+	suite.Require().NoError(err)
+	suite.Require().Len(found, 1)
+	assert.Equal(suite.T(), book.ID, found[0].ID)
+}
+
+// createBooks は書籍を作成して返す
+func (suite *BookRepositoryTestSuite) createBooks(n int) []Book {
+	books := make([]Book, n)
+	for i := range books {
+		books[i] = Book{Title: fmt.Sprintf("Book %d", i+1), Author: "Author", Genre: "Fiction", Purpose: "Entertainment", Description: "Description"}
+		suite.Require().NoError(suite.db.Create(&books[i]).Error)
+	}
+	return books
+}
+
+func (suite *BookRepositoryTestSuite) TestSetTags() {
+	// Arrange
+	books := suite.createBooks(3)
+	suite.Require().NoError(suite.repo.SetTags(books[0].ID, []string{"classic", "american"}))
+	suite.Require().NoError(suite.repo.SetTags(books[1].ID, []string{"sf"}))
+
+	// Act - タグは置き換えられる
+	err := suite.repo.SetTags(books[0].ID, []string{"novel", "classic"})
+
+	// Assert - タグのない本は結果に含まれない
+	suite.Require().NoError(err)
+	tags, err := suite.repo.FindTags([]uint{books[0].ID, books[1].ID, books[2].ID})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), map[uint][]string{
+		books[0].ID: {"classic", "novel"},
+		books[1].ID: {"sf"},
+	}, tags)
+
+	// 空にするとすべて外れる
+	suite.Require().NoError(suite.repo.SetTags(books[1].ID, nil))
+	tags, err = suite.repo.FindTags([]uint{books[1].ID})
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), tags)
+}
+
+func (suite *BookRepositoryTestSuite) TestSetTags_NotFound() {
+	err := suite.repo.SetTags(99999, []string{"classic"})
+
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+}
+
+func (suite *BookRepositoryTestSuite) TestRate() {
+	// Arrange
+	books := suite.createBooks(2)
+	suite.Require().NoError(suite.repo.Rate(books[0].ID, "alice", 5))
+	suite.Require().NoError(suite.repo.Rate(books[0].ID, "bob", 2))
+
+	// Act - 同じ評価者の評価は置き換えられる
+	err := suite.repo.Rate(books[0].ID, "bob", 4)
+
+	// Assert - 評価のない本は結果に含まれない
+	suite.Require().NoError(err)
+	summaries, err := suite.repo.SummarizeRatings([]uint{books[0].ID, books[1].ID})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), map[uint]RatingSummary{books[0].ID: {Count: 2, Average: 4.5}}, summaries)
+}
+
+func (suite *BookRepositoryTestSuite) TestRate_NotFound() {
+	err := suite.repo.Rate(99999, "alice", 5)
+
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+}
+
+func (suite *BookRepositoryTestSuite) TestRate_WithoutRater() {
+	// Arrange
+	books := suite.createBooks(1)
+
+	// Act - 評価者のいない評価は受け付けない
+	err := suite.repo.Rate(books[0].ID, "", 5)
+
+	// Assert
+	assert.ErrorIs(suite.T(), err, ErrValidation)
+	summaries, err := suite.repo.SummarizeRatings([]uint{books[0].ID})
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), summaries)
+}
+
+func (suite *BookRepositoryTestSuite) TestDelete_RemovesTagsAndRatings() {
+	// Arrange
+	books := suite.createBooks(1)
+	suite.Require().NoError(suite.repo.SetTags(books[0].ID, []string{"classic"}))
+	suite.Require().NoError(suite.repo.Rate(books[0].ID, "alice", 5))
+
+	// Act
+	_, err := suite.repo.Delete(books[0].ID)
+
+	// Assert
+	suite.Require().NoError(err)
+	var tags, ratings int64
+	suite.db.Model(&BookTag{}).Count(&tags)
+	suite.db.Model(&BookRating{}).Count(&ratings)
+	assert.Zero(suite.T(), tags)
+	assert.Zero(suite.T(), ratings)
+}
+
 func (suite *BookRepositoryTestSuite) TestRepository_WithSpecialCharacters() {
 	// Arrange - 特殊文字を含む本
 	book := &Book{
@@ -511,7 +1042,37 @@ func (suite *BookRepositoryTestSuite) TestRepository_WithEmptyStrings() {
 	assert.NotZero(suite.T(), book.ID)
 }
 
+// TestBookQueries_MySQL はMySQL向けのSQLを実行せずに生成して確かめる。MySQLの既定の
+// sql_modeでは文字列リテラル中のバックスラッシュがエスケープになるため使わない
+func TestBookQueries_MySQL(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "app@tcp(localhost)/books", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	var statements []string
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}))
+	repo := NewBookRepository(db)
+
+	_, err = repo.Find(BookFilter{Author: `100%_\!`})
+	require.NoError(t, err)
+	_, err = repo.Search(`50%_\!`)
+	require.NoError(t, err)
+
+	require.Len(t, statements, 2)
+	assert.Contains(t, statements[0], `LOWER(author) LIKE '%100!%!_\!!%' ESCAPE '!'`)
+	assert.Contains(t, statements[1], `LOWER(title) LIKE '%50!%!_\!!%' ESCAPE '!'`)
+	for _, statement := range statements {
+		assert.NotContains(t, statement, `ESCAPE '\'`)
+	}
+}
+
 // TestBookRepositoryTestSuite はリポジトリテストスイートを実行
 func TestBookRepositoryTestSuite(t *testing.T) {
 	suite.Run(t, new(BookRepositoryTestSuite))
+}
+
+// TestBookRepositoryTestSuite_Postgres は同じスイートをPostgreSQLに対して実行
+func TestBookRepositoryTestSuite_Postgres(t *testing.T) {
+	suite.Run(t, &BookRepositoryTestSuite{postgresURL: pgtest.URL(t)})
 } 
\ No newline at end of file
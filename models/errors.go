@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned when a write conflicts with the current state of the database
+	ErrConflict = errors.New("conflict")
+	// ErrValidation is returned when the database rejects a record as invalid
+	ErrValidation = errors.New("validation failed")
+
+	// ErrVersionMismatch is returned when a conditional write targets a stale book version
+	ErrVersionMismatch = fmt.Errorf("%w: book version mismatch", ErrConflict)
+	// ErrAPIKeyRevoked is returned when changing an API key that has been revoked
+	ErrAPIKeyRevoked = fmt.Errorf("%w: API key revoked", ErrConflict)
+)
+
+// translateError maps driver and GORM errors onto the repository error types so that
+// callers never have to know which database is behind the repository. Errors that do
+// not describe the data (connection failures, timeouts, ...) are returned unchanged.
+func translateError(db *gorm.DB, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrValidation) {
+		return err
+	}
+
+	translated := err
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		translated = translator.Translate(err)
+	}
+
+	switch {
+	case errors.Is(translated, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(translated, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	case errors.Is(translated, gorm.ErrForeignKeyViolated),
+		errors.Is(translated, gorm.ErrInvalidData),
+		errors.Is(translated, gorm.ErrInvalidField),
+		errors.Is(translated, gorm.ErrInvalidValue):
+		return fmt.Errorf("%w: %v", ErrValidation, err)
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func() Store { return NewMemoryStore() })
+}
+
+func TestMemoryStore_Concurrent(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 50, Period: time.Hour}
+	now := time.Now()
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := store.Take(context.Background(), "client", limit, now)
+			if err == nil && result.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 同時に呼ばれてもバーストを超えて許可しない
+	assert.Equal(t, int64(50), allowed.Load())
+}
+
+func TestMemoryStore_ForgetsRefilledBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 10, Period: 10 * time.Second}
+	start := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	_, err := store.Take(context.Background(), "once", limit, start)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = store.Take(context.Background(), "busy", limit, start.Add(50*time.Second))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, store.Len())
+
+	// 補充が終わったバケットだけを忘れる
+	_, err = store.Take(context.Background(), "busy", limit, start.Add(sweepInterval+time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+}
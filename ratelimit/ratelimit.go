@@ -0,0 +1,126 @@
+// Package ratelimit limits how often clients may call the API with token buckets. Every
+// client gets a bucket per limit, holding up to Limit.Requests tokens and refilled at
+// Limit.Requests per Limit.Period; each request takes a token.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is the rate a client may sustain, with bursts of up to Requests requests
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything; the zero Limit does not
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// String formats the limit like ParseLimit reads it
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// MarshalText formats the limit like String, so that configuration files can hold it
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText reads the limit like ParseLimit
+func (l *Limit) UnmarshalText(text []byte) error {
+	limit, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+// ParseLimit reads a limit written as "<requests>/<period>", such as "30/1m" or "5/s".
+// The period is a Go duration, whose leading 1 may be omitted. "off" and "0" disable
+// the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want <requests>/<period>, such as 30/1m", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive number", s)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	// Allowed reports whether a token was taken
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// ResetAfter is how long the bucket takes to fill up again
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next token, when the request was not allowed
+	RetryAfter time.Duration
+}
+
+// Store holds the token buckets. Take refills the bucket of key as of now and takes a
+// token from it if there is one. It must be atomic per key, so that a store shared by
+// several servers, such as one backed by Redis, enforces a single limit across them.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// bucket is the state of a token bucket as of updated
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills the bucket as of now and takes a token if there is one
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(capacity, b.tokens+float64(elapsed)/float64(perToken))
+		b.updated = now
+	}
+
+	result := Result{Allowed: b.tokens >= 1}
+	if result.Allowed {
+		b.tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = time.Duration((capacity - b.tokens) * float64(perToken))
+	return result
+}
+
+// full reports whether the bucket has refilled by now, which makes it
+// indistinguishable from a new one
+func (b *bucket) full(limit Limit, now time.Time) bool {
+	perToken := limit.Period / time.Duration(limit.Requests)
+	return b.updated.Add(time.Duration((float64(limit.Requests) - b.tokens) * float64(perToken))).Before(now)
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Limit
+	}{
+		{"30/1m", Limit{Requests: 30, Period: time.Minute}},
+		{"5/s", Limit{Requests: 5, Period: time.Second}},
+		{" 100/10s ", Limit{Requests: 100, Period: 10 * time.Second}},
+		{"1000/h", Limit{Requests: 1000, Period: time.Hour}},
+		{"off", Limit{}},
+		{"0", Limit{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLimit(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseLimit_Invalid(t *testing.T) {
+	for _, input := range []string{"", "30", "abc/1m", "-1/1m", "0/1m", "30/", "30/0s", "30/forever"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseLimit(input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLimit_String(t *testing.T) {
+	assert.Equal(t, "30/1m0s", Limit{Requests: 30, Period: time.Minute}.String())
+	assert.Equal(t, "off", Limit{}.String())
+
+	// String の出力は ParseLimit で読み戻せる
+	limit, err := ParseLimit(Limit{Requests: 30, Period: time.Minute}.String())
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 30, Period: time.Minute}, limit)
+}
+
+func TestLimit_Text(t *testing.T) {
+	var limit Limit
+	require.NoError(t, limit.UnmarshalText([]byte("5/s")))
+	assert.Equal(t, Limit{Requests: 5, Period: time.Second}, limit)
+	assert.Error(t, limit.UnmarshalText([]byte("5")))
+
+	text, err := limit.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "5/1s", string(text))
+}
+
+// testStore checks the behaviour every Store must have. Stores backed by an external
+// service can run it against a local fake of that service.
+func testStore(t *testing.T, newStore func() Store) {
+	ctx := context.Background()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	start := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	t.Run("バーストまで許可し、その後は拒否する", func(t *testing.T) {
+		store := newStore()
+		for i := 2; i >= 0; i-- {
+			result, err := store.Take(ctx, "client", limit, start)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed)
+			assert.Equal(t, i, result.Remaining)
+		}
+
+		result, err := store.Take(ctx, "client", limit, start)
+		require.NoError(t, err)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+		assert.Equal(t, time.Second, result.RetryAfter)
+		assert.Equal(t, 3*time.Second, result.ResetAfter)
+	})
+
+	t.Run("時間の経過でトークンが補充される", func(t *testing.T) {
+		store := newStore()
+		for i := 0; i < 3; i++ {
+			_, err := store.Take(ctx, "client", limit, start)
+			require.NoError(t, err)
+		}
+
+		result, err := store.Take(ctx, "client", limit, start.Add(1500*time.Millisecond))
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+
+		result, err = store.Take(ctx, "client", limit, start.Add(1600*time.Millisecond))
+		require.NoError(t, err)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 400*time.Millisecond, result.RetryAfter)
+
+		// 容量を超えては貯まらない
+		result, err = store.Take(ctx, "client", limit, start.Add(time.Hour))
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2, result.Remaining)
+	})
+
+	t.Run("キーごとに独立している", func(t *testing.T) {
+		store := newStore()
+		for i := 0; i < 3; i++ {
+			_, err := store.Take(ctx, "noisy", limit, start)
+			require.NoError(t, err)
+		}
+
+		result, err := store.Take(ctx, "quiet", limit, start)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2, result.Remaining)
+	})
+}
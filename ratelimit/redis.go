@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrConflict is returned by RedisClient.Update when the key changed between its read
+// and its write
+var ErrConflict = errors.New("key changed since it was read")
+
+// RedisClient is the part of a Redis client RedisStore uses
+type RedisClient interface {
+	// Update reads key and sets it to the value returned by update, expiring after ttl,
+	// as an optimistic transaction: WATCH key, GET key, then MULTI, SET key value PX ttl,
+	// EXEC. ok is false when the key does not exist. It returns ErrConflict when the key
+	// was written in between, and the error of update when it fails.
+	Update(ctx context.Context, key string, update func(value string, ok bool) (newValue string, ttl time.Duration, err error)) error
+}
+
+// RedisStore keeps the buckets in Redis, so that every server sharing it enforces a
+// single limit. A take that races with another on the same key is retried on the new
+// state of the bucket until ctx is done; each conflict means another take succeeded, so
+// the retries end. Buckets expire once refilled.
+type RedisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore creates a store keeping the bucket of each key in the Redis key of the
+// same name after prefix, such as "ratelimit:"
+func NewRedisStore(client RedisClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	key = s.prefix + key
+	for {
+		var result Result
+		err := s.client.Update(ctx, key, func(value string, ok bool) (string, time.Duration, error) {
+			b := bucket{tokens: float64(limit.Requests), updated: now}
+			if ok {
+				var err error
+				if b, err = parseRedisBucket(value); err != nil {
+					return "", 0, err
+				}
+			}
+			result = b.take(limit, now)
+			// The bucket expires once refilled, when it is the same as a new one
+			return formatRedisBucket(b), max(result.ResetAfter.Round(time.Millisecond), time.Millisecond), nil
+		})
+		if errors.Is(err, ErrConflict) && ctx.Err() == nil {
+			continue
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("bucket %s: %w", key, err)
+		}
+		return result, nil
+	}
+}
+
+// formatRedisBucket encodes b as "<tokens> <updated in Unix nanoseconds>"
+func formatRedisBucket(b bucket) string {
+	return strconv.FormatFloat(b.tokens, 'g', -1, 64) + " " + strconv.FormatInt(b.updated.UnixNano(), 10)
+}
+
+// parseRedisBucket decodes a bucket encoded by formatRedisBucket
+func parseRedisBucket(value string) (bucket, error) {
+	tokens, updated, ok := strings.Cut(value, " ")
+	if !ok {
+		return bucket{}, fmt.Errorf("invalid value %q", value)
+	}
+	t, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return bucket{}, fmt.Errorf("invalid value %q", value)
+	}
+	u, err := strconv.ParseInt(updated, 10, 64)
+	if err != nil {
+		return bucket{}, fmt.Errorf("invalid value %q", value)
+	}
+	return bucket{tokens: t, updated: time.Unix(0, u)}, nil
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis behaves like a Redis server running the optimistic transactions of
+// RedisClient: the write of an Update fails when another one wrote the key after its
+// read, as EXEC does when a WATCHed key changed. Keys do not expire; their TTL is
+// recorded instead.
+type fakeRedis struct {
+	mu        sync.Mutex
+	entries   map[string]fakeRedisEntry
+	conflicts atomic.Int64
+}
+
+// fakeRedisEntry is a key of fakeRedis with the number of times it was written
+type fakeRedisEntry struct {
+	value   string
+	ttl     time.Duration
+	version int
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{entries: make(map[string]fakeRedisEntry)}
+}
+
+func (r *fakeRedis) Update(_ context.Context, key string, update func(string, bool) (string, time.Duration, error)) error {
+	r.mu.Lock()
+	entry, ok := r.entries[key]
+	r.mu.Unlock()
+
+	value, ttl, err := update(entry.value, ok)
+	if err != nil {
+		return err
+	}
+	// Let concurrent transactions run between the read and the write
+	runtime.Gosched()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries[key].version != entry.version {
+		r.conflicts.Add(1)
+		return ErrConflict
+	}
+	r.entries[key] = fakeRedisEntry{value: value, ttl: ttl, version: entry.version + 1}
+	return nil
+}
+
+func TestRedisStore(t *testing.T) {
+	testStore(t, func() Store { return NewRedisStore(newFakeRedis(), "ratelimit:") })
+}
+
+func TestRedisStore_Concurrent(t *testing.T) {
+	redis := newFakeRedis()
+	store := NewRedisStore(redis, "ratelimit:")
+	limit := Limit{Requests: 50, Period: time.Hour}
+	now := time.Now()
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := store.Take(context.Background(), "client", limit, now)
+			if err == nil && result.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 競合した取得はやり直され、バーストを超えて許可しない
+	assert.Equal(t, int64(50), allowed.Load())
+}
+
+func TestRedisStore_Keys(t *testing.T) {
+	redis := newFakeRedis()
+	store := NewRedisStore(redis, "ratelimit:")
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	start := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+	_, err := store.Take(context.Background(), "default:ip:192.0.2.1", limit, start)
+	require.NoError(t, err)
+
+	// 接頭辞の付いたキーに、補充が終わるまでの有効期限で保存される
+	entry, ok := redis.entries["ratelimit:default:ip:192.0.2.1"]
+	require.True(t, ok)
+	assert.Equal(t, time.Second, entry.ttl)
+	assert.Equal(t, "2 "+strconv.FormatInt(start.UnixNano(), 10), entry.value)
+}
+
+func TestRedisStore_InvalidValue(t *testing.T) {
+	redis := newFakeRedis()
+	redis.entries["ratelimit:client"] = fakeRedisEntry{value: "not a bucket"}
+	store := NewRedisStore(redis, "ratelimit:")
+
+	_, err := store.Take(context.Background(), "client", Limit{Requests: 1, Period: time.Second}, time.Now())
+
+	assert.ErrorContains(t, err, `bucket ratelimit:client: invalid value "not a bucket"`)
+}
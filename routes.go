@@ -0,0 +1,72 @@
+package main
+
+import (
+	"time"
+
+	"recomemento-api-go/auth"
+	"recomemento-api-go/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// legacyDeprecatedSince is when the unversioned routes were deprecated in favour of /v1
+var legacyDeprecatedSince = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// registerAPIRoutes mounts every version of the API. Each version registers its own
+// handlers and DTOs on its group, so that a /v2 with a different representation can be
+// mounted next to /v1. The unversioned paths of the NestJS-era API stay available as
+// deprecated aliases of /v1 until legacySunset; a zero legacySunset leaves the sunset
+// unannounced. GraphQL is served at /graphql outside the versioning, since its schema
+// evolves by deprecating fields rather than by new versions.
+//
+// Every route requires the permission of its operation (see auth.Permission); GraphQL
+// checks mutations and recommendations per field. The administration endpoints only
+// exist under /v1.
+//
+// Every route is rate limited per IP address before authentication, then per client
+// after it, and recommendations additionally by their own, stricter limit.
+func registerAPIRoutes(r *gin.Engine, bookHandler *handlers.BookHandler, graphQLHandler *handlers.GraphQLHandler, apiKeyHandler *handlers.APIKeyHandler, authenticator *handlers.Authenticator, limiter *handlers.RateLimiter, legacySunset time.Time) {
+	v1 := r.Group("/v1", limiter.IP())
+	registerV1Routes(v1, bookHandler, authenticator, limiter)
+	registerAdminRoutes(v1.Group("/admin", authenticator.Require(auth.Administer), limiter.Default()), apiKeyHandler)
+	r.POST("/graphql", limiter.IP(), authenticator.Require(auth.ReadBooks), limiter.Default(), graphQLHandler.Serve)
+
+	legacy := r.Group("/", limiter.IP(), handlers.Deprecated(handlers.Deprecation{
+		Since:     legacyDeprecatedSince,
+		Sunset:    legacySunset,
+		Successor: "/v1",
+	}))
+	registerV1Routes(legacy, bookHandler, authenticator, limiter)
+}
+
+// registerV1Routes mounts the endpoints of API version 1 on group
+func registerV1Routes(group *gin.RouterGroup, bookHandler *handlers.BookHandler, authenticator *handlers.Authenticator, limiter *handlers.RateLimiter) {
+	read := authenticator.Require(auth.ReadBooks)
+	write := authenticator.Require(auth.WriteBooks)
+	recommend := authenticator.Require(auth.Recommend)
+	rate := authenticator.Require(auth.RateBooks)
+	limit := limiter.Default()
+
+	group.POST("/books", write, limit, bookHandler.CreateBook)
+	group.GET("/books", read, limit, bookHandler.GetAllBooks)
+	group.GET("/books/export", read, limit, bookHandler.ExportBooks)
+	group.GET("/books/:id", read, limit, bookHandler.GetBookByID)
+	group.PATCH("/books/:id", write, limit, bookHandler.UpdateBook)
+	group.PUT("/books/:id", write, limit, bookHandler.ReplaceBook)
+	group.DELETE("/books/:id", write, limit, bookHandler.DeleteBook)
+	group.PUT("/books/:id/tags", write, limit, bookHandler.SetBookTags)
+	group.PUT("/books/:id/rating", rate, limit, bookHandler.RateBook)
+	group.POST("/books/recommend", recommend, limit, limiter.Recommend(), bookHandler.RecommendBook)
+	group.POST("/books/bulk", write, limit, bookHandler.BulkBooks)
+	group.POST("/books/import", write, limit, bookHandler.ImportBooks)
+}
+
+// registerAdminRoutes mounts the administration endpoints on group, which must require
+// auth.Administer
+func registerAdminRoutes(group *gin.RouterGroup, apiKeyHandler *handlers.APIKeyHandler) {
+	group.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+	group.GET("/api-keys", apiKeyHandler.ListAPIKeys)
+	group.GET("/api-keys/:id", apiKeyHandler.GetAPIKey)
+	group.POST("/api-keys/:id/rotate", apiKeyHandler.RotateAPIKey)
+	group.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+}
@@ -0,0 +1,87 @@
+// Package pgtest provides PostgreSQL databases to tests
+package pgtest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// URL returns the URL of a PostgreSQL database for the test. TEST_POSTGRES_URL names an
+// existing database, whose tables the tests empty; otherwise a temporary server is
+// started with the initdb and pg_ctl found on PATH, and stopped when the test ends. The
+// test is skipped when neither is available.
+func URL(t testing.TB) string {
+	t.Helper()
+	if url := os.Getenv("TEST_POSTGRES_URL"); url != "" {
+		return url
+	}
+
+	initdb, pgCtl := findBinaries()
+	if initdb == "" || pgCtl == "" {
+		t.Skip("PostgreSQL is not installed: put initdb and pg_ctl on PATH or set TEST_POSTGRES_URL")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("PostgreSQL refuses to run as root: set TEST_POSTGRES_URL")
+	}
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	logFile := filepath.Join(dir, "postgres.log")
+	if output, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-locale", "--no-sync").CombinedOutput(); err != nil {
+		t.Fatalf("initdb: %v\n%s", err, output)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatalf("finding a free port: %v", err)
+	}
+	options := fmt.Sprintf("-p %d -c listen_addresses=127.0.0.1 -c unix_socket_directories='' -c fsync=off", port)
+	if output, err := exec.Command(pgCtl, "start", "-D", data, "-l", logFile, "-w", "-o", options).CombinedOutput(); err != nil {
+		log, _ := os.ReadFile(logFile)
+		t.Fatalf("pg_ctl start: %v\n%s\n%s", err, output, log)
+	}
+	t.Cleanup(func() {
+		if output, err := exec.Command(pgCtl, "stop", "-D", data, "-m", "immediate", "-w").CombinedOutput(); err != nil {
+			t.Errorf("pg_ctl stop: %v\n%s", err, output)
+		}
+	})
+
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+}
+
+// findBinaries looks up initdb and pg_ctl on PATH, then in the versioned directories of
+// the Debian packages, which are not on PATH
+func findBinaries() (initdb, pgCtl string) {
+	var err error
+	if initdb, err = exec.LookPath("initdb"); err == nil {
+		if pgCtl, err = exec.LookPath("pg_ctl"); err == nil {
+			return initdb, pgCtl
+		}
+	}
+
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	for _, dir := range dirs {
+		initdb, pgCtl = filepath.Join(dir, "initdb"), filepath.Join(dir, "pg_ctl")
+		if _, err := os.Stat(initdb); err != nil {
+			continue
+		}
+		if _, err := os.Stat(pgCtl); err == nil {
+			return initdb, pgCtl
+		}
+	}
+	return "", ""
+}
+
+// freePort returns a TCP port that is free on the loopback interface
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
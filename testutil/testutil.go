@@ -197,7 +197,7 @@ func NewTestDatabase(t *testing.T) *TestDatabase {
 	}
 
 	// マイグレーション実行
-	err = db.AutoMigrate(&models.Book{})
+	err = db.AutoMigrate(&models.Book{}, &models.BookTag{}, &models.BookRating{})
 	if err != nil {
 		t.Fatal("Failed to migrate test database:", err)
 	}
@@ -274,14 +274,14 @@ func AssertBookResponseEqual(t *testing.T, expected *models.Book, actual *dto.Bo
 	assert.Equal(t, expected.Description, actual.Description)
 }
 
-// AssertErrorResponse はエラーレスポンスを検証
-func AssertErrorResponse(t *testing.T, body []byte, expectedError, expectedMessage string) {
+// AssertErrorResponse はproblem+jsonエラーレスポンスのコードと詳細を検証
+func AssertErrorResponse(t *testing.T, body []byte, expectedCode, expectedDetail string) {
 	var errorResp dto.ErrorResponse
 	err := json.Unmarshal(body, &errorResp)
 	assert.NoError(t, err)
-	assert.Equal(t, expectedError, errorResp.Error)
-	if expectedMessage != "" {
-		assert.Equal(t, expectedMessage, errorResp.Message)
+	assert.Equal(t, expectedCode, errorResp.Code)
+	if expectedDetail != "" {
+		assert.Equal(t, expectedDetail, errorResp.Detail)
 	}
 }
 